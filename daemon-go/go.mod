@@ -3,13 +3,14 @@ module github.com/oho/knowledge-refinery-daemon
 go 1.25.7
 
 require (
+	github.com/dlclark/regexp2 v1.10.0
 	github.com/go-chi/chi/v5 v5.2.5
 	github.com/pkoukk/tiktoken-go v0.1.8
+	golang.org/x/text v0.30.0
 	modernc.org/sqlite v1.45.0
 )
 
 require (
-	github.com/dlclark/regexp2 v1.10.0 // indirect
 	github.com/dustin/go-humanize v1.0.1 // indirect
 	github.com/google/uuid v1.6.0 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
@@ -3,12 +3,19 @@ package api
 import (
 	"bytes"
 	"encoding/json"
+	"math"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/oho/knowledge-refinery-daemon/internal/config"
+	"github.com/oho/knowledge-refinery-daemon/internal/lmstudio"
+	"github.com/oho/knowledge-refinery-daemon/internal/pipeline"
 	"github.com/oho/knowledge-refinery-daemon/internal/storage"
 )
 
@@ -207,6 +214,96 @@ func TestEvidenceRouterGetChunk(t *testing.T) {
 	}
 }
 
+func TestEvidenceRouterChunkTimeAnchor(t *testing.T) {
+	db := setupTestDB(t)
+
+	asset := storage.NewFileAsset("asset1", "/tmp/talk.vtt", "talk.vtt")
+	db.UpsertFileAsset(asset)
+	start, end := 65.0, 100.5
+	anchor := storage.EvidenceAnchor{AssetID: "asset1", TimeStart: &start, TimeEnd: &end}
+	atom := storage.NewContentAtom("atom1", "asset1", storage.AtomText, 0, anchor.ToJSON())
+	db.InsertContentAtom(atom)
+	db.InsertChunk(storage.NewChunk("chunk1", "atom1", "asset1", "Welcome back", 2, 0, anchor.ToJSON(), "v1"))
+
+	r := chi.NewRouter()
+	r.Mount("/evidence", EvidenceRouter(db))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/evidence/chunk/chunk1", nil))
+
+	var resp struct {
+		EvidenceAnchor storage.EvidenceAnchor `json:"evidence_anchor"`
+		Location       string                 `json:"location"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.EvidenceAnchor.TimeStart == nil || *resp.EvidenceAnchor.TimeStart != 65 ||
+		resp.EvidenceAnchor.TimeEnd == nil || *resp.EvidenceAnchor.TimeEnd != 100.5 {
+		t.Errorf("unexpected anchor: %s", w.Body.String())
+	}
+	if resp.Location != "00:01:05.000-00:01:40.500" {
+		t.Errorf("location = %q", resp.Location)
+	}
+}
+
+func TestEvidenceRouterChunkSpanAnchor(t *testing.T) {
+	db := setupTestDB(t)
+
+	asset := storage.NewFileAsset("asset1", "/tmp/notes.md", "notes.md")
+	db.UpsertFileAsset(asset)
+	offset, length, lineStart, lineEnd := 120, 64, 7, 9
+	anchor := storage.EvidenceAnchor{AssetID: "asset1", Offset: &offset, Length: &length, LineStart: &lineStart, LineEnd: &lineEnd}
+	atom := storage.NewContentAtom("atom1", "asset1", storage.AtomText, 0, `{"asset_id":"asset1"}`)
+	db.InsertContentAtom(atom)
+	db.InsertChunk(storage.NewChunk("chunk1", "atom1", "asset1", "Second section", 2, 0, anchor.ToJSON(), "v1"))
+
+	r := chi.NewRouter()
+	r.Mount("/evidence", EvidenceRouter(db))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/evidence/chunk/chunk1", nil))
+
+	var resp struct {
+		EvidenceAnchor storage.EvidenceAnchor `json:"evidence_anchor"`
+		Location       string                 `json:"location"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	got := resp.EvidenceAnchor
+	if got.Offset == nil || *got.Offset != 120 || got.Length == nil || *got.Length != 64 ||
+		got.LineStart == nil || *got.LineStart != 7 || got.LineEnd == nil || *got.LineEnd != 9 {
+		t.Errorf("unexpected anchor: %s", w.Body.String())
+	}
+	if resp.Location != "lines 7-9" {
+		t.Errorf("location = %q", resp.Location)
+	}
+}
+
+func TestEvidenceRouterSuppressed(t *testing.T) {
+	db := setupTestDB(t)
+
+	r := chi.NewRouter()
+	r.Mount("/evidence", EvidenceRouter(db))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/evidence/asset1/suppressed", nil))
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != "[]" {
+		t.Fatalf("expected empty array, got %d %s", w.Code, w.Body.String())
+	}
+
+	db.InsertSuppressedText([]storage.SuppressedText{
+		{AtomID: "atom1", AssetID: "asset1", Start: 0, End: 24, Text: "ACME Corp — Confidential", Reason: "repeated_in_asset", Occurrences: 4},
+	})
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/evidence/asset1/suppressed", nil))
+	var resp []storage.SuppressedText
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp) != 1 || resp[0].Reason != "repeated_in_asset" || resp[0].End != 24 {
+		t.Errorf("unexpected response: %s", w.Body.String())
+	}
+}
+
 func TestEvidenceRouterAllAssets(t *testing.T) {
 	db := setupTestDB(t)
 
@@ -430,3 +527,669 @@ func TestEvidenceRouterAnnotation(t *testing.T) {
 
 // Ensure unused import doesn't cause build issues
 var _ = os.TempDir
+
+func TestSearchRouterReturnsParentHighlight(t *testing.T) {
+	db := setupTestDB(t)
+	lmSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"data": []map[string]any{{"embedding": []float64{1, 0}}}})
+	}))
+	defer lmSrv.Close()
+	vs, err := storage.NewVectorStore(db.DB(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	asset := storage.NewFileAsset("asset1", "/tmp/notes.txt", "notes.txt")
+	db.UpsertFileAsset(asset)
+	db.InsertContentAtom(storage.NewContentAtom("atom1", "asset1", storage.AtomText, 0, `{"asset_id":"asset1"}`))
+	section := "Intro to the plan. Café budget is tight. Next steps follow."
+	db.InsertParentChunks([]storage.ParentChunk{{
+		ID: "parent1", AtomID: "atom1", AssetID: "asset1", ChunkText: section, EvidenceAnchor: `{"asset_id":"asset1"}`,
+	}})
+	child := storage.NewChunk("chunk1", "atom1", "asset1", "Café budget is tight.", 5, 0, `{"asset_id":"asset1"}`, "v1")
+	parentID, start, end := "parent1", 19, 40
+	child.ParentID, child.ParentStart, child.ParentEnd = &parentID, &start, &end
+	db.InsertChunk(child)
+	vs.AddVectors([]storage.VectorRecord{{ID: "chunk1", Vector: []float32{1, 0}, Text: child.ChunkText, AssetID: "asset1", AtomType: "text"}})
+
+	r := chi.NewRouter()
+	r.Mount("/search", SearchRouter(lmstudio.NewClient(lmSrv.URL+"/v1", 5), vs, db))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/search/quick?q=budget", nil))
+
+	var items []searchResultItem
+	if err := json.Unmarshal(w.Body.Bytes(), &items); err != nil {
+		t.Fatalf("decode %s: %v", w.Body.String(), err)
+	}
+	if len(items) != 1 || items[0].Parent == nil {
+		t.Fatalf("expected one result with a parent, got %s", w.Body.String())
+	}
+	p := items[0].Parent
+	if p.Text != section || p.HighlightStart == nil || p.HighlightEnd == nil {
+		t.Fatalf("unexpected parent: %+v", p)
+	}
+	if got := string([]rune(p.Text)[*p.HighlightStart:*p.HighlightEnd]); got != child.ChunkText {
+		t.Errorf("highlighted span = %q, want %q", got, child.ChunkText)
+	}
+}
+
+func TestSearchRouterRecall(t *testing.T) {
+	db := setupTestDB(t)
+	vs, err := storage.NewVectorStore(db.DB(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vs.AddVectors([]storage.VectorRecord{
+		{ID: "c1", Vector: []float32{1, 0}, Text: "a", AssetID: "asset1", AtomType: "text"},
+		{ID: "c2", Vector: []float32{0, 1}, Text: "b", AssetID: "asset1", AtomType: "text"},
+	})
+
+	r := chi.NewRouter()
+	r.Mount("/search", SearchRouter(lmstudio.NewClient("http://127.0.0.1:1/v1", 1), vs, db))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/search/recall?samples=2&k=1&ef=8", nil))
+
+	var report storage.RecallReport
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatalf("decode %s: %v", w.Body.String(), err)
+	}
+	if report.Vectors != 2 || report.Samples != 2 || report.Ef != 8 || report.Recall != 1 || report.UsingIndex {
+		t.Errorf("unexpected report: %s", w.Body.String())
+	}
+
+	// Oversized requests are capped rather than run
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/search/recall?samples=100000000&k=1000000000", nil))
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatalf("decode %s: %v", w.Body.String(), err)
+	}
+	if report.K != maxRecallK || report.Samples != 2 {
+		t.Errorf("expected k capped at %d, got %s", maxRecallK, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/search/recall?k=zero", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for bad k, got %d", w.Code)
+	}
+}
+
+func TestIngestRouterReembed(t *testing.T) {
+	db := setupTestDB(t)
+	lmSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Model string   `json:"model"`
+			Input []string `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		data := make([]map[string]any, len(req.Input))
+		for i, text := range req.Input {
+			data[i] = map[string]any{"embedding": []float64{float64(len(text)), 1, 0}}
+		}
+		json.NewEncoder(w).Encode(map[string]any{"data": data})
+	}))
+	defer lmSrv.Close()
+	vs, err := storage.NewVectorStore(db.DB(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vs.AddVectors([]storage.VectorRecord{
+		{ID: "chunk1", Vector: []float32{1, 0}, Text: "short", AssetID: "asset1", AtomType: "text"},
+		{ID: "chunk2", Vector: []float32{0, 1}, Text: "a longer text", AssetID: "asset1", AtomType: "text"},
+	})
+
+	cfg := config.DefaultConfig()
+	cfg.Pipeline.ExtractCacheMaxBytes = 0
+	orch := pipeline.NewOrchestrator(db, vs, lmstudio.NewClient(lmSrv.URL+"/v1", 5), cfg)
+	r := chi.NewRouter()
+	r.Mount("/ingest", IngestRouter(orch))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/ingest/reembed", strings.NewReader(`{"model":"new-embed"}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	for deadline := time.Now().Add(5 * time.Second); vs.Model() != "new-embed"; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("re-embed did not switch namespaces: %v", orch.GetStatus()["reembed_job"])
+		}
+	}
+	if vs.Dimension() != 3 || vs.Count() != 2 {
+		t.Errorf("expected 2 vectors of 3 dims, got %d of %d", vs.Count(), vs.Dimension())
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/ingest/namespaces", nil))
+	var namespaces []storage.Namespace
+	if err := json.Unmarshal(w.Body.Bytes(), &namespaces); err != nil {
+		t.Fatalf("decode %s: %v", w.Body.String(), err)
+	}
+	if len(namespaces) != 1 || namespaces[0].Model != "new-embed" || namespaces[0].Vectors != 2 ||
+		namespaces[0].Status != storage.NamespaceActive {
+		t.Errorf("unexpected namespaces %s", w.Body.String())
+	}
+
+	// Switching to the active model again is refused
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/ingest/reembed", strings.NewReader(`{"model":"new-embed"}`)))
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected 409, got %d", w.Code)
+	}
+}
+
+func TestSearchRouterModes(t *testing.T) {
+	db := setupTestDB(t)
+	lmSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"data": []map[string]any{{"embedding": []float64{1, 0}}}})
+	}))
+	defer lmSrv.Close()
+	vs, err := storage.NewVectorStore(db.DB(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db.UpsertFileAsset(storage.NewFileAsset("asset1", "/tmp/manual.txt", "manual.txt"))
+	db.InsertContentAtom(storage.NewContentAtom("atom1", "asset1", storage.AtomText, 0, `{"asset_id":"asset1"}`))
+	texts := map[string]string{
+		"near":  "How to keep the pump running smoothly.",
+		"code":  "The controller shows error E-4012 when the valve sticks.",
+		"other": "Notes on the quarterly budget.",
+	}
+	vectors := map[string][]float32{"near": {1, 0}, "code": {0.6, 0.8}, "other": {0, 1}}
+	for i, id := range []string{"near", "code", "other"} {
+		db.InsertChunk(storage.NewChunk(id, "atom1", "asset1", texts[id], 8, i, `{"asset_id":"asset1"}`, "v1"))
+		vs.AddVectors([]storage.VectorRecord{{ID: id, Vector: vectors[id], Text: texts[id], AssetID: "asset1", AtomType: "text"}})
+	}
+
+	r := chi.NewRouter()
+	r.Mount("/search", SearchRouter(lmstudio.NewClient(lmSrv.URL+"/v1", 5), vs, db))
+	search := func(body string) []searchResultItem {
+		t.Helper()
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("POST", "/search", strings.NewReader(body)))
+		var items []searchResultItem
+		if err := json.Unmarshal(w.Body.Bytes(), &items); err != nil {
+			t.Fatalf("decode %s: %v", w.Body.String(), err)
+		}
+		return items
+	}
+
+	items := search(`{"query": "E-4012", "mode": "vector", "limit": 2}`)
+	if len(items) != 2 || items[0].ChunkID != "near" || items[0].Scores.Vector == nil || items[0].Scores.Keyword != nil {
+		t.Errorf("vector mode should rank by similarity alone, got %+v", items)
+	}
+
+	items = search(`{"query": "E-4012", "mode": "keyword"}`)
+	if len(items) != 1 || items[0].ChunkID != "code" || items[0].Scores.Keyword == nil || items[0].Score != *items[0].Scores.Keyword {
+		t.Errorf("keyword mode should find the error code, got %+v", items)
+	}
+
+	// Hybrid: the keyword match is ranked second by similarity and first by
+	// BM25, so fusion puts it on top
+	items = search(`{"query": "E-4012", "mode": "hybrid", "limit": 3}`)
+	if len(items) != 3 || items[0].ChunkID != "code" {
+		t.Fatalf("expected the keyword match first, got %+v", items)
+	}
+	top := items[0].Scores
+	if top.Vector == nil || *top.VectorRank != 2 || top.Keyword == nil || *top.KeywordRank != 1 || top.Fused == nil {
+		t.Errorf("expected both signals' scores, got %+v", top)
+	}
+	if want := 1.0/(rrfK+2) + 1.0/(rrfK+1); math.Abs(*top.Fused-want) > 1e-12 || items[0].Score != *top.Fused {
+		t.Errorf("fused score = %v, want %v", *top.Fused, want)
+	}
+	if items[1].ChunkID != "near" || items[1].Scores.Keyword != nil {
+		t.Errorf("expected the vector-only match second, got %+v", items[1])
+	}
+
+	// Without a mode, search stays vector-only for existing clients
+	items = search(`{"query": "E-4012", "limit": 2}`)
+	if len(items) != 2 || items[0].ChunkID != "near" || items[0].Scores.Fused != nil || items[0].Score != *items[0].Scores.Vector {
+		t.Errorf("expected vector ranking and cosine distance by default, got %+v", items)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/search/quick?q=pump&mode=fuzzy", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown mode, got %d", w.Code)
+	}
+}
+
+func TestSearchRouterFilters(t *testing.T) {
+	db := setupTestDB(t)
+	vs, err := storage.NewVectorStore(db.DB(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, f := range []struct{ id, path, mime string }{
+		{"pdf", "/docs/2023/budget.pdf", "application/pdf"},
+		{"img", "/docs/2023/budget.png", "image/png"},
+		{"txt", "/other/budget.txt", "text/plain"},
+	} {
+		asset := storage.NewFileAsset(f.id, f.path, f.path[strings.LastIndex(f.path, "/")+1:])
+		asset.MimeType = &f.mime
+		db.UpsertFileAsset(asset)
+		db.InsertContentAtom(storage.NewContentAtom(f.id+"-atom", f.id, storage.AtomText, 0, `{}`))
+		db.InsertChunk(storage.NewChunk(f.id+"-1", f.id+"-atom", f.id, "budget numbers", 2, i, `{}`, "v1"))
+	}
+
+	r := chi.NewRouter()
+	r.Mount("/search", SearchRouter(lmstudio.NewClient("http://127.0.0.1:1/v1", 1), vs, db))
+	search := func(body string) (int, []searchResultItem) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("POST", "/search", strings.NewReader(body)))
+		var items []searchResultItem
+		json.Unmarshal(w.Body.Bytes(), &items)
+		return w.Code, items
+	}
+
+	if _, items := search(`{"query": "budget", "mode": "keyword", "limit": 1, "filter_asset_type": "image"}`); len(items) != 1 || items[0].ChunkID != "img-1" {
+		t.Errorf("expected filter_asset_type to select the image, got %+v", items)
+	}
+	_, items := search(`{"query": "budget", "mode": "keyword", "filters": {"path_prefix": "/docs/", "extensions": ["pdf", "txt"]}}`)
+	if len(items) != 1 || items[0].ChunkID != "pdf-1" {
+		t.Errorf("expected only the PDF under /docs, got %+v", items)
+	}
+	if _, items := search(`{"query": "budget", "mode": "keyword", "filters": {"sentiment": "positive"}}`); items == nil || len(items) != 0 {
+		t.Errorf("expected an empty array for a filter matching nothing, got %+v", items)
+	}
+	if code, _ := search(`{"query": "budget", "filters": {"modified_after": "last week"}}`); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a bad date, got %d", code)
+	}
+}
+
+func TestSearchRouterQueryTemplateAndCache(t *testing.T) {
+	db := setupTestDB(t)
+	var inputs []string
+	lmSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Model string   `json:"model"`
+			Input []string `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		inputs = append(inputs, req.Model+": "+strings.Join(req.Input, "|"))
+		json.NewEncoder(w).Encode(map[string]any{"data": []map[string]any{{"embedding": []float64{1, 0}}}})
+	}))
+	defer lmSrv.Close()
+	lm := lmstudio.NewClient(lmSrv.URL+"/v1", 5)
+	vs, err := storage.NewVectorStore(db.DB(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ns := lm.EmbeddingNamespace("nomic-embed-text-v1.5")
+	if active, err := vs.Adopt(ns, 2); err != nil || !active {
+		t.Fatalf("Adopt: %v, %v", active, err)
+	}
+	vs.AddVectors([]storage.VectorRecord{{ID: "c1", Vector: []float32{1, 0}, Text: "a", AssetID: "asset1", AtomType: "text", Model: ns}})
+
+	r := chi.NewRouter()
+	r.Mount("/search", SearchRouter(lm, vs, db))
+	for range 3 {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/search/quick?q=budget&mode=vector", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+	}
+	if len(inputs) != 1 || inputs[0] != "nomic-embed-text-v1.5: search_query: budget" {
+		t.Errorf("expected one templated query embedding, got %q", inputs)
+	}
+}
+
+func TestSearchRouterRerank(t *testing.T) {
+	db := setupTestDB(t)
+	lmSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/rerank" {
+			json.NewEncoder(w).Encode(map[string]any{"data": []map[string]any{{"embedding": []float64{1, 0}}}})
+			return
+		}
+		var req struct {
+			Query     string   `json:"query"`
+			Documents []string `json:"documents"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Query == "broken" {
+			http.Error(w, "model not loaded", http.StatusServiceUnavailable)
+			return
+		}
+		var results []map[string]any
+		for i, doc := range req.Documents {
+			results = append(results, map[string]any{"index": i, "relevance_score": float64(strings.Count(doc, "pump"))})
+		}
+		json.NewEncoder(w).Encode(map[string]any{"results": results})
+	}))
+	defer lmSrv.Close()
+	vs, err := storage.NewVectorStore(db.DB(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vs.AddVectors([]storage.VectorRecord{
+		{ID: "near", Vector: []float32{1, 0}, Text: "Budget notes.", AssetID: "asset1", AtomType: "text"},
+		{ID: "pump", Vector: []float32{0.6, 0.8}, Text: "Pump manual: prime the pump first.", AssetID: "asset1", AtomType: "text"},
+		{ID: "far", Vector: []float32{0, 1}, Text: "Holiday photos.", AssetID: "asset1", AtomType: "text"},
+	})
+
+	r := chi.NewRouter()
+	r.Mount("/search", SearchRouter(lmstudio.NewClient(lmSrv.URL+"/v1", 5), vs, db))
+	search := func(body string) ([]searchResultItem, string) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("POST", "/search", strings.NewReader(body)))
+		var items []searchResultItem
+		if err := json.Unmarshal(w.Body.Bytes(), &items); err != nil {
+			t.Fatalf("decode %s: %v", w.Body.String(), err)
+		}
+		return items, w.Header().Get("Server-Timing")
+	}
+
+	items, timing := search(`{"query": "pump", "mode": "vector", "limit": 1, "rerank": "cross-encoder"}`)
+	if len(items) != 1 || items[0].ChunkID != "pump" || items[0].Scores.Rerank == nil || items[0].Score != 1 {
+		t.Errorf("expected the reranker to promote the pump chunk, got %+v", items)
+	}
+	if items[0].Scores.VectorRank == nil || *items[0].Scores.VectorRank != 2 {
+		t.Errorf("expected the first-stage rank kept, got %+v", items[0].Scores)
+	}
+	if !strings.Contains(timing, `rerank;dur=`) || !strings.Contains(timing, `desc="cross-encoder"`) ||
+		!strings.Contains(timing, "embed;dur=") || !strings.Contains(timing, "total;dur=") {
+		t.Errorf("unexpected Server-Timing %q", timing)
+	}
+
+	// A failing reranker leaves the first-stage order
+	items, timing = search(`{"query": "broken", "mode": "vector", "limit": 2, "rerank": "cross-encoder"}`)
+	if len(items) != 2 || items[0].ChunkID != "near" || items[0].Scores.Rerank != nil {
+		t.Errorf("expected unreranked results, got %+v", items)
+	}
+	if !strings.Contains(timing, `desc="cross-encoder failed"`) {
+		t.Errorf("expected the failure in Server-Timing, got %q", timing)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/search/quick?q=pump&rerank=magic", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown reranker, got %d", w.Code)
+	}
+}
+
+func TestSearchRouterDiversity(t *testing.T) {
+	db := setupTestDB(t)
+	lmSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"data": []map[string]any{{"embedding": []float64{1, 0}}}})
+	}))
+	defer lmSrv.Close()
+	vs, err := storage.NewVectorStore(db.DB(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Three overlapping neighbours in the manual, one chunk in the memo
+	db.UpsertFileAsset(storage.NewFileAsset("manual", "/docs/manual.txt", "manual.txt"))
+	db.UpsertFileAsset(storage.NewFileAsset("memo", "/docs/memo.txt", "memo.txt"))
+	db.InsertContentAtom(storage.NewContentAtom("manual-atom", "manual", storage.AtomText, 0, `{"asset_id":"manual"}`))
+	db.InsertContentAtom(storage.NewContentAtom("memo-atom", "memo", storage.AtomText, 0, `{"asset_id":"memo"}`))
+	chunks := []struct {
+		id, atom, asset, text, anchor string
+		index                         int
+		vector                        []float32
+	}{
+		{"m0", "manual-atom", "manual", "Prime the pump. Open the valve.", `{"asset_id":"manual","offset":0,"length":31}`, 0, []float32{1, 0.02}},
+		{"m1", "manual-atom", "manual", "Open the valve. Start the motor.", `{"asset_id":"manual","offset":16,"length":32}`, 1, []float32{1, 0}},
+		{"m2", "manual-atom", "manual", "Start the motor. Check the gauge.", `{"asset_id":"manual","offset":32,"length":33}`, 2, []float32{1, 0.01}},
+		{"n0", "memo-atom", "memo", "Pump order placed.", `{"asset_id":"memo"}`, 0, []float32{1, 1}},
+	}
+	for _, c := range chunks {
+		db.InsertChunk(storage.NewChunk(c.id, c.atom, c.asset, c.text, 8, c.index, c.anchor, "v1"))
+		vs.AddVectors([]storage.VectorRecord{{ID: c.id, Vector: c.vector, Text: c.text, AssetID: c.asset, AtomType: "text"}})
+	}
+
+	r := chi.NewRouter()
+	r.Mount("/search", SearchRouter(lmstudio.NewClient(lmSrv.URL+"/v1", 5), vs, db))
+	search := func(body string) []searchResultItem {
+		t.Helper()
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("POST", "/search", strings.NewReader(body)))
+		var items []searchResultItem
+		if err := json.Unmarshal(w.Body.Bytes(), &items); err != nil {
+			t.Fatalf("decode %s: %v", w.Body.String(), err)
+		}
+		return items
+	}
+	ids := func(items []searchResultItem) []string {
+		var out []string
+		for _, it := range items {
+			out = append(out, it.ChunkID)
+		}
+		return out
+	}
+
+	if items := search(`{"query": "pump", "mode": "vector", "limit": 3}`); !slices.Equal(ids(items), []string{"m1", "m2", "m0"}) {
+		t.Fatalf("expected the neighbours to crowd the results, got %v", ids(items))
+	}
+
+	items := search(`{"query": "pump", "mode": "vector", "limit": 3, "collapse": true}`)
+	if !slices.Equal(ids(items), []string{"m1", "n0"}) {
+		t.Fatalf("expected the neighbours collapsed, got %v", ids(items))
+	}
+	merged := items[0]
+	if merged.Text != "Prime the pump. Open the valve. Start the motor. Check the gauge." {
+		t.Errorf("merged text = %q", merged.Text)
+	}
+	if !slices.Equal(merged.MergedChunkIDs, []string{"m0", "m1", "m2"}) {
+		t.Errorf("merged chunks = %v", merged.MergedChunkIDs)
+	}
+	if anchor, _ := storage.ParseEvidenceAnchor(merged.EvidenceAnchor); anchor.Offset == nil || *anchor.Offset != 0 || *anchor.Length != 65 {
+		t.Errorf("expected the anchor to span all three chunks, got %s", merged.EvidenceAnchor)
+	}
+
+	items = search(`{"query": "pump", "mode": "vector", "group_by": "asset", "collapse": false}`)
+	if !slices.Equal(ids(items), []string{"m1", "n0"}) || items[0].AssetHits != 3 || items[1].AssetHits != 1 {
+		t.Errorf("expected one result per asset with hit counts, got %+v", items)
+	}
+
+	items = search(`{"query": "pump", "mode": "vector", "limit": 2, "diversify": true, "mmr_lambda": 0.3, "collapse": false}`)
+	if !slices.Equal(ids(items), []string{"m1", "n0"}) {
+		t.Errorf("expected MMR to pick the memo over a near-duplicate, got %v", ids(items))
+	}
+	items = search(`{"query": "pump", "mode": "vector", "limit": 2, "diversify": true, "mmr_lambda": 1, "collapse": false}`)
+	if !slices.Equal(ids(items), []string{"m1", "m2"}) {
+		t.Errorf("expected lambda 1 to rank by relevance alone, got %v", ids(items))
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/search/quick?q=pump&group_by=folder", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown grouping, got %d", w.Code)
+	}
+}
+
+func TestJoinOverlapping(t *testing.T) {
+	tests := []struct{ a, b, want string }{
+		{"Open the valve. Start the motor.", "Start the motor. Check the gauge.", "Open the valve. Start the motor. Check the gauge."},
+		{"No overlap here.", "Next part.", "No overlap here. Next part."},
+		{"ends in art", "artistic start", "ends in art artistic start"}, // not a whole-word overlap
+		{"same text", "same text", "same text"},
+	}
+	for _, tt := range tests {
+		if got := joinOverlapping(tt.a, tt.b); got != tt.want {
+			t.Errorf("joinOverlapping(%q, %q) = %q, want %q", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestKeywordSnippets(t *testing.T) {
+	text := "The pump is rated for continuous duty in dry and dusty rooms. " +
+		"Error E-4012 means the valve is stuck, so close the café supply line first. " +
+		"Clean the valve seat with a soft brush before you restart the unit."
+	snippets := keywordSnippets(text, "en", queryPhrases("cafe valve E-4012"), 2)
+	if len(snippets) != 2 {
+		t.Fatalf("expected two snippets, got %+v", snippets)
+	}
+	best := snippets[0]
+	if !strings.HasPrefix(best.Text, "Error E-4012") || best.Score != 3 || best.Source != snippetKeyword {
+		t.Fatalf("expected the sentence with all three terms first, got %+v", best)
+	}
+	if got := string([]rune(text)[best.Start:best.End]); got != best.Text {
+		t.Errorf("snippet offsets select %q", got)
+	}
+	var marked []string
+	for _, h := range best.Highlights {
+		marked = append(marked, string([]rune(best.Text)[h.Start:h.End]))
+	}
+	if !slices.Equal(marked, []string{"E-4012", "valve", "café"}) {
+		t.Errorf("highlighted %q", marked)
+	}
+	if snippets[1].Score != 1 || !strings.HasPrefix(snippets[1].Text, "Clean the valve") {
+		t.Errorf("expected the valve sentence second, got %+v", snippets[1])
+	}
+
+	if got := keywordSnippets(text, "en", queryPhrases("turbine"), 2); got != nil {
+		t.Errorf("expected no snippets without a match, got %+v", got)
+	}
+
+	// Long sentences are clipped around the first match at word boundaries
+	long := strings.Repeat("filler words go here ", 30) + "the valve " + strings.Repeat("and more words ", 30)
+	clipped := keywordSnippets(long, "en", queryPhrases("valve"), 1)
+	if len(clipped) != 1 || len([]rune(clipped[0].Text)) > snippetMaxChars || !strings.Contains(clipped[0].Text, "valve") ||
+		strings.HasPrefix(clipped[0].Text, " ") || len(clipped[0].Highlights) != 1 {
+		t.Errorf("unexpected clipped snippet %+v", clipped)
+	}
+}
+
+func TestSearchRouterSnippets(t *testing.T) {
+	db := setupTestDB(t)
+	lmSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/models" {
+			json.NewEncoder(w).Encode(map[string]any{"data": []map[string]any{{"id": "test-embed"}}})
+			return
+		}
+		var req struct {
+			Input []string `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		// Texts about motors and engines point one way, the rest another
+		data := make([]map[string]any, len(req.Input))
+		for i, text := range req.Input {
+			vec := []float64{0, 1}
+			if strings.Contains(text, "motor") || strings.Contains(text, "engine") {
+				vec = []float64{1, 0.1}
+			}
+			data[i] = map[string]any{"embedding": vec}
+		}
+		json.NewEncoder(w).Encode(map[string]any{"data": data})
+	}))
+	defer lmSrv.Close()
+	vs, err := storage.NewVectorStore(db.DB(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text := "Prime the pump and open the intake valve all the way before anything else. " +
+		"Then start the motor and let it run for a minute without any load attached. " +
+		"Finally check the pressure gauge and note the reading in the maintenance log."
+	db.UpsertFileAsset(storage.NewFileAsset("manual", "/docs/manual.txt", "manual.txt"))
+	db.InsertContentAtom(storage.NewContentAtom("atom1", "manual", storage.AtomText, 0, `{"asset_id":"manual"}`))
+	db.InsertChunk(storage.NewChunk("c1", "atom1", "manual", text, 40, 0, `{"asset_id":"manual"}`, "v1"))
+	vs.AddVectors([]storage.VectorRecord{{ID: "c1", Vector: []float32{1, 0}, Text: text, AssetID: "manual", AtomType: "text"}})
+
+	r := chi.NewRouter()
+	r.Mount("/search", SearchRouter(lmstudio.NewClient(lmSrv.URL+"/v1", 5), vs, db))
+	search := func(body string) []searchResultItem {
+		t.Helper()
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("POST", "/search", strings.NewReader(body)))
+		var items []searchResultItem
+		if err := json.Unmarshal(w.Body.Bytes(), &items); err != nil {
+			t.Fatalf("decode %s: %v", w.Body.String(), err)
+		}
+		return items
+	}
+
+	items := search(`{"query": "engine warm-up", "mode": "vector", "snippets": 1}`)
+	if len(items) != 1 || len(items[0].Snippets) != 1 {
+		t.Fatalf("expected one snippet, got %+v", items)
+	}
+	if sn := items[0].Snippets[0]; !strings.HasPrefix(sn.Text, "Then start the motor") || sn.Source != snippetSemantic || sn.Score < 0.99 {
+		t.Errorf("expected the sentence nearest the query, got %+v", sn)
+	}
+
+	items = search(`{"query": "pressure gauge", "mode": "keyword", "snippets": 2}`)
+	if len(items) != 1 || len(items[0].Snippets) != 1 {
+		t.Fatalf("expected one keyword snippet, got %+v", items)
+	}
+	if sn := items[0].Snippets[0]; !strings.HasPrefix(sn.Text, "Finally") || sn.Source != snippetKeyword || len(sn.Highlights) != 2 {
+		t.Errorf("expected the gauge sentence with both terms marked, got %+v", sn)
+	}
+
+	if items := search(`{"query": "pressure gauge", "mode": "keyword"}`); len(items) != 1 || items[0].Snippets != nil {
+		t.Errorf("expected no snippets unless asked, got %+v", items)
+	}
+}
+
+func TestSearchRouterSimilar(t *testing.T) {
+	db := setupTestDB(t)
+	vs, err := storage.NewVectorStore(db.DB(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vectors := map[string][]float32{"a1": {1, 0}, "a2": {0.9, 0.1}, "b1": {0.8, 0.2}, "c1": {0, 1}}
+	for _, asset := range []struct{ id, path string }{{"A", "/docs/a.txt"}, {"B", "/docs/b.pdf"}, {"C", "/docs/c.txt"}} {
+		db.UpsertFileAsset(storage.NewFileAsset(asset.id, asset.path, strings.TrimPrefix(asset.path, "/docs/")))
+		db.InsertContentAtom(storage.NewContentAtom("atom"+asset.id, asset.id, storage.AtomText, 0, `{}`))
+	}
+	for _, id := range []string{"a1", "a2", "b1", "c1"} {
+		asset := strings.ToUpper(id[:1])
+		db.InsertChunk(storage.NewChunk(id, "atom"+asset, asset, "chunk "+id, 2, int(id[1]-'1'), `{}`, "v1"))
+		vs.AddVectors([]storage.VectorRecord{{ID: id, Vector: vectors[id], Text: "chunk " + id, AssetID: asset, AtomType: "text"}})
+	}
+	db.InsertConceptNode(storage.ConceptNode{ID: "k1", Level: 0, CreatedAt: storage.NowISO()})
+	db.InsertGraphEdge(storage.GraphEdge{ID: "e1", SourceID: "k1", TargetID: "c1", EdgeType: "concept_member", Weight: 1, CreatedAt: storage.NowISO()})
+
+	// No LM Studio: neighbours come from stored vectors alone
+	r := chi.NewRouter()
+	r.Mount("/search", SearchRouter(lmstudio.NewClient("http://127.0.0.1:1/v1", 1), vs, db))
+	similar := func(params string) []string {
+		t.Helper()
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/search/similar?"+params, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", params, w.Code, w.Body.String())
+		}
+		var items []searchResultItem
+		json.Unmarshal(w.Body.Bytes(), &items)
+		ids := []string{}
+		for _, item := range items {
+			ids = append(ids, item.ChunkID)
+		}
+		return ids
+	}
+
+	for params, want := range map[string][]string{
+		"chunk_id=a1":                                               {"a2", "b1", "c1"},
+		"chunk_id=a1&exclude_source=true":                           {"b1", "c1"},
+		"chunk_id=a1&limit=1":                                       {"a2"},
+		"chunk_id=a1&extensions=pdf,docx":                           {"b1"},
+		"asset_id=A&exclude_source=true":                            {"b1", "c1"},
+		"asset_id=B":                                                {"b1", "a2", "a1", "c1"},
+		"concept_id=k1":                                             {"c1", "b1", "a2", "a1"},
+		"concept_id=k1&exclude_source=true&limit=2":                 {"b1", "a2"},
+		"chunk_id=a1&path_prefix=/elsewhere/":                       {},
+		"asset_id=C&exclude_source=1&extensions=txt&extensions=pdf": {"b1", "a2", "a1"},
+	} {
+		if got := similar(params); !slices.Equal(got, want) {
+			t.Errorf("%s: got %v, want %v", params, got, want)
+		}
+	}
+
+	for params, code := range map[string]int{
+		"":                                http.StatusBadRequest,
+		"chunk_id=a1&asset_id=A":          http.StatusBadRequest,
+		"chunk_id=missing":                http.StatusNotFound,
+		"concept_id=missing":              http.StatusNotFound,
+		"chunk_id=a1&modified_after=soon": http.StatusBadRequest,
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/search/similar?"+params, nil))
+		if w.Code != code {
+			t.Errorf("%q: expected %d, got %d", params, code, w.Code)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package api
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/oho/knowledge-refinery-daemon/internal/storage"
+)
+
+// groupAsset groups results by their source file.
+const groupAsset = "asset"
+
+// defaultMMRLambda weighs relevance against novelty in maximal marginal
+// relevance: 1 ranks by relevance alone, 0 by novelty alone.
+const defaultMMRLambda = 0.7
+
+// diversityCandidates is how many first-stage results diversification,
+// grouping and collapsing choose from for a given limit.
+func diversityCandidates(limit int) int {
+	return max(5*limit, 50)
+}
+
+// collapseAdjacent merges hits on neighbouring chunks of one atom, which
+// overlap by ChunkOverlapTokens, into the best-ranked of them. The merged
+// hit's text and anchor span all its chunks.
+func collapseAdjacent(db *storage.Database, hits []searchHit) []searchHit {
+	var kept []*searchHit
+	for i := range hits {
+		h := &hits[i]
+		chunk, _ := db.GetChunk(h.rec.ID)
+		if chunk == nil {
+			kept = append(kept, h)
+			continue
+		}
+		h.span = []*storage.Chunk{chunk}
+
+		// Join the first kept span this chunk extends, then absorb any
+		// kept span it now bridges to
+		var into *searchHit
+		for _, k := range kept {
+			if into == nil && adjacent(k.span, chunk) {
+				into = k
+				k.addToSpan(chunk)
+			}
+		}
+		if into == nil {
+			kept = append(kept, h)
+			continue
+		}
+		h.span = nil
+		for j := 0; j < len(kept); j++ {
+			k := kept[j]
+			if k == into || len(k.span) == 0 {
+				continue
+			}
+			if first, last := k.span[0], k.span[len(k.span)-1]; adjacent(into.span, first) || adjacent(into.span, last) {
+				for _, c := range k.span {
+					into.addToSpan(c)
+				}
+				kept = slices.Delete(kept, j, j+1)
+				j--
+			}
+		}
+	}
+
+	out := make([]searchHit, len(kept))
+	for i, k := range kept {
+		if len(k.span) > 1 {
+			k.rec.Text, k.rec.EvidenceAnchor = mergeSpan(k.span)
+		}
+		out[i] = *k
+	}
+	return out
+}
+
+// adjacent reports whether chunk directly precedes or follows a span of
+// chunks ordered by index within one atom.
+func adjacent(span []*storage.Chunk, chunk *storage.Chunk) bool {
+	if len(span) == 0 || span[0].AtomID != chunk.AtomID {
+		return false
+	}
+	return chunk.ChunkIndex == span[0].ChunkIndex-1 || chunk.ChunkIndex == span[len(span)-1].ChunkIndex+1
+}
+
+// addToSpan inserts a chunk into the hit's span in index order.
+func (h *searchHit) addToSpan(chunk *storage.Chunk) {
+	i, _ := slices.BinarySearchFunc(h.span, chunk.ChunkIndex, func(c *storage.Chunk, idx int) int { return c.ChunkIndex - idx })
+	h.span = slices.Insert(h.span, i, chunk)
+}
+
+// mergeSpan joins the texts of consecutive chunks, dropping the text each
+// chunk repeats from its predecessor, and the anchor covering them all.
+func mergeSpan(span []*storage.Chunk) (text, anchor string) {
+	text, anchor = span[0].ChunkText, span[0].EvidenceAnchor
+	merged, anchorErr := storage.ParseEvidenceAnchor(anchor)
+	for _, c := range span[1:] {
+		text = joinOverlapping(text, c.ChunkText)
+		if a, err := storage.ParseEvidenceAnchor(c.EvidenceAnchor); err == nil && anchorErr == nil {
+			merged = merged.Union(a)
+		} else {
+			anchorErr = err
+		}
+	}
+	if anchorErr == nil {
+		anchor = merged.ToJSON()
+	}
+	return text, anchor
+}
+
+// joinOverlapping appends b to a, leaving out the longest run of whole
+// words that ends a and begins b.
+func joinOverlapping(a, b string) string {
+	for k := min(len(a), len(b)); k > 0; k-- {
+		if !strings.HasSuffix(a, b[:k]) {
+			continue
+		}
+		startsWord := k == len(a) || unicode.IsSpace(rune(a[len(a)-k-1]))
+		endsWord := k == len(b) || unicode.IsSpace(rune(b[k]))
+		if startsWord && endsWord {
+			return a + b[k:]
+		}
+	}
+	return a + " " + b
+}
+
+// groupByAsset keeps the best hit of each asset, counting the asset's
+// chunks among all hits.
+func groupByAsset(hits []searchHit) []searchHit {
+	var out []searchHit
+	byAsset := make(map[string]int)
+	for _, h := range hits {
+		chunks := max(len(h.span), 1)
+		if i, ok := byAsset[h.rec.AssetID]; ok {
+			out[i].assetHits += chunks
+			continue
+		}
+		byAsset[h.rec.AssetID] = len(out)
+		h.assetHits = chunks
+		out = append(out, h)
+	}
+	return out
+}
+
+// diversify picks limit hits by maximal marginal relevance: each pick
+// maximises lambda*relevance - (1-lambda)*(greatest cosine similarity to
+// an earlier pick). When scores are cosine distances (distances), relevance
+// is the similarity to the query; other scores are scaled to [0, 1] over
+// all hits.
+func diversify(hits []searchHit, vectors map[string][]float32, lambda float64, distances bool, limit int) []searchHit {
+	if len(hits) <= 1 {
+		return hits
+	}
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, h := range hits {
+		lo, hi = math.Min(lo, h.score), math.Max(hi, h.score)
+	}
+	relevance := make([]float64, len(hits))
+	for i, h := range hits {
+		switch {
+		case distances:
+			relevance[i] = 1 - h.score
+		case hi == lo:
+			relevance[i] = 1
+		default:
+			relevance[i] = (h.score - lo) / (hi - lo)
+		}
+	}
+
+	picked := make([]bool, len(hits))
+	// redundancy[i] is hit i's greatest similarity to the picks so far
+	redundancy := make([]float64, len(hits))
+	out := make([]searchHit, 0, min(limit, len(hits)))
+	for len(out) < cap(out) {
+		best, bestValue := -1, math.Inf(-1)
+		for i := range hits {
+			if picked[i] {
+				continue
+			}
+			if v := lambda*relevance[i] - (1-lambda)*redundancy[i]; v > bestValue {
+				best, bestValue = i, v
+			}
+		}
+		picked[best] = true
+		out = append(out, hits[best])
+		if pv := vectors[hits[best].rec.ID]; pv != nil {
+			for i := range hits {
+				if v := vectors[hits[i].rec.ID]; v != nil && !picked[i] {
+					redundancy[i] = math.Max(redundancy[i], cosine(pv, v))
+				}
+			}
+		}
+	}
+	return out
+}
+
+// cosine returns the similarity of two normalized vectors.
+func cosine(a, b []float32) float64 {
+	var sum float32
+	for i := range min(len(a), len(b)) {
+		sum += a[i] * b[i]
+	}
+	return float64(sum)
+}
@@ -10,14 +10,16 @@ import (
 )
 
 type evidenceResponse struct {
-	AssetID        string  `json:"asset_id"`
-	Path           string  `json:"path"`
-	Filename       string  `json:"filename"`
-	MimeType       *string `json:"mime_type"`
-	SizeBytes      int64   `json:"size_bytes"`
-	Exists         bool    `json:"exists"`
-	EvidenceAnchor any     `json:"evidence_anchor,omitempty"`
-	ChunkText      *string `json:"chunk_text,omitempty"`
+	AssetID        string                  `json:"asset_id"`
+	Path           string                  `json:"path"`
+	Filename       string                  `json:"filename"`
+	MimeType       *string                 `json:"mime_type"`
+	SizeBytes      int64                   `json:"size_bytes"`
+	Exists         bool                    `json:"exists"`
+	EvidenceAnchor *storage.EvidenceAnchor `json:"evidence_anchor,omitempty"`
+	Location       string                  `json:"location,omitempty"` // human-readable anchor, e.g. "cell 3"
+	ChunkText      *string                 `json:"chunk_text,omitempty"`
+	Metadata       map[string]string       `json:"metadata,omitempty"`
 }
 
 func EvidenceRouter(db *storage.Database) chi.Router {
@@ -31,6 +33,7 @@ func EvidenceRouter(db *storage.Database) chi.Router {
 			return
 		}
 
+		meta, _ := db.GetAssetMetadata(asset.ID)
 		_, fileExists := os.Stat(asset.Path)
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(evidenceResponse{
@@ -40,9 +43,26 @@ func EvidenceRouter(db *storage.Database) chi.Router {
 			MimeType:  asset.MimeType,
 			SizeBytes: asset.SizeBytes,
 			Exists:    fileExists == nil,
+			Metadata:  meta,
 		})
 	})
 
+	// Lines left out of the asset's chunks as boilerplate, with their
+	// character offsets in the atom text they came from.
+	r.Get("/{asset_id}/suppressed", func(w http.ResponseWriter, r *http.Request) {
+		assetID := chi.URLParam(r, "asset_id")
+		spans, err := db.GetSuppressedText(assetID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if spans == nil {
+			spans = []storage.SuppressedText{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(spans)
+	})
+
 	r.Get("/chunk/{chunk_id}", func(w http.ResponseWriter, r *http.Request) {
 		chunkID := chi.URLParam(r, "chunk_id")
 		chunk, err := db.GetChunk(chunkID)
@@ -56,9 +76,10 @@ func EvidenceRouter(db *storage.Database) chi.Router {
 			return
 		}
 
-		var anchor any
-		if chunk.EvidenceAnchor != "" {
-			json.Unmarshal([]byte(chunk.EvidenceAnchor), &anchor)
+		var anchor *storage.EvidenceAnchor
+		var location string
+		if ea, err := storage.ParseEvidenceAnchor(chunk.EvidenceAnchor); err == nil {
+			anchor, location = &ea, ea.Describe()
 		}
 
 		_, fileExists := os.Stat(asset.Path)
@@ -71,6 +92,7 @@ func EvidenceRouter(db *storage.Database) chi.Router {
 			SizeBytes:      asset.SizeBytes,
 			Exists:         fileExists == nil,
 			EvidenceAnchor: anchor,
+			Location:       location,
 			ChunkText:      &chunk.ChunkText,
 		})
 	})
@@ -6,12 +6,17 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"github.com/oho/knowledge-refinery-daemon/internal/pipeline"
+	"github.com/oho/knowledge-refinery-daemon/internal/storage"
 )
 
 type startIngestRequest struct {
 	Paths []string `json:"paths"`
 }
 
+type reembedRequest struct {
+	Model string `json:"model"` // defaults to LM Studio's embedding model
+}
+
 func IngestRouter(orch *pipeline.Orchestrator) chi.Router {
 	r := chi.NewRouter()
 
@@ -37,6 +42,38 @@ func IngestRouter(orch *pipeline.Orchestrator) chi.Router {
 		})
 	})
 
+	// Re-embed the corpus with another model; searches switch over when it
+	// completes.
+	r.Post("/reembed", func(w http.ResponseWriter, r *http.Request) {
+		var req reembedRequest
+		json.NewDecoder(r.Body).Decode(&req) // may be empty body
+
+		jobID, err := orch.Reembed(req.Model)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"job_id": jobID,
+			"status": "started",
+		})
+	})
+
+	r.Get("/namespaces", func(w http.ResponseWriter, r *http.Request) {
+		namespaces, err := orch.Namespaces()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if namespaces == nil {
+			namespaces = []storage.Namespace{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(namespaces)
+	})
+
 	r.Get("/status", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(orch.GetStatus())
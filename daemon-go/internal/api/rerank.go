@@ -0,0 +1,94 @@
+package api
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/oho/knowledge-refinery-daemon/internal/lmstudio"
+)
+
+// Rerankers re-score the top candidates of a search: a cross-encoder
+// behind a /rerank endpoint, or the chat model rating each passage.
+const (
+	rerankNone         = ""
+	rerankCrossEncoder = "cross-encoder"
+	rerankLLM          = "llm"
+)
+
+// defaultRerankCandidates is how many candidates are re-scored unless the
+// request says otherwise; maxRerankCandidates caps what it may ask for.
+const (
+	defaultRerankCandidates = 30
+	maxRerankCandidates     = 200
+)
+
+// rerankMethod validates a requested reranker; "" and "none" skip reranking.
+func rerankMethod(method string) (string, bool) {
+	switch strings.ToLower(method) {
+	case "", "none":
+		return rerankNone, true
+	case rerankCrossEncoder, "rerank":
+		return rerankCrossEncoder, true
+	case rerankLLM:
+		return rerankLLM, true
+	}
+	return "", false
+}
+
+// rerankCandidates is how many first-stage results a reranker re-scores.
+func rerankCandidates(requested, limit int) int {
+	if requested <= 0 {
+		requested = defaultRerankCandidates
+	}
+	return max(limit, min(requested, maxRerankCandidates))
+}
+
+// rerankHits re-scores hits with the chosen reranker and orders them by
+// it, highest first. Ties keep their first-stage order.
+func rerankHits(lm *lmstudio.Client, method, query string, hits []searchHit) ([]searchHit, error) {
+	texts := make([]string, len(hits))
+	for i, h := range hits {
+		texts[i] = h.rec.Text
+	}
+	var scores []float64
+	var err error
+	switch method {
+	case rerankCrossEncoder:
+		scores, err = lm.Rerank(query, texts)
+	case rerankLLM:
+		scores, err = lm.ScoreRelevance(query, texts, nil)
+	default:
+		return nil, fmt.Errorf("unknown reranker %q", method)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range hits {
+		score := scores[i]
+		hits[i].score, hits[i].scores.Rerank = score, &score
+	}
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].score > hits[j].score })
+	return hits, nil
+}
+
+// serverTiming collects the duration of a request's stages for the
+// Server-Timing response header, e.g. "embed;dur=12.5, rerank;dur=240.1".
+type serverTiming struct {
+	metrics []string
+}
+
+// since records a stage that started at start.
+func (t *serverTiming) since(name string, start time.Time, desc string) {
+	metric := fmt.Sprintf("%s;dur=%.1f", name, float64(time.Since(start).Microseconds())/1000)
+	if desc != "" {
+		metric += fmt.Sprintf(";desc=%q", desc)
+	}
+	t.metrics = append(t.metrics, metric)
+}
+
+func (t *serverTiming) String() string {
+	return strings.Join(t.metrics, ", ")
+}
@@ -2,8 +2,13 @@ package api
 
 import (
 	"encoding/json"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/oho/knowledge-refinery-daemon/internal/lmstudio"
@@ -11,31 +16,274 @@ import (
 )
 
 type searchRequest struct {
-	Query           string  `json:"query"`
-	Limit           int     `json:"limit"`
-	FilterAssetType *string `json:"filter_asset_type"`
+	Query           string            `json:"query"`
+	Limit           int               `json:"limit"`
+	FilterAssetType *string           `json:"filter_asset_type"` // MIME type, e.g. "application/pdf" or "image"
+	Metadata        map[string]string `json:"metadata"`          // e.g. {"captured_at": "2023", "author": "Smith"}
+	Language        string            `json:"language"`          // ISO 639-1 code, e.g. "de"
+	Mode            string            `json:"mode"`              // "vector" (default), "keyword" or "hybrid"
+	Filters         searchFilters     `json:"filters"`
+
+	// Rerank re-scores the top RerankCandidates results (default 30) with
+	// "cross-encoder" or "llm" before the best Limit are returned.
+	Rerank           string `json:"rerank"`
+	RerankCandidates int    `json:"rerank_candidates"`
+
+	// Diversify picks results by maximal marginal relevance, GroupBy
+	// "asset" returns each file's best result, and Collapse (default on
+	// with either) merges results on adjacent chunks of a file.
+	Diversify bool     `json:"diversify"`
+	MMRLambda *float64 `json:"mmr_lambda"` // default 0.7; 1 ignores novelty
+	GroupBy   string   `json:"group_by"`
+	Collapse  *bool    `json:"collapse"`
+
+	// Snippets asks for up to this many short passages per result showing
+	// why it matched, with the query terms highlighted.
+	Snippets int `json:"snippets"`
 }
 
-type searchResultItem struct {
-	ChunkID        string   `json:"chunk_id"`
-	Score          float64  `json:"score"`
-	Text           string   `json:"text"`
-	AssetID        string   `json:"asset_id"`
-	AssetPath      string   `json:"asset_path"`
-	EvidenceAnchor string   `json:"evidence_anchor"`
-	Topics         *string  `json:"topics"`
-	Summary        *string  `json:"summary"`
-	Sentiment      *string  `json:"sentiment"`
+// searchFilters scope a search; see storage.SearchFilter. Times are
+// RFC 3339 or dates, a modified_before date including that whole day.
+type searchFilters struct {
+	MIMETypes      []string `json:"mime_types"`
+	Extensions     []string `json:"extensions"`
+	Volumes        []string `json:"volumes"`
+	PathPrefix     string   `json:"path_prefix"`
+	PathGlob       string   `json:"path_glob"`
+	ModifiedAfter  string   `json:"modified_after"`
+	ModifiedBefore string   `json:"modified_before"`
+	Topics         []string `json:"topics"`
 	Entities       []string `json:"entities"`
+	Sentiment      string   `json:"sentiment"`
+	Concepts       []string `json:"concepts"`
+}
+
+// filter combines the request's filters into one storage filter.
+func (req searchRequest) filter() (storage.SearchFilter, error) {
+	f := req.Filters
+	sf := storage.SearchFilter{
+		MIMETypes:  f.MIMETypes,
+		Extensions: f.Extensions,
+		Volumes:    f.Volumes,
+		PathPrefix: f.PathPrefix,
+		PathGlob:   f.PathGlob,
+		Metadata:   req.Metadata,
+		Topics:     f.Topics,
+		Entities:   f.Entities,
+		Sentiment:  f.Sentiment,
+		Concepts:   f.Concepts,
+		Language:   req.Language,
+	}
+	if req.FilterAssetType != nil && *req.FilterAssetType != "" {
+		sf.MIMETypes = append(sf.MIMETypes, *req.FilterAssetType)
+	}
+	for _, bound := range []struct {
+		name, value string
+		dst         **time.Time
+		endOfDay    bool
+	}{
+		{"modified_after", f.ModifiedAfter, &sf.ModifiedAfter, false},
+		{"modified_before", f.ModifiedBefore, &sf.ModifiedBefore, true},
+	} {
+		if bound.value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, bound.value)
+		if err != nil {
+			if t, err = time.Parse(time.DateOnly, bound.value); err != nil {
+				return sf, fmt.Errorf("%s must be an RFC 3339 time or a date", bound.name)
+			}
+			if bound.endOfDay {
+				t = t.Add(24*time.Hour - time.Nanosecond)
+			}
+		}
+		*bound.dst = &t
+	}
+	return sf, nil
+}
+
+// Search modes: rank chunks by embedding similarity, by BM25 keyword score,
+// or by both, merged with reciprocal rank fusion.
+const (
+	modeVector  = "vector"
+	modeKeyword = "keyword"
+	modeHybrid  = "hybrid"
+)
+
+// GET /search/recall runs two searches per sample, one of them exact, so
+// the sample count and k are capped.
+const (
+	maxRecallSamples = 1000
+	maxRecallK       = 100
+)
+
+// rrfK damps the weight of the top ranks in reciprocal rank fusion; 60 is
+// the usual choice.
+const rrfK = 60
+
+// fusionCandidates is how many results each signal contributes to hybrid
+// ranking for a given limit.
+func fusionCandidates(limit int) int {
+	return max(4*limit, 50)
+}
+
+type searchResultItem struct {
+	ChunkID        string          `json:"chunk_id"`
+	Score          float64         `json:"score"`
+	Text           string          `json:"text"`
+	AssetID        string          `json:"asset_id"`
+	AssetPath      string          `json:"asset_path"`
+	EvidenceAnchor string          `json:"evidence_anchor"`
+	Topics         *string         `json:"topics"`
+	Summary        *string         `json:"summary"`
+	Sentiment      *string         `json:"sentiment"`
+	Entities       []string        `json:"entities"`
+	Language       string          `json:"language,omitempty"`
+	Parent         *searchParent   `json:"parent,omitempty"`
+	Scores         searchScores    `json:"scores"`
+	MergedChunkIDs []string        `json:"merged_chunk_ids,omitempty"` // adjacent chunks collapsed into Text, in order
+	AssetHits      int             `json:"asset_hits,omitempty"`       // matching chunks of the asset when grouped
+	Snippets       []searchSnippet `json:"snippets,omitempty"`
+}
+
+// searchScores are a result's scores from each signal that found it, with
+// its 1-based rank there. Score is the cosine distance in vector mode, the
+// BM25 score in keyword mode and the fused score in hybrid mode, or the
+// rerank score when the results were reranked.
+type searchScores struct {
+	Vector      *float64 `json:"vector,omitempty"` // cosine distance, lower is better
+	VectorRank  *int     `json:"vector_rank,omitempty"`
+	Keyword     *float64 `json:"keyword,omitempty"` // BM25, higher is better
+	KeywordRank *int     `json:"keyword_rank,omitempty"`
+	Fused       *float64 `json:"fused,omitempty"`  // reciprocal rank fusion
+	Rerank      *float64 `json:"rerank,omitempty"` // reranker relevance, higher is better
+}
+
+// searchOptions choose how a search ranks its results.
+type searchOptions struct {
+	mode             string
+	rerank           string
+	rerankCandidates int
+	diversify        bool
+	mmrLambda        float64
+	groupBy          string
+	collapse         bool
+	snippets         int
+}
+
+// setDiversity validates and applies the diversification options;
+// collapsing defaults to on when results are diversified or grouped.
+func (o *searchOptions) setDiversity(lambda *float64, groupBy string, collapse *bool) error {
+	o.mmrLambda = defaultMMRLambda
+	if lambda != nil {
+		if *lambda < 0 || *lambda > 1 {
+			return fmt.Errorf("mmr_lambda must be between 0 and 1")
+		}
+		o.mmrLambda = *lambda
+	}
+	switch strings.ToLower(groupBy) {
+	case "", "none":
+		o.groupBy = ""
+	case groupAsset:
+		o.groupBy = groupAsset
+	default:
+		return fmt.Errorf("group_by must be none or asset")
+	}
+	o.collapse = o.diversify || o.groupBy != ""
+	if collapse != nil {
+		o.collapse = *collapse
+	}
+	return nil
+}
+
+// pool is how many first-stage results the later stages choose from.
+func (o searchOptions) pool(limit int) int {
+	pool := limit
+	if o.rerank != rerankNone {
+		pool = rerankCandidates(o.rerankCandidates, limit)
+	}
+	if o.diversify || o.groupBy != "" || o.collapse {
+		pool = max(pool, diversityCandidates(limit))
+	}
+	return pool
+}
+
+// searchHit is a ranked result before enrichment.
+type searchHit struct {
+	rec       storage.VectorRecord
+	score     float64
+	scores    searchScores
+	span      []*storage.Chunk // chunks collapsed into rec, in order
+	assetHits int
+}
+
+// rankHits orders the results of the signals a mode uses, fusing them in
+// hybrid mode: each result scores the sum of 1/(rrfK+rank) over the
+// rankings it appears in.
+func rankHits(mode string, vector []storage.SearchResult, keyword []storage.TextMatch, limit int) []searchHit {
+	var hits []*searchHit
+	byID := make(map[string]*searchHit)
+	hit := func(rec storage.VectorRecord) *searchHit {
+		if h, ok := byID[rec.ID]; ok {
+			return h
+		}
+		h := &searchHit{rec: rec}
+		byID[rec.ID] = h
+		hits = append(hits, h)
+		return h
+	}
+	for i, res := range vector {
+		h, rank, dist := hit(res.VectorRecord), i+1, res.Distance
+		h.scores.Vector, h.scores.VectorRank = &dist, &rank
+		h.score += 1 / float64(rrfK+rank)
+		if mode == modeVector {
+			h.score = dist
+		}
+	}
+	for i, m := range keyword {
+		h, rank, bm25 := hit(m.VectorRecord), i+1, m.Score
+		h.scores.Keyword, h.scores.KeywordRank = &bm25, &rank
+		h.score += 1 / float64(rrfK+rank)
+		if mode == modeKeyword {
+			h.score = bm25
+		}
+	}
+	if mode == modeHybrid {
+		sort.SliceStable(hits, func(i, j int) bool { return hits[i].score > hits[j].score })
+	}
+
+	out := make([]searchHit, 0, min(limit, len(hits)))
+	for _, h := range hits[:min(limit, len(hits))] {
+		if mode == modeHybrid {
+			fused := h.score
+			h.scores.Fused = &fused
+		}
+		out = append(out, *h)
+	}
+	return out
+}
+
+// searchParent is the section a matching chunk was cut from. The match is
+// Text[HighlightStart:HighlightEnd], counted in characters (code points).
+type searchParent struct {
+	ID             string `json:"id"`
+	Text           string `json:"text"`
+	HighlightStart *int   `json:"highlight_start,omitempty"`
+	HighlightEnd   *int   `json:"highlight_end,omitempty"`
 }
 
 func SearchRouter(lm *lmstudio.Client, vs *storage.VectorStore, db *storage.Database) chi.Router {
 	r := chi.NewRouter()
 
-	doSearch := func(query string, limit int) ([]searchResultItem, error) {
-		rawVec, err := lm.EmbedSingle(query, nil)
+	// embedQuery embeds with the model and query template the searched
+	// vectors came from, not whichever model LM Studio offers now.
+	embedQuery := func(query string) ([]float32, error) {
+		rawVec, err := lm.EmbedQuery(query, vs.Model())
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("failed to embed query: %w", err)
+		}
+		if dim := vs.Dimension(); vs.Count() > 0 && len(rawVec) != dim {
+			return nil, fmt.Errorf("query embedding has %d dimensions, indexed vectors have %d", len(rawVec), dim)
 		}
 
 		// Convert float64 to float32
@@ -43,23 +291,45 @@ func SearchRouter(lm *lmstudio.Client, vs *storage.VectorStore, db *storage.Data
 		for i, v := range rawVec {
 			queryVec[i] = float32(v)
 		}
+		return queryVec, nil
+	}
 
-		results := vs.Search(queryVec, limit)
-
-		items := make([]searchResultItem, len(results))
-		for i, res := range results {
+	// toItems enriches ranked hits with their parent section and annotation.
+	toItems := func(hits []searchHit) []searchResultItem {
+		items := make([]searchResultItem, len(hits))
+		for i, hit := range hits {
+			res := hit.rec
 			item := searchResultItem{
 				ChunkID:        res.ID,
-				Score:          res.Distance,
+				Score:          hit.score,
+				Scores:         hit.scores,
 				Text:           res.Text,
 				AssetID:        res.AssetID,
 				AssetPath:      res.AssetPath,
 				EvidenceAnchor: res.EvidenceAnchor,
+				Language:       res.Language,
+				AssetHits:      hit.assetHits,
+			}
+			if len(hit.span) > 1 {
+				for _, c := range hit.span {
+					item.MergedChunkIDs = append(item.MergedChunkIDs, c.ID)
+				}
 			}
 
 			if res.Topics != "" {
 				item.Topics = &res.Topics
 			}
+			if chunk, _ := db.GetChunk(res.ID); chunk != nil && chunk.ParentID != nil {
+				if parent, _ := db.GetParentChunk(*chunk.ParentID); parent != nil {
+					start, end := spanHighlight(hit.span, chunk)
+					item.Parent = &searchParent{
+						ID:             parent.ID,
+						Text:           parent.ChunkText,
+						HighlightStart: start,
+						HighlightEnd:   end,
+					}
+				}
+			}
 
 			// Enrich with annotation
 			ann, _ := db.GetCurrentAnnotation(res.ID)
@@ -93,6 +363,99 @@ func SearchRouter(lm *lmstudio.Client, vs *storage.VectorStore, db *storage.Data
 
 			items[i] = item
 		}
+		return items
+	}
+
+	doSearch := func(query string, limit int, scope storage.SearchFilter, opts searchOptions, timing *serverTiming) ([]searchResultItem, error) {
+		// Filters are resolved to the assets and chunks they admit and
+		// applied while candidates are selected, so limits hold.
+		resolved, err := db.ResolveFilter(scope)
+		if err != nil {
+			return nil, fmt.Errorf("resolve filters: %w", err)
+		}
+		var filter func(*storage.VectorRecord) bool
+		if resolved != nil {
+			if resolved.MatchesNone() {
+				return []searchResultItem{}, nil
+			}
+			filter = resolved.Accept
+		}
+
+		// Rerankers and diversification pick the results from a larger
+		// first-stage pool
+		mode, pool := opts.mode, opts.pool(limit)
+		candidates := pool
+		if mode == modeHybrid {
+			candidates = fusionCandidates(pool)
+		}
+		var queryVec []float32
+		if mode != modeKeyword {
+			start := time.Now()
+			if queryVec, err = embedQuery(query); err != nil {
+				return nil, err
+			}
+			timing.since("embed", start, "")
+		}
+		start := time.Now()
+		var vectorResults []storage.SearchResult
+		if mode != modeKeyword {
+			vectorResults = vs.SearchFiltered(queryVec, candidates, filter)
+		}
+		var keywordResults []storage.TextMatch
+		if mode != modeVector {
+			keywordResults, err = db.SearchChunkText(query, candidates, filter)
+			if err != nil {
+				return nil, fmt.Errorf("keyword search: %w", err)
+			}
+		}
+		hits := rankHits(mode, vectorResults, keywordResults, pool)
+		timing.since("retrieve", start, mode)
+
+		if opts.rerank != rerankNone && len(hits) > 0 {
+			// A failing reranker leaves the first-stage order
+			start := time.Now()
+			reranked, err := rerankHits(lm, opts.rerank, query, hits)
+			if err != nil {
+				slog.Warn("Rerank failed, returning unreranked results", "reranker", opts.rerank, "error", err)
+				timing.since("rerank", start, opts.rerank+" failed")
+			} else {
+				hits = reranked
+				timing.since("rerank", start, opts.rerank)
+			}
+		}
+		if opts.collapse || opts.groupBy != "" || opts.diversify {
+			start := time.Now()
+			if opts.collapse {
+				hits = collapseAdjacent(db, hits)
+			}
+			if opts.groupBy == groupAsset {
+				hits = groupByAsset(hits)
+			}
+			if opts.diversify {
+				ids := make([]string, len(hits))
+				for i, h := range hits {
+					ids[i] = h.rec.ID
+				}
+				// Vector mode scores are cosine distances, unless reranked
+				distances := mode == modeVector && (len(hits) == 0 || hits[0].scores.Rerank == nil)
+				hits = diversify(hits, vs.Vectors(ids), opts.mmrLambda, distances, limit)
+			}
+			timing.since("diversify", start, "")
+		}
+		items := toItems(hits[:min(limit, len(hits))])
+
+		if opts.snippets > 0 {
+			// Keyword matches show their query terms; semantic matches the
+			// sentences nearest to the query
+			start := time.Now()
+			embedWindows := func(texts []string) ([][]float64, error) { return lm.EmbedNamespaceDocuments(texts, vs.Model()) }
+			if err := addSnippets(items, query, queryVec, mode != modeVector, opts.snippets, embedWindows); err != nil {
+				slog.Warn("Failed to embed snippet windows", "error", err)
+				timing.since("snippets", start, "semantic failed")
+			} else {
+				timing.since("snippets", start, "")
+			}
+		}
 		return items, nil
 	}
 
@@ -105,13 +468,37 @@ func SearchRouter(lm *lmstudio.Client, vs *storage.VectorStore, db *storage.Data
 		if req.Limit <= 0 {
 			req.Limit = 20
 		}
+		mode, ok := searchMode(req.Mode)
+		if !ok {
+			http.Error(w, "mode must be vector, keyword or hybrid", http.StatusBadRequest)
+			return
+		}
+		rerank, ok := rerankMethod(req.Rerank)
+		if !ok {
+			http.Error(w, "rerank must be none, cross-encoder or llm", http.StatusBadRequest)
+			return
+		}
+		scope, err := req.filter()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
-		items, err := doSearch(req.Query, req.Limit)
+		start, timing := time.Now(), &serverTiming{}
+		opts := searchOptions{mode: mode, rerank: rerank, rerankCandidates: req.RerankCandidates, diversify: req.Diversify,
+			snippets: min(max(req.Snippets, 0), maxSnippets)}
+		if err := opts.setDiversity(req.MMRLambda, req.GroupBy, req.Collapse); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		items, err := doSearch(req.Query, req.Limit, scope, opts, timing)
 		if err != nil {
-			http.Error(w, "Failed to embed query: "+err.Error(), http.StatusInternalServerError)
+			http.Error(w, "Search failed: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
+		timing.since("total", start, "")
 
+		w.Header().Set("Server-Timing", timing.String())
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(items)
 	})
@@ -129,15 +516,157 @@ func SearchRouter(lm *lmstudio.Client, vs *storage.VectorStore, db *storage.Data
 			}
 		}
 
-		items, err := doSearch(q, limit)
+		mode, ok := searchMode(r.URL.Query().Get("mode"))
+		if !ok {
+			http.Error(w, "mode must be vector, keyword or hybrid", http.StatusBadRequest)
+			return
+		}
+		rerank, ok := rerankMethod(r.URL.Query().Get("rerank"))
+		if !ok {
+			http.Error(w, "rerank must be none, cross-encoder or llm", http.StatusBadRequest)
+			return
+		}
+		opts := searchOptions{mode: mode, rerank: rerank}
+		if v := r.URL.Query().Get("rerank_candidates"); v != "" {
+			if n, err := strconv.Atoi(v); err == nil && n > 0 {
+				opts.rerankCandidates = n
+			}
+		}
+		opts.diversify, _ = strconv.ParseBool(r.URL.Query().Get("diversify"))
+		if v := r.URL.Query().Get("snippets"); v != "" {
+			if n, err := strconv.Atoi(v); err == nil && n > 0 {
+				opts.snippets = min(n, maxSnippets)
+			}
+		}
+		var lambda *float64
+		if v := r.URL.Query().Get("mmr_lambda"); v != "" {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				lambda = &f
+			}
+		}
+		var collapse *bool
+		if v := r.URL.Query().Get("collapse"); v != "" {
+			if b, err := strconv.ParseBool(v); err == nil {
+				collapse = &b
+			}
+		}
+		if err := opts.setDiversity(lambda, r.URL.Query().Get("group_by"), collapse); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		start, timing := time.Now(), &serverTiming{}
+		items, err := doSearch(q, limit, storage.SearchFilter{Language: r.URL.Query().Get("lang")}, opts, timing)
 		if err != nil {
-			http.Error(w, "Failed to embed query: "+err.Error(), http.StatusInternalServerError)
+			http.Error(w, "Search failed: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
+		timing.since("total", start, "")
 
+		w.Header().Set("Server-Timing", timing.String())
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(items)
 	})
 
+	// More like this: the neighbours of a chunk, asset or concept, found
+	// with its stored vectors rather than a query, under /search's filters.
+	r.Get("/similar", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		limit := defaultSimilarLimit
+		if l := q.Get("limit"); l != "" {
+			if n, err := strconv.Atoi(l); err == nil && n > 0 {
+				limit = n
+			}
+		}
+		excludeSource, _ := strconv.ParseBool(q.Get("exclude_source"))
+		scope, err := queryFilterRequest(q).filter()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		start, timing := time.Now(), &serverTiming{}
+		src, status, err := findSimilarSource(db, vs, q, excludeSource)
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+		timing.since("source", start, src.kind)
+
+		resolved, err := db.ResolveFilter(scope)
+		if err != nil {
+			http.Error(w, "resolve filters: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		items := []searchResultItem{}
+		if resolved == nil || !resolved.MatchesNone() {
+			filter := src.accept
+			if resolved != nil {
+				filter = func(rec *storage.VectorRecord) bool { return src.accept(rec) && resolved.Accept(rec) }
+			}
+			retrieveStart := time.Now()
+			hits := rankHits(modeVector, vs.SearchFiltered(src.vector, limit, filter), nil, limit)
+			timing.since("retrieve", retrieveStart, modeVector)
+			items = toItems(hits)
+		}
+		timing.since("total", start, "")
+
+		w.Header().Set("Server-Timing", timing.String())
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(items)
+	})
+
+	// Recall of the approximate index against exact search, measured on
+	// randomly chosen stored vectors. ef overrides the configured ef_search.
+	r.Get("/recall", func(w http.ResponseWriter, r *http.Request) {
+		samples, k, ef := 100, 10, 0
+		for name, dst := range map[string]*int{"samples": &samples, "k": &k, "ef": &ef} {
+			if v := r.URL.Query().Get(name); v != "" {
+				n, err := strconv.Atoi(v)
+				if err != nil || n <= 0 {
+					http.Error(w, name+" must be a positive integer", http.StatusBadRequest)
+					return
+				}
+				*dst = n
+			}
+		}
+		samples, k = min(samples, maxRecallSamples), min(k, maxRecallK)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(vs.MeasureRecall(samples, k, ef))
+	})
+
 	return r
 }
+
+// spanHighlight returns the range of chunk's parent that a collapsed span
+// covers: all of it when every chunk of the span lies in that parent, else
+// chunk's own range.
+func spanHighlight(span []*storage.Chunk, chunk *storage.Chunk) (start, end *int) {
+	start, end = chunk.ParentStart, chunk.ParentEnd
+	if start == nil || end == nil {
+		return start, end
+	}
+	lo, hi := *start, *end
+	for _, c := range span {
+		if c.ParentID == nil || *c.ParentID != *chunk.ParentID || c.ParentStart == nil || c.ParentEnd == nil {
+			return start, end
+		}
+		lo, hi = min(lo, *c.ParentStart), max(hi, *c.ParentEnd)
+	}
+	return &lo, &hi
+}
+
+// searchMode validates a requested search mode, defaulting to vector, so
+// callers that predate the other modes keep their ranking and scores.
+func searchMode(mode string) (string, bool) {
+	switch strings.ToLower(mode) {
+	case "", modeVector:
+		return modeVector, true
+	case modeHybrid:
+		return modeHybrid, true
+	case modeKeyword:
+		return modeKeyword, true
+	}
+	return "", false
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/oho/knowledge-refinery-daemon/internal/storage"
+)
+
+// defaultSimilarLimit is how many neighbours GET /search/similar returns
+// unless asked for more.
+const defaultSimilarLimit = 10
+
+// similarSource is the chunk, asset or concept GET /search/similar finds
+// neighbours of, as a stored vector: the chunk's own, the mean of the
+// asset's chunks or the centroid of the concept's members.
+type similarSource struct {
+	kind   string // "chunk", "asset" or "concept"
+	vector []float32
+	accept func(*storage.VectorRecord) bool // drops the source from its neighbours
+}
+
+// findSimilarSource looks up the source named by the chunk_id, asset_id or
+// concept_id parameter, exactly one of which must be given. A chunk is
+// never its own neighbour; with excludeSource a chunk's or asset's file,
+// or a concept's members, are left out too. The int is the HTTP status of
+// a failed lookup.
+func findSimilarSource(db *storage.Database, vs *storage.VectorStore, q url.Values, excludeSource bool) (*similarSource, int, error) {
+	var given []string
+	for _, name := range []string{"chunk_id", "asset_id", "concept_id"} {
+		if q.Get(name) != "" {
+			given = append(given, name)
+		}
+	}
+	if len(given) != 1 {
+		return nil, http.StatusBadRequest, fmt.Errorf("exactly one of chunk_id, asset_id or concept_id is required")
+	}
+
+	src := &similarSource{}
+	var err error
+	switch id := q.Get(given[0]); given[0] {
+	case "chunk_id":
+		src.kind = "chunk"
+		chunk, _ := db.GetChunk(id)
+		if chunk == nil {
+			return nil, http.StatusNotFound, fmt.Errorf("chunk %s not found", id)
+		}
+		src.vector, _, err = vs.MeanVector([]string{id})
+		src.accept = func(rec *storage.VectorRecord) bool {
+			return rec.ID != id && !(excludeSource && rec.AssetID == chunk.AssetID)
+		}
+	case "asset_id":
+		src.kind = "asset"
+		if asset, _ := db.GetFileAsset(id); asset == nil {
+			return nil, http.StatusNotFound, fmt.Errorf("asset %s not found", id)
+		}
+		src.vector, _, err = vs.AssetVector(id)
+		src.accept = func(rec *storage.VectorRecord) bool {
+			return !(excludeSource && rec.AssetID == id)
+		}
+	case "concept_id":
+		src.kind = "concept"
+		if node, _ := db.GetConceptNodeByID(id); node == nil {
+			return nil, http.StatusNotFound, fmt.Errorf("concept %s not found", id)
+		}
+		var memberIDs []string
+		if memberIDs, err = db.GetMemberChunkIDs(id); err != nil {
+			break
+		}
+		members := make(map[string]bool, len(memberIDs))
+		for _, m := range memberIDs {
+			members[m] = true
+		}
+		src.vector, _, err = vs.MeanVector(memberIDs)
+		src.accept = func(rec *storage.VectorRecord) bool {
+			return !(excludeSource && members[rec.ID])
+		}
+	}
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("read %s vectors: %w", src.kind, err)
+	}
+	if src.vector == nil {
+		return nil, http.StatusNotFound, fmt.Errorf("%s %s has no vectors from the active embedding model", src.kind, q.Get(given[0]))
+	}
+	return src, 0, nil
+}
+
+// queryFilterRequest reads the filters of a POST /search request from query
+// parameters of the same names. Lists are comma-separated or repeated, and
+// metadata keys are prefixed "metadata.", e.g. metadata.author=Smith.
+func queryFilterRequest(q url.Values) searchRequest {
+	list := func(name string) []string {
+		var values []string
+		for _, v := range q[name] {
+			for _, part := range strings.Split(v, ",") {
+				if part = strings.TrimSpace(part); part != "" {
+					values = append(values, part)
+				}
+			}
+		}
+		return values
+	}
+	req := searchRequest{
+		Language: q.Get("language"),
+		Filters: searchFilters{
+			MIMETypes:      list("mime_types"),
+			Extensions:     list("extensions"),
+			Volumes:        list("volumes"),
+			PathPrefix:     q.Get("path_prefix"),
+			PathGlob:       q.Get("path_glob"),
+			ModifiedAfter:  q.Get("modified_after"),
+			ModifiedBefore: q.Get("modified_before"),
+			Topics:         list("topics"),
+			Entities:       list("entities"),
+			Sentiment:      q.Get("sentiment"),
+			Concepts:       list("concepts"),
+		},
+	}
+	if req.Language == "" {
+		req.Language = q.Get("lang")
+	}
+	if t := q.Get("filter_asset_type"); t != "" {
+		req.FilterAssetType = &t
+	}
+	for name := range q {
+		if key, ok := strings.CutPrefix(name, "metadata."); ok && key != "" {
+			if req.Metadata == nil {
+				req.Metadata = make(map[string]string)
+			}
+			req.Metadata[key] = q.Get(name)
+		}
+	}
+	return req
+}
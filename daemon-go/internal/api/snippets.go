@@ -0,0 +1,340 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/oho/knowledge-refinery-daemon/internal/language"
+	"golang.org/x/text/unicode/norm"
+)
+
+// searchSnippet is a short passage of a result's text showing why it
+// matched. Start and End locate it in the result's text and Highlights
+// locate query terms in the snippet, all in characters (code points).
+type searchSnippet struct {
+	Text       string      `json:"text"`
+	Start      int         `json:"start"`
+	End        int         `json:"end"`
+	Highlights []textRange `json:"highlights,omitempty"`
+	Source     string      `json:"source"` // "keyword" or "semantic"
+	Score      float64     `json:"score"`  // query terms found, or cosine similarity to the query
+}
+
+type textRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// Snippet sources.
+const (
+	snippetKeyword  = "keyword"
+	snippetSemantic = "semantic"
+)
+
+// Snippets are sentence windows of at least snippetMinChars characters,
+// clipped to snippetMaxChars; maxSnippets caps how many a result gets.
+const (
+	snippetMinChars = 60
+	snippetMaxChars = 300
+	maxSnippets     = 5
+)
+
+// byteRange is a span of a text in bytes.
+type byteRange struct{ start, end int }
+
+// textWord is a run of letters and digits, folded for matching.
+type textWord struct {
+	byteRange
+	folded string
+}
+
+// foldWord lowercases a word and drops its diacritics, as the keyword
+// index does.
+func foldWord(w string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.Is(unicode.Mn, r) {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, norm.NFD.String(w))
+}
+
+// splitWords returns the words of text with their byte offsets.
+func splitWords(text string) []textWord {
+	var words []textWord
+	start := -1
+	for i, r := range text {
+		inWord := unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r)
+		switch {
+		case inWord && start < 0:
+			start = i
+		case !inWord && start >= 0:
+			words = append(words, textWord{byteRange{start, i}, foldWord(text[start:i])})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		words = append(words, textWord{byteRange{start, len(text)}, foldWord(text[start:])})
+	}
+	return words
+}
+
+// queryPhrases splits a query as keyword search does: each
+// whitespace-separated part is a phrase of its folded words.
+func queryPhrases(query string) [][]string {
+	var phrases [][]string
+	for _, part := range strings.Fields(query) {
+		var phrase []string
+		for _, w := range splitWords(part) {
+			phrase = append(phrase, w.folded)
+		}
+		if len(phrase) > 0 {
+			phrases = append(phrases, phrase)
+		}
+	}
+	return phrases
+}
+
+// termMatch is an occurrence of query phrase i in a text.
+type termMatch struct {
+	byteRange
+	phrase int
+}
+
+// findTerms returns the occurrences of the phrases in text, in order.
+func findTerms(text string, phrases [][]string) []termMatch {
+	words := splitWords(text)
+	var matches []termMatch
+	for i := range words {
+		for p, phrase := range phrases {
+			if i+len(phrase) > len(words) {
+				continue
+			}
+			found := true
+			for j, term := range phrase {
+				if words[i+j].folded != term {
+					found = false
+					break
+				}
+			}
+			if found {
+				matches = append(matches, termMatch{byteRange{words[i].start, words[i+len(phrase)-1].end}, p})
+				break
+			}
+		}
+	}
+	return matches
+}
+
+// sentenceWindows splits text into runs of whole sentences of at least
+// snippetMinChars characters where the text allows.
+func sentenceWindows(text, lang string) []byteRange {
+	var windows []byteRange
+	from := 0
+	for _, s := range language.Sentences(text, lang) {
+		i := strings.Index(text[from:], s)
+		if i < 0 {
+			continue
+		}
+		start, end := from+i, from+i+len(s)
+		from = end
+		if n := len(windows); n > 0 && utf8.RuneCountInString(text[windows[n-1].start:windows[n-1].end]) < snippetMinChars {
+			windows[n-1].end = end
+			continue
+		}
+		windows = append(windows, byteRange{start, end})
+	}
+	return windows
+}
+
+// clipWindow shortens a window longer than snippetMaxChars characters to
+// that many around focus, a byte offset in it, cutting at spaces.
+func clipWindow(text string, w byteRange, focus int) byteRange {
+	if utf8.RuneCountInString(text[w.start:w.end]) <= snippetMaxChars {
+		return w
+	}
+	// Start a third of the way before focus, then take snippetMaxChars
+	start := focus
+	for n := 0; start > w.start && n < snippetMaxChars/3; n++ {
+		_, size := utf8.DecodeLastRuneInString(text[:start])
+		start -= size
+	}
+	end := start
+	for n := 0; end < w.end && n < snippetMaxChars; n++ {
+		_, size := utf8.DecodeRuneInString(text[end:])
+		end += size
+	}
+	if start > w.start {
+		if i := strings.IndexFunc(text[start:end], unicode.IsSpace); i >= 0 && start+i < focus {
+			start += i + 1
+		}
+	}
+	if end < w.end {
+		if i := strings.LastIndexFunc(text[start:end], unicode.IsSpace); i > 0 && start+i > focus {
+			end = start + i
+		}
+	}
+	return byteRange{start, end}
+}
+
+// newSnippet cuts window w out of text, highlighting the matches inside it.
+func newSnippet(text string, w byteRange, matches []termMatch, source string, score float64) searchSnippet {
+	start := utf8.RuneCountInString(text[:w.start])
+	sn := searchSnippet{
+		Text:   text[w.start:w.end],
+		Start:  start,
+		End:    start + utf8.RuneCountInString(text[w.start:w.end]),
+		Source: source,
+		Score:  score,
+	}
+	for _, m := range matches {
+		if m.start >= w.start && m.end <= w.end {
+			hs := utf8.RuneCountInString(text[w.start:m.start])
+			sn.Highlights = append(sn.Highlights, textRange{hs, hs + utf8.RuneCountInString(text[m.start:m.end])})
+		}
+	}
+	return sn
+}
+
+// keywordSnippets returns up to n windows of text with the most distinct
+// query phrases, best first; none when no phrase occurs.
+func keywordSnippets(text, lang string, phrases [][]string, n int) []searchSnippet {
+	matches := findTerms(text, phrases)
+	if len(matches) == 0 {
+		return nil
+	}
+	type scored struct {
+		w     byteRange
+		score int
+	}
+	var candidates []scored
+	for _, w := range sentenceWindows(text, lang) {
+		distinct := make(map[int]bool)
+		focus := -1
+		for _, m := range matches {
+			if m.start >= w.start && m.end <= w.end {
+				distinct[m.phrase] = true
+				if focus < 0 {
+					focus = m.start
+				}
+			}
+		}
+		if len(distinct) > 0 {
+			candidates = append(candidates, scored{clipWindow(text, w, focus), len(distinct)})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].score > candidates[j].score })
+
+	var out []searchSnippet
+	for _, c := range candidates[:min(n, len(candidates))] {
+		out = append(out, newSnippet(text, c.w, matches, snippetKeyword, float64(c.score)))
+	}
+	return out
+}
+
+// semanticWindows returns text's sentence windows, clipped, for embedding.
+func semanticWindows(text, lang string) []byteRange {
+	windows := sentenceWindows(text, lang)
+	for i, w := range windows {
+		windows[i] = clipWindow(text, w, w.start)
+	}
+	return windows
+}
+
+// semanticSnippets returns the n windows most similar to the query, given
+// each window's cosine similarity, best first.
+func semanticSnippets(text string, windows []byteRange, similarity []float64, phrases [][]string, n int) []searchSnippet {
+	order := make([]int, len(windows))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return similarity[order[a]] > similarity[order[b]] })
+
+	matches := findTerms(text, phrases)
+	var out []searchSnippet
+	for _, i := range order[:min(n, len(order))] {
+		out = append(out, newSnippet(text, windows[i], matches, snippetSemantic, similarity[i]))
+	}
+	return out
+}
+
+// snippetEmbedBatch is how many windows one embedding request carries.
+const snippetEmbedBatch = 64
+
+// addSnippets gives each item up to n snippets. With keywordFirst, items
+// whose text contains query terms get the windows with the most of them;
+// the others, given a query vector, get the windows whose embeddings are
+// nearest to it. embed embeds windows comparably with queryVec. An
+// embedding error leaves the semantic snippets out.
+func addSnippets(items []searchResultItem, query string, queryVec []float32, keywordFirst bool, n int,
+	embed func([]string) ([][]float64, error)) error {
+	phrases := queryPhrases(query)
+	type pending struct {
+		item    int
+		windows []byteRange
+		first   int // index of the first window's text in texts
+	}
+	var semantic []pending
+	var texts []string
+	for i := range items {
+		item := &items[i]
+		if keywordFirst {
+			if item.Snippets = keywordSnippets(item.Text, item.Language, phrases, n); item.Snippets != nil {
+				continue
+			}
+		}
+		if queryVec == nil {
+			continue
+		}
+		windows := semanticWindows(item.Text, item.Language)
+		if len(windows) == 0 {
+			continue
+		}
+		semantic = append(semantic, pending{i, windows, len(texts)})
+		for _, w := range windows {
+			texts = append(texts, item.Text[w.start:w.end])
+		}
+	}
+	if len(texts) == 0 {
+		return nil
+	}
+
+	vecs := make([][]float64, 0, len(texts))
+	for start := 0; start < len(texts); start += snippetEmbedBatch {
+		batch, err := embed(texts[start:min(start+snippetEmbedBatch, len(texts))])
+		if err != nil {
+			return err
+		}
+		vecs = append(vecs, batch...)
+	}
+	if len(vecs) != len(texts) {
+		return fmt.Errorf("embedded %d of %d snippet windows", len(vecs), len(texts))
+	}
+	for _, p := range semantic {
+		similarity := make([]float64, len(p.windows))
+		for j := range p.windows {
+			similarity[j] = cosineSimilarity(queryVec, vecs[p.first+j])
+		}
+		item := &items[p.item]
+		item.Snippets = semanticSnippets(item.Text, p.windows, similarity, phrases, n)
+	}
+	return nil
+}
+
+// cosineSimilarity compares a query vector with an embedding.
+func cosineSimilarity(q []float32, v []float64) float64 {
+	var dot, qq, vv float64
+	for i := range min(len(q), len(v)) {
+		dot += float64(q[i]) * v[i]
+		qq += float64(q[i]) * float64(q[i])
+		vv += v[i] * v[i]
+	}
+	if qq == 0 || vv == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(qq*vv)
+}
@@ -9,20 +9,23 @@ import (
 	"path/filepath"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/oho/knowledge-refinery-daemon/internal/pipeline"
 	"github.com/oho/knowledge-refinery-daemon/internal/storage"
 )
 
 type addVolumeRequest struct {
-	Path  string  `json:"path"`
-	Label *string `json:"label"`
+	Path          string  `json:"path"`
+	Label         *string `json:"label"`
+	ChunkStrategy *string `json:"chunk_strategy"` // "fixed" or "semantic"; nil uses the config
 }
 
 type volumeResponse struct {
-	ID         string  `json:"id"`
-	Path       string  `json:"path"`
-	Label      *string `json:"label"`
-	AddedAt    string  `json:"added_at"`
-	LastScanAt *string `json:"last_scan_at"`
+	ID            string  `json:"id"`
+	Path          string  `json:"path"`
+	Label         *string `json:"label"`
+	AddedAt       string  `json:"added_at"`
+	LastScanAt    *string `json:"last_scan_at"`
+	ChunkStrategy *string `json:"chunk_strategy,omitempty"`
 }
 
 func VolumesRouter(db *storage.Database) chi.Router {
@@ -35,6 +38,11 @@ func VolumesRouter(db *storage.Database) chi.Router {
 			return
 		}
 
+		if req.ChunkStrategy != nil && !pipeline.ValidChunkStrategy(*req.ChunkStrategy) {
+			http.Error(w, "Unknown chunk_strategy: "+*req.ChunkStrategy, http.StatusBadRequest)
+			return
+		}
+
 		p, _ := filepath.Abs(req.Path)
 		info, err := os.Stat(p)
 		if err != nil || !info.IsDir() {
@@ -53,6 +61,7 @@ func VolumesRouter(db *storage.Database) chi.Router {
 		}
 
 		vol := storage.NewWatchedVolume(volID, p, label)
+		vol.ChunkStrategy = req.ChunkStrategy
 		if err := db.AddWatchedVolume(vol); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -61,7 +70,7 @@ func VolumesRouter(db *storage.Database) chi.Router {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(volumeResponse{
 			ID: vol.ID, Path: vol.Path, Label: vol.Label,
-			AddedAt: vol.AddedAt, LastScanAt: vol.LastScanAt,
+			AddedAt: vol.AddedAt, LastScanAt: vol.LastScanAt, ChunkStrategy: vol.ChunkStrategy,
 		})
 	})
 
@@ -75,7 +84,7 @@ func VolumesRouter(db *storage.Database) chi.Router {
 		for i, v := range vols {
 			resp[i] = volumeResponse{
 				ID: v.ID, Path: v.Path, Label: v.Label,
-				AddedAt: v.AddedAt, LastScanAt: v.LastScanAt,
+				AddedAt: v.AddedAt, LastScanAt: v.LastScanAt, ChunkStrategy: v.ChunkStrategy,
 			}
 		}
 		w.Header().Set("Content-Type", "application/json")
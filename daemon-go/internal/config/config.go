@@ -1,9 +1,14 @@
 package config
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 )
 
 type LMStudioConfig struct {
@@ -11,6 +16,34 @@ type LMStudioConfig struct {
 	Timeout           float64 `json:"timeout"`
 	MaxRetries        int     `json:"max_retries"`
 	EmbeddingBatchSize int    `json:"embedding_batch_size"`
+	VisionModel        string `json:"vision_model"`
+	TranscriptionModel string `json:"transcription_model"`
+	TranscriptionURL   string `json:"transcription_url"` // defaults to <base_url>/audio/transcriptions
+	RerankURL          string `json:"rerank_url"`   // defaults to <base_url>/rerank
+	RerankModel        string `json:"rerank_model"` // cross-encoder to request; empty uses the server's
+
+	// EmbeddingTokenizer and ChatTokenizer are paths to the models'
+	// tokenizer.json (or the directory holding it). Without them token
+	// counts are cl100k_base estimates. EmbeddingMaxTokens overrides the
+	// embedding model's max sequence length read from its tokenizer.
+	EmbeddingTokenizer string `json:"embedding_tokenizer,omitempty"`
+	ChatTokenizer      string `json:"chat_tokenizer,omitempty"`
+	EmbeddingMaxTokens int    `json:"embedding_max_tokens,omitempty"`
+
+	// EmbeddingTemplates adds or overrides the instructions embedding
+	// models expect around documents and queries, keyed by a substring of
+	// the model ID. QueryCacheSize is how many query embeddings are kept
+	// for repeated searches; 0 disables the cache.
+	EmbeddingTemplates map[string]EmbeddingTemplate `json:"embedding_templates,omitempty"`
+	QueryCacheSize     int                          `json:"query_cache_size"`
+}
+
+// EmbeddingTemplate wraps text before embedding. "{text}" marks where the
+// text goes; without it the template is a prefix, and "" leaves the text
+// as is.
+type EmbeddingTemplate struct {
+	Document string `json:"document"`
+	Query    string `json:"query"`
 }
 
 type PipelineConfig struct {
@@ -19,10 +52,45 @@ type PipelineConfig struct {
 	ChunkMinTokens          int    `json:"chunk_min_tokens"`
 	ChunkMaxTokens          int    `json:"chunk_max_tokens"`
 	ChunkOverlapTokens      int    `json:"chunk_overlap_tokens"`
+	ParentChunkMaxTokens    int    `json:"parent_chunk_max_tokens"` // 0 disables parent sections
 	MaxConcurrentExtractions int   `json:"max_concurrent_extractions"`
 	MaxConcurrentEmbeddings  int   `json:"max_concurrent_embeddings"`
 	MaxFileSizeBytes        int64  `json:"max_file_size_bytes"`
 	ScanBatchSize           int    `json:"scan_batch_size"`
+	VisionCaptions          bool   `json:"vision_captions"`
+	AudioTranscription      bool   `json:"audio_transcription"`
+	DICOMDeidentify         string `json:"dicom_deidentify"`
+	DICOMPseudonymSalt      string `json:"dicom_pseudonym_salt"`
+	ExtractCacheMaxBytes    int64  `json:"extract_cache_max_bytes"` // 0 disables the cache
+
+	// ChunkStrategy is "fixed" (greedy sentence packing) or "semantic"
+	// (split where adjacent sentence embeddings diverge).
+	// ChunkStrategyByType overrides it per file extension, e.g. {".md": "semantic"}.
+	ChunkStrategy                string            `json:"chunk_strategy"`
+	ChunkStrategyByType          map[string]string `json:"chunk_strategy_by_type,omitempty"`
+	SemanticBreakpointPercentile float64           `json:"semantic_breakpoint_percentile"`
+	SemanticWindowSentences      int               `json:"semantic_window_sentences"`
+
+	// Lines repeated in at least BoilerplateMinAtoms atoms and half the
+	// atoms of an asset (headers, footers, page numbers), or in
+	// BoilerplateVolumeAssets assets of a watched volume (disclaimers,
+	// signatures), are left out of chunks. 0 disables either check.
+	BoilerplateMinAtoms     int `json:"boilerplate_min_atoms"`
+	BoilerplateVolumeAssets int `json:"boilerplate_volume_assets"`
+}
+
+// VectorIndexConfig tunes the HNSW index used for vector search; see
+// storage.IndexParams. M 0 disables it.
+type VectorIndexConfig struct {
+	M              int `json:"m"`
+	EfConstruction int `json:"ef_construction"`
+	EfSearch       int `json:"ef_search"`
+	ExactBelow     int `json:"exact_below"` // collections smaller than this are searched exactly
+
+	// Quantization is "none" or "int8"; int8 holds a quarter of the bytes
+	// per vector and re-scores Rescore candidates per result in float32.
+	Quantization string `json:"quantization"`
+	Rescore      int    `json:"rescore"`
 }
 
 type SandboxConfig struct {
@@ -33,17 +101,33 @@ type SandboxConfig struct {
 	MaxRSSBytes       int64 `json:"max_rss_bytes"`
 }
 
+// PluginConfig declares an external extractor. The executable is run with
+// the asset path as its last argument and writes JSON atom records to stdout.
+type PluginConfig struct {
+	Name           string   `json:"name"`
+	Command        string   `json:"command"`
+	Args           []string `json:"args,omitempty"`
+	Globs          []string `json:"globs,omitempty"`
+	MimeTypes      []string `json:"mime_types,omitempty"`
+	Priority       int      `json:"priority"`
+	TimeoutSeconds int      `json:"timeout_seconds,omitempty"`
+	Version        string   `json:"version,omitempty"` // bump to invalidate cached extractions
+}
+
 type Config struct {
-	DataDir       string         `json:"data_dir"`
-	DBPath        string         `json:"db_path"`
-	VectorDir     string         `json:"vector_dir"`
-	ThumbnailsDir string         `json:"thumbnails_dir"`
-	TempDir       string         `json:"temp_dir"`
-	Host          string         `json:"host"`
-	Port          int            `json:"port"`
-	LMStudio      LMStudioConfig `json:"lm_studio"`
-	Pipeline      PipelineConfig `json:"pipeline"`
-	Sandbox       SandboxConfig  `json:"sandbox"`
+	DataDir       string            `json:"data_dir"`
+	DBPath        string            `json:"db_path"`
+	VectorDir     string            `json:"vector_dir"`
+	ThumbnailsDir string            `json:"thumbnails_dir"`
+	TempDir       string            `json:"temp_dir"`
+	CacheDir      string            `json:"cache_dir"`
+	Host          string            `json:"host"`
+	Port          int               `json:"port"`
+	LMStudio      LMStudioConfig    `json:"lm_studio"`
+	Pipeline      PipelineConfig    `json:"pipeline"`
+	Sandbox       SandboxConfig     `json:"sandbox"`
+	VectorIndex   VectorIndexConfig `json:"vector_index"`
+	Plugins       []PluginConfig    `json:"plugins,omitempty"`
 }
 
 func DefaultConfig() Config {
@@ -55,6 +139,7 @@ func DefaultConfig() Config {
 		VectorDir:     filepath.Join(dataDir, "vectors"),
 		ThumbnailsDir: filepath.Join(dataDir, "thumbnails"),
 		TempDir:       filepath.Join(dataDir, "tmp"),
+		CacheDir:      filepath.Join(dataDir, "extract_cache"),
 		Host:          "127.0.0.1",
 		Port:          8742,
 		LMStudio: LMStudioConfig{
@@ -62,6 +147,7 @@ func DefaultConfig() Config {
 			Timeout:           120.0,
 			MaxRetries:        3,
 			EmbeddingBatchSize: 32,
+			QueryCacheSize:     512,
 		},
 		Pipeline: PipelineConfig{
 			Version:                 "v1.0",
@@ -69,10 +155,20 @@ func DefaultConfig() Config {
 			ChunkMinTokens:          400,
 			ChunkMaxTokens:          800,
 			ChunkOverlapTokens:      50,
+			ParentChunkMaxTokens:    2000,
 			MaxConcurrentExtractions: 4,
 			MaxConcurrentEmbeddings:  2,
 			MaxFileSizeBytes:        500 * 1024 * 1024,
 			ScanBatchSize:           1000,
+			DICOMDeidentify:         "basic",
+			ExtractCacheMaxBytes:    1024 * 1024 * 1024,
+
+			ChunkStrategy:                "fixed",
+			SemanticBreakpointPercentile: 90,
+			SemanticWindowSentences:      1,
+
+			BoilerplateMinAtoms:     3,
+			BoilerplateVolumeAssets: 5,
 		},
 		Sandbox: SandboxConfig{
 			MaxOutputBytes:    100 * 1024 * 1024,
@@ -81,22 +177,109 @@ func DefaultConfig() Config {
 			MaxCPUSeconds:     300,
 			MaxRSSBytes:       2 * 1024 * 1024 * 1024,
 		},
+		VectorIndex: VectorIndexConfig{
+			M:              16,
+			EfConstruction: 200,
+			EfSearch:       64,
+			ExactBelow:     20000,
+			Quantization:   "none",
+			Rescore:        4,
+		},
 	}
 }
 
 func LoadConfig() Config {
 	cfg := DefaultConfig()
 
-	if dataDir := os.Getenv("KR_DATA_DIR"); dataDir != "" {
-		cfg.DataDir = dataDir
-		cfg.DBPath = filepath.Join(dataDir, "refinery.db")
-		cfg.VectorDir = filepath.Join(dataDir, "vectors")
-		cfg.ThumbnailsDir = filepath.Join(dataDir, "thumbnails")
-		cfg.TempDir = filepath.Join(dataDir, "tmp")
+	dataDir := os.Getenv("KR_DATA_DIR")
+	if dataDir != "" {
+		cfg.setDataDir(dataDir)
+	}
+	path := os.Getenv("KR_CONFIG")
+	if path == "" {
+		path = filepath.Join(cfg.DataDir, "config.json")
+	}
+	if err := cfg.loadFile(path); err != nil {
+		slog.Warn("Ignoring config file", "path", path, "error", err)
+	}
+	if dataDir != "" && cfg.DataDir != dataDir {
+		cfg.setDataDir(dataDir) // the environment wins over the file
 	}
 	if lmURL := os.Getenv("KR_LM_STUDIO_URL"); lmURL != "" {
 		cfg.LMStudio.BaseURL = lmURL
 	}
+	if v := os.Getenv("KR_VISION_CAPTIONS"); v != "" {
+		cfg.Pipeline.VisionCaptions, _ = strconv.ParseBool(v)
+	}
+	if vision := os.Getenv("KR_VISION_MODEL"); vision != "" {
+		cfg.LMStudio.VisionModel = vision
+		cfg.Pipeline.VisionCaptions = true
+	}
+	if v := os.Getenv("KR_AUDIO_TRANSCRIPTION"); v != "" {
+		cfg.Pipeline.AudioTranscription, _ = strconv.ParseBool(v)
+	}
+	if model := os.Getenv("KR_TRANSCRIPTION_MODEL"); model != "" {
+		cfg.LMStudio.TranscriptionModel = model
+		cfg.Pipeline.AudioTranscription = true
+	}
+	if url := os.Getenv("KR_TRANSCRIPTION_URL"); url != "" {
+		cfg.LMStudio.TranscriptionURL = url
+	}
+	if url := os.Getenv("KR_RERANK_URL"); url != "" {
+		cfg.LMStudio.RerankURL = url
+	}
+	if model := os.Getenv("KR_RERANK_MODEL"); model != "" {
+		cfg.LMStudio.RerankModel = model
+	}
+	if v := os.Getenv("KR_EMBEDDING_TOKENIZER"); v != "" {
+		cfg.LMStudio.EmbeddingTokenizer = v
+	}
+	if v := os.Getenv("KR_CHAT_TOKENIZER"); v != "" {
+		cfg.LMStudio.ChatTokenizer = v
+	}
+	if v := os.Getenv("KR_EMBEDDING_MAX_TOKENS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.LMStudio.EmbeddingMaxTokens = n
+		}
+	}
+	if v := os.Getenv("KR_QUERY_CACHE_SIZE"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.LMStudio.QueryCacheSize = n
+		}
+	}
+	if v := os.Getenv("KR_CHUNK_STRATEGY"); v != "" {
+		cfg.Pipeline.ChunkStrategy = v
+	}
+	if v := os.Getenv("KR_BOILERPLATE"); v != "" {
+		if on, err := strconv.ParseBool(v); err == nil && !on {
+			cfg.Pipeline.BoilerplateMinAtoms = 0
+			cfg.Pipeline.BoilerplateVolumeAssets = 0
+		}
+	}
+	if v := os.Getenv("KR_DICOM_DEIDENTIFY"); v != "" {
+		cfg.Pipeline.DICOMDeidentify = v
+	}
+	if v := os.Getenv("KR_DICOM_SALT"); v != "" {
+		cfg.Pipeline.DICOMPseudonymSalt = v
+	}
+	if v := os.Getenv("KR_EXTRACT_CACHE_MB"); v != "" {
+		if mb, err := strconv.ParseInt(v, 10, 64); err == nil {
+			cfg.Pipeline.ExtractCacheMaxBytes = mb * 1024 * 1024
+		}
+	}
+	if v := os.Getenv("KR_HNSW_M"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.VectorIndex.M = n
+		}
+	}
+	if v := os.Getenv("KR_VECTOR_QUANTIZATION"); v != "" {
+		cfg.VectorIndex.Quantization = v
+	}
+	if v := os.Getenv("KR_HNSW_EF_SEARCH"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.VectorIndex.EfSearch = n
+		}
+	}
 	if port := os.Getenv("KR_PORT"); port != "" {
 		if p, err := strconv.Atoi(port); err == nil {
 			cfg.Port = p
@@ -104,11 +287,58 @@ func LoadConfig() Config {
 	}
 
 	cfg.EnsureDirs()
+	if cfg.Pipeline.DICOMDeidentify == "pseudonymize" && cfg.Pipeline.DICOMPseudonymSalt == "" {
+		cfg.Pipeline.DICOMPseudonymSalt = loadOrCreateSalt(filepath.Join(cfg.DataDir, "dicom_salt"))
+	}
 	return cfg
 }
 
+// loadOrCreateSalt returns the secret stored at path, generating one on
+// first use so pseudonyms stay stable across restarts.
+func loadOrCreateSalt(path string) string {
+	if data, err := os.ReadFile(path); err == nil && len(data) > 0 {
+		return strings.TrimSpace(string(data))
+	}
+	buf := make([]byte, 32)
+	rand.Read(buf)
+	salt := hex.EncodeToString(buf)
+	os.WriteFile(path, []byte(salt), 0o600)
+	return salt
+}
+
+func (c *Config) setDataDir(dataDir string) {
+	c.DataDir = dataDir
+	c.DBPath = filepath.Join(dataDir, "refinery.db")
+	c.VectorDir = filepath.Join(dataDir, "vectors")
+	c.ThumbnailsDir = filepath.Join(dataDir, "thumbnails")
+	c.TempDir = filepath.Join(dataDir, "tmp")
+	c.CacheDir = filepath.Join(dataDir, "extract_cache")
+}
+
+// loadFile overlays a JSON config file onto c. A missing file is not an
+// error. Paths derived from data_dir follow it unless set explicitly.
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var probe struct {
+		DataDir string `json:"data_dir"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return err
+	}
+	if probe.DataDir != "" && probe.DataDir != c.DataDir {
+		c.setDataDir(probe.DataDir)
+	}
+	return json.Unmarshal(data, c)
+}
+
 func (c *Config) EnsureDirs() {
-	for _, d := range []string{c.DataDir, c.VectorDir, c.ThumbnailsDir, c.TempDir} {
+	for _, d := range []string{c.DataDir, c.VectorDir, c.ThumbnailsDir, c.TempDir, c.CacheDir} {
 		os.MkdirAll(d, 0o755)
 	}
 }
@@ -61,3 +61,30 @@ func TestEnsureDirs(t *testing.T) {
 		}
 	}
 }
+
+func TestLoadConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	path := dir + "/config.json"
+	os.WriteFile(path, []byte(`{
+		"port": 9000,
+		"plugins": [{"name": "lab", "command": "/usr/local/bin/lab2json", "globs": ["*.lab"], "priority": 30}]
+	}`), 0644)
+	t.Setenv("KR_DATA_DIR", dir)
+	t.Setenv("KR_CONFIG", path)
+	t.Setenv("KR_PORT", "")
+
+	cfg := LoadConfig()
+
+	if cfg.Port != 9000 {
+		t.Errorf("expected port from file, got %d", cfg.Port)
+	}
+	if cfg.LMStudio.BaseURL != "http://127.0.0.1:1234/v1" {
+		t.Errorf("expected defaults to survive, got %s", cfg.LMStudio.BaseURL)
+	}
+	if len(cfg.Plugins) != 1 || cfg.Plugins[0].Globs[0] != "*.lab" || cfg.Plugins[0].Priority != 30 {
+		t.Errorf("unexpected plugins: %+v", cfg.Plugins)
+	}
+	if cfg.DataDir != dir {
+		t.Errorf("expected data dir %s, got %s", dir, cfg.DataDir)
+	}
+}
@@ -0,0 +1,190 @@
+// Package language identifies the natural language of extracted text and
+// splits it into sentences by that language's rules.
+//
+// Detection is deliberately lightweight: the dominant Unicode script settles
+// most non-Latin languages, and Latin-script text is scored against short
+// stopword lists. Results are ISO 639-1 codes, or Undetermined when the
+// sample is too short or ambiguous.
+package language
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Undetermined is the ISO 639-2 code for text whose language is unknown.
+const Undetermined = "und"
+
+// minLetters is the smallest sample worth classifying.
+const minLetters = 20
+
+// Names maps supported codes to English language names, for prompts and UI.
+var Names = map[string]string{
+	"ar": "Arabic", "da": "Danish", "de": "German", "el": "Greek", "en": "English",
+	"es": "Spanish", "fa": "Persian", "fi": "Finnish", "fr": "French", "he": "Hebrew",
+	"hi": "Hindi", "it": "Italian", "ja": "Japanese", "ko": "Korean", "nl": "Dutch",
+	"no": "Norwegian", "pl": "Polish", "pt": "Portuguese", "ru": "Russian", "sv": "Swedish",
+	"th": "Thai", "tr": "Turkish", "uk": "Ukrainian", "zh": "Chinese",
+}
+
+// Name returns the English name for code, or the code itself.
+func Name(code string) string {
+	if n, ok := Names[code]; ok {
+		return n
+	}
+	return code
+}
+
+// IsCJK reports whether code is a language written without spaces between
+// words, where sentence splitting and token estimates need special care.
+func IsCJK(code string) bool {
+	return code == "zh" || code == "ja" || code == "th"
+}
+
+var stopwords = map[string][]string{
+	"en": {"the", "and", "of", "to", "is", "in", "that", "it", "with", "for", "was", "on", "are", "this", "be", "by", "not", "or", "have", "from"},
+	"de": {"der", "die", "und", "das", "ist", "nicht", "mit", "den", "ein", "eine", "zu", "von", "sich", "auf", "für", "dem", "des", "auch", "wird", "werden"},
+	"fr": {"le", "la", "les", "et", "des", "est", "une", "un", "du", "que", "pas", "pour", "dans", "qui", "sur", "avec", "sont", "au", "ce", "il"},
+	"es": {"el", "la", "los", "las", "y", "de", "que", "en", "es", "por", "una", "un", "del", "con", "para", "se", "no", "su", "como", "más"},
+	"it": {"il", "di", "che", "la", "e", "un", "una", "per", "non", "sono", "del", "della", "gli", "con", "le", "si", "è", "nel", "anche", "come"},
+	"pt": {"o", "a", "os", "as", "de", "que", "e", "do", "da", "em", "um", "uma", "para", "não", "com", "por", "se", "mais", "dos", "são"},
+	"nl": {"de", "het", "een", "en", "van", "is", "dat", "niet", "op", "te", "zijn", "met", "voor", "die", "er", "ook", "aan", "wordt", "bij", "maar"},
+	"sv": {"och", "att", "det", "som", "en", "är", "av", "för", "med", "till", "den", "inte", "har", "på", "om", "ett", "var", "jag", "de", "kan"},
+	"da": {"og", "at", "det", "er", "en", "til", "af", "på", "med", "for", "den", "ikke", "som", "har", "de", "et", "var", "om", "kan", "fra"},
+	"no": {"og", "i", "det", "er", "en", "til", "av", "på", "med", "for", "som", "ikke", "har", "de", "et", "var", "om", "kan", "fra", "jeg"},
+	"fi": {"ja", "on", "ei", "se", "että", "oli", "hän", "ovat", "kun", "mutta", "myös", "tai", "niin", "kuin", "joka", "sen", "ole", "tämä", "mitä", "vain"},
+	"pl": {"i", "w", "nie", "na", "się", "z", "jest", "że", "do", "to", "jak", "o", "ale", "co", "od", "po", "tak", "są", "dla", "przez"},
+	"tr": {"ve", "bir", "bu", "da", "de", "için", "ile", "olarak", "daha", "çok", "gibi", "olan", "ne", "ama", "en", "sonra", "kadar", "değil", "var", "mi"},
+}
+
+// stopwordSets is stopwords indexed for lookup.
+var stopwordSets = func() map[string]map[string]bool {
+	sets := make(map[string]map[string]bool, len(stopwords))
+	for lang, words := range stopwords {
+		set := make(map[string]bool, len(words))
+		for _, w := range words {
+			set[w] = true
+		}
+		sets[lang] = set
+	}
+	return sets
+}()
+
+// maxSample bounds how much text is inspected; the head of an atom is
+// representative enough and keeps detection cheap on large documents.
+const maxSample = 8192
+
+// Detect returns the ISO 639-1 code of text's dominant language.
+func Detect(text string) string {
+	if len(text) > maxSample {
+		text = text[:maxSample]
+	}
+
+	var letters, latin, han, kana, hangul, cyrillic, arabic, hebrew, greek, thai, devanagari int
+	var persian, ukrainian int
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		switch {
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		case unicode.Is(unicode.Hiragana, r), unicode.Is(unicode.Katakana, r):
+			kana++
+		case unicode.Is(unicode.Han, r):
+			han++
+		case unicode.Is(unicode.Hangul, r):
+			hangul++
+		case unicode.Is(unicode.Cyrillic, r):
+			cyrillic++
+			if strings.ContainsRune("іїєґІЇЄҐ", r) {
+				ukrainian++
+			}
+		case unicode.Is(unicode.Arabic, r):
+			arabic++
+			if strings.ContainsRune("پچژگک", r) {
+				persian++
+			}
+		case unicode.Is(unicode.Hebrew, r):
+			hebrew++
+		case unicode.Is(unicode.Greek, r):
+			greek++
+		case unicode.Is(unicode.Thai, r):
+			thai++
+		case unicode.Is(unicode.Devanagari, r):
+			devanagari++
+		}
+	}
+	if letters < minLetters {
+		return Undetermined
+	}
+
+	// Japanese mixes kana into Han text; any meaningful kana share means ja.
+	cjk := han + kana
+	switch {
+	case cjk*2 > letters:
+		if kana*10 > cjk {
+			return "ja"
+		}
+		return "zh"
+	case hangul*2 > letters:
+		return "ko"
+	case cyrillic*2 > letters:
+		if ukrainian*50 > cyrillic {
+			return "uk"
+		}
+		return "ru"
+	case arabic*2 > letters:
+		if persian*50 > arabic {
+			return "fa"
+		}
+		return "ar"
+	case hebrew*2 > letters:
+		return "he"
+	case greek*2 > letters:
+		return "el"
+	case thai*2 > letters:
+		return "th"
+	case devanagari*2 > letters:
+		return "hi"
+	case latin*2 > letters:
+		return detectLatin(text)
+	}
+	return Undetermined
+}
+
+// detectLatin scores Latin-script text by stopword hits per language.
+func detectLatin(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	})
+	if len(words) < 5 {
+		return Undetermined
+	}
+
+	scores := make(map[string]int)
+	for _, w := range words {
+		for lang, set := range stopwordSets {
+			if set[w] {
+				scores[lang]++
+			}
+		}
+	}
+
+	best, bestScore, second := Undetermined, 0, 0
+	for lang, s := range scores {
+		if s > bestScore || (s == bestScore && lang < best) {
+			second = bestScore
+			best, bestScore = lang, s
+		} else if s > second {
+			second = s
+		}
+	}
+	// Require stopwords to be a plausible share of the text and a clear
+	// winner; otherwise the sample is probably code, names or tables.
+	if bestScore*10 < len(words) || bestScore == second {
+		return Undetermined
+	}
+	return best
+}
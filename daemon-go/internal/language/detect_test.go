@@ -0,0 +1,39 @@
+package language
+
+import "testing"
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"english", "The quick brown fox jumps over the lazy dog and it is not afraid of the farmer.", "en"},
+		{"german", "Der schnelle braune Fuchs springt über den faulen Hund, und das ist nicht das erste Mal.", "de"},
+		{"french", "Le renard brun rapide saute par-dessus le chien paresseux et il est dans la cour avec les enfants.", "fr"},
+		{"spanish", "El zorro marrón rápido salta sobre el perro perezoso y no se detiene en la casa de los vecinos.", "es"},
+		{"japanese", "今日は天気がとても良いので、公園へ散歩に行きました。桜がきれいに咲いていました。", "ja"},
+		{"chinese", "今天天气很好，我们去公园散步。公园里的花都开了，非常漂亮，很多人在拍照。", "zh"},
+		{"korean", "오늘은 날씨가 매우 좋아서 공원에 산책을 갔습니다. 꽃이 아름답게 피어 있었습니다.", "ko"},
+		{"russian", "Быстрая коричневая лиса прыгает через ленивую собаку и убегает в тёмный лес.", "ru"},
+		{"ukrainian", "Швидка руда лисиця стрибає через лінивого собаку і тікає в темний ліс, де її ніхто не знайде.", "uk"},
+		{"too short", "Hello there", Undetermined},
+		{"numbers", "12345 67890 3.14159 2.71828 1.41421 1.73205", Undetermined},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Detect(tt.text); got != tt.want {
+				t.Errorf("Detect(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestName(t *testing.T) {
+	if got := Name("de"); got != "German" {
+		t.Errorf("Name(de) = %q", got)
+	}
+	if got := Name("xx"); got != "xx" {
+		t.Errorf("Name(xx) = %q, want code back", got)
+	}
+}
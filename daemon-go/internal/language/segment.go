@@ -0,0 +1,213 @@
+package language
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// abbreviations lists, per language, lowercased words that end with a
+// period without ending the sentence. Internal periods are kept ("e.g").
+var abbreviations = map[string][]string{
+	"en": {"mr", "mrs", "ms", "dr", "prof", "sr", "jr", "st", "vs", "e.g", "i.e", "cf", "approx", "inc", "ltd", "co", "corp", "dept", "est", "al", "ed", "eds", "u.s", "u.k", "a.m", "p.m", "jan", "feb", "mar", "apr", "jun", "jul", "aug", "sep", "sept", "oct", "nov", "dec"},
+	"de": {"z.b", "bzw", "usw", "ca", "dr", "prof", "str", "vgl", "evtl", "ggf", "d.h", "u.a", "s.o", "s.u", "inkl", "bzgl", "z.t", "hr", "fr", "geb", "jh", "mio", "mrd", "u.ä", "o.ä", "sog"},
+	"fr": {"m", "mm", "mme", "mlle", "dr", "pr", "cf", "p.ex", "env", "av", "bd", "st", "ste", "vol", "éd", "janv", "févr", "oct", "nov", "déc"},
+	"es": {"sr", "sra", "srta", "dr", "dra", "ud", "uds", "p.ej", "av", "ej", "aprox", "núm", "pág", "etc", "ee.uu"},
+	"it": {"sig", "sigg", "dott", "prof", "ing", "avv", "es", "pag", "ca", "ecc", "geom", "rag"},
+	"pt": {"sr", "sra", "dr", "dra", "prof", "ex", "av", "pág", "exmo", "exma", "v.ex", "lda"},
+	"nl": {"dhr", "mevr", "dr", "prof", "bijv", "bv", "o.a", "m.a.w", "d.w.z", "enz", "ca", "blz", "nl"},
+	"ru": {"т.е", "т.д", "т.п", "т.к", "г", "гг", "др", "им", "см", "стр", "ул", "проф", "тыс", "млн", "млрд", "руб", "коп"},
+	"uk": {"т.д", "т.п", "р", "рр", "див", "ім", "вул", "проф", "тис", "млн", "млрд", "грн"},
+	"pl": {"np", "tzn", "itd", "itp", "dr", "prof", "ul", "godz", "tys", "mln", "mld", "zł", "wg", "ok"},
+	"sv": {"t.ex", "bl.a", "d.v.s", "m.m", "o.s.v", "ca", "dr", "prof", "resp"},
+}
+
+// numberAbbreviations end with a period when a number follows, as in
+// "Fig. 3" or "S. 12", in any language.
+var numberAbbreviations = map[string]bool{
+	"no": true, "nr": true, "nos": true, "fig": true, "figs": true, "p": true, "pp": true, "s": true,
+	"vol": true, "art": true, "ch": true, "sec": true, "abs": true, "bd": true, "kap": true, "n": true, "№": true,
+}
+
+var abbreviationSets = func() map[string]map[string]bool {
+	sets := make(map[string]map[string]bool, len(abbreviations))
+	for lang, words := range abbreviations {
+		set := make(map[string]bool, len(words))
+		for _, w := range words {
+			set[w] = true
+		}
+		sets[lang] = set
+	}
+	return sets
+}()
+
+// fullWidthStops end a sentence without a following space (Chinese and
+// Japanese).
+const fullWidthStops = "。！？｡"
+
+// spacedStops end a sentence when followed by whitespace.
+const spacedStops = ".!?…؟۔।॥։።"
+
+// closers may follow a stop and belong to the sentence it ends.
+const closers = `"'”’)]}»」』）】〕〉》`
+
+// openers may precede an abbreviation, as in "(e.g.".
+const openers = `"'“‘([{«`
+
+// clauseBreaks separate clauses; the full-width ones need no space.
+const (
+	clauseBreaks          = ",;:"
+	fullWidthClauseBreaks = "，；：、"
+)
+
+// Sentences splits text into sentences with the rules for lang, an ISO
+// 639-1 code ("" or Undetermined uses the English abbreviations).
+//
+// A period ends a sentence only when whitespace follows and the next word
+// does not start in lowercase, and not after a known abbreviation, an
+// initial ("J. Smith"), a number abbreviation before a number ("Fig. 3"),
+// or a German ordinal ("am 3. Mai"). Full-width stops end a sentence
+// unless they close a quotation the sentence continues after, and a blank
+// line always does. Thai, which has no sentence punctuation, is split at
+// the spaces that separate its sentences.
+func Sentences(text, lang string) []string {
+	abbrevs := abbreviationSets[lang]
+	if abbrevs == nil {
+		abbrevs = abbreviationSets["en"]
+	}
+
+	var out []string
+	start := 0
+	emit := func(end int) {
+		if s := strings.TrimSpace(text[start:end]); s != "" {
+			out = append(out, s)
+		}
+		start = end
+	}
+
+	prev := rune(0)
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		switch {
+		case strings.ContainsRune(fullWidthStops, r):
+			end := skipRunes(text, i+size, fullWidthStops)
+			quoted := skipRunes(text, end, closers)
+			// A quoted sentence followed by more text, as in
+			// 「行きます。」と言った, does not end the enclosing one.
+			if quoted == end || quoted == len(text) || unicode.IsSpace(runeAt(text, quoted)) {
+				emit(quoted)
+			}
+			i, prev = quoted, r
+			continue
+
+		case strings.ContainsRune(spacedStops, r):
+			end := skipRunes(text, i+size, spacedStops+closers)
+			if endsSentence(text, start, i, end, lang, abbrevs) {
+				emit(end)
+			}
+			i, prev = end, r
+			continue
+
+		case r == '\n':
+			if j := skipRunes(text, i+size, " \t\r"); j < len(text) && text[j] == '\n' {
+				emit(i)
+			}
+
+		case lang == "th" && unicode.IsSpace(r) && unicode.Is(unicode.Thai, prev):
+			j := skipSpace(text, i)
+			if unicode.Is(unicode.Thai, runeAt(text, j)) {
+				emit(i)
+			}
+		}
+		i += size
+		prev = r
+	}
+	emit(len(text))
+	return out
+}
+
+// endsSentence decides whether the stop at text[stop:end] ends the
+// sentence that began at start.
+func endsSentence(text string, start, stop, end int, lang string, abbrevs map[string]bool) bool {
+	if end < len(text) && !unicode.IsSpace(runeAt(text, end)) {
+		return false // "3.14", "example.com", "?!" inside a word
+	}
+	next := runeAt(text, skipSpace(text, end))
+	if unicode.IsLower(next) {
+		return false
+	}
+	if text[stop] != '.' || end-stop > 1 && strings.Count(text[stop:end], ".") > 1 {
+		return true // "!", "?" or an ellipsis
+	}
+
+	word := text[start:stop]
+	if i := strings.LastIndexFunc(word, unicode.IsSpace); i >= 0 {
+		word = word[i+1:]
+	}
+	word = strings.ToLower(strings.TrimLeft(word, openers))
+	switch {
+	case word == "":
+		return true
+	case abbrevs[word]:
+		return false
+	case numberAbbreviations[word] && unicode.IsDigit(next):
+		return false
+	case utf8.RuneCountInString(word) == 1 && unicode.IsLetter([]rune(word)[0]):
+		return false // an initial
+	case lang == "de" && strings.TrimFunc(word, unicode.IsDigit) == "":
+		return false // an ordinal
+	}
+	return true
+}
+
+// Clauses splits a sentence after commas, semicolons and colons, for
+// sentences too long to keep whole.
+func Clauses(sentence string) []string {
+	var out []string
+	start := 0
+	for i, r := range sentence {
+		end := i + utf8.RuneLen(r)
+		split := strings.ContainsRune(fullWidthClauseBreaks, r)
+		if strings.ContainsRune(clauseBreaks, r) && end < len(sentence) {
+			split = unicode.IsSpace(runeAt(sentence, end))
+		}
+		if split {
+			if s := strings.TrimSpace(sentence[start:end]); s != "" {
+				out = append(out, s)
+			}
+			start = end
+		}
+	}
+	if s := strings.TrimSpace(sentence[start:]); s != "" {
+		out = append(out, s)
+	}
+	return out
+}
+
+// skipRunes returns the offset of the first rune at or after i not in set.
+func skipRunes(text string, i int, set string) int {
+	for i < len(text) {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if !strings.ContainsRune(set, r) {
+			break
+		}
+		i += size
+	}
+	return i
+}
+
+func runeAt(text string, i int) rune {
+	r, _ := utf8.DecodeRuneInString(text[i:])
+	return r
+}
+
+func skipSpace(text string, i int) int {
+	for i < len(text) {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if !unicode.IsSpace(r) {
+			break
+		}
+		i += size
+	}
+	return i
+}
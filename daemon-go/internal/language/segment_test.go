@@ -0,0 +1,52 @@
+package language
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSentences(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		lang string
+		want []string
+	}{
+		{"abbreviations", "Dr. Smith arrived at 3.30 p.m. yesterday. He brought tools, e.g. hammers. Then he left!",
+			"en", []string{"Dr. Smith arrived at 3.30 p.m. yesterday.", "He brought tools, e.g. hammers.", "Then he left!"}},
+		{"initials and numbers", "See Fig. 3 by J. Smith. The results are clear.",
+			"en", []string{"See Fig. 3 by J. Smith.", "The results are clear."}},
+		{"quotes and lowercase", `He said "Stop." Then he waited... and waited. Done?`,
+			"en", []string{`He said "Stop."`, "Then he waited... and waited.", "Done?"}},
+		{"german", "Wir treffen uns am 3. Mai, z.B. im Büro. Danach gibt es Kaffee.",
+			"de", []string{"Wir treffen uns am 3. Mai, z.B. im Büro.", "Danach gibt es Kaffee."}},
+		{"chinese", "今天天气很好。我们去公园散步！你来吗？",
+			"zh", []string{"今天天气很好。", "我们去公园散步！", "你来吗？"}},
+		{"japanese quote", "彼は「行きます。」と言った。明日は雨です。",
+			"ja", []string{"彼は「行きます。」と言った。", "明日は雨です。"}},
+		{"thai", "วันนี้อากาศดีมาก เราไปเดินเล่นที่สวน",
+			"th", []string{"วันนี้อากาศดีมาก", "เราไปเดินเล่นที่สวน"}},
+		{"blank line", "Introduction\n\nThe study covers three sites.",
+			"en", []string{"Introduction", "The study covers three sites."}},
+		{"hindi", "मैं घर जा रहा हूँ। कल मिलेंगे।",
+			"hi", []string{"मैं घर जा रहा हूँ।", "कल मिलेंगे।"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Sentences(tt.text, tt.lang); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Sentences = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClauses(t *testing.T) {
+	got := Clauses("First we measured, then we waited; finally: results, 3,5 units")
+	want := []string{"First we measured,", "then we waited;", "finally:", "results,", "3,5 units"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Clauses = %q, want %q", got, want)
+	}
+	if got := Clauses("我们测量了，然后等待；最后得到结果"); len(got) != 3 {
+		t.Errorf("full-width clauses = %q", got)
+	}
+}
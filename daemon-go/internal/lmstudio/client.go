@@ -2,32 +2,53 @@ package lmstudio
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log/slog"
+	"mime/multipart"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strings"
 	"time"
+	"unicode"
 )
 
 // Client communicates with LM Studio's OpenAI-compatible API.
 type Client struct {
-	baseURL       string // e.g. http://127.0.0.1:1234/v1
-	rootURL       string // e.g. http://127.0.0.1:1234 (for native API)
-	httpClient    *http.Client
-	contextLength *int // cached after first query
+	baseURL          string // e.g. http://127.0.0.1:1234/v1
+	rootURL          string // e.g. http://127.0.0.1:1234 (for native API)
+	transcriptionURL string // full URL of an OpenAI-compatible /audio/transcriptions endpoint
+	rerankURL        string // full URL of an OpenAI-compatible /rerank endpoint
+	rerankModel      string
+	httpClient       *http.Client
+	contextLength    *int                         // cached after first query
+	templates        map[string]EmbeddingTemplate // by lower-case model ID substring
+	queryCache       *queryCache
 }
 
 func NewClient(baseURL string, timeout float64) *Client {
 	root := strings.TrimRight(baseURL, "/")
 	root = strings.TrimSuffix(root, "/v1")
 	return &Client{
-		baseURL: baseURL,
-		rootURL: root,
+		baseURL:          baseURL,
+		rootURL:          root,
+		transcriptionURL: strings.TrimRight(baseURL, "/") + "/audio/transcriptions",
+		rerankURL:        strings.TrimRight(baseURL, "/") + "/rerank",
 		httpClient: &http.Client{
 			Timeout: time.Duration(timeout * float64(time.Second)),
 		},
+		queryCache: newQueryCache(defaultQueryCacheSize),
+	}
+}
+
+// SetTranscriptionURL points Transcribe at a separate server, such as a
+// local whisper server, instead of LM Studio itself.
+func (c *Client) SetTranscriptionURL(url string) {
+	if url != "" {
+		c.transcriptionURL = url
 	}
 }
 
@@ -61,6 +82,39 @@ func ChatMsg(role, content string) ChatMessage {
 	return ChatMessage{Role: role, Content: content}
 }
 
+// ContentPart is one element of a multimodal (OpenAI-style) message body.
+type ContentPart struct {
+	Type     string    `json:"type"`
+	Text     string    `json:"text,omitempty"`
+	ImageURL *ImageURL `json:"image_url,omitempty"`
+}
+
+// ImageURL carries an image reference, usually a base64 data URL.
+type ImageURL struct {
+	URL string `json:"url"`
+}
+
+// MultimodalMessage is a chat message whose content is a list of parts.
+type MultimodalMessage struct {
+	Role    string        `json:"role"`
+	Content []ContentPart `json:"content"`
+}
+
+// TranscriptionSegment is one timed span of a transcription, in seconds.
+type TranscriptionSegment struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+	Text  string  `json:"text"`
+}
+
+// Transcription is the verbose_json response of /audio/transcriptions.
+type Transcription struct {
+	Text     string                 `json:"text"`
+	Language string                 `json:"language"`
+	Duration float64                `json:"duration"`
+	Segments []TranscriptionSegment `json:"segments"`
+}
+
 type chatChoice struct {
 	Message ChatMessage `json:"message"`
 }
@@ -168,6 +222,9 @@ func (c *Client) GetEmbeddingModel() *string {
 	embedKeywords := []string{"embed", "e5", "bge", "gte", "nomic"}
 	for _, m := range models {
 		lower := strings.ToLower(m.ID)
+		if strings.Contains(lower, "rerank") {
+			continue // cross-encoders such as bge-reranker do not embed
+		}
 		for _, kw := range embedKeywords {
 			if strings.Contains(lower, kw) {
 				return &m.ID
@@ -203,6 +260,62 @@ func (c *Client) GetChatModel() *string {
 	return nil
 }
 
+// visionModelNames name vision-capable model families; "minicpm-v" means
+// the name tokens "minicpm" and "v" in sequence.
+var visionModelNames = []string{"vl", "vision", "llava", "pixtral", "moondream", "minicpm-v", "gemma-3", "internvl"}
+
+// GetVisionModel returns the first model whose ID suggests image input support.
+// Names are compared by whole tokens, so "codegemma-3b" is not "gemma-3".
+func (c *Client) GetVisionModel() *string {
+	models := c.ListModels()
+	for _, m := range models {
+		tokens := modelNameTokens(m.ID)
+		for _, name := range visionModelNames {
+			if hasNameTokens(tokens, modelNameTokens(name)) {
+				return &m.ID
+			}
+		}
+	}
+	return nil
+}
+
+// modelNameTokens splits a model ID into lower-case runs of letters and digits.
+func modelNameTokens(id string) []string {
+	return strings.FieldsFunc(strings.ToLower(id), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// hasNameTokens reports whether want occurs in tokens in sequence. A token
+// may carry a version after the wanted one, as "moondream2" for "moondream".
+func hasNameTokens(tokens, want []string) bool {
+	for i := 0; i+len(want) <= len(tokens); i++ {
+		match := true
+		for j, w := range want {
+			rest, ok := strings.CutPrefix(tokens[i+j], w)
+			if !ok || strings.TrimLeft(rest, "0123456789") != "" {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// GetTranscriptionModel returns the first speech-to-text model, if any.
+func (c *Client) GetTranscriptionModel() *string {
+	models := c.ListModels()
+	for _, m := range models {
+		if strings.Contains(strings.ToLower(m.ID), "whisper") {
+			return &m.ID
+		}
+	}
+	return nil
+}
+
 // Embed sends texts to the embedding endpoint and returns vectors.
 func (c *Client) Embed(texts []string, model *string) ([][]float64, error) {
 	if model == nil {
@@ -255,6 +368,15 @@ func (c *Client) EmbedSingle(text string, model *string) ([]float64, error) {
 
 // Chat sends messages to the chat completions endpoint.
 func (c *Client) Chat(messages []ChatMessage, model *string, temperature float64, maxTokens int) (string, error) {
+	return c.chatCompletion(messages, model, temperature, maxTokens)
+}
+
+// ChatMultimodal sends messages with text and image parts to the chat completions endpoint.
+func (c *Client) ChatMultimodal(messages []MultimodalMessage, model *string, temperature float64, maxTokens int) (string, error) {
+	return c.chatCompletion(messages, model, temperature, maxTokens)
+}
+
+func (c *Client) chatCompletion(messages any, model *string, temperature float64, maxTokens int) (string, error) {
 	if model == nil {
 		model = c.GetChatModel()
 	}
@@ -301,6 +423,114 @@ func (c *Client) Chat(messages []ChatMessage, model *string, temperature float64
 	return text, nil
 }
 
+// DescribeImage sends an image file with an instruction prompt to a vision-capable model.
+// The image is inlined as a base64 data URL, so it never leaves the local machine.
+func (c *Client) DescribeImage(imagePath, prompt string, model *string) (string, error) {
+	if model == nil {
+		model = c.GetVisionModel()
+	}
+	if model == nil {
+		return "", fmt.Errorf("no vision model available in LM Studio")
+	}
+
+	data, err := os.ReadFile(imagePath)
+	if err != nil {
+		return "", fmt.Errorf("read image: %w", err)
+	}
+	dataURL := fmt.Sprintf("data:%s;base64,%s", imageMimeType(imagePath), base64.StdEncoding.EncodeToString(data))
+
+	messages := []MultimodalMessage{{
+		Role: "user",
+		Content: []ContentPart{
+			{Type: "text", Text: prompt},
+			{Type: "image_url", ImageURL: &ImageURL{URL: dataURL}},
+		},
+	}}
+
+	raw, err := c.ChatMultimodal(messages, model, 0.1, 1024)
+	if err != nil {
+		return "", err
+	}
+	return stripCodeFences(raw), nil
+}
+
+// transcribeTimeout is far longer than the chat timeout: transcribing an
+// hour-long recording on a laptop takes minutes.
+const transcribeTimeout = 60 * time.Minute
+
+// Transcribe uploads an audio file to the transcription endpoint and returns
+// its timed segments. A response without segments is returned as a single
+// segment spanning the whole recording.
+func (c *Client) Transcribe(audioPath string, model *string) (*Transcription, error) {
+	if model == nil {
+		model = c.GetTranscriptionModel()
+	}
+	if model == nil {
+		return nil, fmt.Errorf("no transcription model available in LM Studio")
+	}
+
+	f, err := os.Open(audioPath)
+	if err != nil {
+		return nil, fmt.Errorf("open audio: %w", err)
+	}
+	defer f.Close()
+
+	// Stream the recording instead of buffering it: an hour of WAV is
+	// hundreds of megabytes.
+	pr, pw := io.Pipe()
+	defer pr.Close() // unblocks the writer if the request fails early
+	mw := multipart.NewWriter(pw)
+	go func() {
+		mw.WriteField("model", *model)
+		mw.WriteField("response_format", "verbose_json")
+		mw.WriteField("timestamp_granularities[]", "segment")
+		part, err := mw.CreateFormFile("file", filepath.Base(audioPath))
+		if err == nil {
+			if _, err = io.Copy(part, f); err != nil {
+				err = fmt.Errorf("read audio: %w", err)
+			}
+		}
+		if err == nil {
+			err = mw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	client := &http.Client{Timeout: transcribeTimeout}
+	resp, err := client.Post(c.transcriptionURL, mw.FormDataContentType(), pr)
+	if err != nil {
+		return nil, fmt.Errorf("transcription request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		b, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("transcription failed (status %d): %s", resp.StatusCode, string(b))
+	}
+
+	var result Transcription
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decode transcription: %w", err)
+	}
+	if len(result.Segments) == 0 && strings.TrimSpace(result.Text) != "" {
+		result.Segments = []TranscriptionSegment{{Start: 0, End: result.Duration, Text: result.Text}}
+	}
+	return &result, nil
+}
+
+func imageMimeType(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".png":
+		return "image/png"
+	case ".webp":
+		return "image/webp"
+	case ".gif":
+		return "image/gif"
+	default:
+		return "image/jpeg"
+	}
+}
+
 // AnnotateChunk sends a chunk to the LLM for annotation, with context-aware truncation.
 func (c *Client) AnnotateChunk(chunkText, promptTemplate string, model *string) (string, error) {
 	ctx := c.GetContextLength(model)
@@ -321,7 +551,11 @@ func (c *Client) AnnotateChunk(chunkText, promptTemplate string, model *string)
 		return "", err
 	}
 
-	// Strip markdown code fences
+	return stripCodeFences(raw), nil
+}
+
+// stripCodeFences removes markdown code fences around a model response.
+func stripCodeFences(raw string) string {
 	text := strings.TrimSpace(raw)
 	if strings.HasPrefix(text, "```") {
 		lines := strings.Split(text, "\n")
@@ -333,8 +567,7 @@ func (c *Client) AnnotateChunk(chunkText, promptTemplate string, model *string)
 		}
 		text = strings.TrimSpace(strings.Join(filtered, "\n"))
 	}
-
-	return text, nil
+	return text
 }
 
 func max(a, b int) int {
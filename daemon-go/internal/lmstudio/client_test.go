@@ -1,10 +1,17 @@
 package lmstudio
 
 import (
+	"bytes"
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+	"unicode/utf8"
 )
 
 func TestHealthCheckConnected(t *testing.T) {
@@ -199,3 +206,357 @@ func TestAnnotateChunkCodeFenceStripping(t *testing.T) {
 		t.Errorf("expected stripped JSON, got '%s'", result)
 	}
 }
+
+func TestDescribeImageSendsDataURL(t *testing.T) {
+	var gotParts []ContentPart
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/chat/completions" {
+			var body struct {
+				Messages []MultimodalMessage `json:"messages"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			if len(body.Messages) > 0 {
+				gotParts = body.Messages[0].Content
+			}
+			json.NewEncoder(w).Encode(chatResponse{
+				Choices: []chatChoice{
+					{Message: ChatMessage{Role: "assistant", Content: "```json\n{\"caption\": \"a cat\"}\n```"}},
+				},
+			})
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	imgPath := filepath.Join(t.TempDir(), "photo.png")
+	os.WriteFile(imgPath, []byte("fake-png"), 0644)
+
+	client := NewClient(srv.URL+"/v1", 10)
+	model := "qwen2.5-vl-7b"
+	result, err := client.DescribeImage(imgPath, "describe", &model)
+	if err != nil {
+		t.Fatalf("DescribeImage: %v", err)
+	}
+	if result != `{"caption": "a cat"}` {
+		t.Errorf("expected stripped JSON, got '%s'", result)
+	}
+	if len(gotParts) != 2 || gotParts[1].ImageURL == nil {
+		t.Fatalf("expected text and image parts, got %+v", gotParts)
+	}
+	if !strings.HasPrefix(gotParts[1].ImageURL.URL, "data:image/png;base64,") {
+		t.Errorf("unexpected image URL: %s", gotParts[1].ImageURL.URL)
+	}
+}
+
+func TestGetVisionModel(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(modelsResponse{
+			Data: []modelEntry{
+				{ID: "nomic-embed-text-v1.5", Object: "model"},
+				{ID: "codegemma-3b-instruct", Object: "model"},
+				{ID: "devlstral-small", Object: "model"},
+				{ID: "qwen2.5-vl-7b-instruct", Object: "model"},
+			},
+		})
+	}))
+	defer srv.Close()
+
+	client := NewClient(srv.URL+"/v1", 10)
+	model := client.GetVisionModel()
+	if model == nil || *model != "qwen2.5-vl-7b-instruct" {
+		t.Errorf("expected qwen2.5-vl-7b-instruct, got %v", model)
+	}
+}
+
+func TestVisionModelNames(t *testing.T) {
+	for id, want := range map[string]bool{
+		"qwen2.5-vl-7b-instruct":          true,
+		"llama-3.2-11b-vision-instruct":   true,
+		"google/gemma-3-12b-it":           true,
+		"moondream2":                      true,
+		"openbmb/MiniCPM-V-2_6":           true,
+		"llava-v1.6-mistral-7b":           true,
+		"codegemma-3b":                    false,
+		"gemma-2-9b-it":                   false,
+		"devlstral-small":                 false,
+		"minicpm3-4b":                     false,
+		"text-embedding-nomic-embed-v1.5": false,
+	} {
+		got := false
+		for _, name := range visionModelNames {
+			if hasNameTokens(modelNameTokens(id), modelNameTokens(name)) {
+				got = true
+			}
+		}
+		if got != want {
+			t.Errorf("%s: vision = %v, want %v", id, got, want)
+		}
+	}
+}
+
+func TestTranscribe(t *testing.T) {
+	audio := append([]byte("RIFF fake"), bytes.Repeat([]byte{0, 1, 2, 3}, 1<<18)...)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/whisper/v1/audio/transcriptions" {
+			http.NotFound(w, r)
+			return
+		}
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Fatalf("parse form: %v", err)
+		}
+		if r.FormValue("model") != "whisper-small" || r.FormValue("response_format") != "verbose_json" {
+			t.Errorf("unexpected form: %v", r.MultipartForm.Value)
+		}
+		f, hdr, err := r.FormFile("file")
+		if err != nil || hdr.Filename != "memo.wav" {
+			t.Fatalf("missing file part: %v", err)
+		}
+		data, _ := io.ReadAll(f)
+		f.Close()
+		if !bytes.Equal(data, audio) {
+			t.Errorf("uploaded %d bytes, expected the %d-byte recording", len(data), len(audio))
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"text":     "Hello there.",
+			"language": "english",
+			"duration": 2.5,
+			"segments": []map[string]any{{"id": 0, "start": 0.0, "end": 2.5, "text": " Hello there."}},
+		})
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "memo.wav")
+	os.WriteFile(path, audio, 0644)
+
+	client := NewClient("http://127.0.0.1:1/v1", 1)
+	client.SetTranscriptionURL(srv.URL + "/whisper/v1/audio/transcriptions")
+	model := "whisper-small"
+	tr, err := client.Transcribe(path, &model)
+	if err != nil {
+		t.Fatalf("Transcribe: %v", err)
+	}
+	if len(tr.Segments) != 1 || tr.Segments[0].End != 2.5 || tr.Language != "english" {
+		t.Errorf("unexpected transcription: %+v", tr)
+	}
+}
+
+func TestEmbeddingTemplates(t *testing.T) {
+	client := NewClient("http://127.0.0.1:1/v1", 1)
+
+	nomic := client.EmbeddingTemplate("text-embedding-nomic-embed-text-v1.5@q8_0")
+	if got := nomic.FormatDocument("notes"); got != "search_document: notes" {
+		t.Errorf("nomic document = %q", got)
+	}
+	if got := nomic.FormatQuery("budget"); got != "search_query: budget" {
+		t.Errorf("nomic query = %q", got)
+	}
+	if got := client.EmbeddingTemplate("BGE-M3"); !got.IsZero() {
+		t.Errorf("bge-m3 needs no template, got %+v", got)
+	}
+	if got := client.EmbeddingTemplate("bge-small-en-v1.5").FormatDocument("notes"); got != "notes" {
+		t.Errorf("bge documents are embedded as is, got %q", got)
+	}
+	if got := client.EmbeddingTemplate("unknown-embed"); !got.IsZero() {
+		t.Errorf("unknown models need no template, got %+v", got)
+	}
+	if ns := client.EmbeddingNamespace("unknown-embed"); ns != "unknown-embed" {
+		t.Errorf("namespace without template = %q", ns)
+	}
+	ns := client.EmbeddingNamespace("nomic-embed-text-v1.5")
+	if model, templated := NamespaceModel(ns); model != "nomic-embed-text-v1.5" || !templated {
+		t.Errorf("namespace %q parsed as %q, %v", ns, model, templated)
+	}
+
+	// Configured templates win, the longest match first; an empty one
+	// switches the built-in off
+	client.SetEmbeddingTemplates(map[string]EmbeddingTemplate{
+		"Nomic-Embed":         {},
+		"nomic-embed-text-v2": {Document: "doc: ", Query: "<q>{text}</q>"},
+	})
+	if got := client.EmbeddingTemplate("nomic-embed-text-v1.5"); !got.IsZero() {
+		t.Errorf("expected the built-in switched off, got %+v", got)
+	}
+	v2 := client.EmbeddingTemplate("nomic-embed-text-v2-moe")
+	if got := v2.FormatDocument("notes") + v2.FormatQuery("budget"); got != "doc: notes<q>budget</q>" {
+		t.Errorf("configured template gave %q", got)
+	}
+	if changed := client.EmbeddingNamespace("nomic-embed-text-v1.5"); changed == ns {
+		t.Error("changing the template should change the namespace")
+	}
+}
+
+func TestEmbedQueryTemplateAndCache(t *testing.T) {
+	type embeddingsRequest struct {
+		Model string   `json:"model"`
+		Input []string `json:"input"`
+	}
+	var requests []embeddingsRequest
+	loaded, modelLookups := "test-embed", 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/models" {
+			modelLookups++
+			json.NewEncoder(w).Encode(modelsResponse{Data: []modelEntry{{ID: loaded, Object: "model"}}})
+			return
+		}
+		var req embeddingsRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		requests = append(requests, req)
+		data := make([]embeddingItem, len(req.Input))
+		for i, text := range req.Input {
+			data[i] = embeddingItem{Embedding: []float64{float64(len(text))}}
+		}
+		json.NewEncoder(w).Encode(embeddingsResponse{Data: data})
+	}))
+	defer srv.Close()
+
+	client := NewClient(srv.URL+"/v1", 10)
+	client.SetQueryCacheSize(2)
+	if _, err := client.EmbedDocuments([]string{"a", "b"}, "nomic-embed-text-v1.5"); err != nil {
+		t.Fatalf("EmbedDocuments: %v", err)
+	}
+	if in := requests[0].Input; in[0] != "search_document: a" || in[1] != "search_document: b" {
+		t.Errorf("documents sent as %q", in)
+	}
+
+	// A templated namespace gets the query template; a bare one and the
+	// legacy namespace get the raw text
+	templated := client.EmbeddingNamespace("nomic-embed-text-v1.5")
+	for _, tc := range []struct{ namespace, model, input string }{
+		{templated, "nomic-embed-text-v1.5", "search_query: budget"},
+		{"nomic-embed-text-v1.5", "nomic-embed-text-v1.5", "budget"},
+		{"", "test-embed", "budget"},
+	} {
+		requests = nil
+		if _, err := client.EmbedQuery("budget", tc.namespace); err != nil {
+			t.Fatalf("EmbedQuery: %v", err)
+		}
+		if len(requests) != 1 || requests[0].Model != tc.model || requests[0].Input[0] != tc.input {
+			t.Errorf("namespace %q: sent %+v, want %q with %q", tc.namespace, requests, tc.input, tc.model)
+		}
+	}
+
+	// The two most recent queries are cached; the oldest was evicted
+	requests = nil
+	client.EmbedQuery("budget", "")
+	client.EmbedQuery("budget", "nomic-embed-text-v1.5")
+	if len(requests) != 0 {
+		t.Errorf("expected cached queries, got %d requests", len(requests))
+	}
+	client.EmbedQuery("budget", templated)
+	if len(requests) != 1 {
+		t.Errorf("expected the evicted query re-embedded, got %d requests", len(requests))
+	}
+
+	// Cached legacy queries do not ask LM Studio for its model each time
+	modelLookups = 0
+	client.EmbedQuery("budget", "")
+	if modelLookups != 0 {
+		t.Errorf("expected the legacy model remembered, got %d lookups", modelLookups)
+	}
+
+	// Once it is looked up again, the legacy namespace follows the loaded
+	// model, so a cached vector of the previous model is not reused
+	requests, loaded = nil, "other-embed"
+	client.queryCache.legacyAt = time.Time{}
+	client.EmbedQuery("budget", "")
+	if len(requests) != 1 || requests[0].Model != "other-embed" {
+		t.Errorf("expected the query re-embedded with the new model, got %+v", requests)
+	}
+
+	client.SetQueryCacheSize(0)
+	if n := client.queryCache.len(); n != 0 {
+		t.Errorf("expected an empty cache, has %d", n)
+	}
+	requests = nil
+	client.EmbedQuery("budget", "")
+	client.EmbedQuery("budget", "")
+	if len(requests) != 2 {
+		t.Errorf("expected no caching at size 0, got %d requests", len(requests))
+	}
+}
+
+func TestRerank(t *testing.T) {
+	var req map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rerank" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		// Results come back best first, not in document order
+		json.NewEncoder(w).Encode(rerankResponse{Results: []rerankResult{
+			{Index: 1, RelevanceScore: 0.9}, {Index: 0, RelevanceScore: 0.2},
+		}})
+	}))
+	defer srv.Close()
+
+	client := NewClient("http://127.0.0.1:1/v1", 10)
+	client.SetRerankEndpoint(srv.URL+"/rerank", "bge-reranker-v2-m3")
+	scores, err := client.Rerank("pump error", []string{"budget", "pump manual"})
+	if err != nil {
+		t.Fatalf("Rerank: %v", err)
+	}
+	if len(scores) != 2 || scores[0] != 0.2 || scores[1] != 0.9 {
+		t.Errorf("expected scores in document order, got %v", scores)
+	}
+	if req["model"] != "bge-reranker-v2-m3" || req["query"] != "pump error" {
+		t.Errorf("unexpected request %v", req)
+	}
+}
+
+func TestScoreRelevance(t *testing.T) {
+	var prompts []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Messages []ChatMessage `json:"messages"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		prompt := req.Messages[1].Content
+		prompts = append(prompts, prompt)
+		// Rate each passage by its number, fenced like many models answer
+		ratings := make([]int, strings.Count(prompt, "Passage "))
+		for i := range ratings {
+			ratings[i] = i
+		}
+		b, _ := json.Marshal(ratings)
+		json.NewEncoder(w).Encode(chatResponse{Choices: []chatChoice{
+			{Message: ChatMessage{Role: "assistant", Content: "```json\n" + string(b) + "\n```"}},
+		}})
+	}))
+	defer srv.Close()
+
+	client := NewClient(srv.URL+"/v1", 10)
+	docs := make([]string, 12)
+	for i := range docs {
+		docs[i] = "passage text"
+	}
+	model := "test-chat"
+	scores, err := client.ScoreRelevance("pump error", docs, &model)
+	if err != nil {
+		t.Fatalf("ScoreRelevance: %v", err)
+	}
+	if len(prompts) != 2 || !strings.HasPrefix(prompts[0], "Query: pump error\n") {
+		t.Fatalf("expected two batched prompts, got %q", prompts)
+	}
+	if len(scores) != 12 || scores[9] != 9 || scores[10] != 0 || scores[11] != 1 {
+		t.Errorf("unexpected scores %v", scores)
+	}
+
+	// Long passages are cut between runes, not inside one
+	prompts = nil
+	long := "a" + strings.Repeat("é", 1000)
+	if _, err := client.ScoreRelevance("pump error", []string{long}, &model); err != nil {
+		t.Fatalf("ScoreRelevance: %v", err)
+	}
+	if len(prompts) != 1 || strings.ContainsRune(prompts[0], utf8.RuneError) || strings.Contains(prompts[0], long) {
+		t.Errorf("expected the passage truncated on a rune boundary, got %q", prompts)
+	}
+
+	if _, err := parseRatings("[1, 2]", 3); err == nil {
+		t.Error("expected an error when passages are left unrated")
+	}
+	if _, err := parseRatings("I cannot rate these.", 1); err == nil {
+		t.Error("expected an error without ratings")
+	}
+}
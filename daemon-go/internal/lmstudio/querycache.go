@@ -0,0 +1,110 @@
+package lmstudio
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// defaultQueryCacheSize is how many query embeddings are kept unless
+// SetQueryCacheSize says otherwise.
+const defaultQueryCacheSize = 512
+
+// queryCache keeps the embeddings of recent search queries, least
+// recently used first out, so repeated and typeahead queries skip the
+// round trip to LM Studio.
+type queryCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List // front is most recently used
+	entries map[string]*list.Element
+
+	// The model embedding queries of the legacy namespace, and when LM
+	// Studio was last asked for it
+	legacy   string
+	legacyAt time.Time
+}
+
+// legacyModelTTL is how long the model for legacy-namespace queries is
+// remembered, so cached queries need no round trip to LM Studio while a
+// change of model is still noticed soon.
+const legacyModelTTL = 30 * time.Second
+
+type queryCacheEntry struct {
+	key    string
+	vector []float64
+}
+
+func newQueryCache(size int) *queryCache {
+	return &queryCache{size: size, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+func (q *queryCache) get(key string) ([]float64, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	el, ok := q.entries[key]
+	if !ok {
+		return nil, false
+	}
+	q.order.MoveToFront(el)
+	return el.Value.(*queryCacheEntry).vector, true
+}
+
+func (q *queryCache) put(key string, vector []float64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.size <= 0 {
+		return
+	}
+	if el, ok := q.entries[key]; ok {
+		el.Value.(*queryCacheEntry).vector = vector
+		q.order.MoveToFront(el)
+		return
+	}
+	q.entries[key] = q.order.PushFront(&queryCacheEntry{key: key, vector: vector})
+	q.evict()
+}
+
+// evict drops the least recently used entries beyond the size limit.
+func (q *queryCache) evict() {
+	for q.order.Len() > q.size {
+		el := q.order.Back()
+		q.order.Remove(el)
+		delete(q.entries, el.Value.(*queryCacheEntry).key)
+	}
+}
+
+// legacyModel returns the model for legacy-namespace queries, asking
+// resolve when the remembered one is older than legacyModelTTL.
+func (q *queryCache) legacyModel(resolve func() *string) *string {
+	q.mu.Lock()
+	if q.legacy != "" && time.Since(q.legacyAt) < legacyModelTTL {
+		model := q.legacy
+		q.mu.Unlock()
+		return &model
+	}
+	q.mu.Unlock()
+
+	model := resolve()
+	if model != nil {
+		q.mu.Lock()
+		q.legacy, q.legacyAt = *model, time.Now()
+		q.mu.Unlock()
+	}
+	return model
+}
+
+func (q *queryCache) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.order.Len()
+}
+
+// SetQueryCacheSize sets how many query embeddings EmbedQuery keeps; 0
+// turns the cache off.
+func (c *Client) SetQueryCacheSize(n int) {
+	c.queryCache.mu.Lock()
+	defer c.queryCache.mu.Unlock()
+	c.queryCache.size = n
+	c.queryCache.evict()
+}
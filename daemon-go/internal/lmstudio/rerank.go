@@ -0,0 +1,143 @@
+package lmstudio
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// SetRerankEndpoint points Rerank at an OpenAI-compatible /rerank endpoint,
+// such as a llama.cpp or infinity server running a cross-encoder, and names
+// the model to request from it. An empty url keeps <base_url>/rerank; an
+// empty model lets the server use the one it has loaded.
+func (c *Client) SetRerankEndpoint(url, model string) {
+	if url != "" {
+		c.rerankURL = url
+	}
+	c.rerankModel = model
+}
+
+type rerankResult struct {
+	Index          int     `json:"index"`
+	RelevanceScore float64 `json:"relevance_score"`
+}
+
+type rerankResponse struct {
+	Results []rerankResult `json:"results"`
+}
+
+// Rerank scores how well each document answers query with a cross-encoder.
+// The scores are in document order, higher is more relevant.
+func (c *Client) Rerank(query string, documents []string) ([]float64, error) {
+	if len(documents) == 0 {
+		return nil, nil
+	}
+	body := map[string]any{
+		"query":     query,
+		"documents": documents,
+		"top_n":     len(documents),
+	}
+	if c.rerankModel != "" {
+		body["model"] = c.rerankModel
+	}
+	payload, _ := json.Marshal(body)
+
+	resp, err := c.httpClient.Post(c.rerankURL, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("rerank request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		b, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("rerank failed (status %d): %s", resp.StatusCode, string(b))
+	}
+
+	var result rerankResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decode rerank response: %w", err)
+	}
+	if len(result.Results) != len(documents) {
+		return nil, fmt.Errorf("rerank returned %d scores for %d documents", len(result.Results), len(documents))
+	}
+	scores := make([]float64, len(documents))
+	for _, r := range result.Results {
+		if r.Index < 0 || r.Index >= len(documents) {
+			return nil, fmt.Errorf("rerank returned index %d for %d documents", r.Index, len(documents))
+		}
+		scores[r.Index] = r.RelevanceScore
+	}
+	return scores, nil
+}
+
+const relevancePrompt = `You judge search results. Rate how relevant each numbered passage is to the search query, from 0 (unrelated) to 10 (answers it directly).
+Respond with only a JSON array of the ratings in passage order, e.g. [7, 0, 3].`
+
+// relevanceBatch is how many passages one relevance prompt rates.
+const relevanceBatch = 10
+
+// ScoreRelevance rates how well each document answers query by asking the
+// chat model, as a reranker when no cross-encoder is available. The scores
+// are in document order, from 0 to 10.
+func (c *Client) ScoreRelevance(query string, documents []string, model *string) ([]float64, error) {
+	if model == nil {
+		model = c.GetChatModel()
+	}
+	if model == nil {
+		return nil, fmt.Errorf("no chat model available in LM Studio")
+	}
+	ctx := c.GetContextLength(model)
+	maxPassageBytes := min(1500, max(200, (ctx-1000)*3/relevanceBatch))
+
+	scores := make([]float64, 0, len(documents))
+	for start := 0; start < len(documents); start += relevanceBatch {
+		batch := documents[start:min(start+relevanceBatch, len(documents))]
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "Query: %s\n", query)
+		for i, doc := range batch {
+			if len(doc) > maxPassageBytes {
+				// Cut at a rune boundary so the prompt stays valid UTF-8
+				cut := maxPassageBytes
+				for cut > 0 && !utf8.RuneStart(doc[cut]) {
+					cut--
+				}
+				doc = doc[:cut]
+			}
+			fmt.Fprintf(&sb, "\nPassage %d:\n%s\n", i+1, doc)
+		}
+
+		raw, err := c.Chat([]ChatMessage{
+			{Role: "system", Content: relevancePrompt},
+			{Role: "user", Content: sb.String()},
+		}, model, 0, 256)
+		if err != nil {
+			return nil, err
+		}
+		ratings, err := parseRatings(raw, len(batch))
+		if err != nil {
+			return nil, err
+		}
+		scores = append(scores, ratings...)
+	}
+	return scores, nil
+}
+
+// parseRatings reads the JSON array of n ratings from a model response.
+func parseRatings(raw string, n int) ([]float64, error) {
+	text := stripCodeFences(raw)
+	start, end := strings.Index(text, "["), strings.LastIndex(text, "]")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("no ratings in relevance response: %q", raw)
+	}
+	var ratings []float64
+	if err := json.Unmarshal([]byte(text[start:end+1]), &ratings); err != nil {
+		return nil, fmt.Errorf("decode relevance ratings: %w", err)
+	}
+	if len(ratings) != n {
+		return nil, fmt.Errorf("relevance response rated %d of %d passages", len(ratings), n)
+	}
+	return ratings, nil
+}
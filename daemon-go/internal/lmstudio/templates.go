@@ -0,0 +1,178 @@
+package lmstudio
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// EmbeddingTemplate is the instruction an embedding model expects around
+// text it embeds for storage (Document) and for searching (Query).
+// "{text}" marks where the text goes; a template without it is a prefix,
+// and an empty template leaves the text as is.
+type EmbeddingTemplate struct {
+	Document string
+	Query    string
+}
+
+// IsZero reports whether the template leaves all text unchanged.
+func (t EmbeddingTemplate) IsZero() bool {
+	return isIdentity(t.Document) && isIdentity(t.Query)
+}
+
+func isIdentity(tmpl string) bool {
+	return tmpl == "" || tmpl == "{text}"
+}
+
+func applyTemplate(tmpl, text string) string {
+	if strings.Contains(tmpl, "{text}") {
+		return strings.ReplaceAll(tmpl, "{text}", text)
+	}
+	return tmpl + text
+}
+
+// FormatDocument returns text as the model should see it for storage.
+func (t EmbeddingTemplate) FormatDocument(text string) string {
+	return applyTemplate(t.Document, text)
+}
+
+// FormatQuery returns text as the model should see it for searching.
+func (t EmbeddingTemplate) FormatQuery(text string) string {
+	return applyTemplate(t.Query, text)
+}
+
+const searchPassagesInstruction = "Represent this sentence for searching relevant passages: {text}"
+
+// builtinTemplates are the instructions published with common embedding
+// models, matched as case-insensitive substrings of the model ID in order.
+var builtinTemplates = []struct {
+	match    string
+	template EmbeddingTemplate
+}{
+	{"nomic-embed-text", EmbeddingTemplate{Document: "search_document: {text}", Query: "search_query: {text}"}},
+	{"e5-", EmbeddingTemplate{Document: "passage: {text}", Query: "query: {text}"}},
+	{"bge-m3", EmbeddingTemplate{}},
+	{"bge-", EmbeddingTemplate{Query: searchPassagesInstruction}},
+	{"mxbai-embed", EmbeddingTemplate{Query: searchPassagesInstruction}},
+	{"snowflake-arctic-embed", EmbeddingTemplate{Query: searchPassagesInstruction}},
+	{"qwen3-embedding", EmbeddingTemplate{
+		Query: "Instruct: Given a web search query, retrieve relevant passages that answer the query\nQuery:{text}",
+	}},
+}
+
+// SetEmbeddingTemplates adds templates for models whose ID contains the
+// key (case-insensitive), taking precedence over the built-in ones. An
+// empty template switches a built-in one off.
+func (c *Client) SetEmbeddingTemplates(templates map[string]EmbeddingTemplate) {
+	c.templates = make(map[string]EmbeddingTemplate, len(templates))
+	for match, t := range templates {
+		c.templates[strings.ToLower(match)] = t
+	}
+}
+
+// EmbeddingTemplate returns the template for an embedding model. Among
+// configured templates the longest matching key wins.
+func (c *Client) EmbeddingTemplate(model string) EmbeddingTemplate {
+	id := strings.ToLower(model)
+	best, found := "", false
+	for match := range c.templates {
+		if strings.Contains(id, match) && (!found || len(match) > len(best)) {
+			best, found = match, true
+		}
+	}
+	if found {
+		return c.templates[best]
+	}
+	for _, b := range builtinTemplates {
+		if strings.Contains(id, b.match) {
+			return b.template
+		}
+	}
+	return EmbeddingTemplate{}
+}
+
+// namespaceSep separates the model ID from the template tag in a
+// namespace. LM Studio model IDs use "@" for variants, not "#".
+const namespaceSep = "#"
+
+// EmbeddingNamespace names the vectors a model produces with its current
+// template: the model ID, tagged with a hash of the template if it has
+// one, so vectors embedded with different instructions are kept apart.
+func (c *Client) EmbeddingNamespace(model string) string {
+	t := c.EmbeddingTemplate(model)
+	if t.IsZero() {
+		return model
+	}
+	sum := sha256.Sum256([]byte(t.Document + "\x00" + t.Query))
+	return model + namespaceSep + hex.EncodeToString(sum[:4])
+}
+
+// NamespaceModel returns the model ID of a namespace and whether its
+// vectors were embedded with a template.
+func NamespaceModel(namespace string) (model string, templated bool) {
+	model, _, templated = strings.Cut(namespace, namespaceSep)
+	return model, templated
+}
+
+// EmbedDocuments embeds texts for storage with model's document template.
+func (c *Client) EmbedDocuments(texts []string, model string) ([][]float64, error) {
+	t := c.EmbeddingTemplate(model)
+	if !isIdentity(t.Document) {
+		formatted := make([]string, len(texts))
+		for i, text := range texts {
+			formatted[i] = t.FormatDocument(text)
+		}
+		texts = formatted
+	}
+	return c.Embed(texts, &model)
+}
+
+// EmbedQuery embeds a search query for comparison with the vectors of a
+// namespace: with the model's query template if the namespace's vectors
+// were embedded with a template, as is otherwise. "" is the namespace of
+// vectors stored before models were recorded, searched with the current
+// embedding model. Recent queries are answered from a cache.
+func (c *Client) EmbedQuery(text, namespace string) ([]float64, error) {
+	var model *string
+	input := text
+	if namespace == "" {
+		// Key the cache by the current model, so a query is not answered
+		// with a vector from the model loaded before it. The raw text with
+		// that model is also what its untemplated namespace would embed.
+		if model = c.queryCache.legacyModel(c.GetEmbeddingModel); model == nil {
+			return nil, fmt.Errorf("no embedding model available in LM Studio")
+		}
+		namespace = *model
+	} else {
+		id, templated := NamespaceModel(namespace)
+		model = &id
+		if templated {
+			input = c.EmbeddingTemplate(id).FormatQuery(text)
+		}
+	}
+	key := namespace + "\x00" + text
+	if vec, ok := c.queryCache.get(key); ok {
+		return vec, nil
+	}
+	vec, err := c.EmbedSingle(input, model)
+	if err != nil {
+		return nil, err
+	}
+	c.queryCache.put(key, vec)
+	return vec, nil
+}
+
+// EmbedNamespaceDocuments embeds texts as documents comparable with the
+// vectors of a namespace, with the model's document template if the
+// namespace has one; see EmbedQuery.
+func (c *Client) EmbedNamespaceDocuments(texts []string, namespace string) ([][]float64, error) {
+	if namespace == "" {
+		return c.Embed(texts, nil)
+	}
+	model, templated := NamespaceModel(namespace)
+	if !templated {
+		return c.Embed(texts, &model)
+	}
+	return c.EmbedDocuments(texts, model)
+}
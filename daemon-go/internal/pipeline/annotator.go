@@ -6,8 +6,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"slices"
 	"time"
 
+	"github.com/oho/knowledge-refinery-daemon/internal/language"
 	"github.com/oho/knowledge-refinery-daemon/internal/lmstudio"
 	"github.com/oho/knowledge-refinery-daemon/internal/storage"
 )
@@ -34,6 +36,7 @@ type Annotator struct {
 	pipelineVersion string
 	prompt          string
 	model           *string
+	truncated       func(text string) bool // flags chunks the embedding model cut off
 }
 
 func NewAnnotator(lm *lmstudio.Client, db *storage.Database, pipelineVersion string) *Annotator {
@@ -69,9 +72,10 @@ func (a *Annotator) AnnotateChunk(chunk storage.Chunk, maxRetries int) *storage.
 		}
 	}
 
+	prompt := a.promptFor(chunk)
 	var parsed annotationJSON
 	for attempt := 0; attempt < maxRetries; attempt++ {
-		response, err := a.lm.AnnotateChunk(chunk.ChunkText, a.prompt, a.model)
+		response, err := a.lm.AnnotateChunk(chunk.ChunkText, prompt, a.model)
 		if err != nil {
 			wait := time.Duration(5*(attempt+1)) * time.Second
 			slog.Warn("Annotation attempt failed",
@@ -100,6 +104,9 @@ func (a *Annotator) AnnotateChunk(chunk storage.Chunk, maxRetries int) *storage.
 	topicsJSON, _ := json.Marshal(parsed.Topics)
 	entitiesJSON, _ := json.Marshal(parsed.Entities)
 	claimsJSON, _ := json.Marshal(parsed.Claims)
+	if a.truncated != nil && a.truncated(chunk.ChunkText) && !slices.Contains(parsed.QualityFlags, QualityEmbeddingTruncated) {
+		parsed.QualityFlags = append(parsed.QualityFlags, QualityEmbeddingTruncated)
+	}
 	qualityJSON, _ := json.Marshal(parsed.QualityFlags)
 
 	topicsStr := string(topicsJSON)
@@ -138,6 +145,16 @@ func (a *Annotator) AnnotateChunk(chunk storage.Chunk, maxRetries int) *storage.
 	}
 }
 
+// promptFor tells the model which language a non-English chunk is in, so
+// summaries and claims are written in that language rather than translated.
+func (a *Annotator) promptFor(chunk storage.Chunk) string {
+	if chunk.Language == nil || *chunk.Language == "en" || *chunk.Language == language.Undetermined {
+		return a.prompt
+	}
+	return a.prompt + fmt.Sprintf("\n\nThe text is in %s. Write the summary and claims in %s; keep entity names as written.",
+		language.Name(*chunk.Language), language.Name(*chunk.Language))
+}
+
 // AnnotateChunks annotates multiple chunks. Returns count of successful annotations.
 func (a *Annotator) AnnotateChunks(chunks []storage.Chunk) int {
 	count := 0
@@ -0,0 +1,231 @@
+package pipeline
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/oho/knowledge-refinery-daemon/internal/storage"
+)
+
+// Reasons recorded for suppressed lines.
+const (
+	SuppressedInAsset  = "repeated_in_asset"
+	SuppressedInVolume = "repeated_in_volume"
+)
+
+// Lines outside these lengths (in characters) are not tracked across a
+// volume: short ones are headings like "Summary", long ones real content.
+const (
+	volumeLineMinChars = 8
+	volumeLineMaxChars = 300
+)
+
+// edgeLines is how many lines at the top and bottom of an atom count as
+// its header and footer, where page numbers are recognised.
+const edgeLines = 2
+
+var (
+	digitsRE     = regexp.MustCompile(`\d+`)
+	pageNumberRE = regexp.MustCompile(`^(page |seite |p\. ?|- ?)?#( ?(of|/|von) ?#)?( ?-)?$`) // after digitsRE masking
+)
+
+// Span is a byte range of an atom's text.
+type Span struct {
+	Start, End int
+}
+
+// Boilerplate finds headers, footers, page numbers, disclaimers and
+// signatures: lines repeated on many pages of an asset or in many assets
+// of a watched volume. They are left out of chunks so they do not dominate
+// similarity edges and concept clusters.
+type Boilerplate struct {
+	minAtoms     int // 0 disables the per-asset check
+	volumeAssets int // 0 disables the per-volume check
+}
+
+func NewBoilerplate(minAtoms, volumeAssets int) *Boilerplate {
+	return &Boilerplate{minAtoms: minAtoms, volumeAssets: volumeAssets}
+}
+
+// VolumeAssets returns how many assets of a volume must share a line for
+// it to be suppressed, or 0 when the volume check is off.
+func (b *Boilerplate) VolumeAssets() int { return b.volumeAssets }
+
+// boilerplateKey normalises a line so repeats match despite case and
+// spacing, and page numbers match despite the changing number ("Page 3
+// of 10", "Page 4 of 10").
+func boilerplateKey(line string) string {
+	key := NormalizeText(line)
+	if masked := digitsRE.ReplaceAllString(key, "#"); pageNumberRE.MatchString(masked) {
+		return masked
+	}
+	return key
+}
+
+func lineHash(key string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(key)))[:16]
+}
+
+func hasLetter(s string) bool {
+	return strings.IndexFunc(s, unicode.IsLetter) >= 0
+}
+
+type atomLine struct {
+	span Span // the line including its newline
+	key  string
+	edge bool // among the first or last edgeLines non-empty lines
+}
+
+// atomLines returns the non-empty lines of text.
+func atomLines(text string) []atomLine {
+	var lines []atomLine
+	for start := 0; start < len(text); {
+		end := strings.IndexByte(text[start:], '\n')
+		if end < 0 {
+			end = len(text)
+		} else {
+			end += start + 1
+		}
+		if key := boilerplateKey(text[start:end]); key != "" {
+			lines = append(lines, atomLine{span: Span{start, end}, key: key})
+		}
+		start = end
+	}
+	for i := range lines {
+		lines[i].edge = i < edgeLines || i >= len(lines)-edgeLines
+	}
+	return lines
+}
+
+// VolumeLines returns the hashes of the lines in atoms that are tracked
+// across a volume.
+func (b *Boilerplate) VolumeLines(atoms []storage.ContentAtom) []string {
+	seen := make(map[string]bool)
+	var hashes []string
+	for _, atom := range atoms {
+		if atom.AtomType != storage.AtomText || atom.PayloadText == nil {
+			continue
+		}
+		for _, l := range atomLines(*atom.PayloadText) {
+			n := utf8.RuneCountInString(l.key)
+			if n < volumeLineMinChars || n > volumeLineMaxChars || !hasLetter(l.key) {
+				continue
+			}
+			if h := lineHash(l.key); !seen[h] {
+				seen[h] = true
+				hashes = append(hashes, h)
+			}
+		}
+	}
+	return hashes
+}
+
+// Find returns the lines of each text atom to leave out of chunking, keyed
+// by atom ID, and the records describing them. A line is suppressed when
+// it appears in at least minAtoms atoms and half of the asset's text
+// atoms, or when volumeRepeats (line hash to asset count, from
+// Database.RepeatedBoilerplateLines) lists it. Page numbers only count at
+// the top or bottom of an atom, and other lines without letters never
+// count, so numeric content survives.
+func (b *Boilerplate) Find(atoms []storage.ContentAtom, volumeRepeats map[string]int) (map[string][]Span, []storage.SuppressedText) {
+	type textAtom struct {
+		atom  storage.ContentAtom
+		lines []atomLine
+	}
+	var texts []textAtom
+	atomCount := make(map[string]int) // key -> number of atoms containing it
+	for _, atom := range atoms {
+		if atom.AtomType != storage.AtomText || atom.PayloadText == nil {
+			continue
+		}
+		ta := textAtom{atom: atom, lines: atomLines(*atom.PayloadText)}
+		seen := make(map[string]bool)
+		for _, l := range ta.lines {
+			if !seen[l.key] && b.candidate(l) {
+				seen[l.key] = true
+				atomCount[l.key]++
+			}
+		}
+		texts = append(texts, ta)
+	}
+
+	excluded := make(map[string][]Span)
+	var records []storage.SuppressedText
+	for _, ta := range texts {
+		text := *ta.atom.PayloadText
+		for _, l := range ta.lines {
+			if !b.candidate(l) {
+				continue
+			}
+			reason, n := "", 0
+			if c := atomCount[l.key]; b.minAtoms > 0 && c >= b.minAtoms && c*2 >= len(texts) {
+				reason, n = SuppressedInAsset, c
+			} else if c := volumeRepeats[lineHash(l.key)]; c > 0 && hasLetter(l.key) {
+				reason, n = SuppressedInVolume, c
+			}
+			if reason == "" {
+				continue
+			}
+			excluded[ta.atom.ID] = append(excluded[ta.atom.ID], l.span)
+			start := utf8.RuneCountInString(text[:l.span.Start])
+			records = append(records, storage.SuppressedText{
+				AtomID:      ta.atom.ID,
+				AssetID:     ta.atom.AssetID,
+				Start:       start,
+				End:         start + utf8.RuneCountInString(text[l.span.Start:l.span.End]),
+				Text:        strings.TrimSpace(text[l.span.Start:l.span.End]),
+				Reason:      reason,
+				Occurrences: n,
+				CreatedAt:   storage.NowISO(),
+			})
+		}
+	}
+	return excluded, records
+}
+
+func (b *Boilerplate) candidate(l atomLine) bool {
+	if hasLetter(l.key) && !pageNumberRE.MatchString(l.key) {
+		return true
+	}
+	return l.edge && pageNumberRE.MatchString(l.key)
+}
+
+// textSegment maps a piece of stripped text, starting at byte at, back to
+// byte orig of the original text.
+type textSegment struct {
+	at, orig int
+}
+
+// stripSpans removes spans (sorted, non-overlapping) from text and returns
+// the remaining text with the mapping of its pieces to the original.
+func stripSpans(text string, spans []Span) (string, []textSegment) {
+	var b strings.Builder
+	var segs []textSegment
+	pos := 0
+	for _, sp := range append(spans, Span{len(text), len(text)}) {
+		if sp.Start > pos {
+			segs = append(segs, textSegment{at: b.Len(), orig: pos})
+			b.WriteString(text[pos:sp.Start])
+		}
+		pos = max(pos, sp.End)
+	}
+	return b.String(), segs
+}
+
+// originalOffset maps a byte offset in stripped text back to the original
+// text. End offsets map to the end of the piece they close rather than the
+// start of the next one.
+func originalOffset(segs []textSegment, off int, isEnd bool) int {
+	i := len(segs) - 1
+	for i > 0 && (segs[i].at > off || isEnd && segs[i].at == off) {
+		i--
+	}
+	if i < 0 {
+		return off
+	}
+	return segs[i].orig + off - segs[i].at
+}
@@ -0,0 +1,89 @@
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/oho/knowledge-refinery-daemon/internal/config"
+	"github.com/oho/knowledge-refinery-daemon/internal/storage"
+)
+
+func pageAtoms(pages []string) []storage.ContentAtom {
+	atoms := make([]storage.ContentAtom, len(pages))
+	for i := range pages {
+		page := i + 1
+		anchor := storage.EvidenceAnchor{AssetID: "asset1", Page: &page}
+		atoms[i] = storage.NewContentAtom(fmt.Sprintf("atom%d", i), "asset1", storage.AtomText, i, anchor.ToJSON())
+		atoms[i].PayloadText = &pages[i]
+	}
+	return atoms
+}
+
+func TestBoilerplateSuppressesHeadersAndPageNumbers(t *testing.T) {
+	var pages []string
+	for i := 1; i <= 4; i++ {
+		pages = append(pages, fmt.Sprintf("ACME Corp — Confidential\nFindings for region %d are summarised here.\n12\nSee the appendix.\nPage %d of 4", i, i))
+	}
+	atoms := pageAtoms(pages)
+
+	excluded, records := NewBoilerplate(3, 0).Find(atoms, nil)
+	if len(records) != 12 {
+		t.Fatalf("expected a header, a footer and the repeated note per page, got %d records: %+v", len(records), records)
+	}
+	for _, r := range records {
+		if r.Reason != SuppressedInAsset || r.Occurrences != 4 {
+			t.Errorf("unexpected record %+v", r)
+		}
+		if got := string([]rune(pages[0])[r.Start:r.End]); r.AtomID == "atom0" && strings.TrimSpace(got) != r.Text {
+			t.Errorf("offsets %d-%d select %q, want %q", r.Start, r.End, got, r.Text)
+		}
+	}
+
+	chunker := NewChunker(config.PipelineConfig{ChunkMaxTokens: 100, Version: "test"})
+	_, chunks := chunker.ChunkAtomsExcluding(atoms, "asset1", ChunkFixed, excluded)
+	if len(chunks) != 4 {
+		t.Fatalf("expected one chunk per page, got %d", len(chunks))
+	}
+	for i, c := range chunks {
+		if strings.Contains(c.ChunkText, "Confidential") || strings.Contains(c.ChunkText, "Page") ||
+			strings.Contains(c.ChunkText, "appendix") {
+			t.Errorf("chunk %d kept boilerplate: %q", i, c.ChunkText)
+		}
+		if !strings.Contains(c.ChunkText, "12") {
+			t.Errorf("chunk %d lost a numeric line from the body: %q", i, c.ChunkText)
+		}
+		a, _ := storage.ParseEvidenceAnchor(c.EvidenceAnchor)
+		span := string([]rune(pages[i])[*a.Offset : *a.Offset+*a.Length])
+		if !strings.HasPrefix(span, "Findings") || !strings.HasSuffix(span, "12") {
+			t.Errorf("chunk %d anchor selects %q in the original page", i, span)
+		}
+	}
+}
+
+func TestBoilerplateVolumeRepeats(t *testing.T) {
+	body := "Thanks for the update on the budget.\n--\nJane Doe, Head of Finance\nThis message may contain privileged information."
+	atoms := pageAtoms([]string{body})
+	b := NewBoilerplate(3, 5)
+
+	hashes := b.VolumeLines(atoms)
+	repeats := map[string]int{}
+	for _, h := range hashes {
+		if h == lineHash(boilerplateKey("Jane Doe, Head of Finance")) ||
+			h == lineHash(boilerplateKey("This message may contain privileged information.")) {
+			repeats[h] = 7
+		}
+	}
+	if len(repeats) != 2 {
+		t.Fatalf("expected the signature lines among the tracked lines, got %d of %d", len(repeats), len(hashes))
+	}
+
+	excluded, records := b.Find(atoms, repeats)
+	if len(records) != 2 || records[0].Reason != SuppressedInVolume || records[0].Occurrences != 7 {
+		t.Fatalf("unexpected records %+v", records)
+	}
+	text, _ := stripSpans(body, excluded["atom0"])
+	if text != "Thanks for the update on the budget.\n--\n" {
+		t.Errorf("stripped text = %q", text)
+	}
+}
@@ -2,13 +2,18 @@ package pipeline
 
 import (
 	"crypto/sha256"
+	"encoding/json"
 	"fmt"
 	"log/slog"
 	"regexp"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/oho/knowledge-refinery-daemon/internal/config"
+	"github.com/oho/knowledge-refinery-daemon/internal/language"
 	"github.com/oho/knowledge-refinery-daemon/internal/storage"
+	"github.com/oho/knowledge-refinery-daemon/internal/tokenizer"
 	"github.com/pkoukk/tiktoken-go"
 )
 
@@ -23,11 +28,31 @@ func init() {
 }
 
 // CountTokens counts tokens using tiktoken, fallback to word-based estimate.
+// The estimate counts each Han, kana, Hangul or Thai character as a token,
+// since those scripts do not separate words with spaces.
 func CountTokens(text string) int {
 	if encoder != nil {
 		return len(encoder.Encode(text, nil, nil))
 	}
-	return int(float64(len(strings.Fields(text))) * 1.33)
+	words, chars := 0, 0
+	for _, field := range strings.Fields(text) {
+		n := 0
+		for _, r := range field {
+			if isUnspacedScript(r) {
+				n++
+			}
+		}
+		if n > 0 {
+			chars += n
+		} else {
+			words++
+		}
+	}
+	return int(float64(words)*1.33) + chars
+}
+
+func isUnspacedScript(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul, unicode.Thai)
 }
 
 // NormalizeText collapses whitespace and lowercases for stable hashing.
@@ -53,16 +78,46 @@ type Chunker struct {
 	max             int
 	overlap         int
 	pipelineVersion string
+
+	strategy       string
+	strategyByType map[string]string
+	percentile     float64
+	window         int
+	embed          SentenceEmbedder // required by the semantic strategy
+	parentMax      int              // token limit of parent sections; 0 disables them
+
+	embedTokenizer *tokenizer.Tokenizer // nil counts with cl100k_base
+	chatTokenizer  *tokenizer.Tokenizer
+	embedMax       int // tokens the embedding model accepts; 0 if unknown
 }
 
 func NewChunker(cfg config.PipelineConfig) *Chunker {
-	return &Chunker{
+	c := &Chunker{
 		target:          cfg.ChunkTargetTokens,
 		min:             cfg.ChunkMinTokens,
 		max:             cfg.ChunkMaxTokens,
 		overlap:         cfg.ChunkOverlapTokens,
 		pipelineVersion: cfg.Version,
+		strategy:        ChunkFixed,
+		strategyByType:  make(map[string]string),
+		percentile:      cfg.SemanticBreakpointPercentile,
+		window:          cfg.SemanticWindowSentences,
+		parentMax:       cfg.ParentChunkMaxTokens,
 	}
+	if ValidChunkStrategy(cfg.ChunkStrategy) {
+		c.strategy = cfg.ChunkStrategy
+	} else if cfg.ChunkStrategy != "" {
+		slog.Warn("Unknown chunk strategy, using fixed", "strategy", cfg.ChunkStrategy)
+	}
+	for ext, strategy := range cfg.ChunkStrategyByType {
+		if ValidChunkStrategy(strategy) {
+			c.strategyByType[strings.ToLower(ext)] = strategy
+		}
+	}
+	if c.percentile <= 0 || c.percentile >= 100 {
+		c.percentile = 90
+	}
+	return c
 }
 
 // AdaptToContext adjusts chunk sizes based on the LLM's context window.
@@ -83,6 +138,9 @@ func (c *Chunker) AdaptToContext(contextLength int) {
 	if newMin > c.min {
 		newMin = c.min
 	}
+	if c.parentMax > available {
+		c.parentMax = available
+	}
 	if newMax != c.max {
 		slog.Info("Adapted chunk sizes to context",
 			"context", contextLength, "target", newTarget, "min", newMin, "max", newMax)
@@ -92,8 +150,29 @@ func (c *Chunker) AdaptToContext(contextLength int) {
 	}
 }
 
-// ChunkAtoms splits all text atoms into Chunk records.
+// ChunkAtoms splits all text atoms into Chunk records using the default
+// strategy.
 func (c *Chunker) ChunkAtoms(atoms []storage.ContentAtom, assetID string) []storage.Chunk {
+	_, chunks := c.ChunkAtomsWithStrategy(atoms, assetID, c.strategy)
+	return chunks
+}
+
+// ChunkAtomsWithStrategy splits all text atoms into Chunk records with the
+// given strategy. The strategy actually used for each atom is recorded in
+// the chunk's pipeline version.
+//
+// With parent sections enabled, each atom is first cut into sections of up
+// to parentMax tokens, and chunks are cut from those sections and linked to
+// them. Sections that yield a single chunk get no parent record.
+func (c *Chunker) ChunkAtomsWithStrategy(atoms []storage.ContentAtom, assetID, strategy string) ([]storage.ParentChunk, []storage.Chunk) {
+	return c.ChunkAtomsExcluding(atoms, assetID, strategy, nil)
+}
+
+// ChunkAtomsExcluding is ChunkAtomsWithStrategy leaving out the byte spans
+// of each atom's text listed in excluded under its ID, such as boilerplate
+// lines. Chunk anchors still refer to offsets in the atom's full text.
+func (c *Chunker) ChunkAtomsExcluding(atoms []storage.ContentAtom, assetID, strategy string, excluded map[string][]Span) ([]storage.ParentChunk, []storage.Chunk) {
+	var allParents []storage.ParentChunk
 	var allChunks []storage.Chunk
 	chunkIndex := 0
 
@@ -101,51 +180,172 @@ func (c *Chunker) ChunkAtoms(atoms []storage.ContentAtom, assetID string) []stor
 		if atom.AtomType != storage.AtomText || atom.PayloadText == nil {
 			continue
 		}
-		text := *atom.PayloadText
-		textChunks := c.splitText(text)
+		full := *atom.PayloadText
+		text := full
+		var segs []textSegment
+		if spans := excluded[atom.ID]; len(spans) > 0 {
+			text, segs = stripSpans(full, spans)
+		}
+		lang := atomLanguage(atom)
+		base, err := storage.ParseEvidenceAnchor(atom.EvidenceAnchor)
+		locatable := err == nil
+		// anchorFor narrows the atom's anchor to the span of part at or
+		// after byte offset *from, advancing *from past the span's start.
+		anchorFor := func(part string, from *int) string {
+			if locatable {
+				if start, end, ok := locateSpan(text, part, *from); ok {
+					*from = start + 1
+					if segs != nil {
+						start, end = originalOffset(segs, start, false), originalOffset(segs, end, true)
+					}
+					return spanAnchor(base, full, start, end)
+				}
+			}
+			return atom.EvidenceAnchor
+		}
+
+		sections := []string{text}
+		if c.parentMax > 0 {
+			sections = c.splitParents(text, lang)
+		}
+		sectionFrom := 0
+		for _, section := range sections {
+			textChunks, version := c.splitWithStrategy(section, lang, strategy, atom.ID)
+			chunkFrom := sectionFrom
+			sectionAnchor := anchorFor(section, &sectionFrom)
+
+			var parent *storage.ParentChunk
+			if c.parentMax > 0 && len(textChunks) > 1 {
+				p := storage.ParentChunk{
+					ID:              ComputeChunkID(assetID, "parent:"+atom.EvidenceAnchor, section),
+					AtomID:          atom.ID,
+					AssetID:         assetID,
+					ChunkText:       section,
+					TokenCount:      c.countTokens(section),
+					ChunkIndex:      len(allParents),
+					EvidenceAnchor:  sectionAnchor,
+					PipelineVersion: version,
+					CreatedAt:       storage.NowISO(),
+				}
+				allParents = append(allParents, p)
+				parent = &p
+			}
+
+			searchFrom := 0
+			for _, chunkText := range textChunks {
+				tokenCount := c.countTokens(chunkText)
+				// IDs hash the atom's anchor, not the chunk's, so they stay
+				// stable across versions that refine chunk anchors.
+				chunkID := ComputeChunkID(assetID, atom.EvidenceAnchor, chunkText)
+
+				chunk := storage.NewChunk(
+					chunkID, atom.ID, assetID, chunkText,
+					tokenCount, chunkIndex, anchorFor(chunkText, &chunkFrom), version,
+				)
+				if lang != "" {
+					chunk.Language = &lang
+				}
+				if parent != nil {
+					chunk.ParentID = &parent.ID
+					if start, end, ok := locateSpan(section, chunkText, searchFrom); ok {
+						rs := utf8.RuneCountInString(section[:start])
+						re := rs + utf8.RuneCountInString(section[start:end])
+						chunk.ParentStart, chunk.ParentEnd = &rs, &re
+						searchFrom = start + 1
+					}
+				}
+				allChunks = append(allChunks, chunk)
+				chunkIndex++
+			}
+		}
+	}
+	return allParents, allChunks
+}
 
-		for _, chunkText := range textChunks {
-			tokenCount := CountTokens(chunkText)
-			chunkID := ComputeChunkID(assetID, atom.EvidenceAnchor, chunkText)
+// spanAnchor returns base narrowed to text[start:end]: the character offset
+// and length within the atom and, when the atom's text maps line for line
+// onto its source lines, the lines the span covers.
+func spanAnchor(base storage.EvidenceAnchor, text string, start, end int) string {
+	a := base
+	offset := utf8.RuneCountInString(text[:start])
+	length := utf8.RuneCountInString(text[start:end])
+	a.Offset, a.Length = &offset, &length
+	if base.LineStart != nil && base.LineEnd != nil && *base.LineEnd-*base.LineStart == strings.Count(text, "\n") {
+		lineStart := *base.LineStart + strings.Count(text[:start], "\n")
+		lineEnd := lineStart + strings.Count(text[start:end], "\n")
+		a.LineStart, a.LineEnd = &lineStart, &lineEnd
+	}
+	return a.ToJSON()
+}
 
-			allChunks = append(allChunks, storage.NewChunk(
-				chunkID, atom.ID, assetID, chunkText,
-				tokenCount, chunkIndex, atom.EvidenceAnchor, c.pipelineVersion,
-			))
-			chunkIndex++
+// splitWithStrategy cuts text into chunks and returns the pipeline version
+// recording the strategy that was actually used.
+func (c *Chunker) splitWithStrategy(text, lang, strategy, atomID string) ([]string, string) {
+	if strategy == ChunkSemantic {
+		chunks, err := c.splitSemantic(text, lang)
+		if err == nil {
+			return chunks, c.pipelineVersion + "+" + ChunkSemantic
 		}
+		slog.Warn("Semantic chunking failed, using fixed", "atom", atomID, "error", err)
+	}
+	return c.splitText(text, lang), c.pipelineVersion
+}
+
+// splitParents cuts text into non-overlapping sections of up to parentMax
+// tokens along sentence boundaries.
+func (c *Chunker) splitParents(text, lang string) []string {
+	sections := &Chunker{max: c.parentMax, embedTokenizer: c.embedTokenizer, chatTokenizer: c.chatTokenizer}
+	return sections.splitText(text, lang)
+}
+
+// atomLanguage returns the language recorded in an atom's metadata by the
+// extractor registry, or "" if none was recorded.
+func atomLanguage(atom storage.ContentAtom) string {
+	if atom.MetadataJSON == nil {
+		return ""
+	}
+	var meta struct {
+		Language string `json:"language"`
 	}
-	return allChunks
+	if json.Unmarshal([]byte(*atom.MetadataJSON), &meta) != nil {
+		return ""
+	}
+	return meta.Language
 }
 
-// sentenceBoundaryRE matches sentence-ending punctuation followed by whitespace.
-// Go's regexp doesn't support lookbehinds, so we match the full pattern and
-// reconstruct sentences by keeping the punctuation with the preceding text.
-var sentenceBoundaryRE = regexp.MustCompile(`([.!?])\s+`)
+// usesFullWidthStops reports whether sentences in lang end with full-width
+// punctuation and are written without a space between them.
+func usesFullWidthStops(lang string) bool {
+	return language.IsCJK(lang) && lang != "th"
+}
 
-func (c *Chunker) splitText(text string) []string {
+func (c *Chunker) splitText(text, lang string) []string {
 	text = strings.TrimSpace(text)
 	if text == "" {
 		return nil
 	}
 
-	totalTokens := CountTokens(text)
+	totalTokens := c.countTokens(text)
 	if totalTokens <= c.max {
 		return []string{text}
 	}
 
-	sentences := c.splitSentences(text)
+	sentences := c.splitSentences(text, lang)
+	sep := " "
+	if usesFullWidthStops(lang) {
+		sep = ""
+	}
 	var chunks []string
 	var current []string
 	currentTokens := 0
 
 	for _, sentence := range sentences {
-		sentTokens := CountTokens(sentence)
+		sentTokens := c.countTokens(sentence)
 
 		if currentTokens+sentTokens > c.max && len(current) > 0 {
 			// Emit current chunk
-			chunkText := strings.TrimSpace(strings.Join(current, " "))
-			if CountTokens(chunkText) >= c.min {
+			chunkText := strings.TrimSpace(strings.Join(current, sep))
+			if c.countTokens(chunkText) >= c.min {
 				chunks = append(chunks, chunkText)
 			}
 
@@ -153,7 +353,7 @@ func (c *Chunker) splitText(text string) []string {
 			overlapTokens := 0
 			overlapStart := len(current)
 			for i := len(current) - 1; i >= 0; i-- {
-				st := CountTokens(current[i])
+				st := c.countTokens(current[i])
 				if overlapTokens+st > c.overlap {
 					break
 				}
@@ -163,7 +363,7 @@ func (c *Chunker) splitText(text string) []string {
 			current = current[overlapStart:]
 			currentTokens = 0
 			for _, s := range current {
-				currentTokens += CountTokens(s)
+				currentTokens += c.countTokens(s)
 			}
 		}
 
@@ -173,7 +373,7 @@ func (c *Chunker) splitText(text string) []string {
 
 	// Emit final chunk
 	if len(current) > 0 {
-		chunkText := strings.TrimSpace(strings.Join(current, " "))
+		chunkText := strings.TrimSpace(strings.Join(current, sep))
 		if chunkText != "" {
 			chunks = append(chunks, chunkText)
 		}
@@ -182,47 +382,74 @@ func (c *Chunker) splitText(text string) []string {
 	return chunks
 }
 
-func (c *Chunker) splitSentences(text string) []string {
-	// Split on sentence boundaries while keeping the punctuation with the sentence.
-	// We find all matches of `[.!?]\s+` and use their positions to split.
-	indices := sentenceBoundaryRE.FindAllStringIndex(text, -1)
-	if len(indices) == 0 {
-		// No sentence boundaries found — split on newlines or return as-is
-		return c.splitLongBlock(text)
+// splitSentences splits text into sentences with the rules for lang.
+// Sentences over the token limit are split at line breaks, then between
+// clauses.
+func (c *Chunker) splitSentences(text, lang string) []string {
+	parts := language.Sentences(text, lang)
+	if len(parts) <= 1 {
+		// No sentence boundaries found — split on newlines
+		parts = c.splitLongBlock(text)
 	}
 
-	var parts []string
-	start := 0
-	for _, idx := range indices {
-		// idx[0] is the position of the punctuation, idx[1] is after the whitespace
-		// Keep the punctuation char with the sentence (split after it)
-		end := idx[0] + 1 // include the punctuation
-		part := strings.TrimSpace(text[start:end])
-		if part != "" {
-			parts = append(parts, part)
-		}
-		start = idx[1] // skip the whitespace
-	}
-	// Remainder after last match
-	if start < len(text) {
-		part := strings.TrimSpace(text[start:])
-		if part != "" {
-			parts = append(parts, part)
-		}
-	}
-
-	// Further split any sentences that are too long
 	var result []string
 	for _, part := range parts {
-		if CountTokens(part) > c.max {
-			result = append(result, c.splitLongBlock(part)...)
-		} else {
+		if c.countTokens(part) <= c.max {
 			result = append(result, part)
+			continue
+		}
+		for _, line := range c.splitLongBlock(part) {
+			if c.countTokens(line) > c.max {
+				result = append(result, language.Clauses(line)...)
+			} else {
+				result = append(result, line)
+			}
 		}
 	}
 	return result
 }
 
+// locateSpan finds needle in haystack at or after byte offset from and
+// returns its byte range. Whitespace is ignored when comparing, since
+// chunks rejoin sentences with single spaces.
+func locateSpan(haystack, needle string, from int) (int, int, bool) {
+	needle = strings.TrimSpace(needle)
+	if needle == "" || from > len(haystack) {
+		return 0, 0, false
+	}
+	if i := strings.Index(haystack[from:], needle); i >= 0 {
+		return from + i, from + i + len(needle), true
+	}
+	for start := from; start < len(haystack); start++ {
+		if haystack[start] != needle[0] {
+			continue
+		}
+		h, n := start, 0
+		for n < len(needle) {
+			if isASCIISpace(needle[n]) {
+				n++
+				continue
+			}
+			for h < len(haystack) && isASCIISpace(haystack[h]) {
+				h++
+			}
+			if h == len(haystack) || haystack[h] != needle[n] {
+				break
+			}
+			h++
+			n++
+		}
+		if n == len(needle) {
+			return start, h, true
+		}
+	}
+	return 0, 0, false
+}
+
+func isASCIISpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r' || b == '\f' || b == '\v'
+}
+
 func (c *Chunker) splitLongBlock(text string) []string {
 	var result []string
 	for _, sub := range strings.Split(text, "\n") {
@@ -1,12 +1,16 @@
 package pipeline
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/oho/knowledge-refinery-daemon/internal/config"
 	"github.com/oho/knowledge-refinery-daemon/internal/storage"
+	"github.com/oho/knowledge-refinery-daemon/internal/tokenizer"
 )
 
 func TestCountTokens(t *testing.T) {
@@ -139,3 +143,309 @@ func TestChunkerAdaptToContext(t *testing.T) {
 		t.Errorf("max should decrease with small context, got %d", chunker.max)
 	}
 }
+
+func TestChunkerJapaneseSentences(t *testing.T) {
+	cfg := config.PipelineConfig{
+		ChunkTargetTokens:  50,
+		ChunkMinTokens:     10,
+		ChunkMaxTokens:     100,
+		ChunkOverlapTokens: 0,
+		Version:            "test",
+	}
+	chunker := NewChunker(cfg)
+
+	var sb strings.Builder
+	for i := 0; i < 40; i++ {
+		fmt.Fprintf(&sb, "これは%d番目の文で、日本語のテキストを分割するための例です。", i)
+	}
+	text := sb.String()
+
+	atom := storage.NewContentAtom("atom1", "asset1", storage.AtomText, 0, `{"asset_id":"asset1"}`)
+	atom.PayloadText = &text
+	meta := `{"encoding":"shift_jis","language":"ja"}`
+	atom.MetadataJSON = &meta
+
+	chunks := chunker.ChunkAtoms([]storage.ContentAtom{atom}, "asset1")
+	if len(chunks) < 2 {
+		t.Fatalf("expected unspaced Japanese text to split on 。, got %d chunk(s)", len(chunks))
+	}
+	var joined strings.Builder
+	for _, c := range chunks {
+		if c.Language == nil || *c.Language != "ja" {
+			t.Errorf("chunk %d language = %v, want ja", c.ChunkIndex, c.Language)
+		}
+		if !strings.HasSuffix(c.ChunkText, "。") || strings.Contains(c.ChunkText, " ") {
+			t.Errorf("chunk %d should hold whole sentences without added spaces: %q", c.ChunkIndex, c.ChunkText)
+		}
+		joined.WriteString(c.ChunkText)
+	}
+	if joined.String() != text {
+		t.Error("chunks without overlap should reassemble the original text")
+	}
+}
+
+func TestChunkerSemanticSplitsAtTopicShift(t *testing.T) {
+	cfg := config.PipelineConfig{
+		ChunkMinTokens:               10,
+		ChunkMaxTokens:               100,
+		Version:                      "test",
+		ChunkStrategy:                ChunkSemantic,
+		SemanticBreakpointPercentile: 90,
+		SemanticWindowSentences:      1,
+	}
+	chunker := NewChunker(cfg)
+	// Each window embeds as (cat sentences, rocket sentences).
+	chunker.SetSentenceEmbedder(func(texts []string) ([][]float64, error) {
+		vecs := make([][]float64, len(texts))
+		for i, s := range texts {
+			vecs[i] = []float64{float64(strings.Count(s, "Cats")), float64(strings.Count(s, "Rockets"))}
+		}
+		return vecs, nil
+	})
+
+	var sentences []string
+	for i := 0; i < 6; i++ {
+		sentences = append(sentences, fmt.Sprintf("Cats nap in sunny window number %d all afternoon.", i))
+	}
+	for i := 0; i < 6; i++ {
+		sentences = append(sentences, fmt.Sprintf("Rockets need stage %d to burn before orbit.", i))
+	}
+	text := strings.Join(sentences, " ")
+	atom := storage.NewContentAtom("atom1", "asset1", storage.AtomText, 0, `{"asset_id":"asset1"}`)
+	atom.PayloadText = &text
+
+	chunks := chunker.ChunkAtoms([]storage.ContentAtom{atom}, "asset1")
+	if len(chunks) != 2 {
+		t.Fatalf("expected a split at the topic shift, got %d chunks", len(chunks))
+	}
+	if strings.Contains(chunks[0].ChunkText, "Rockets") || strings.Contains(chunks[1].ChunkText, "Cats") {
+		t.Errorf("chunks straddle topics: %q | %q", chunks[0].ChunkText, chunks[1].ChunkText)
+	}
+	for _, c := range chunks {
+		if c.PipelineVersion != "test+semantic" {
+			t.Errorf("pipeline version = %q, want test+semantic", c.PipelineVersion)
+		}
+	}
+}
+
+func TestChunkerSemanticFallsBackToFixed(t *testing.T) {
+	chunker := NewChunker(config.PipelineConfig{ChunkMinTokens: 10, ChunkMaxTokens: 100, Version: "test"})
+	chunker.SetSentenceEmbedder(func(texts []string) ([][]float64, error) {
+		return nil, fmt.Errorf("embedding model not loaded")
+	})
+
+	var sentences []string
+	for i := 0; i < 30; i++ {
+		sentences = append(sentences, fmt.Sprintf("Sentence %d carries enough words to matter here.", i))
+	}
+	text := strings.Join(sentences, " ")
+	atom := storage.NewContentAtom("atom1", "asset1", storage.AtomText, 0, `{"asset_id":"asset1"}`)
+	atom.PayloadText = &text
+
+	_, chunks := chunker.ChunkAtomsWithStrategy([]storage.ContentAtom{atom}, "asset1", ChunkSemantic)
+	if len(chunks) < 2 {
+		t.Fatalf("expected fixed chunking, got %d chunks", len(chunks))
+	}
+	if chunks[0].PipelineVersion != "test" {
+		t.Errorf("pipeline version = %q, want the fixed strategy's", chunks[0].PipelineVersion)
+	}
+}
+
+func TestChunkerStrategyFor(t *testing.T) {
+	chunker := NewChunker(config.PipelineConfig{
+		ChunkStrategy:       ChunkFixed,
+		ChunkStrategyByType: map[string]string{".MD": ChunkSemantic},
+	})
+	semantic, fixed := ChunkSemantic, ChunkFixed
+	volumes := []storage.WatchedVolume{
+		{Path: "/docs", ChunkStrategy: &semantic},
+		{Path: "/docs/logs", ChunkStrategy: &fixed},
+		{Path: "/notes"},
+	}
+	cases := []struct {
+		path, want string
+	}{
+		{"/docs/report.txt", ChunkSemantic},
+		{"/docs/logs/today.md", ChunkFixed}, // innermost volume wins
+		{"/notes/idea.md", ChunkSemantic},   // by file type
+		{"/notes/idea.txt", ChunkFixed},     // default
+		{"/docsmore/x.txt", ChunkFixed},     // not under /docs
+	}
+	for _, tc := range cases {
+		asset := storage.NewFileAsset("a", tc.path, filepath.Base(tc.path))
+		if got := chunker.StrategyFor(asset, volumes); got != tc.want {
+			t.Errorf("StrategyFor(%s) = %s, want %s", tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestChunkerParentSections(t *testing.T) {
+	chunker := NewChunker(config.PipelineConfig{
+		ChunkMinTokens:       5,
+		ChunkMaxTokens:       30,
+		ParentChunkMaxTokens: 90,
+		Version:              "test",
+	})
+
+	var sentences []string
+	for i := 0; i < 24; i++ {
+		sentences = append(sentences, fmt.Sprintf("Sentence %d über   the\nquarterly numbers.", i))
+	}
+	text := strings.Join(sentences, "  ")
+	atom := storage.NewContentAtom("atom1", "asset1", storage.AtomText, 0, `{"asset_id":"asset1"}`)
+	atom.PayloadText = &text
+
+	parents, chunks := chunker.ChunkAtomsWithStrategy([]storage.ContentAtom{atom}, "asset1", ChunkFixed)
+	if len(parents) < 2 || len(chunks) <= len(parents) {
+		t.Fatalf("expected several parents with several chunks each, got %d parents and %d chunks", len(parents), len(chunks))
+	}
+	byID := make(map[string]storage.ParentChunk)
+	for _, p := range parents {
+		byID[p.ID] = p
+	}
+	for _, c := range chunks {
+		if c.ParentID == nil {
+			t.Fatalf("chunk %d has no parent", c.ChunkIndex)
+		}
+		parent, ok := byID[*c.ParentID]
+		if !ok || c.ParentStart == nil || c.ParentEnd == nil {
+			t.Fatalf("chunk %d is not located in its parent", c.ChunkIndex)
+		}
+		span := string([]rune(parent.ChunkText)[*c.ParentStart:*c.ParentEnd])
+		if NormalizeText(span) != NormalizeText(c.ChunkText) {
+			t.Errorf("chunk %d span = %q, want %q", c.ChunkIndex, span, c.ChunkText)
+		}
+	}
+}
+
+func TestChunkerNoParentForSingleChunk(t *testing.T) {
+	chunker := NewChunker(config.PipelineConfig{ChunkMaxTokens: 100, ParentChunkMaxTokens: 400})
+	text := "Short enough for one chunk."
+	atom := storage.NewContentAtom("atom1", "asset1", storage.AtomText, 0, `{"asset_id":"asset1"}`)
+	atom.PayloadText = &text
+
+	parents, chunks := chunker.ChunkAtomsWithStrategy([]storage.ContentAtom{atom}, "asset1", ChunkFixed)
+	if len(parents) != 0 || len(chunks) != 1 || chunks[0].ParentID != nil {
+		t.Errorf("expected one unparented chunk, got %d parents and %+v", len(parents), chunks)
+	}
+}
+
+func TestLocateSpanIgnoresWhitespace(t *testing.T) {
+	haystack := "Header line\nfirst part\n\nsecond part. Tail."
+	start, end, ok := locateSpan(haystack, "first part second part.", 0)
+	if !ok || haystack[start:end] != "first part\n\nsecond part." {
+		t.Errorf("locateSpan = %q, %v", haystack[start:end], ok)
+	}
+	if _, _, ok := locateSpan(haystack, "Header", 1); ok {
+		t.Error("expected no match before the start offset")
+	}
+}
+
+func TestChunkerRecordsOffsetsAndLines(t *testing.T) {
+	chunker := NewChunker(config.PipelineConfig{ChunkMinTokens: 5, ChunkMaxTokens: 30, Version: "test"})
+
+	var lines []string
+	for i := 0; i < 20; i++ {
+		lines = append(lines, fmt.Sprintf("Line %d reports the quarterly numbers for the région.", i))
+	}
+	text := strings.Join(lines, "\n")
+	lineStart, lineEnd := 5, 24
+	anchor := storage.EvidenceAnchor{AssetID: "asset1", LineStart: &lineStart, LineEnd: &lineEnd}
+	atom := storage.NewContentAtom("atom1", "asset1", storage.AtomText, 0, anchor.ToJSON())
+	atom.PayloadText = &text
+
+	chunks := chunker.ChunkAtoms([]storage.ContentAtom{atom}, "asset1")
+	if len(chunks) < 2 {
+		t.Fatalf("expected several chunks, got %d", len(chunks))
+	}
+	runes := []rune(text)
+	for _, c := range chunks {
+		a, err := storage.ParseEvidenceAnchor(c.EvidenceAnchor)
+		if err != nil || a.Offset == nil || a.Length == nil || a.LineStart == nil || a.LineEnd == nil {
+			t.Fatalf("chunk %d anchor = %s", c.ChunkIndex, c.EvidenceAnchor)
+		}
+		span := string(runes[*a.Offset : *a.Offset+*a.Length])
+		if NormalizeText(span) != NormalizeText(c.ChunkText) {
+			t.Errorf("chunk %d span = %q, want %q", c.ChunkIndex, span, c.ChunkText)
+		}
+		wantStart := lineStart + strings.Count(string(runes[:*a.Offset]), "\n")
+		if *a.LineStart != wantStart || *a.LineEnd != wantStart+strings.Count(span, "\n") {
+			t.Errorf("chunk %d lines = %d-%d, want start %d", c.ChunkIndex, *a.LineStart, *a.LineEnd, wantStart)
+		}
+	}
+}
+
+// letterTokenizer writes a WordPiece tokenizer that spends one token per
+// letter and accepts 8 tokens of text between [CLS] and [SEP].
+func letterTokenizer(t *testing.T) *tokenizer.Tokenizer {
+	t.Helper()
+	vocab := map[string]int{"[UNK]": 0, ".": 1}
+	for r := 'a'; r <= 'z'; r++ {
+		vocab[string(r)] = len(vocab)
+		vocab["##"+string(r)] = len(vocab)
+	}
+	body, _ := json.Marshal(map[string]any{
+		"truncation":     map[string]any{"max_length": 10},
+		"normalizer":     map[string]any{"type": "BertNormalizer", "lowercase": true},
+		"pre_tokenizer":  map[string]any{"type": "BertPreTokenizer"},
+		"post_processor": map[string]any{"type": "BertProcessing"},
+		"model":          map[string]any{"type": "WordPiece", "vocab": vocab},
+	})
+	path := filepath.Join(t.TempDir(), "tokenizer.json")
+	if err := os.WriteFile(path, body, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tok, err := tokenizer.Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	return tok
+}
+
+func TestChunkerFitsEmbeddingTokenizer(t *testing.T) {
+	tok := letterTokenizer(t)
+	chunker := NewChunker(config.PipelineConfig{ChunkTargetTokens: 60, ChunkMinTokens: 1, ChunkMaxTokens: 100, Version: "test"})
+	chunker.SetTokenizers(tok, nil, 0)
+
+	text := strings.Repeat("Ab cd. ", 12)
+	atom := storage.NewContentAtom("atom1", "asset1", storage.AtomText, 0, `{"asset_id":"asset1"}`)
+	atom.PayloadText = &text
+
+	chunks := chunker.ChunkAtoms([]storage.ContentAtom{atom}, "asset1")
+	if len(chunks) < 2 {
+		t.Fatalf("expected the 8-token limit to split the text, got %d chunk(s)", len(chunks))
+	}
+	for _, c := range chunks {
+		if c.TokenCount > 8 || chunker.TruncatedForEmbedding(c.ChunkText) {
+			t.Errorf("chunk %d has %d tokens, over the embedding limit: %q", c.ChunkIndex, c.TokenCount, c.ChunkText)
+		}
+	}
+	if !chunker.TruncatedForEmbedding("abcdefghij") {
+		t.Error("expected a 10-token word to be flagged as truncated")
+	}
+}
+
+func TestChunkerSplitsLongSentenceAtClauses(t *testing.T) {
+	chunker := NewChunker(config.PipelineConfig{ChunkMinTokens: 1, ChunkMaxTokens: 12, Version: "test"})
+
+	var clauses []string
+	for i := 0; i < 10; i++ {
+		clauses = append(clauses, fmt.Sprintf("clause %d adds another measured detail", i))
+	}
+	text := "Dr. Weber noted that " + strings.Join(clauses, ", ") + "."
+	atom := storage.NewContentAtom("atom1", "asset1", storage.AtomText, 0, `{"asset_id":"asset1"}`)
+	atom.PayloadText = &text
+
+	chunks := chunker.ChunkAtoms([]storage.ContentAtom{atom}, "asset1")
+	if len(chunks) < 3 {
+		t.Fatalf("expected the run-on sentence to split between clauses, got %d chunk(s)", len(chunks))
+	}
+	if !strings.HasPrefix(chunks[0].ChunkText, "Dr. Weber noted") {
+		t.Errorf("first chunk split after the abbreviation: %q", chunks[0].ChunkText)
+	}
+	for _, c := range chunks[:len(chunks)-1] {
+		if !strings.HasSuffix(c.ChunkText, ",") {
+			t.Errorf("chunk %d does not end at a clause break: %q", c.ChunkIndex, c.ChunkText)
+		}
+	}
+}
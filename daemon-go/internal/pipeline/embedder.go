@@ -1,6 +1,7 @@
 package pipeline
 
 import (
+	"fmt"
 	"log/slog"
 
 	"github.com/oho/knowledge-refinery-daemon/internal/lmstudio"
@@ -14,7 +15,12 @@ type Embedder struct {
 	db        *storage.Database
 	batchSize int
 	model     *string
-	dimDetected bool
+	namespace string // model, tagged with its embedding template
+	dim       int
+
+	// tokens reports a text's length and the model's limit in embedding
+	// tokens, so chunks the model will truncate can be logged.
+	tokens func(text string) (tokens, limit int)
 }
 
 func NewEmbedder(lm *lmstudio.Client, vs *storage.VectorStore, db *storage.Database, batchSize int) *Embedder {
@@ -26,31 +32,36 @@ func NewEmbedder(lm *lmstudio.Client, vs *storage.VectorStore, db *storage.Datab
 	}
 }
 
+// Model returns the embedding model in use, or "" before the first run.
+func (e *Embedder) Model() string {
+	if e.model == nil {
+		return ""
+	}
+	return *e.model
+}
+
+// Namespace returns the namespace the embedder's vectors are stored in,
+// or "" before the first run.
+func (e *Embedder) Namespace() string {
+	return e.namespace
+}
+
 // EmbedChunks embeds a list of chunks and stores them in the vector store.
 func (e *Embedder) EmbedChunks(chunks []storage.Chunk) int {
 	if len(chunks) == 0 {
 		return 0
 	}
 
-	// Auto-detect model
+	// Resolve the model and namespace on every run: a re-embed may have
+	// activated another namespace since the last one.
+	e.model = e.embeddingModel()
 	if e.model == nil {
-		e.model = e.lm.GetEmbeddingModel()
-		if e.model == nil {
-			slog.Error("No embedding model available in LM Studio")
-			return 0
-		}
+		slog.Error("No embedding model available in LM Studio")
+		return 0
 	}
-
-	// Detect dimension from a test call
-	if !e.dimDetected {
-		vec, err := e.lm.EmbedSingle("hello world", e.model)
-		if err != nil {
-			slog.Error("Failed to detect embedding dimension", "error", err)
-			return 0
-		}
-		e.vs.SetDimension(len(vec))
-		e.dimDetected = true
-		slog.Info("Detected embedding dimension", "dim", len(vec), "model", *e.model)
+	if err := e.selectNamespace(*e.model); err != nil {
+		slog.Error("Failed to select embedding namespace", "error", err)
+		return 0
 	}
 
 	embeddedCount := 0
@@ -65,9 +76,15 @@ func (e *Embedder) EmbedChunks(chunks []storage.Chunk) int {
 		texts := make([]string, len(batch))
 		for j, c := range batch {
 			texts[j] = c.ChunkText
+			if e.tokens != nil {
+				if n, limit := e.tokens(c.ChunkText); limit > 0 && n > limit {
+					slog.Warn("Chunk exceeds embedding model's max sequence length, tail will be ignored",
+						"chunk", c.ID, "tokens", n, "max", limit)
+				}
+			}
 		}
 
-		rawVecs, err := e.lm.Embed(texts, e.model)
+		rawVecs, err := e.lm.EmbedDocuments(texts, *e.model)
 		if err != nil {
 			slog.Error("Embedding batch failed", "error", err)
 			continue
@@ -97,6 +114,10 @@ func (e *Embedder) EmbedChunks(chunks []storage.Chunk) int {
 				EvidenceAnchor:  c.EvidenceAnchor,
 				PipelineVersion: c.PipelineVersion,
 				AtomType:        "text",
+				Model:           e.namespace,
+			}
+			if c.Language != nil {
+				records[j].Language = *c.Language
 			}
 		}
 
@@ -116,3 +137,55 @@ func (e *Embedder) EmbedChunks(chunks []storage.Chunk) int {
 
 	return embeddedCount
 }
+
+// embeddingModel returns the active namespace's model while LM Studio still
+// offers it, so a model activated by a re-embed stays in use, and otherwise
+// the first embedding model loaded.
+func (e *Embedder) embeddingModel() *string {
+	if active, _ := lmstudio.NamespaceModel(e.vs.Model()); active != "" {
+		for _, m := range e.lm.ListModels() {
+			if m.ID == active {
+				return &active
+			}
+		}
+	}
+	return e.lm.GetEmbeddingModel()
+}
+
+// selectNamespace picks the namespace model's vectors are stored in: the
+// active one when it can be adopted, or else a namespace of its own,
+// built until a re-embed switches over, because vectors of another model
+// or template are not comparable.
+func (e *Embedder) selectNamespace(model string) error {
+	vec, err := e.lm.EmbedSingle("hello world", &model)
+	if err != nil {
+		return fmt.Errorf("detect embedding dimension: %w", err)
+	}
+	ns := e.lm.EmbeddingNamespace(model)
+	if ns != e.namespace || len(vec) != e.dim {
+		slog.Info("Detected embedding dimension", "dim", len(vec), "model", model)
+	}
+
+	if ns != model && e.vs.Model() == "" && e.vs.Count() > 0 {
+		// Vectors stored before namespaces were embedded without a
+		// template; claim them for the bare model first.
+		if _, err := e.vs.Adopt(model, len(vec)); err != nil {
+			return err
+		}
+	}
+	active, err := e.vs.Adopt(ns, len(vec))
+	if err != nil {
+		return err
+	}
+	if active {
+		e.vs.SetDimension(len(vec))
+	} else {
+		if err := e.vs.BeginNamespace(ns, len(vec)); err != nil {
+			return fmt.Errorf("create embedding namespace: %w", err)
+		}
+		slog.Warn("Embedding namespace differs from the searched vectors, new chunks are searchable after re-embedding",
+			"namespace", ns, "active", e.vs.Model())
+	}
+	e.namespace, e.dim = ns, len(vec)
+	return nil
+}
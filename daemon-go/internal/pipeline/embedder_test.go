@@ -0,0 +1,65 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/oho/knowledge-refinery-daemon/internal/lmstudio"
+	"github.com/oho/knowledge-refinery-daemon/internal/storage"
+)
+
+func TestEmbedderFollowsActivatedNamespace(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/models" {
+			json.NewEncoder(w).Encode(map[string]any{"data": []map[string]string{{"id": "old-embed"}, {"id": "new-embed"}}})
+			return
+		}
+		var req struct {
+			Input []string `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		data := make([]map[string]any, len(req.Input))
+		for i, text := range req.Input {
+			data[i] = map[string]any{"embedding": []float64{float64(len(text)), 1, 0}}
+		}
+		json.NewEncoder(w).Encode(map[string]any{"data": data})
+	}))
+	defer srv.Close()
+
+	db, err := storage.NewDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	defer db.Close()
+	vs, err := storage.NewVectorStore(db.DB(), 3)
+	if err != nil {
+		t.Fatalf("NewVectorStore: %v", err)
+	}
+	e := NewEmbedder(lmstudio.NewClient(srv.URL+"/v1", 10), vs, db, 8)
+
+	chunk := func(id string) []storage.Chunk {
+		return []storage.Chunk{{ID: id, AssetID: "asset1", ChunkText: "text of " + id}}
+	}
+	if n := e.EmbedChunks(chunk("c1")); n != 1 || e.Namespace() != "old-embed" || vs.Model() != "old-embed" {
+		t.Fatalf("expected the first embedding model adopted, got %d embedded into %q (active %q)", n, e.Namespace(), vs.Model())
+	}
+
+	// An operator re-embeds with the other loaded model
+	if err := vs.BeginNamespace("new-embed", 3); err != nil {
+		t.Fatalf("BeginNamespace: %v", err)
+	}
+	vs.AddVectors([]storage.VectorRecord{{ID: "c1", Vector: []float32{1, 1, 0}, Text: "text of c1", AssetID: "asset1", Model: "new-embed"}})
+	if err := vs.Activate("new-embed"); err != nil {
+		t.Fatalf("Activate: %v", err)
+	}
+
+	if n := e.EmbedChunks(chunk("c2")); n != 1 || e.Namespace() != "new-embed" {
+		t.Fatalf("expected later runs to embed into the activated namespace, got %d into %q", n, e.Namespace())
+	}
+	if vs.Count() != 2 {
+		t.Errorf("expected both chunks searchable, got %d vectors", vs.Count())
+	}
+}
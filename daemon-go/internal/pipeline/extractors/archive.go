@@ -105,7 +105,8 @@ func extractZip(asset storage.FileAsset, depth int) ([]storage.ContentAtom, erro
 			continue
 		}
 
-		text := strings.TrimSpace(string(data))
+		text, enc := decodeText(data)
+		text = strings.TrimSpace(text)
 		if text == "" {
 			continue
 		}
@@ -117,6 +118,7 @@ func extractZip(asset storage.FileAsset, depth int) ([]storage.ContentAtom, erro
 			asset.ID, storage.AtomText, seqIdx, anchor.ToJSON(),
 		)
 		atom.PayloadText = &text
+		setAtomMetadata(&atom, "encoding", enc)
 		atoms = append(atoms, atom)
 		seqIdx++
 	}
@@ -192,7 +194,8 @@ func extractTar(asset storage.FileAsset, isGzip bool, depth int) ([]storage.Cont
 			continue
 		}
 
-		text := strings.TrimSpace(string(data))
+		text, enc := decodeText(data)
+		text = strings.TrimSpace(text)
 		if text == "" {
 			continue
 		}
@@ -204,6 +207,7 @@ func extractTar(asset storage.FileAsset, isGzip bool, depth int) ([]storage.Cont
 			asset.ID, storage.AtomText, seqIdx, anchor.ToJSON(),
 		)
 		atom.PayloadText = &text
+		setAtomMetadata(&atom, "encoding", enc)
 		atoms = append(atoms, atom)
 		seqIdx++
 	}
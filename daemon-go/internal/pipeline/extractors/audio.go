@@ -0,0 +1,114 @@
+package extractors
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/oho/knowledge-refinery-daemon/internal/lmstudio"
+	"github.com/oho/knowledge-refinery-daemon/internal/storage"
+)
+
+var audioFormats = map[string]string{
+	".wav": "WAV", ".mp3": "MP3", ".m4a": "M4A",
+}
+
+// Transcriber turns an audio file into timed text segments.
+// *lmstudio.Client satisfies it.
+type Transcriber interface {
+	Transcribe(audioPath string, model *string) (*lmstudio.Transcription, error)
+}
+
+// AudioExtractor transcribes recordings through an OpenAI-compatible
+// transcription endpoint. Segments are grouped like subtitle cues into
+// atoms anchored by their time range.
+type AudioExtractor struct {
+	transcriber Transcriber
+	model       *string
+}
+
+// NewAudioExtractor returns an extractor using t. An empty model picks the
+// first whisper model LM Studio reports.
+func NewAudioExtractor(t Transcriber, model string) *AudioExtractor {
+	e := &AudioExtractor{transcriber: t}
+	if model != "" {
+		e.model = &model
+	}
+	return e
+}
+
+func (e *AudioExtractor) Name() string  { return "audio" }
+func (e *AudioExtractor) Priority() int { return 12 }
+
+// Version includes the configured model, since another model transcribes
+// the same recording differently.
+func (e *AudioExtractor) Version() string {
+	if e.model == nil {
+		return "1"
+	}
+	return "1+" + *e.model
+}
+
+func (e *AudioExtractor) CanHandle(asset storage.FileAsset) bool {
+	return IsAudio(asset.Filename)
+}
+
+// IsAudio reports whether filename is a recording AudioExtractor transcribes.
+func IsAudio(filename string) bool {
+	_, ok := audioFormats[strings.ToLower(filepath.Ext(filename))]
+	return ok
+}
+
+func (e *AudioExtractor) Extract(asset storage.FileAsset) ([]storage.ContentAtom, error) {
+	tr, err := e.transcriber.Transcribe(asset.Path, e.model)
+	if err != nil {
+		return nil, fmt.Errorf("transcribe %s: %w", asset.Filename, err)
+	}
+
+	var cues []subtitleCue
+	for _, s := range tr.Segments {
+		text := strings.Join(strings.Fields(s.Text), " ")
+		if text == "" {
+			continue
+		}
+		cues = append(cues, subtitleCue{start: s.Start, end: s.End, text: text})
+	}
+
+	var atoms []storage.ContentAtom
+	seqIdx := 0
+	for _, group := range groupSubtitleCues(cues) {
+		lines := make([]string, len(group))
+		for i, c := range group {
+			lines[i] = c.text
+		}
+		text := strings.Join(lines, "\n")
+		start, end := group[0].start, group[len(group)-1].end
+		anchor := storage.EvidenceAnchor{AssetID: asset.ID, TimeStart: &start, TimeEnd: &end}
+		atom := storage.NewContentAtom(
+			ComputeAtomID(asset.ID, storage.AtomText, seqIdx),
+			asset.ID, storage.AtomText, seqIdx, anchor.ToJSON(),
+		)
+		atom.PayloadText = &text
+		atoms = append(atoms, atom)
+		seqIdx++
+	}
+
+	duration := tr.Duration
+	if duration == 0 && len(cues) > 0 {
+		duration = cues[len(cues)-1].end
+	}
+	meta := map[string]string{
+		"format":        audioFormats[strings.ToLower(filepath.Ext(asset.Filename))],
+		"segment_count": strconv.Itoa(len(cues)),
+		"duration":      storage.FormatTimestamp(duration),
+	}
+	if tr.Language != "" {
+		meta["spoken_language"] = tr.Language
+	}
+	if e.model != nil {
+		meta["transcription_model"] = *e.model
+	}
+	atoms = append(atoms, metadataAtom(asset.ID, meta, seqIdx))
+	return atoms, nil
+}
@@ -0,0 +1,67 @@
+package extractors
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/oho/knowledge-refinery-daemon/internal/lmstudio"
+	"github.com/oho/knowledge-refinery-daemon/internal/storage"
+)
+
+type fakeTranscriber struct {
+	model string
+	tr    lmstudio.Transcription
+}
+
+func (f *fakeTranscriber) Transcribe(audioPath string, model *string) (*lmstudio.Transcription, error) {
+	if model != nil {
+		f.model = *model
+	}
+	return &f.tr, nil
+}
+
+func TestAudioExtractorGroupsSegments(t *testing.T) {
+	fake := &fakeTranscriber{tr: lmstudio.Transcription{
+		Language: "english",
+		Duration: 95.5,
+		Segments: []lmstudio.TranscriptionSegment{
+			{Start: 0, End: 4.2, Text: " Welcome to the weekly sync."},
+			{Start: 4.2, End: 9, Text: " First item is the   release."},
+			{Start: 9, End: 10, Text: "  "},
+			{Start: 80, End: 95.5, Text: " Let's wrap up."},
+		},
+	}}
+	e := NewAudioExtractor(fake, "whisper-large-v3")
+	asset := storage.NewFileAsset("audio", "/tmp/sync.M4A", "sync.M4A")
+	if !e.CanHandle(asset) {
+		t.Fatal("expected .M4A to be handled")
+	}
+
+	atoms, err := e.Extract(asset)
+	if err != nil {
+		t.Fatalf("Extract: %v", err)
+	}
+	if fake.model != "whisper-large-v3" {
+		t.Errorf("model = %q", fake.model)
+	}
+	if len(atoms) != 3 {
+		t.Fatalf("expected 2 groups and a metadata atom, got %d atoms", len(atoms))
+	}
+	if got := *atoms[0].PayloadText; got != "Welcome to the weekly sync.\nFirst item is the release." {
+		t.Errorf("group 1 = %q", got)
+	}
+
+	var anchor storage.EvidenceAnchor
+	json.Unmarshal([]byte(atoms[1].EvidenceAnchor), &anchor)
+	if anchor.TimeStart == nil || *anchor.TimeStart != 80 || anchor.TimeEnd == nil || *anchor.TimeEnd != 95.5 {
+		t.Errorf("group 2 anchor = %+v", anchor)
+	}
+
+	meta := *atoms[2].MetadataJSON
+	for _, want := range []string{`"format":"M4A"`, `"segment_count":"3"`, `"duration":"00:01:35.500"`, `"spoken_language":"english"`} {
+		if !strings.Contains(meta, want) {
+			t.Errorf("metadata %s missing %s", meta, want)
+		}
+	}
+}
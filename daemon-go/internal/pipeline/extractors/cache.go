@@ -0,0 +1,241 @@
+package extractors
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oho/knowledge-refinery-daemon/internal/storage"
+)
+
+// registryCacheVersion covers the post-processing Registry.Extract applies
+// to every extractor's output (language tags, the metadata pass). Bump it
+// when that changes so cached results are not reused.
+const registryCacheVersion = 1
+
+// VersionedExtractor is implemented by extractors whose output depends on
+// configuration or has changed since their first release. Extractors
+// without it are cached as version "1"; bump the version whenever an
+// extractor's output changes.
+type VersionedExtractor interface {
+	Version() string
+}
+
+func extractorVersion(e Extractor) string {
+	if v, ok := e.(VersionedExtractor); ok {
+		return v.Version()
+	}
+	return "1"
+}
+
+// ExtractCache stores extraction results on disk keyed by content hash,
+// extractor name and extractor version, so unchanged bytes are never
+// re-extracted by an unchanged extractor. Entries are gzipped JSON; the
+// least recently used are evicted once the cache exceeds maxBytes.
+type ExtractCache struct {
+	dir      string
+	maxBytes int64
+
+	mu     sync.Mutex
+	size   int64
+	loaded bool // size has been computed from disk
+}
+
+func NewExtractCache(dir string, maxBytes int64) *ExtractCache {
+	return &ExtractCache{dir: dir, maxBytes: maxBytes}
+}
+
+func (c *ExtractCache) path(key string) string {
+	return filepath.Join(c.dir, key[:2], key+".json.gz")
+}
+
+func cacheKey(contentHash string, e Extractor) string {
+	h := sha256.Sum256([]byte(fmt.Sprintf("%s:%s:%s:%d", contentHash, e.Name(), extractorVersion(e), registryCacheVersion)))
+	return fmt.Sprintf("%x", h)
+}
+
+// Get returns the cached atoms for asset, rewritten to belong to it. The
+// second result is false on a miss or an unreadable entry.
+func (c *ExtractCache) Get(asset storage.FileAsset, e Extractor) ([]storage.ContentAtom, bool) {
+	if asset.ContentHash == nil {
+		return nil, false
+	}
+	path := c.path(cacheKey(*asset.ContentHash, e))
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, false
+	}
+	defer f.Close()
+
+	var entry cacheEntry
+	zr, err := gzip.NewReader(f)
+	if err == nil {
+		err = json.NewDecoder(zr).Decode(&entry)
+	}
+	if err != nil {
+		slog.Warn("Dropping unreadable extraction cache entry", "path", path, "error", err)
+		c.remove(path)
+		return nil, false
+	}
+	now := time.Now()
+	os.Chtimes(path, now, now) // mark as recently used
+	return rebaseAtoms(entry.Atoms, entry.AssetPath, asset), true
+}
+
+// Put stores atoms extracted from asset. Results that reference files
+// other than the asset itself cannot be reused elsewhere and are skipped.
+func (c *ExtractCache) Put(asset storage.FileAsset, e Extractor, atoms []storage.ContentAtom) {
+	if asset.ContentHash == nil {
+		return
+	}
+	for _, a := range atoms {
+		if a.PayloadRef != nil && *a.PayloadRef != asset.Path {
+			return
+		}
+	}
+
+	path := c.path(cacheKey(*asset.ContentHash, e))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		slog.Warn("Extraction cache unavailable", "dir", c.dir, "error", err)
+		return
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".entry-*")
+	if err != nil {
+		return
+	}
+	zw := gzip.NewWriter(tmp)
+	err = json.NewEncoder(zw).Encode(cacheEntry{AssetPath: asset.Path, Atoms: atoms})
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.loadSize()
+	if info, err := os.Stat(path); err == nil {
+		c.size -= info.Size()
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+	if info, err := os.Stat(path); err == nil {
+		c.size += info.Size()
+	}
+	if c.size > c.maxBytes {
+		c.evict()
+	}
+}
+
+type cacheEntry struct {
+	AssetPath string                `json:"asset_path"`
+	Atoms     []storage.ContentAtom `json:"atoms"`
+}
+
+// rebaseAtoms moves cached atoms onto asset: IDs and anchors are recomputed
+// for its asset ID, exactly as a fresh extraction would produce them, and
+// references to the originally extracted file point at asset's path.
+func rebaseAtoms(cached []storage.ContentAtom, cachedPath string, asset storage.FileAsset) []storage.ContentAtom {
+	atoms := make([]storage.ContentAtom, len(cached))
+	for i, a := range cached {
+		anchor, err := storage.ParseEvidenceAnchor(a.EvidenceAnchor)
+		if err != nil {
+			anchor = storage.EvidenceAnchor{}
+		}
+		anchor.AssetID = asset.ID
+		atom := storage.NewContentAtom(
+			ComputeAtomID(asset.ID, a.AtomType, a.SequenceIndex),
+			asset.ID, a.AtomType, a.SequenceIndex, anchor.ToJSON(),
+		)
+		atom.PayloadText = a.PayloadText
+		atom.MetadataJSON = a.MetadataJSON
+		if a.PayloadRef != nil {
+			ref := *a.PayloadRef
+			if ref == cachedPath {
+				ref = asset.Path
+			}
+			atom.PayloadRef = &ref
+		}
+		atoms[i] = atom
+	}
+	return atoms
+}
+
+type cacheFile struct {
+	path  string
+	size  int64
+	mtime time.Time
+}
+
+func (c *ExtractCache) files() []cacheFile {
+	var files []cacheFile
+	filepath.WalkDir(c.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(path, ".json.gz") {
+			return nil // skip entries still being written
+		}
+		if info, err := d.Info(); err == nil {
+			files = append(files, cacheFile{path: path, size: info.Size(), mtime: info.ModTime()})
+		}
+		return nil
+	})
+	return files
+}
+
+// loadSize computes the cache size from disk on first use. Callers hold mu.
+func (c *ExtractCache) loadSize() {
+	if c.loaded {
+		return
+	}
+	for _, f := range c.files() {
+		c.size += f.size
+	}
+	c.loaded = true
+}
+
+// evict removes least recently used entries until the cache is back under
+// 90% of its limit, so a full cache does not evict on every write. Callers
+// hold mu.
+func (c *ExtractCache) evict() {
+	files := c.files()
+	sort.Slice(files, func(i, j int) bool { return files[i].mtime.Before(files[j].mtime) })
+	target := c.maxBytes / 10 * 9
+	removed := 0
+	for _, f := range files {
+		if c.size <= target {
+			break
+		}
+		if os.Remove(f.path) == nil {
+			c.size -= f.size
+			removed++
+		}
+	}
+	slog.Debug("Evicted extraction cache entries", "removed", removed, "bytes", c.size)
+}
+
+func (c *ExtractCache) remove(path string) {
+	info, err := os.Stat(path)
+	if err != nil || os.Remove(path) != nil {
+		return
+	}
+	c.mu.Lock()
+	if c.loaded {
+		c.size -= info.Size()
+	}
+	c.mu.Unlock()
+}
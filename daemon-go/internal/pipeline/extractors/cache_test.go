@@ -0,0 +1,134 @@
+package extractors
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/oho/knowledge-refinery-daemon/internal/storage"
+)
+
+// countingExtractor emits one text atom and one atom referencing the asset.
+type countingExtractor struct {
+	calls   int
+	version string
+}
+
+func (e *countingExtractor) Name() string                           { return "counting" }
+func (e *countingExtractor) Priority() int                          { return 1 }
+func (e *countingExtractor) Version() string                        { return e.version }
+func (e *countingExtractor) CanHandle(asset storage.FileAsset) bool { return true }
+
+func (e *countingExtractor) Extract(asset storage.FileAsset) ([]storage.ContentAtom, error) {
+	e.calls++
+	page := 3
+	anchor := storage.EvidenceAnchor{AssetID: asset.ID, Page: &page}
+	text := storage.NewContentAtom(ComputeAtomID(asset.ID, storage.AtomText, 0), asset.ID, storage.AtomText, 0, anchor.ToJSON())
+	body := "Quarterly revenue grew by ten percent."
+	text.PayloadText = &body
+	img := storage.NewContentAtom(ComputeAtomID(asset.ID, storage.AtomImage, 1), asset.ID, storage.AtomImage, 1, anchor.ToJSON())
+	img.PayloadRef = &asset.Path
+	return []storage.ContentAtom{text, img}, nil
+}
+
+func cachedAsset(id, path, hash string) storage.FileAsset {
+	asset := storage.NewFileAsset(id, path, filepath.Base(path))
+	asset.ContentHash = &hash
+	return asset
+}
+
+func TestRegistryCacheReusesAtomsForSameContent(t *testing.T) {
+	ext := &countingExtractor{version: "1"}
+	reg := NewRegistry()
+	reg.Register(ext)
+	reg.SetCache(NewExtractCache(t.TempDir(), 1<<20))
+
+	first, err := reg.Extract(cachedAsset("old-id", "/docs/report.bin", "hash1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The same bytes under a new asset ID (touched or moved file).
+	moved := cachedAsset("new-id", "/archive/report.bin", "hash1")
+	second, err := reg.Extract(moved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ext.calls != 1 {
+		t.Fatalf("extractor ran %d times, want 1", ext.calls)
+	}
+	if len(second) != len(first) {
+		t.Fatalf("cached result has %d atoms, want %d", len(second), len(first))
+	}
+	for i, a := range second {
+		if a.AssetID != "new-id" || a.ID != ComputeAtomID("new-id", a.AtomType, a.SequenceIndex) {
+			t.Errorf("atom %d not rebased: id=%s asset=%s", i, a.ID, a.AssetID)
+		}
+		anchor, _ := storage.ParseEvidenceAnchor(a.EvidenceAnchor)
+		if anchor.AssetID != "new-id" || anchor.Page == nil || *anchor.Page != 3 {
+			t.Errorf("atom %d anchor = %s", i, a.EvidenceAnchor)
+		}
+	}
+	if *second[0].PayloadText != *first[0].PayloadText || second[0].MetadataJSON == nil {
+		t.Errorf("text atom not restored: %+v", second[0])
+	}
+	if second[1].PayloadRef == nil || *second[1].PayloadRef != "/archive/report.bin" {
+		t.Errorf("payload ref = %v, want the new path", second[1].PayloadRef)
+	}
+
+	// A new extractor version or new content must miss.
+	ext.version = "2"
+	reg.Extract(moved)
+	reg.Extract(cachedAsset("new-id", "/archive/report.bin", "hash2"))
+	if ext.calls != 3 {
+		t.Errorf("extractor ran %d times, want 3", ext.calls)
+	}
+}
+
+func TestExtractCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	dir := t.TempDir()
+	ext := &countingExtractor{version: "1"}
+	probe := NewExtractCache(dir, 1<<20)
+	atoms, _ := ext.Extract(cachedAsset("a", "/a", "h0"))
+	probe.Put(cachedAsset("a", "/a", "h0"), ext, atoms)
+	entrySize := probe.size
+
+	cache := NewExtractCache(dir, entrySize*3)
+	old := time.Now().Add(-time.Hour)
+	for i, hash := range []string{"h1", "h2"} {
+		asset := cachedAsset("a", "/a", hash)
+		cache.Put(asset, ext, atoms)
+		stamp := old.Add(time.Duration(i) * time.Minute)
+		os.Chtimes(cache.path(cacheKey(hash, ext)), stamp, stamp)
+	}
+	// h0 was written first but is used now, so h1 is the oldest entry.
+	if _, ok := cache.Get(cachedAsset("b", "/b", "h0"), ext); !ok {
+		t.Fatal("expected h0 to be cached")
+	}
+	cache.Put(cachedAsset("a", "/a", "h3"), ext, atoms)
+
+	if _, ok := cache.Get(cachedAsset("b", "/b", "h1"), ext); ok {
+		t.Error("least recently used entry h1 should have been evicted")
+	}
+	for _, hash := range []string{"h0", "h3"} {
+		if _, ok := cache.Get(cachedAsset("b", "/b", hash), ext); !ok {
+			t.Errorf("entry %s should still be cached", hash)
+		}
+	}
+	if cache.size > entrySize*3 {
+		t.Errorf("cache size %d exceeds limit %d", cache.size, entrySize*3)
+	}
+}
+
+func TestExtractCacheSkipsForeignPayloadRefs(t *testing.T) {
+	cache := NewExtractCache(t.TempDir(), 1<<20)
+	ext := &countingExtractor{version: "1"}
+	asset := cachedAsset("a", "/docs/scan.pdf", "h")
+	ref := "/docs/scan-page1.png"
+	atom := storage.NewContentAtom("x", "a", storage.AtomImage, 0, `{"asset_id":"a"}`)
+	atom.PayloadRef = &ref
+	cache.Put(asset, ext, []storage.ContentAtom{atom})
+	if _, ok := cache.Get(asset, ext); ok {
+		t.Error("atoms referencing other files should not be cached")
+	}
+}
@@ -1,9 +1,10 @@
 package extractors
 
 import (
-	"encoding/binary"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
@@ -11,42 +12,69 @@ import (
 	"github.com/oho/knowledge-refinery-daemon/internal/storage"
 )
 
-// DICOMExtractor does minimal binary header parsing for DICOM files.
-type DICOMExtractor struct{}
+// DICOMExtractor parses DICOM headers into a text summary and a metadata
+// atom, de-identifying patient attributes according to Profile first.
+type DICOMExtractor struct {
+	Profile DeidentifyProfile // zero value means DeidentifyBasic
+	Salt    string            // HMAC key for DeidentifyPseudonymize
+}
 
 func (e *DICOMExtractor) Name() string     { return "dicom" }
 func (e *DICOMExtractor) Priority() int    { return 15 }
 
+// Version changes with the de-identification settings, so cached output
+// produced under another profile or salt is never reused.
+func (e *DICOMExtractor) Version() string {
+	salt := sha256.Sum256([]byte(e.Salt))
+	return fmt.Sprintf("2+%s:%x", e.Profile, salt[:4])
+}
+
 func (e *DICOMExtractor) CanHandle(asset storage.FileAsset) bool {
 	ext := strings.ToLower(filepath.Ext(asset.Filename))
 	return ext == ".dcm" || ext == ".dicom"
 }
 
+// dicomSummaryFields are rendered, in order, into the text atom.
+var dicomSummaryFields = []struct {
+	keyword string
+	label   string
+}{
+	{"PatientName", "Patient"},
+	{"PatientSex", "Sex"},
+	{"PatientAge", "Age"},
+	{"StudyDescription", "Study"},
+	{"SeriesDescription", "Series"},
+	{"Modality", "Modality"},
+	{"BodyPartExamined", "Body part"},
+	{"ProtocolName", "Protocol"},
+	{"StudyDate", "Study date"},
+	{"Manufacturer", "Manufacturer"},
+	{"ManufacturerModelName", "Model"},
+	{"NumberOfFrames", "Frames"},
+}
+
 func (e *DICOMExtractor) Extract(asset storage.FileAsset) ([]storage.ContentAtom, error) {
 	data, err := os.ReadFile(asset.Path)
 	if err != nil {
 		return nil, err
 	}
 
-	metadata := parseDICOMMetadata(data)
+	metadata, reportText := e.parse(data, asset)
 
 	var atoms []storage.ContentAtom
 	seqIdx := 0
 
 	// Text summary
 	var parts []string
-	if v, ok := metadata["PatientName"]; ok {
-		parts = append(parts, fmt.Sprintf("Patient: %s", v))
-	}
-	if v, ok := metadata["StudyDescription"]; ok {
-		parts = append(parts, fmt.Sprintf("Study: %s", v))
-	}
-	if v, ok := metadata["Modality"]; ok {
-		parts = append(parts, fmt.Sprintf("Modality: %s", v))
+	for _, f := range dicomSummaryFields {
+		if v, ok := metadata[f.keyword]; ok {
+			parts = append(parts, fmt.Sprintf("%s: %s", f.label, v))
+		}
 	}
-	if v, ok := metadata["Manufacturer"]; ok {
-		parts = append(parts, fmt.Sprintf("Manufacturer: %s", v))
+	if rows, cols := metadata["Rows"], metadata["Columns"]; rows != "" && cols != "" {
+		parts = append(parts, fmt.Sprintf("Dimensions: %sx%s", cols, rows))
 	}
+	parts = append(parts, reportText...)
 
 	if len(parts) > 0 {
 		text := strings.Join(parts, "\n")
@@ -86,83 +114,47 @@ func (e *DICOMExtractor) Extract(asset storage.FileAsset) ([]storage.ContentAtom
 	return atoms, nil
 }
 
-// parseDICOMMetadata does minimal DICOM binary parsing.
-func parseDICOMMetadata(data []byte) map[string]string {
-	meta := make(map[string]string)
-
-	// Check DICM magic at offset 128
-	if len(data) < 136 {
-		return meta
-	}
-	if string(data[128:132]) != "DICM" {
-		return meta
-	}
-
-	// Known DICOM tags (group, element) -> name
-	tags := map[[2]uint16]string{
-		{0x0010, 0x0010}: "PatientName",
-		{0x0010, 0x0020}: "PatientID",
-		{0x0008, 0x1030}: "StudyDescription",
-		{0x0008, 0x103E}: "SeriesDescription",
-		{0x0008, 0x0060}: "Modality",
-		{0x0008, 0x0070}: "Manufacturer",
-		{0x0008, 0x0080}: "InstitutionName",
-		{0x0008, 0x0020}: "StudyDate",
+// parse returns de-identified metadata keyed by DICOM keyword, plus any
+// structured report text found in nested content sequences.
+func (e *DICOMExtractor) parse(data []byte, asset storage.FileAsset) (map[string]string, []string) {
+	ds, err := parseDICOM(data)
+	if err != nil {
+		slog.Warn("DICOM parse failed", "file", asset.Filename, "error", err)
+		return nil, nil
 	}
+	deid := newDICOMDeidentifier(e.Profile, e.Salt, ds)
+	deid.apply(ds)
 
-	offset := 132
-	for offset+8 <= len(data) {
-		if offset > 10000 { // Don't scan too far
-			break
-		}
-		group := binary.LittleEndian.Uint16(data[offset:])
-		element := binary.LittleEndian.Uint16(data[offset+2:])
-		key := [2]uint16{group, element}
-
-		// Skip meta-header group (0002) with explicit VR
-		vr := string(data[offset+4 : offset+6])
-		var length uint32
-		isExplicitLong := vr == "OB" || vr == "OW" || vr == "OF" || vr == "SQ" || vr == "UC" || vr == "UN" || vr == "UR" || vr == "UT"
-
-		if isExplicitLong {
-			if offset+12 > len(data) {
-				break
-			}
-			length = binary.LittleEndian.Uint32(data[offset+8:])
-			offset += 12
-		} else if vr[0] >= 'A' && vr[0] <= 'Z' && vr[1] >= 'A' && vr[1] <= 'Z' {
-			// Explicit VR, short
-			if offset+8 > len(data) {
-				break
-			}
-			length = uint32(binary.LittleEndian.Uint16(data[offset+6:]))
-			offset += 8
-		} else {
-			// Implicit VR
-			if offset+8 > len(data) {
-				break
+	meta := make(map[string]string)
+	for _, list := range [][]dicomElement{ds.Meta, ds.Elements} {
+		for _, el := range list {
+			if kw := el.keyword(); kw != "" && el.Text != "" {
+				meta[kw] = el.Text
 			}
-			length = binary.LittleEndian.Uint32(data[offset+4:])
-			offset += 8
 		}
+	}
+	if ds.HasPixelData && meta["NumberOfFrames"] == "" {
+		meta["NumberOfFrames"] = "1"
+	}
+	if deid.profile != DeidentifyOff {
+		meta["PatientIdentityRemoved"] = "YES"
+		meta["DeidentificationMethod"] = string(deid.profile)
+	}
 
-		if length == 0xFFFFFFFF || length > 10000 {
-			break
-		}
+	var report []string
+	collectDICOMText(ds.Elements, &report)
+	return meta, report
+}
 
-		if offset+int(length) > len(data) {
-			break
+// collectDICOMText gathers TextValue items from structured report content
+// sequences, depth first.
+func collectDICOMText(elems []dicomElement, out *[]string) {
+	for _, el := range elems {
+		if el.Tag == tagTextValue && strings.TrimSpace(el.Text) != "" {
+			*out = append(*out, strings.TrimSpace(el.Text))
 		}
-
-		if name, ok := tags[key]; ok {
-			value := strings.TrimRight(string(data[offset:offset+int(length)]), "\x00 ")
-			if value != "" {
-				meta[name] = value
-			}
+		for _, item := range el.Items {
+			collectDICOMText(item, out)
 		}
-
-		offset += int(length)
 	}
-
-	return meta
 }
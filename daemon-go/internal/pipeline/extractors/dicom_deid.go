@@ -0,0 +1,283 @@
+package extractors
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/big"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// DeidentifyProfile controls how patient-identifying DICOM attributes are
+// handled before any text or metadata atom is produced.
+type DeidentifyProfile string
+
+const (
+	// DeidentifyBasic removes identifying attributes, private tags and UIDs,
+	// and reduces dates to the year. It is the default.
+	DeidentifyBasic DeidentifyProfile = "basic"
+	// DeidentifyPseudonymize replaces names, IDs and UIDs with salted hashes
+	// so studies of the same patient stay linkable, and retains age, sex,
+	// size and weight for research use.
+	DeidentifyPseudonymize DeidentifyProfile = "pseudonymize"
+	// DeidentifyOff keeps every attribute as recorded.
+	DeidentifyOff DeidentifyProfile = "off"
+)
+
+type deidAction int
+
+const (
+	deidRemove         deidAction = iota
+	deidPseudonym                 // hashed in pseudonymize mode, removed otherwise
+	deidUID                       // remapped in pseudonymize mode, removed otherwise
+	deidYear                      // dates reduced to the year
+	deidCharacteristic            // retained in pseudonymize mode, removed otherwise
+)
+
+// dicomPHITags lists attributes treated as protected health information,
+// following the PS3.15 Basic Application Level Confidentiality Profile for
+// the tags in dicomDictionary. Study and series descriptions are kept but
+// scrubbed of the patient's name.
+var dicomPHITags = map[dicomTag]deidAction{
+	0x00020003: deidUID,  // MediaStorageSOPInstanceUID
+	0x00080012: deidYear, // InstanceCreationDate
+	0x00080013: deidRemove,
+	0x00080014: deidUID,
+	0x00080018: deidUID,
+	0x00080020: deidYear,
+	0x00080021: deidYear,
+	0x00080022: deidYear,
+	0x00080023: deidYear,
+	0x0008002A: deidYear,
+	0x00080030: deidRemove,
+	0x00080031: deidRemove,
+	0x00080032: deidRemove,
+	0x00080033: deidRemove,
+	0x00080050: deidPseudonym, // AccessionNumber
+	0x00080080: deidRemove,    // InstitutionName
+	0x00080081: deidRemove,
+	0x00080090: deidRemove, // ReferringPhysicianName
+	0x00080092: deidRemove,
+	0x00080094: deidRemove,
+	0x00080096: deidRemove,
+	0x00081010: deidRemove, // StationName
+	0x00081040: deidRemove,
+	0x00081048: deidRemove,
+	0x00081050: deidRemove,
+	0x00081060: deidRemove,
+	0x00081070: deidRemove,
+	0x00081080: deidRemove,
+	0x00081120: deidRemove, // ReferencedPatientSequence
+	0x00081155: deidUID,
+	0x00100010: deidPseudonym, // PatientName
+	0x00100020: deidPseudonym, // PatientID
+	0x00100021: deidRemove,
+	0x00100030: deidRemove, // PatientBirthDate
+	0x00100032: deidRemove,
+	0x00100040: deidCharacteristic, // PatientSex
+	0x00100050: deidRemove,
+	0x00101000: deidRemove,
+	0x00101001: deidRemove,
+	0x00101002: deidRemove,
+	0x00101005: deidRemove,
+	0x00101010: deidCharacteristic, // PatientAge
+	0x00101020: deidCharacteristic,
+	0x00101030: deidCharacteristic,
+	0x00101040: deidRemove, // PatientAddress
+	0x00101060: deidRemove,
+	0x00102000: deidRemove,
+	0x00102110: deidRemove,
+	0x00102154: deidRemove,
+	0x00102160: deidRemove,
+	0x00102180: deidRemove,
+	0x001021B0: deidRemove,
+	0x001021C0: deidRemove,
+	0x00104000: deidRemove,
+	0x00181000: deidRemove, // DeviceSerialNumber
+	0x0020000D: deidUID,
+	0x0020000E: deidUID,
+	0x00200010: deidPseudonym, // StudyID
+	0x00200052: deidUID,
+	0x00204000: deidRemove, // ImageComments
+	0x00321032: deidRemove,
+	0x00324000: deidRemove,
+	0x00380010: deidRemove,
+	0x00380300: deidRemove,
+	0x00380500: deidRemove,
+	0x00400244: deidYear,
+	0x00400245: deidRemove,
+	0x00400253: deidRemove,
+	0x00401001: deidRemove,
+	0x00402016: deidRemove,
+	0x00402017: deidRemove,
+	0x0040A124: deidUID,
+}
+
+// freeTextVRs are scrubbed of patient name parts and IDs.
+var freeTextVRs = map[string]bool{
+	"LO": true, "LT": true, "PN": true, "SH": true, "ST": true, "UC": true, "UT": true,
+}
+
+// dicomDeidentifier applies a profile to a parsed dataset.
+type dicomDeidentifier struct {
+	profile DeidentifyProfile
+	salt    []byte
+	names   *regexp.Regexp // patient name parts and IDs to scrub from free text
+}
+
+// newDICOMDeidentifier prepares a de-identifier for ds. Unknown profiles
+// fall back to DeidentifyBasic.
+func newDICOMDeidentifier(profile DeidentifyProfile, salt string, ds *dicomDataset) *dicomDeidentifier {
+	switch profile {
+	case DeidentifyPseudonymize, DeidentifyOff:
+	default:
+		profile = DeidentifyBasic
+	}
+	d := &dicomDeidentifier{profile: profile, salt: []byte(salt)}
+
+	var words []string
+	for _, tag := range []dicomTag{tagPatientName, tagOtherPatientNames, tagPatientBirthName, tagPatientID} {
+		for _, w := range strings.FieldsFunc(ds.value(tag), func(r rune) bool { return r == ' ' || r == ',' }) {
+			if len([]rune(w)) >= 2 {
+				words = append(words, regexp.QuoteMeta(w))
+			}
+		}
+	}
+	if len(words) > 0 {
+		// Longest first, so a part is not cut short by a shorter one it
+		// starts with
+		sort.Slice(words, func(i, j int) bool { return len(words[i]) > len(words[j]) })
+		d.names = regexp.MustCompile(`(?i)(?:` + strings.Join(words, "|") + `)`)
+	}
+	return d
+}
+
+// scrub redacts the patient's name parts and IDs where they stand as whole
+// words in free text. \b only knows ASCII word characters, so the
+// characters around each match are checked as Unicode letters and digits.
+// It makes a single pass, so a name part that occurs in the redaction
+// marker cannot match again.
+func (d *dicomDeidentifier) scrub(text string) string {
+	var sb strings.Builder
+	pos := 0 // text before pos has been copied or redacted
+	for from := 0; from < len(text); {
+		loc := d.names.FindStringIndex(text[from:])
+		if loc == nil {
+			break
+		}
+		start, end := from+loc[0], from+loc[1]
+		before, _ := utf8.DecodeLastRuneInString(text[:start])
+		after, _ := utf8.DecodeRuneInString(text[end:])
+		if (start > 0 && isWordRune(before)) || (end < len(text) && isWordRune(after)) {
+			// Not a whole word; a match may still begin inside it
+			_, size := utf8.DecodeRuneInString(text[start:])
+			from = start + max(size, 1)
+			continue
+		}
+		sb.WriteString(text[pos:start])
+		sb.WriteString("[REDACTED]")
+		pos, from = end, max(end, start+1)
+	}
+	if pos == 0 {
+		return text
+	}
+	sb.WriteString(text[pos:])
+	return sb.String()
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// apply de-identifies the dataset in place.
+func (d *dicomDeidentifier) apply(ds *dicomDataset) {
+	if d.profile == DeidentifyOff {
+		return
+	}
+	ds.Meta = d.applyElements(ds.Meta)
+	ds.Elements = d.applyElements(ds.Elements)
+}
+
+func (d *dicomDeidentifier) applyElements(elems []dicomElement) []dicomElement {
+	out := make([]dicomElement, 0, len(elems))
+	for _, el := range elems {
+		if el.Tag.group()%2 == 1 {
+			continue // private tags may hold anything
+		}
+		action, phi := dicomPHITags[el.Tag]
+		if !phi {
+			for i := range el.Items {
+				el.Items[i] = d.applyElements(el.Items[i])
+			}
+			if d.names != nil && el.Text != "" && freeTextVRs[el.VR] {
+				el.Text = d.scrub(el.Text)
+			}
+			out = append(out, el)
+			continue
+		}
+		if el.Text == "" {
+			continue
+		}
+
+		switch action {
+		case deidRemove:
+			continue
+		case deidPseudonym:
+			if d.profile != DeidentifyPseudonymize {
+				continue
+			}
+			el.Text = d.pseudonym(el.Text)
+		case deidUID:
+			if d.profile != DeidentifyPseudonymize {
+				continue
+			}
+			el.Text = d.uid(el.Text)
+		case deidYear:
+			if len(el.Text) < 4 {
+				continue
+			}
+			el.Text = el.Text[:4]
+		case deidCharacteristic:
+			if d.profile != DeidentifyPseudonymize {
+				continue
+			}
+			if el.Tag == tagPatientAge {
+				el.Text = capAge(el.Text)
+			}
+		}
+		el.Value, el.Items = nil, nil
+		out = append(out, el)
+	}
+	return out
+}
+
+func (d *dicomDeidentifier) mac(value string) []byte {
+	h := hmac.New(sha256.New, d.salt)
+	h.Write([]byte(value))
+	return h.Sum(nil)
+}
+
+// pseudonym maps a value to a stable "ANON-…" token.
+func (d *dicomDeidentifier) pseudonym(value string) string {
+	return "ANON-" + strings.ToUpper(hex.EncodeToString(d.mac(value))[:12])
+}
+
+// uid maps a UID to a stable UUID-derived UID under the 2.25 root.
+func (d *dicomDeidentifier) uid(value string) string {
+	return "2.25." + new(big.Int).SetBytes(d.mac(value)[:16]).String()
+}
+
+// capAge reports ages over 89 years as 090Y, as HIPAA Safe Harbor requires.
+func capAge(age string) string {
+	if len(age) == 4 && age[3] == 'Y' {
+		if n, err := strconv.Atoi(age[:3]); err == nil && n > 89 {
+			return "090Y"
+		}
+	}
+	return age
+}
@@ -0,0 +1,214 @@
+package extractors
+
+import "fmt"
+
+// dicomTag packs a (group, element) pair as group<<16 | element.
+type dicomTag uint32
+
+func newDICOMTag(group, element uint16) dicomTag {
+	return dicomTag(uint32(group)<<16 | uint32(element))
+}
+
+func (t dicomTag) group() uint16 { return uint16(t >> 16) }
+
+func (t dicomTag) String() string {
+	return fmt.Sprintf("(%04X,%04X)", uint16(t>>16), uint16(t))
+}
+
+// Structural tags.
+const (
+	tagItem                 dicomTag = 0xFFFEE000
+	tagItemDelimitation     dicomTag = 0xFFFEE00D
+	tagSequenceDelimitation dicomTag = 0xFFFEE0DD
+	tagPixelData            dicomTag = 0x7FE00010
+	tagTransferSyntaxUID    dicomTag = 0x00020010
+	tagSpecificCharacterSet dicomTag = 0x00080005
+	tagPatientName          dicomTag = 0x00100010
+	tagPatientID            dicomTag = 0x00100020
+	tagOtherPatientNames    dicomTag = 0x00101001
+	tagPatientBirthName     dicomTag = 0x00101005
+	tagPatientAge           dicomTag = 0x00101010
+	tagNumberOfFrames       dicomTag = 0x00280008
+	tagTextValue            dicomTag = 0x0040A160
+)
+
+type dicomTagInfo struct {
+	vr      string
+	keyword string
+}
+
+// dicomDictionary is the subset of the PS3.6 data dictionary the extractor
+// understands: identification, patient, study/series, acquisition, image
+// geometry and structured report text. VRs are needed for implicit VR files;
+// keywords name the metadata fields. Tags outside the dictionary are parsed
+// (so sequences nest correctly) but not reported.
+var dicomDictionary = map[dicomTag]dicomTagInfo{
+	// File meta information
+	0x00020000: {"UL", "FileMetaInformationGroupLength"},
+	0x00020001: {"OB", "FileMetaInformationVersion"},
+	0x00020002: {"UI", "MediaStorageSOPClassUID"},
+	0x00020003: {"UI", "MediaStorageSOPInstanceUID"},
+	0x00020010: {"UI", "TransferSyntaxUID"},
+	0x00020012: {"UI", "ImplementationClassUID"},
+	0x00020013: {"SH", "ImplementationVersionName"},
+	0x00020016: {"AE", "SourceApplicationEntityTitle"},
+
+	// Identification
+	0x00080005: {"CS", "SpecificCharacterSet"},
+	0x00080008: {"CS", "ImageType"},
+	0x00080012: {"DA", "InstanceCreationDate"},
+	0x00080013: {"TM", "InstanceCreationTime"},
+	0x00080014: {"UI", "InstanceCreatorUID"},
+	0x00080016: {"UI", "SOPClassUID"},
+	0x00080018: {"UI", "SOPInstanceUID"},
+	0x00080020: {"DA", "StudyDate"},
+	0x00080021: {"DA", "SeriesDate"},
+	0x00080022: {"DA", "AcquisitionDate"},
+	0x00080023: {"DA", "ContentDate"},
+	0x0008002A: {"DT", "AcquisitionDateTime"},
+	0x00080030: {"TM", "StudyTime"},
+	0x00080031: {"TM", "SeriesTime"},
+	0x00080032: {"TM", "AcquisitionTime"},
+	0x00080033: {"TM", "ContentTime"},
+	0x00080050: {"SH", "AccessionNumber"},
+	0x00080060: {"CS", "Modality"},
+	0x00080064: {"CS", "ConversionType"},
+	0x00080068: {"CS", "PresentationIntentType"},
+	0x00080070: {"LO", "Manufacturer"},
+	0x00080080: {"LO", "InstitutionName"},
+	0x00080081: {"ST", "InstitutionAddress"},
+	0x00080090: {"PN", "ReferringPhysicianName"},
+	0x00080092: {"ST", "ReferringPhysicianAddress"},
+	0x00080094: {"SH", "ReferringPhysicianTelephoneNumbers"},
+	0x00080096: {"SQ", "ReferringPhysicianIdentificationSequence"},
+	0x00080100: {"SH", "CodeValue"},
+	0x00080102: {"SH", "CodingSchemeDesignator"},
+	0x00080104: {"LO", "CodeMeaning"},
+	0x00081010: {"SH", "StationName"},
+	0x00081030: {"LO", "StudyDescription"},
+	0x00081032: {"SQ", "ProcedureCodeSequence"},
+	0x0008103E: {"LO", "SeriesDescription"},
+	0x00081040: {"LO", "InstitutionalDepartmentName"},
+	0x00081048: {"PN", "PhysiciansOfRecord"},
+	0x00081050: {"PN", "PerformingPhysicianName"},
+	0x00081060: {"PN", "NameOfPhysiciansReadingStudy"},
+	0x00081070: {"PN", "OperatorsName"},
+	0x00081080: {"LO", "AdmittingDiagnosesDescription"},
+	0x00081090: {"LO", "ManufacturerModelName"},
+	0x00081110: {"SQ", "ReferencedStudySequence"},
+	0x00081111: {"SQ", "ReferencedPerformedProcedureStepSequence"},
+	0x00081115: {"SQ", "ReferencedSeriesSequence"},
+	0x00081120: {"SQ", "ReferencedPatientSequence"},
+	0x00081140: {"SQ", "ReferencedImageSequence"},
+	0x00081150: {"UI", "ReferencedSOPClassUID"},
+	0x00081155: {"UI", "ReferencedSOPInstanceUID"},
+	0x00082111: {"ST", "DerivationDescription"},
+
+	// Patient
+	0x00100010: {"PN", "PatientName"},
+	0x00100020: {"LO", "PatientID"},
+	0x00100021: {"LO", "IssuerOfPatientID"},
+	0x00100030: {"DA", "PatientBirthDate"},
+	0x00100032: {"TM", "PatientBirthTime"},
+	0x00100040: {"CS", "PatientSex"},
+	0x00100050: {"SQ", "PatientInsurancePlanCodeSequence"},
+	0x00101000: {"LO", "OtherPatientIDs"},
+	0x00101001: {"PN", "OtherPatientNames"},
+	0x00101002: {"SQ", "OtherPatientIDsSequence"},
+	0x00101005: {"PN", "PatientBirthName"},
+	0x00101010: {"AS", "PatientAge"},
+	0x00101020: {"DS", "PatientSize"},
+	0x00101030: {"DS", "PatientWeight"},
+	0x00101040: {"LO", "PatientAddress"},
+	0x00101060: {"PN", "PatientMotherBirthName"},
+	0x00102000: {"LO", "MedicalAlerts"},
+	0x00102110: {"LO", "Allergies"},
+	0x00102154: {"SH", "PatientTelephoneNumbers"},
+	0x00102160: {"SH", "EthnicGroup"},
+	0x00102180: {"SH", "Occupation"},
+	0x001021B0: {"LT", "AdditionalPatientHistory"},
+	0x001021C0: {"US", "PregnancyStatus"},
+	0x00104000: {"LT", "PatientComments"},
+	0x00120062: {"CS", "PatientIdentityRemoved"},
+	0x00120063: {"LO", "DeidentificationMethod"},
+
+	// Acquisition
+	0x00180010: {"LO", "ContrastBolusAgent"},
+	0x00180015: {"CS", "BodyPartExamined"},
+	0x00180020: {"CS", "ScanningSequence"},
+	0x00180021: {"CS", "SequenceVariant"},
+	0x00180022: {"CS", "ScanOptions"},
+	0x00180023: {"CS", "MRAcquisitionType"},
+	0x00180050: {"DS", "SliceThickness"},
+	0x00180060: {"DS", "KVP"},
+	0x00180080: {"DS", "RepetitionTime"},
+	0x00180081: {"DS", "EchoTime"},
+	0x00180082: {"DS", "InversionTime"},
+	0x00180087: {"DS", "MagneticFieldStrength"},
+	0x00180088: {"DS", "SpacingBetweenSlices"},
+	0x00181000: {"LO", "DeviceSerialNumber"},
+	0x00181020: {"LO", "SoftwareVersions"},
+	0x00181030: {"LO", "ProtocolName"},
+	0x00181150: {"IS", "ExposureTime"},
+	0x00181151: {"IS", "XRayTubeCurrent"},
+	0x00181152: {"IS", "Exposure"},
+	0x00181160: {"SH", "FilterType"},
+	0x00181210: {"SH", "ConvolutionKernel"},
+	0x00185100: {"CS", "PatientPosition"},
+
+	// Study / series / instance
+	0x0020000D: {"UI", "StudyInstanceUID"},
+	0x0020000E: {"UI", "SeriesInstanceUID"},
+	0x00200010: {"SH", "StudyID"},
+	0x00200011: {"IS", "SeriesNumber"},
+	0x00200012: {"IS", "AcquisitionNumber"},
+	0x00200013: {"IS", "InstanceNumber"},
+	0x00200020: {"CS", "PatientOrientation"},
+	0x00200032: {"DS", "ImagePositionPatient"},
+	0x00200037: {"DS", "ImageOrientationPatient"},
+	0x00200052: {"UI", "FrameOfReferenceUID"},
+	0x00201041: {"DS", "SliceLocation"},
+	0x00204000: {"LT", "ImageComments"},
+
+	// Image pixel description
+	0x00280002: {"US", "SamplesPerPixel"},
+	0x00280004: {"CS", "PhotometricInterpretation"},
+	0x00280008: {"IS", "NumberOfFrames"},
+	0x00280010: {"US", "Rows"},
+	0x00280011: {"US", "Columns"},
+	0x00280030: {"DS", "PixelSpacing"},
+	0x00280100: {"US", "BitsAllocated"},
+	0x00280101: {"US", "BitsStored"},
+	0x00280102: {"US", "HighBit"},
+	0x00280103: {"US", "PixelRepresentation"},
+	0x00281050: {"DS", "WindowCenter"},
+	0x00281051: {"DS", "WindowWidth"},
+	0x00281052: {"DS", "RescaleIntercept"},
+	0x00281053: {"DS", "RescaleSlope"},
+
+	// Requests, visits and procedure steps
+	0x00321032: {"PN", "RequestingPhysician"},
+	0x00321060: {"LO", "RequestedProcedureDescription"},
+	0x00324000: {"LT", "StudyComments"},
+	0x00380010: {"LO", "AdmissionID"},
+	0x00380300: {"LO", "CurrentPatientLocation"},
+	0x00380500: {"LO", "PatientState"},
+	0x00400244: {"DA", "PerformedProcedureStepStartDate"},
+	0x00400245: {"TM", "PerformedProcedureStepStartTime"},
+	0x00400253: {"SH", "PerformedProcedureStepID"},
+	0x00400254: {"LO", "PerformedProcedureStepDescription"},
+	0x00400275: {"SQ", "RequestAttributesSequence"},
+	0x00401001: {"SH", "RequestedProcedureID"},
+	0x00402016: {"LO", "PlacerOrderNumberImagingServiceRequest"},
+	0x00402017: {"LO", "FillerOrderNumberImagingServiceRequest"},
+
+	// Structured reports
+	0x0040A040: {"CS", "ValueType"},
+	0x0040A043: {"SQ", "ConceptNameCodeSequence"},
+	0x0040A124: {"UI", "UID"},
+	0x0040A160: {"UT", "TextValue"},
+	0x0040A730: {"SQ", "ContentSequence"},
+
+	0x00540081: {"US", "NumberOfSlices"},
+	0x7FE00010: {"OW", "PixelData"},
+}
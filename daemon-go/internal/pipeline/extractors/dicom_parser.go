@@ -0,0 +1,420 @@
+package extractors
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Transfer syntaxes that change how the dataset after the file meta group is
+// encoded. Compressed pixel transfer syntaxes use explicit VR little endian
+// for the dataset itself.
+const (
+	tsImplicitLittleEndian = "1.2.840.10008.1.2"
+	tsDeflatedLittleEndian = "1.2.840.10008.1.2.1.99"
+	tsExplicitBigEndian    = "1.2.840.10008.1.2.2"
+)
+
+const (
+	undefinedLength       = 0xFFFFFFFF
+	maxDICOMDepth         = 16
+	maxDICOMElements      = 100000
+	maxDICOMInflatedBytes = 64 * 1024 * 1024
+)
+
+var (
+	errNotDICOM       = errors.New("dicom: missing DICM marker")
+	errDICOMTruncated = errors.New("dicom: truncated element")
+)
+
+// VRs whose explicit encoding uses a 2-byte reserved field and 4-byte length.
+var longVRs = map[string]bool{
+	"OB": true, "OD": true, "OF": true, "OL": true, "OV": true, "OW": true,
+	"SQ": true, "SV": true, "UC": true, "UN": true, "UR": true, "UT": true, "UV": true,
+}
+
+var shortVRs = map[string]bool{
+	"AE": true, "AS": true, "AT": true, "CS": true, "DA": true, "DS": true,
+	"DT": true, "FD": true, "FL": true, "IS": true, "LO": true, "LT": true,
+	"PN": true, "SH": true, "SL": true, "SS": true, "ST": true, "TM": true,
+	"UI": true, "UL": true, "US": true,
+}
+
+// Free-text VRs keep backslashes and leading spaces; other string VRs are
+// multi-valued and padded.
+var textVRs = map[string]bool{"LT": true, "ST": true, "UT": true}
+
+var stringVRs = map[string]bool{
+	"AE": true, "AS": true, "CS": true, "DA": true, "DS": true, "DT": true,
+	"IS": true, "LO": true, "LT": true, "PN": true, "SH": true, "ST": true,
+	"TM": true, "UC": true, "UI": true, "UR": true, "UT": true,
+}
+
+// dicomElement is one parsed data element. Value holds the raw bytes of
+// non-sequence elements; Text is the decoded display value (empty for
+// binary VRs). Items holds the datasets of a sequence.
+type dicomElement struct {
+	Tag   dicomTag
+	VR    string
+	Value []byte
+	Text  string
+	Items [][]dicomElement
+
+	length uint32 // raw length, only meaningful for item headers
+}
+
+func (e dicomElement) keyword() string {
+	return dicomDictionary[e.Tag].keyword
+}
+
+// dicomDataset is a parsed DICOM file: the file meta group, the main
+// dataset up to (not including) pixel data, and whether pixel data follows.
+type dicomDataset struct {
+	Meta           []dicomElement
+	Elements       []dicomElement
+	TransferSyntax string
+	HasPixelData   bool
+}
+
+// value returns the decoded text of a top-level element.
+func (ds *dicomDataset) value(tag dicomTag) string {
+	for _, list := range [][]dicomElement{ds.Elements, ds.Meta} {
+		for _, e := range list {
+			if e.Tag == tag {
+				return e.Text
+			}
+		}
+	}
+	return ""
+}
+
+type dicomParser struct {
+	data     []byte
+	pos      int
+	order    binary.ByteOrder
+	explicit bool
+	count    int
+	pixels   bool
+}
+
+// parseDICOM parses a DICOM Part 10 file (or a bare dataset without the
+// 128-byte preamble). Explicit and implicit VR, big endian and deflated
+// transfer syntaxes are supported; sequences of defined and undefined length
+// are parsed recursively. Parsing stops at the top-level pixel data. A
+// truncated file yields the elements read so far.
+func parseDICOM(data []byte) (*dicomDataset, error) {
+	pos := 0
+	if len(data) >= 132 && string(data[128:132]) == "DICM" {
+		pos = 132
+	} else if len(data) < 8 || !looksLikeDataset(data) {
+		return nil, errNotDICOM
+	}
+
+	ds := &dicomDataset{}
+
+	// The file meta group is always explicit VR little endian.
+	meta := &dicomParser{data: data, pos: pos, order: binary.LittleEndian, explicit: true}
+	for meta.pos+8 <= len(data) && binary.LittleEndian.Uint16(data[meta.pos:]) == 0x0002 {
+		el, err := meta.readElement(0)
+		if err != nil {
+			break
+		}
+		ds.Meta = append(ds.Meta, el)
+	}
+	decodeDICOMText(ds.Meta, "", binary.LittleEndian)
+	for _, e := range ds.Meta {
+		if e.Tag == tagTransferSyntaxUID {
+			ds.TransferSyntax = e.Text
+		}
+	}
+
+	p := &dicomParser{data: data[meta.pos:], order: binary.LittleEndian, explicit: true}
+	switch ds.TransferSyntax {
+	case tsImplicitLittleEndian:
+		p.explicit = false
+	case tsExplicitBigEndian:
+		p.order = binary.BigEndian
+	case tsDeflatedLittleEndian:
+		inflated, err := io.ReadAll(io.LimitReader(flate.NewReader(bytes.NewReader(p.data)), maxDICOMInflatedBytes))
+		if err != nil && len(inflated) == 0 {
+			return nil, fmt.Errorf("dicom: inflate dataset: %w", err)
+		}
+		p.data = inflated
+	case "":
+		p.explicit = len(p.data) >= 6 && (shortVRs[string(p.data[4:6])] || longVRs[string(p.data[4:6])])
+	}
+
+	ds.Elements, _ = p.readElements(len(p.data), 0)
+	ds.HasPixelData = p.pixels
+	decodeDICOMText(ds.Elements, charsetOf(ds.Elements), p.order)
+	return ds, nil
+}
+
+// looksLikeDataset accepts preamble-less files that start with the file
+// meta group or the identification group.
+func looksLikeDataset(data []byte) bool {
+	group := binary.LittleEndian.Uint16(data)
+	return group == 0x0002 || group == 0x0008
+}
+
+// readElements reads elements until end, an item delimiter, or (at the top
+// level) the pixel data element.
+func (p *dicomParser) readElements(end, depth int) ([]dicomElement, error) {
+	var out []dicomElement
+	for p.pos < end {
+		if depth == 0 && p.pos+4 <= len(p.data) && p.peekTag() == tagPixelData {
+			p.pixels = true
+			return out, nil
+		}
+		el, err := p.readElement(depth)
+		if err != nil {
+			return out, err
+		}
+		if el.Tag == tagItemDelimitation {
+			return out, nil
+		}
+		out = append(out, el)
+	}
+	return out, nil
+}
+
+func (p *dicomParser) peekTag() dicomTag {
+	return newDICOMTag(p.order.Uint16(p.data[p.pos:]), p.order.Uint16(p.data[p.pos+2:]))
+}
+
+func (p *dicomParser) readElement(depth int) (dicomElement, error) {
+	if p.pos+8 > len(p.data) {
+		return dicomElement{}, errDICOMTruncated
+	}
+	if p.count++; p.count > maxDICOMElements {
+		return dicomElement{}, fmt.Errorf("dicom: more than %d elements", maxDICOMElements)
+	}
+	el := dicomElement{Tag: p.peekTag()}
+
+	var length uint32
+	switch {
+	case el.Tag.group() == 0xFFFE:
+		// Item and delimitation headers never carry a VR.
+		el.length = p.order.Uint32(p.data[p.pos+4:])
+		p.pos += 8
+		return el, nil
+	case p.explicit:
+		el.VR = string(p.data[p.pos+4 : p.pos+6])
+		if longVRs[el.VR] {
+			if p.pos+12 > len(p.data) {
+				return el, errDICOMTruncated
+			}
+			length = p.order.Uint32(p.data[p.pos+8:])
+			p.pos += 12
+		} else {
+			length = uint32(p.order.Uint16(p.data[p.pos+6:]))
+			p.pos += 8
+		}
+	default:
+		el.VR = "UN"
+		if info, ok := dicomDictionary[el.Tag]; ok {
+			el.VR = info.vr
+		}
+		length = p.order.Uint32(p.data[p.pos+4:])
+		p.pos += 8
+	}
+
+	switch {
+	case el.VR == "SQ":
+		items, err := p.readSequence(length, depth)
+		el.Items = items
+		return el, err
+	case length == undefinedLength && (el.VR == "OB" || el.VR == "OW"):
+		// Encapsulated (compressed) pixel data fragments.
+		return el, p.skipFragments()
+	case length == undefinedLength:
+		// UN of undefined length is a sequence encoded as implicit VR
+		// little endian (PS3.5 6.2.2).
+		explicit, order := p.explicit, p.order
+		p.explicit, p.order = false, binary.LittleEndian
+		items, err := p.readSequence(length, depth)
+		p.explicit, p.order = explicit, order
+		el.VR, el.Items = "SQ", items
+		return el, err
+	}
+
+	if int64(length) > int64(len(p.data)-p.pos) {
+		return el, errDICOMTruncated
+	}
+	el.Value = p.data[p.pos : p.pos+int(length)]
+	p.pos += int(length)
+	return el, nil
+}
+
+func (p *dicomParser) readSequence(length uint32, depth int) ([][]dicomElement, error) {
+	if depth >= maxDICOMDepth {
+		return nil, fmt.Errorf("dicom: sequences nested deeper than %d", maxDICOMDepth)
+	}
+	end := len(p.data)
+	if length != undefinedLength {
+		if int64(length) > int64(len(p.data)-p.pos) {
+			return nil, errDICOMTruncated
+		}
+		end = p.pos + int(length)
+	}
+
+	var items [][]dicomElement
+	for p.pos < end {
+		hdr, err := p.readElement(depth)
+		if err != nil {
+			return items, err
+		}
+		switch hdr.Tag {
+		case tagSequenceDelimitation:
+			return items, nil
+		case tagItem:
+			itemEnd := end
+			if hdr.length != undefinedLength {
+				if int64(hdr.length) > int64(end-p.pos) {
+					return items, errDICOMTruncated
+				}
+				itemEnd = p.pos + int(hdr.length)
+			}
+			elems, err := p.readElements(itemEnd, depth+1)
+			items = append(items, elems)
+			if err != nil {
+				return items, err
+			}
+			if hdr.length != undefinedLength {
+				p.pos = itemEnd
+			}
+		default:
+			return items, fmt.Errorf("dicom: unexpected %s in sequence", hdr.Tag)
+		}
+	}
+	return items, nil
+}
+
+func (p *dicomParser) skipFragments() error {
+	for {
+		hdr, err := p.readElement(0)
+		if err != nil {
+			return err
+		}
+		switch hdr.Tag {
+		case tagSequenceDelimitation:
+			return nil
+		case tagItem:
+			if int64(hdr.length) > int64(len(p.data)-p.pos) {
+				return errDICOMTruncated
+			}
+			p.pos += int(hdr.length)
+		default:
+			return fmt.Errorf("dicom: unexpected %s in pixel data", hdr.Tag)
+		}
+	}
+}
+
+func charsetOf(elems []dicomElement) string {
+	for _, e := range elems {
+		if e.Tag == tagSpecificCharacterSet {
+			return strings.TrimSpace(strings.TrimRight(string(e.Value), "\x00 "))
+		}
+	}
+	return ""
+}
+
+// decodeDICOMText fills Text for every element, recursing into sequences.
+// Nested datasets inherit the character set unless they declare their own.
+func decodeDICOMText(elems []dicomElement, charset string, order binary.ByteOrder) {
+	for i := range elems {
+		e := &elems[i]
+		for j := range e.Items {
+			itemCharset := charset
+			if cs := charsetOf(e.Items[j]); cs != "" {
+				itemCharset = cs
+			}
+			decodeDICOMText(e.Items[j], itemCharset, order)
+		}
+		e.Text = decodeDICOMValue(e.VR, e.Value, charset, order)
+	}
+}
+
+// decodeDICOMValue renders a raw value for display. Multiple values are
+// joined with ", "; person names are rendered as "Family Given".
+func decodeDICOMValue(vr string, raw []byte, charset string, order binary.ByteOrder) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	if stringVRs[vr] {
+		s := decodeDICOMString(raw, charset)
+		s = strings.TrimRight(s, "\x00 ")
+		if textVRs[vr] {
+			return s
+		}
+		parts := strings.Split(s, `\`)
+		for i, part := range parts {
+			part = strings.TrimSpace(part)
+			if vr == "PN" {
+				// Use the alphabetic component group; ideographic and
+				// phonetic groups follow '='.
+				part, _, _ = strings.Cut(part, "=")
+				part = strings.Join(strings.Fields(strings.ReplaceAll(part, "^", " ")), " ")
+			}
+			parts[i] = part
+		}
+		return strings.Join(parts, ", ")
+	}
+
+	var vals []string
+	switch vr {
+	case "US":
+		for i := 0; i+2 <= len(raw); i += 2 {
+			vals = append(vals, strconv.FormatUint(uint64(order.Uint16(raw[i:])), 10))
+		}
+	case "SS":
+		for i := 0; i+2 <= len(raw); i += 2 {
+			vals = append(vals, strconv.FormatInt(int64(int16(order.Uint16(raw[i:]))), 10))
+		}
+	case "UL":
+		for i := 0; i+4 <= len(raw); i += 4 {
+			vals = append(vals, strconv.FormatUint(uint64(order.Uint32(raw[i:])), 10))
+		}
+	case "SL":
+		for i := 0; i+4 <= len(raw); i += 4 {
+			vals = append(vals, strconv.FormatInt(int64(int32(order.Uint32(raw[i:]))), 10))
+		}
+	case "FL":
+		for i := 0; i+4 <= len(raw); i += 4 {
+			vals = append(vals, strconv.FormatFloat(float64(math.Float32frombits(order.Uint32(raw[i:]))), 'g', -1, 32))
+		}
+	case "FD":
+		for i := 0; i+8 <= len(raw); i += 8 {
+			vals = append(vals, strconv.FormatFloat(math.Float64frombits(order.Uint64(raw[i:])), 'g', -1, 64))
+		}
+	case "AT":
+		for i := 0; i+4 <= len(raw); i += 4 {
+			vals = append(vals, newDICOMTag(order.Uint16(raw[i:]), order.Uint16(raw[i+2:])).String())
+		}
+	}
+	return strings.Join(vals, ", ")
+}
+
+// decodeDICOMString handles the default repertoire, ISO_IR 100 (Latin-1)
+// and ISO_IR 192 (UTF-8). Other character sets are passed through with
+// invalid sequences replaced.
+func decodeDICOMString(raw []byte, charset string) string {
+	if strings.Contains(charset, "ISO_IR 100") || strings.Contains(charset, "ISO 2022 IR 100") {
+		runes := make([]rune, len(raw))
+		for i, b := range raw {
+			runes[i] = rune(b)
+		}
+		return string(runes)
+	}
+	if utf8.Valid(raw) {
+		return string(raw)
+	}
+	return strings.ToValidUTF8(string(raw), "�")
+}
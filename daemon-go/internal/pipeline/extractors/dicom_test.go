@@ -0,0 +1,258 @@
+package extractors
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/oho/knowledge-refinery-daemon/internal/storage"
+)
+
+// dicomWriter builds little endian DICOM test files.
+type dicomWriter struct {
+	buf      bytes.Buffer
+	explicit bool
+}
+
+func (w *dicomWriter) element(group, elem uint16, vr string, value []byte) {
+	le := binary.LittleEndian
+	binary.Write(&w.buf, le, group)
+	binary.Write(&w.buf, le, elem)
+	if len(value)%2 == 1 {
+		value = append(value, ' ')
+	}
+	switch {
+	case !w.explicit:
+		binary.Write(&w.buf, le, uint32(len(value)))
+	case longVRs[vr]:
+		w.buf.WriteString(vr)
+		w.buf.Write([]byte{0, 0})
+		binary.Write(&w.buf, le, uint32(len(value)))
+	default:
+		w.buf.WriteString(vr)
+		binary.Write(&w.buf, le, uint16(len(value)))
+	}
+	w.buf.Write(value)
+}
+
+func (w *dicomWriter) str(group, elem uint16, vr, value string) {
+	w.element(group, elem, vr, []byte(value))
+}
+
+// sequence writes an undefined-length sequence of undefined-length items.
+func (w *dicomWriter) sequence(group, elem uint16, items ...func(*dicomWriter)) {
+	le := binary.LittleEndian
+	binary.Write(&w.buf, le, group)
+	binary.Write(&w.buf, le, elem)
+	if w.explicit {
+		w.buf.WriteString("SQ")
+		w.buf.Write([]byte{0, 0})
+	}
+	binary.Write(&w.buf, le, uint32(undefinedLength))
+	for _, item := range items {
+		binary.Write(&w.buf, le, []uint16{0xFFFE, 0xE000})
+		binary.Write(&w.buf, le, uint32(undefinedLength))
+		item(w)
+		binary.Write(&w.buf, le, []uint16{0xFFFE, 0xE00D})
+		binary.Write(&w.buf, le, uint32(0))
+	}
+	binary.Write(&w.buf, le, []uint16{0xFFFE, 0xE0DD})
+	binary.Write(&w.buf, le, uint32(0))
+}
+
+func buildDICOM(transferSyntax string, body func(*dicomWriter)) []byte {
+	meta := &dicomWriter{explicit: true}
+	meta.str(0x0002, 0x0010, "UI", transferSyntax)
+	ds := &dicomWriter{explicit: transferSyntax != tsImplicitLittleEndian}
+	body(ds)
+
+	out := make([]byte, 128)
+	out = append(out, "DICM"...)
+	out = append(out, meta.buf.Bytes()...)
+	return append(out, ds.buf.Bytes()...)
+}
+
+func sampleDICOMBody(w *dicomWriter) {
+	w.str(0x0008, 0x0020, "DA", "20230115")
+	w.str(0x0008, 0x0060, "CS", "MR")
+	w.str(0x0008, 0x0080, "LO", "St Mary Hospital")
+	w.str(0x0008, 0x1030, "LO", "Brain MRI for SMITH follow-up")
+	w.str(0x0010, 0x0010, "PN", "SMITH^JANE")
+	w.str(0x0010, 0x0020, "LO", "MRN12345")
+	w.str(0x0010, 0x0030, "DA", "19600101")
+	w.str(0x0010, 0x0040, "CS", "F")
+	w.str(0x0010, 0x1010, "AS", "063Y")
+	w.str(0x0020, 0x000D, "UI", "1.2.3.4.5")
+	w.str(0x0029, 0x0010, "LO", "PRIVATE SMITH")
+	w.sequence(0x0040, 0xA730, func(w *dicomWriter) {
+		w.str(0x0040, 0xA040, "CS", "TEXT")
+		w.str(0x0040, 0xA160, "UT", "No acute findings. Discussed with Jane Smith.")
+	})
+	w.str(0x0028, 0x0008, "IS", "24")
+	w.element(0x0028, 0x0010, "US", []byte{0x00, 0x02})
+	w.element(0x0028, 0x0011, "US", []byte{0x00, 0x01})
+	w.element(0x7FE0, 0x0010, "OW", make([]byte, 16))
+}
+
+func TestParseDICOMExplicitAndImplicitVR(t *testing.T) {
+	for _, ts := range []string{"1.2.840.10008.1.2.1", tsImplicitLittleEndian} {
+		ds, err := parseDICOM(buildDICOM(ts, sampleDICOMBody))
+		if err != nil {
+			t.Fatalf("%s: parseDICOM: %v", ts, err)
+		}
+		if ds.TransferSyntax != ts {
+			t.Errorf("expected transfer syntax %s, got %s", ts, ds.TransferSyntax)
+		}
+		if got := ds.value(tagPatientName); got != "SMITH JANE" {
+			t.Errorf("%s: unexpected PatientName %q", ts, got)
+		}
+		if got := ds.value(tagNumberOfFrames); got != "24" {
+			t.Errorf("%s: unexpected NumberOfFrames %q", ts, got)
+		}
+		if got := ds.value(0x00280010); got != "512" {
+			t.Errorf("%s: unexpected Rows %q", ts, got)
+		}
+		if !ds.HasPixelData {
+			t.Errorf("%s: expected pixel data to be detected", ts)
+		}
+		var report []string
+		collectDICOMText(ds.Elements, &report)
+		if len(report) != 1 || !strings.HasPrefix(report[0], "No acute findings") {
+			t.Errorf("%s: expected report text from sequence, got %v", ts, report)
+		}
+	}
+}
+
+func TestParseDICOMRejectsNonDICOM(t *testing.T) {
+	if _, err := parseDICOM([]byte("definitely not a dicom file at all")); err == nil {
+		t.Error("expected error for non-DICOM data")
+	}
+}
+
+func extractDICOM(t *testing.T, ext *DICOMExtractor) (string, map[string]string) {
+	t.Helper()
+	return extractDICOMBody(t, ext, sampleDICOMBody)
+}
+
+func extractDICOMBody(t *testing.T, ext *DICOMExtractor, body func(*dicomWriter)) (string, map[string]string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "scan.dcm")
+	os.WriteFile(path, buildDICOM("1.2.840.10008.1.2.1", body), 0644)
+
+	atoms, err := ext.Extract(storage.NewFileAsset("asset1", path, "scan.dcm"))
+	if err != nil {
+		t.Fatalf("Extract: %v", err)
+	}
+	var text string
+	meta := map[string]string{}
+	for _, a := range atoms {
+		switch a.AtomType {
+		case storage.AtomText:
+			text = *a.PayloadText
+		case storage.AtomMetadata:
+			json.Unmarshal([]byte(*a.MetadataJSON), &meta)
+		}
+	}
+	return text, meta
+}
+
+func TestDICOMBasicDeidentification(t *testing.T) {
+	text, meta := extractDICOM(t, &DICOMExtractor{})
+
+	all := text
+	for _, v := range meta {
+		all += "\n" + v
+	}
+	for _, leak := range []string{"SMITH", "Smith", "JANE", "Jane", "MRN12345", "1960", "St Mary", "1.2.3.4.5"} {
+		if strings.Contains(all, leak) {
+			t.Errorf("de-identified output leaks %q:\n%s", leak, all)
+		}
+	}
+	if meta["StudyDate"] != "2023" {
+		t.Errorf("expected StudyDate reduced to year, got %q", meta["StudyDate"])
+	}
+	if _, ok := meta["PatientSex"]; ok {
+		t.Error("basic profile should remove PatientSex")
+	}
+	if !strings.Contains(text, "Study: Brain MRI for [REDACTED] follow-up") {
+		t.Errorf("expected scrubbed study description, got:\n%s", text)
+	}
+	if meta["NumberOfFrames"] != "24" || meta["Modality"] != "MR" {
+		t.Errorf("expected technical fields to survive, got %v", meta)
+	}
+}
+
+func TestDICOMDeidentifiesNonASCIINames(t *testing.T) {
+	text, meta := extractDICOMBody(t, &DICOMExtractor{}, func(w *dicomWriter) {
+		w.str(0x0008, 0x0005, "CS", "ISO_IR 192")
+		w.str(0x0008, 0x1030, "LO", "CT for José Åsa")
+		w.str(0x0010, 0x0010, "PN", "Øster^José^Åsa")
+		w.sequence(0x0040, 0xA730, func(w *dicomWriter) {
+			w.str(0x0040, 0xA040, "CS", "TEXT")
+			w.str(0x0040, 0xA160, "UT", "Øster,José: follow-up in 6 months (Åsa)")
+		})
+	})
+	all := text
+	for _, v := range meta {
+		all += "\n" + v
+	}
+	for _, leak := range []string{"José", "Åsa", "Øster"} {
+		if strings.Contains(all, leak) {
+			t.Errorf("de-identified output leaks %q:\n%s", leak, all)
+		}
+	}
+	if !strings.Contains(text, "CT for [REDACTED] [REDACTED]") {
+		t.Errorf("expected scrubbed study description, got:\n%s", text)
+	}
+	if !strings.Contains(text, "[REDACTED],[REDACTED]: follow-up in 6 months ([REDACTED])") {
+		t.Errorf("expected scrubbed report text keeping punctuation, got:\n%s", text)
+	}
+}
+
+func TestDICOMScrubIsSinglePass(t *testing.T) {
+	// A name part found in the redaction marker must not match it again
+	text, _ := extractDICOMBody(t, &DICOMExtractor{}, func(w *dicomWriter) {
+		w.str(0x0008, 0x1030, "LO", "Redacted scan, reviewed by Ann with Anna")
+		w.str(0x0010, 0x0010, "PN", "REDACTED^ANNA^ANN")
+	})
+	if !strings.Contains(text, "Study: [REDACTED] scan, reviewed by [REDACTED] with [REDACTED]") {
+		t.Errorf("expected each name part redacted once, got:\n%s", text)
+	}
+	if strings.Contains(text, "[[") {
+		t.Errorf("redaction marker was redacted again:\n%s", text)
+	}
+}
+
+func TestDICOMPseudonymization(t *testing.T) {
+	_, meta1 := extractDICOM(t, &DICOMExtractor{Profile: DeidentifyPseudonymize, Salt: "s1"})
+	_, meta2 := extractDICOM(t, &DICOMExtractor{Profile: DeidentifyPseudonymize, Salt: "s1"})
+	_, meta3 := extractDICOM(t, &DICOMExtractor{Profile: DeidentifyPseudonymize, Salt: "s2"})
+
+	name := meta1["PatientName"]
+	if !strings.HasPrefix(name, "ANON-") || strings.Contains(name, "SMITH") {
+		t.Errorf("expected pseudonymised PatientName, got %q", name)
+	}
+	if meta2["PatientName"] != name || meta2["StudyInstanceUID"] != meta1["StudyInstanceUID"] {
+		t.Error("pseudonyms should be stable for the same salt")
+	}
+	if meta3["PatientName"] == name {
+		t.Error("pseudonyms should depend on the salt")
+	}
+	if !strings.HasPrefix(meta1["StudyInstanceUID"], "2.25.") {
+		t.Errorf("expected remapped UID, got %q", meta1["StudyInstanceUID"])
+	}
+	if meta1["PatientSex"] != "F" || meta1["PatientAge"] != "063Y" {
+		t.Errorf("pseudonymize profile should retain patient characteristics, got %v", meta1)
+	}
+}
+
+func TestDICOMDeidentificationOff(t *testing.T) {
+	text, meta := extractDICOM(t, &DICOMExtractor{Profile: DeidentifyOff})
+	if meta["PatientName"] != "SMITH JANE" || !strings.Contains(text, "Patient: SMITH JANE") {
+		t.Errorf("off profile should keep PatientName, got %q", meta["PatientName"])
+	}
+}
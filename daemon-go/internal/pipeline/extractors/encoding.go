@@ -0,0 +1,164 @@
+package extractors
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// Encoding names recorded in atom metadata.
+const (
+	encUTF8        = "utf-8"
+	encUTF16LE     = "utf-16le"
+	encUTF16BE     = "utf-16be"
+	encShiftJIS    = "shift_jis"
+	encEUCJP       = "euc-jp"
+	encWindows1252 = "windows-1252"
+)
+
+var declaredCharsetRE = regexp.MustCompile(`(?i)(?:<meta[^>]+charset=["']?|<\?xml[^>]+encoding=["']|\\ansicpg)([\w-]+)`)
+
+// decodeText converts raw file bytes to UTF-8 and reports the source
+// encoding. Detection order: byte order mark, UTF-16 without BOM (NUL byte
+// pattern), valid UTF-8, an in-document declaration (HTML meta, XML prolog,
+// RTF \ansicpg), Japanese multi-byte encodings, and finally Windows-1252,
+// a superset of Latin-1 that decodes any byte sequence.
+func decodeText(data []byte) (string, string) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}):
+		return string(data[3:]), encUTF8
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		return decodeWith(unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM), data[2:]), encUTF16LE
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		return decodeWith(unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM), data[2:]), encUTF16BE
+	}
+
+	if order := guessUTF16(data); order != "" {
+		if order == encUTF16LE {
+			return decodeWith(unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM), data), encUTF16LE
+		}
+		return decodeWith(unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM), data), encUTF16BE
+	}
+
+	if utf8.Valid(data) {
+		return string(data), encUTF8
+	}
+
+	if enc, name := declaredEncoding(data); enc != nil {
+		return decodeWith(enc, data), name
+	}
+
+	for _, candidate := range []struct {
+		enc  encoding.Encoding
+		name string
+	}{
+		{japanese.ShiftJIS, encShiftJIS},
+		{japanese.EUCJP, encEUCJP},
+	} {
+		if text, ok := decodeStrict(candidate.enc, data); ok && looksJapanese(text) {
+			return text, candidate.name
+		}
+	}
+
+	return decodeWith(charmap.Windows1252, data), encWindows1252
+}
+
+// isUTF16 reports whether decodeText reads data as UTF-16, from a byte
+// order mark or the NUL byte pattern.
+func isUTF16(data []byte) bool {
+	return bytes.HasPrefix(data, []byte{0xFF, 0xFE}) || bytes.HasPrefix(data, []byte{0xFE, 0xFF}) || guessUTF16(data) != ""
+}
+
+// guessUTF16 detects BOM-less UTF-16 from the share of NUL bytes at even
+// or odd offsets, which is high for mostly-ASCII text.
+func guessUTF16(data []byte) string {
+	n := len(data)
+	if n > 4096 {
+		n = 4096
+	}
+	if n < 4 {
+		return ""
+	}
+	var evenNUL, oddNUL int
+	for i := 0; i+1 < n; i += 2 {
+		if data[i] == 0 {
+			evenNUL++
+		}
+		if data[i+1] == 0 {
+			oddNUL++
+		}
+	}
+	pairs := n / 2
+	switch {
+	case oddNUL*10 > pairs*6 && evenNUL*10 < pairs:
+		return encUTF16LE
+	case evenNUL*10 > pairs*6 && oddNUL*10 < pairs:
+		return encUTF16BE
+	}
+	return ""
+}
+
+func declaredEncoding(data []byte) (encoding.Encoding, string) {
+	head := data
+	if len(head) > 2048 {
+		head = head[:2048]
+	}
+	m := declaredCharsetRE.FindSubmatch(head)
+	if m == nil {
+		return nil, ""
+	}
+	label := strings.ToLower(string(m[1]))
+	if _, err := strconv.Atoi(label); err == nil {
+		label = "windows-" + label // RTF \ansicpgNNNN
+	}
+	enc, err := htmlindex.Get(label)
+	if err != nil {
+		return nil, ""
+	}
+	name, _ := htmlindex.Name(enc)
+	if name == encUTF8 {
+		return nil, "" // declared UTF-8 but invalid: fall through to heuristics
+	}
+	return enc, name
+}
+
+func decodeWith(enc encoding.Encoding, data []byte) string {
+	out, err := enc.NewDecoder().Bytes(data)
+	if err != nil {
+		return strings.ToValidUTF8(string(data), "�")
+	}
+	return string(out)
+}
+
+// decodeStrict decodes data and rejects the result if the decoder had to
+// substitute replacement characters for invalid sequences.
+func decodeStrict(enc encoding.Encoding, data []byte) (string, bool) {
+	out, err := enc.NewDecoder().Bytes(data)
+	if err != nil || bytes.ContainsRune(out, utf8.RuneError) {
+		return "", false
+	}
+	return string(out), true
+}
+
+// looksJapanese requires kana, which Shift-JIS/EUC-JP misdecodings of
+// Western text almost never produce.
+func looksJapanese(text string) bool {
+	var kana, other int
+	for _, r := range text {
+		switch {
+		case r >= 0x3040 && r <= 0x30FF:
+			kana++
+		case r > 0x7F && !(r >= 0x4E00 && r <= 0x9FFF) && !(r >= 0xFF00 && r <= 0xFFEF) && !(r >= 0x3000 && r <= 0x303F):
+			other++
+		}
+	}
+	return kana > 0 && other*10 < kana
+}
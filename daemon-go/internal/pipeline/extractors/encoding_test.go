@@ -0,0 +1,121 @@
+package extractors
+
+import (
+	"encoding/json"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/unicode"
+
+	"github.com/oho/knowledge-refinery-daemon/internal/storage"
+)
+
+func encode(t *testing.T, enc encoding.Encoding, s string) []byte {
+	t.Helper()
+	b, err := enc.NewEncoder().Bytes([]byte(s))
+	if err != nil {
+		t.Fatalf("encode %q: %v", s, err)
+	}
+	return b
+}
+
+func TestDecodeText(t *testing.T) {
+	const german = "Grüße aus München, schöne Straße."
+	const japaneseText = "こんにちは、世界。日本語のテキストです。"
+
+	tests := []struct {
+		name     string
+		data     []byte
+		wantText string
+		wantEnc  string
+	}{
+		{"utf-8", []byte(german), german, encUTF8},
+		{"utf-8 bom", append([]byte{0xEF, 0xBB, 0xBF}, german...), german, encUTF8},
+		{"utf-16le bom", encode(t, unicode.UTF16(unicode.LittleEndian, unicode.UseBOM), german), german, encUTF16LE},
+		{"utf-16be bom", encode(t, unicode.UTF16(unicode.BigEndian, unicode.UseBOM), german), german, encUTF16BE},
+		{"utf-16le no bom", encode(t, unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM), "Plain ASCII text in UTF-16"), "Plain ASCII text in UTF-16", encUTF16LE},
+		{"latin-1", encode(t, charmap.ISO8859_1, german), german, encWindows1252},
+		{"shift_jis", encode(t, japanese.ShiftJIS, japaneseText), japaneseText, encShiftJIS},
+		{"euc-jp", encode(t, japanese.EUCJP, japaneseText), japaneseText, encEUCJP},
+		{
+			"declared koi8-r",
+			append([]byte(`<meta charset="koi8-r">`), encode(t, charmap.KOI8R, "Привет, мир")...),
+			`<meta charset="koi8-r">Привет, мир`, "koi8-r",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, enc := decodeText(tt.data)
+			if text != tt.wantText || enc != tt.wantEnc {
+				t.Errorf("decodeText = (%q, %q), want (%q, %q)", text, enc, tt.wantText, tt.wantEnc)
+			}
+		})
+	}
+}
+
+func TestRegistryAnnotatesEncodingAndLanguage(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "brief.txt")
+	text := "Sehr geehrte Damen und Herren, die Lieferung ist leider nicht rechtzeitig eingetroffen. Wir bitten um eine Gutschrift für die Verspätung."
+	os.WriteFile(path, encode(t, charmap.Windows1252, text), 0644)
+
+	asset := storage.NewFileAsset("brief-id", path, "brief.txt")
+	atoms, err := CreateDefaultRegistry().Extract(asset)
+	if err != nil {
+		t.Fatalf("Extract: %v", err)
+	}
+	if len(atoms) == 0 || atoms[0].AtomType != storage.AtomText {
+		t.Fatalf("expected a text atom first, got %+v", atoms)
+	}
+	if *atoms[0].PayloadText != text {
+		t.Errorf("text = %q", *atoms[0].PayloadText)
+	}
+	var meta map[string]string
+	if err := json.Unmarshal([]byte(*atoms[0].MetadataJSON), &meta); err != nil {
+		t.Fatalf("metadata: %v", err)
+	}
+	if meta["encoding"] != encWindows1252 || meta["language"] != "de" {
+		t.Errorf("metadata = %v, want windows-1252/de", meta)
+	}
+}
+
+func TestTikaFallbackRejectsBinary(t *testing.T) {
+	random := make([]byte, 4096)
+	rng := rand.New(rand.NewPCG(1, 2))
+	for i := range random {
+		random[i] = byte(rng.UintN(256))
+	}
+	nulHeavy := make([]byte, 4096)
+	for i := range nulHeavy {
+		if i%5 == 0 {
+			nulHeavy[i] = byte('A' + i%26)
+		}
+	}
+
+	dir := t.TempDir()
+	ext := &TikaFallbackExtractor{}
+	for name, data := range map[string][]byte{
+		"random.bin": random,
+		"nuls.bin":   nulHeavy,
+	} {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, data, 0644)
+		atoms, err := ext.Extract(storage.NewFileAsset(name, path, name))
+		if err != nil || len(atoms) != 0 {
+			t.Errorf("%s: expected binary data to be rejected, got %d atoms (%v)", name, len(atoms), err)
+		}
+	}
+
+	// UTF-16 text is mostly NUL bytes but still text
+	path := filepath.Join(dir, "notes.txt")
+	os.WriteFile(path, encode(t, unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM), "Plain ASCII text in UTF-16"), 0644)
+	atoms, err := ext.Extract(storage.NewFileAsset("notes", path, "notes.txt"))
+	if err != nil || len(atoms) != 1 || *atoms[0].PayloadText != "Plain ASCII text in UTF-16" {
+		t.Errorf("expected UTF-16 text to be extracted, got %v (%v)", atoms, err)
+	}
+}
@@ -0,0 +1,322 @@
+package extractors
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// EXIF tag IDs we normalise. IFD0 and the Exif sub-IFD share one namespace.
+const (
+	tagImageDescription = 0x010E
+	tagMake             = 0x010F
+	tagModel            = 0x0110
+	tagOrientation      = 0x0112
+	tagSoftware         = 0x0131
+	tagDateTime         = 0x0132
+	tagArtist           = 0x013B
+	tagCopyright        = 0x8298
+	tagExposureTime     = 0x829A
+	tagFNumber          = 0x829D
+	tagExifIFD          = 0x8769
+	tagISO              = 0x8827
+	tagGPSIFD           = 0x8825
+	tagDateTimeOriginal = 0x9003
+	tagOffsetOriginal   = 0x9011
+	tagFocalLength      = 0x920A
+	tagPixelXDimension  = 0xA002
+	tagPixelYDimension  = 0xA003
+	tagLensModel        = 0xA434
+)
+
+// GPS IFD tag IDs.
+const (
+	gpsLatitudeRef  = 0x0001
+	gpsLatitude     = 0x0002
+	gpsLongitudeRef = 0x0003
+	gpsLongitude    = 0x0004
+	gpsAltitudeRef  = 0x0005
+	gpsAltitude     = 0x0006
+)
+
+var exifTextKeys = map[uint16]string{
+	tagImageDescription: "description",
+	tagMake:             "camera_make",
+	tagModel:            "camera_model",
+	tagSoftware:         "creator_tool",
+	tagArtist:           "author",
+	tagCopyright:        "copyright",
+	tagLensModel:        "lens_model",
+}
+
+type tiffEntry struct {
+	typ   uint16
+	count uint32
+	data  []byte // raw value bytes, already resolved from offset when needed
+}
+
+type tiffReader struct {
+	buf   []byte
+	order binary.ByteOrder
+}
+
+var tiffTypeSizes = map[uint16]int{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 7: 1, 9: 4, 10: 8}
+
+// parseEXIF decodes a TIFF-structured EXIF block into normalised metadata keys.
+func parseEXIF(tiff []byte) map[string]string {
+	meta := make(map[string]string)
+	if len(tiff) < 8 {
+		return meta
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return meta
+	}
+	if order.Uint16(tiff[2:]) != 42 {
+		return meta
+	}
+	r := &tiffReader{buf: tiff, order: order}
+
+	ifd0 := r.readIFD(order.Uint32(tiff[4:]))
+	entries := ifd0
+	if e, ok := ifd0[tagExifIFD]; ok {
+		for tag, sub := range r.readIFD(r.uint(e)) {
+			entries[tag] = sub
+		}
+	}
+
+	for tag, key := range exifTextKeys {
+		if e, ok := entries[tag]; ok {
+			if v := r.ascii(e); v != "" {
+				meta[key] = v
+			}
+		}
+	}
+	if e, ok := entries[tagOrientation]; ok {
+		meta["orientation"] = fmt.Sprintf("%d", r.uint(e))
+	}
+	if e, ok := entries[tagPixelXDimension]; ok {
+		meta["image_width"] = fmt.Sprintf("%d", r.uint(e))
+	}
+	if e, ok := entries[tagPixelYDimension]; ok {
+		meta["image_height"] = fmt.Sprintf("%d", r.uint(e))
+	}
+	if e, ok := entries[tagISO]; ok {
+		meta["iso"] = fmt.Sprintf("%d", r.uint(e))
+	}
+	if e, ok := entries[tagFNumber]; ok {
+		if v, ok := r.rational(e, 0); ok {
+			meta["f_number"] = formatFloat(v)
+		}
+	}
+	if e, ok := entries[tagFocalLength]; ok {
+		if v, ok := r.rational(e, 0); ok {
+			meta["focal_length_mm"] = formatFloat(v)
+		}
+	}
+	if e, ok := entries[tagExposureTime]; ok {
+		if v, ok := r.rational(e, 0); ok {
+			meta["exposure_time_s"] = formatFloat(v)
+		}
+	}
+
+	offset := ""
+	if e, ok := entries[tagOffsetOriginal]; ok {
+		offset = r.ascii(e)
+	}
+	if e, ok := entries[tagDateTimeOriginal]; ok {
+		if v := normalizeEXIFDate(r.ascii(e), offset); v != "" {
+			meta["captured_at"] = v
+		}
+	}
+	if e, ok := entries[tagDateTime]; ok {
+		if v := normalizeEXIFDate(r.ascii(e), ""); v != "" {
+			meta["modified"] = v
+		}
+	}
+
+	if e, ok := entries[tagGPSIFD]; ok {
+		gps := r.readIFD(r.uint(e))
+		if lat, ok := r.gpsCoordinate(gps[gpsLatitude], gps[gpsLatitudeRef], "S"); ok {
+			meta["gps_latitude"] = fmt.Sprintf("%.6f", lat)
+		}
+		if lon, ok := r.gpsCoordinate(gps[gpsLongitude], gps[gpsLongitudeRef], "W"); ok {
+			meta["gps_longitude"] = fmt.Sprintf("%.6f", lon)
+		}
+		if alt, ok := gps[gpsAltitude]; ok {
+			if v, ok := r.rational(alt, 0); ok {
+				if ref, ok := gps[gpsAltitudeRef]; ok && len(ref.data) > 0 && ref.data[0] == 1 {
+					v = -v
+				}
+				meta["gps_altitude_m"] = formatFloat(v)
+			}
+		}
+	}
+	return meta
+}
+
+func (r *tiffReader) readIFD(offset uint32) map[uint16]tiffEntry {
+	entries := make(map[uint16]tiffEntry)
+	if int(offset)+2 > len(r.buf) {
+		return entries
+	}
+	n := int(r.order.Uint16(r.buf[offset:]))
+	pos := int(offset) + 2
+	for i := 0; i < n && pos+12 <= len(r.buf); i++ {
+		tag := r.order.Uint16(r.buf[pos:])
+		typ := r.order.Uint16(r.buf[pos+2:])
+		count := r.order.Uint32(r.buf[pos+4:])
+		size, ok := tiffTypeSizes[typ]
+		pos += 12
+		if !ok || count > 1<<20 {
+			continue
+		}
+		total := size * int(count)
+		var data []byte
+		if total <= 4 {
+			data = r.buf[pos-4 : pos-4+total]
+		} else {
+			valOff := int(r.order.Uint32(r.buf[pos-4:]))
+			if valOff < 0 || valOff+total > len(r.buf) {
+				continue
+			}
+			data = r.buf[valOff : valOff+total]
+		}
+		entries[tag] = tiffEntry{typ: typ, count: count, data: data}
+	}
+	return entries
+}
+
+func (r *tiffReader) uint(e tiffEntry) uint32 {
+	switch {
+	case e.typ == 3 && len(e.data) >= 2:
+		return uint32(r.order.Uint16(e.data))
+	case (e.typ == 4 || e.typ == 9) && len(e.data) >= 4:
+		return r.order.Uint32(e.data)
+	case e.typ == 1 && len(e.data) >= 1:
+		return uint32(e.data[0])
+	}
+	return 0
+}
+
+func (r *tiffReader) ascii(e tiffEntry) string {
+	if e.typ != 2 && e.typ != 7 {
+		return ""
+	}
+	s := string(bytes.TrimRight(e.data, "\x00"))
+	return strings.TrimSpace(s)
+}
+
+func (r *tiffReader) rational(e tiffEntry, idx int) (float64, bool) {
+	if e.typ != 5 && e.typ != 10 {
+		return 0, false
+	}
+	off := idx * 8
+	if off+8 > len(e.data) {
+		return 0, false
+	}
+	num := r.order.Uint32(e.data[off:])
+	den := r.order.Uint32(e.data[off+4:])
+	if den == 0 {
+		return 0, false
+	}
+	if e.typ == 10 {
+		return float64(int32(num)) / float64(int32(den)), true
+	}
+	return float64(num) / float64(den), true
+}
+
+func (r *tiffReader) gpsCoordinate(value, ref tiffEntry, negativeRef string) (float64, bool) {
+	deg, ok1 := r.rational(value, 0)
+	minutes, ok2 := r.rational(value, 1)
+	sec, ok3 := r.rational(value, 2)
+	if !ok1 || !ok2 || !ok3 {
+		return 0, false
+	}
+	v := deg + minutes/60 + sec/3600
+	if strings.EqualFold(r.ascii(ref), negativeRef) {
+		v = -v
+	}
+	return v, true
+}
+
+// normalizeEXIFDate converts "2023:05:01 12:34:56" into ISO 8601, appending
+// the EXIF offset ("+02:00") when one is recorded.
+func normalizeEXIFDate(s, offset string) string {
+	s = strings.TrimSpace(s)
+	if len(s) < 19 || strings.HasPrefix(s, "0000") {
+		return ""
+	}
+	out := strings.Replace(s[:10], ":", "-", 2) + "T" + s[11:19]
+	if len(offset) == 6 && (offset[0] == '+' || offset[0] == '-') {
+		out += offset
+	}
+	return out
+}
+
+func formatFloat(v float64) string {
+	s := fmt.Sprintf("%.4f", v)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+// findEXIFBlock locates the TIFF-structured EXIF payload inside JPEG, PNG,
+// WebP or bare TIFF files. Returns nil when the container carries none.
+func findEXIFBlock(data []byte) []byte {
+	switch {
+	case len(data) > 4 && data[0] == 0xFF && data[1] == 0xD8:
+		pos := 2
+		for pos+4 <= len(data) && data[pos] == 0xFF {
+			marker := data[pos+1]
+			if marker == 0xDA || marker == 0xD9 { // start of scan / end of image
+				break
+			}
+			segLen := int(binary.BigEndian.Uint16(data[pos+2:]))
+			end := pos + 2 + segLen
+			if segLen < 2 || end > len(data) {
+				break
+			}
+			seg := data[pos+4 : end]
+			if marker == 0xE1 && bytes.HasPrefix(seg, []byte("Exif\x00\x00")) {
+				return seg[6:]
+			}
+			pos = end
+		}
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		pos := 8
+		for pos+12 <= len(data) {
+			n := int(binary.BigEndian.Uint32(data[pos:]))
+			typ := string(data[pos+4 : pos+8])
+			if n < 0 || pos+12+n > len(data) {
+				break
+			}
+			if typ == "eXIf" {
+				return data[pos+8 : pos+8+n]
+			}
+			pos += 12 + n
+		}
+	case len(data) > 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		pos := 12
+		for pos+8 <= len(data) {
+			typ := string(data[pos : pos+4])
+			n := int(binary.LittleEndian.Uint32(data[pos+4:]))
+			if n < 0 || pos+8+n > len(data) {
+				break
+			}
+			if typ == "EXIF" {
+				block := data[pos+8 : pos+8+n]
+				return bytes.TrimPrefix(block, []byte("Exif\x00\x00"))
+			}
+			pos += 8 + n + n%2
+		}
+	case bytes.HasPrefix(data, []byte("II*\x00")) || bytes.HasPrefix(data, []byte("MM\x00*")):
+		return data
+	}
+	return nil
+}
@@ -2,9 +2,14 @@ package extractors
 
 import (
 	"crypto/sha256"
+	"encoding/json"
 	"fmt"
+	"log/slog"
+	"os/exec"
 	"sort"
 
+	"github.com/oho/knowledge-refinery-daemon/internal/config"
+	"github.com/oho/knowledge-refinery-daemon/internal/language"
 	"github.com/oho/knowledge-refinery-daemon/internal/storage"
 )
 
@@ -19,6 +24,7 @@ type Extractor interface {
 // Registry holds extractors sorted by priority (highest first).
 type Registry struct {
 	extractors []Extractor
+	cache      *ExtractCache // nil disables caching
 }
 
 func NewRegistry() *Registry {
@@ -32,31 +38,129 @@ func (r *Registry) Register(e Extractor) {
 	})
 }
 
-// Extract tries each extractor in priority order.
+// SetCache makes Extract reuse results for content it has already seen.
+func (r *Registry) SetCache(c *ExtractCache) {
+	r.cache = c
+}
+
+// Extract tries each extractor in priority order, tags text atoms with
+// their detected language, then runs the metadata pass unless the extractor
+// already emitted its own metadata atom. With a cache set, the result for
+// the same content hash and extractor version is reused instead.
 func (r *Registry) Extract(asset storage.FileAsset) ([]storage.ContentAtom, error) {
 	for _, e := range r.extractors {
 		if e.CanHandle(asset) {
-			return e.Extract(asset)
+			if r.cache != nil {
+				if atoms, ok := r.cache.Get(asset, e); ok {
+					slog.Debug("Extraction cache hit", "file", asset.Filename, "extractor", e.Name())
+					return atoms, nil
+				}
+			}
+			atoms, err := e.Extract(asset)
+			if err != nil {
+				return nil, err
+			}
+			annotateLanguage(atoms)
+			atoms = appendMetadataAtom(asset, atoms)
+			if r.cache != nil {
+				r.cache.Put(asset, e, atoms)
+			}
+			return atoms, nil
 		}
 	}
 	return nil, fmt.Errorf("no extractor can handle: %s", asset.Filename)
 }
 
+func appendMetadataAtom(asset storage.FileAsset, atoms []storage.ContentAtom) []storage.ContentAtom {
+	seqIdx := 0
+	for _, a := range atoms {
+		if a.AtomType == storage.AtomMetadata {
+			return atoms
+		}
+		if a.SequenceIndex >= seqIdx {
+			seqIdx = a.SequenceIndex + 1
+		}
+	}
+	meta := ExtractFileMetadata(asset)
+	if len(meta) == 0 {
+		return atoms
+	}
+	return append(atoms, metadataAtom(asset.ID, meta, seqIdx))
+}
+
+// annotateLanguage records the detected language of each text atom in its
+// metadata, unless the extractor already set one.
+func annotateLanguage(atoms []storage.ContentAtom) {
+	for i := range atoms {
+		a := &atoms[i]
+		if a.AtomType != storage.AtomText || a.PayloadText == nil {
+			continue
+		}
+		if _, ok := atomMetadata(*a)["language"]; ok {
+			continue
+		}
+		setAtomMetadata(a, "language", language.Detect(*a.PayloadText))
+	}
+}
+
+// atomMetadata decodes an atom's metadata object, or returns an empty map.
+func atomMetadata(a storage.ContentAtom) map[string]any {
+	meta := make(map[string]any)
+	if a.MetadataJSON != nil {
+		json.Unmarshal([]byte(*a.MetadataJSON), &meta)
+	}
+	return meta
+}
+
+// setAtomMetadata sets one key in an atom's metadata object, keeping any
+// keys already present.
+func setAtomMetadata(a *storage.ContentAtom, key string, value any) {
+	meta := atomMetadata(*a)
+	meta[key] = value
+	data, _ := json.Marshal(meta)
+	s := string(data)
+	a.MetadataJSON = &s
+}
+
 // ComputeAtomID generates a deterministic atom ID.
 func ComputeAtomID(assetID string, atomType storage.AtomType, seqIdx int) string {
 	h := sha256.Sum256([]byte(fmt.Sprintf("%s:%s:%d", assetID, string(atomType), seqIdx)))
 	return fmt.Sprintf("%x", h)[:32]
 }
 
-// CreateDefaultRegistry builds a registry with all extractors.
+// CreateDefaultRegistry builds a registry with all extractors using the
+// default pipeline configuration.
 func CreateDefaultRegistry() *Registry {
+	return CreateRegistry(config.DefaultConfig())
+}
+
+// CreateRegistry builds a registry with all built-in extractors, configured
+// from cfg, plus any plugin extractors it declares.
+func CreateRegistry(cfg config.Config) *Registry {
 	r := NewRegistry()
 	r.Register(&PDFExtractor{})
 	r.Register(&EPUBExtractor{})
+	r.Register(&MOBIExtractor{})
 	r.Register(&ImageExtractor{})
-	r.Register(&DICOMExtractor{})
+	r.Register(&DICOMExtractor{
+		Profile: DeidentifyProfile(cfg.Pipeline.DICOMDeidentify),
+		Salt:    cfg.Pipeline.DICOMPseudonymSalt,
+	})
+	r.Register(&NotebookExtractor{})
+	r.Register(&LaTeXExtractor{})
+	r.Register(&SubtitleExtractor{})
 	r.Register(&TextExtractor{})
 	r.Register(&ArchiveExtractor{})
 	r.Register(&TikaFallbackExtractor{})
+
+	for _, p := range cfg.Plugins {
+		if _, err := exec.LookPath(p.Command); err != nil {
+			slog.Warn("Skipping extractor plugin", "plugin", p.Name, "command", p.Command, "error", err)
+			continue
+		}
+		plugin := NewPluginExtractor(p, cfg.Sandbox, cfg.TempDir)
+		r.Register(plugin)
+		slog.Info("Registered extractor plugin", "plugin", p.Name, "priority", plugin.Priority())
+	}
 	return r
 }
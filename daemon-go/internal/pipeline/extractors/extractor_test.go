@@ -104,6 +104,21 @@ func TestTextExtractorPlainText(t *testing.T) {
 	}
 }
 
+func TestTextExtractorLineAnchor(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "notes.md")
+	os.WriteFile(path, []byte("\n\n# Notes\nfirst\nsecond\n\n"), 0644)
+
+	atoms, err := (&TextExtractor{}).Extract(storage.NewFileAsset("id", path, "notes.md"))
+	if err != nil || len(atoms) != 1 {
+		t.Fatalf("Extract: %v, %d atoms", err, len(atoms))
+	}
+	anchor, _ := storage.ParseEvidenceAnchor(atoms[0].EvidenceAnchor)
+	if anchor.LineStart == nil || *anchor.LineStart != 3 || anchor.LineEnd == nil || *anchor.LineEnd != 5 {
+		t.Errorf("anchor = %s, want lines 3-5", atoms[0].EvidenceAnchor)
+	}
+}
+
 func TestTextExtractorHTML(t *testing.T) {
 	dir := t.TempDir()
 	path := filepath.Join(dir, "page.html")
@@ -231,8 +246,8 @@ func TestTikaFallbackCanHandle(t *testing.T) {
 func TestDefaultRegistryOrder(t *testing.T) {
 	reg := CreateDefaultRegistry()
 	// Verify we have all extractors
-	if len(reg.extractors) != 7 {
-		t.Errorf("expected 7 extractors, got %d", len(reg.extractors))
+	if len(reg.extractors) != 11 {
+		t.Errorf("expected 11 extractors, got %d", len(reg.extractors))
 	}
 	// Verify priority ordering (highest first)
 	for i := 1; i < len(reg.extractors); i++ {
@@ -0,0 +1,374 @@
+package extractors
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/oho/knowledge-refinery-daemon/internal/storage"
+)
+
+// latexSectionLevels ranks sectioning commands; deeper levels nest under
+// shallower ones in the chapter anchor.
+var latexSectionLevels = map[string]int{
+	"part": 0, "chapter": 1, "section": 2, "subsection": 3, "subsubsection": 4,
+}
+
+var latexSectionRE = regexp.MustCompile(`^\s*\\(part|chapter|section|subsection|subsubsection)\*?\s*(?:\[[^\]]*\])?\s*\{`)
+
+// latexMathEnvs are kept verbatim, delimiters included.
+var latexMathEnvs = map[string]bool{
+	"equation": true, "align": true, "alignat": true, "gather": true, "multline": true,
+	"flalign": true, "eqnarray": true, "displaymath": true, "math": true,
+}
+
+// latexCommand says what to do with a command and its brace arguments.
+type latexCommand struct {
+	args   int
+	render func(args []string) string // nil drops the command and its arguments
+}
+
+var latexCommands = map[string]latexCommand{
+	"label": {1, nil}, "includegraphics": {1, nil}, "bibliography": {1, nil},
+	"bibliographystyle": {1, nil}, "input": {1, nil}, "include": {1, nil},
+	"usepackage": {1, nil}, "documentclass": {1, nil}, "thanks": {1, nil},
+	"vspace": {1, nil}, "hspace": {1, nil}, "setlength": {2, nil},
+	"newcommand": {2, nil}, "renewcommand": {2, nil},
+
+	"cite": {1, bracketed}, "citep": {1, bracketed}, "citet": {1, bracketed},
+	"parencite": {1, bracketed}, "autocite": {1, bracketed}, "textcite": {1, bracketed},
+	"ref": {1, verbatim}, "eqref": {1, verbatim}, "autoref": {1, verbatim},
+	"cref": {1, verbatim}, "Cref": {1, verbatim}, "pageref": {1, verbatim},
+	"url": {1, verbatim},
+
+	"begin": {1, literal("\n")}, "end": {1, literal("\n")},
+	"item": {0, literal("\n- ")}, "and": {0, literal(",")}, "par": {0, literal("\n\n")},
+}
+
+// Commands whose arguments are themselves LaTeX are added in init, since
+// rendering them refers back to latexCommands.
+func init() {
+	latexCommands["href"] = latexCommand{2, func(a []string) string { return latexToText(a[1]) }}
+	latexCommands["footnote"] = latexCommand{1, func(a []string) string { return " (" + latexToText(a[0]) + ")" }}
+}
+
+func literal(s string) func([]string) string {
+	return func([]string) string { return s }
+}
+
+func bracketed(a []string) string { return "[" + a[0] + "]" }
+func verbatim(a []string) string  { return a[0] }
+
+var (
+	latexSpaceRE = regexp.MustCompile(`[ \t]+`)
+	latexBlankRE = regexp.MustCompile(`\n\s*\n+`)
+)
+
+// LaTeXExtractor splits LaTeX sources into one atom per section or
+// subsection. Commands are stripped to their text, math is kept as LaTeX,
+// and each atom is anchored by its section path and source line range.
+type LaTeXExtractor struct{}
+
+func (e *LaTeXExtractor) Name() string  { return "latex" }
+func (e *LaTeXExtractor) Priority() int { return 12 }
+
+func (e *LaTeXExtractor) CanHandle(asset storage.FileAsset) bool {
+	ext := strings.ToLower(filepath.Ext(asset.Filename))
+	return ext == ".tex" || ext == ".ltx"
+}
+
+type latexSection struct {
+	path      string
+	level     string
+	startLine int // 1-based, inclusive
+	lines     []string
+}
+
+func (e *LaTeXExtractor) Extract(asset storage.FileAsset) ([]storage.ContentAtom, error) {
+	data, err := os.ReadFile(asset.Path)
+	if err != nil {
+		return nil, err
+	}
+	src, enc := decodeText(data)
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = stripLaTeXComment(line)
+	}
+
+	// Only the document body is content; the preamble holds the title.
+	bodyStart, bodyEnd := 0, len(lines)
+	for i, line := range lines {
+		if strings.Contains(line, `\begin{document}`) {
+			bodyStart = i + 1
+		} else if strings.Contains(line, `\end{document}`) {
+			bodyEnd = i
+			break
+		}
+	}
+
+	meta := latexMetadata(strings.Join(lines, "\n"))
+
+	var sections []*latexSection
+	current := &latexSection{startLine: bodyStart + 1}
+	var headings [5]string
+	for i := bodyStart; i < bodyEnd; i++ {
+		m := latexSectionRE.FindStringSubmatchIndex(lines[i])
+		if m == nil {
+			current.lines = append(current.lines, lines[i])
+			continue
+		}
+		sections = append(sections, current)
+
+		cmd := lines[i][m[2]:m[3]]
+		title, _, _ := readLaTeXArg(lines[i], m[1]-1)
+		level := latexSectionLevels[cmd]
+		headings[level] = strings.TrimSpace(latexToText(title))
+		for l := level + 1; l < len(headings); l++ {
+			headings[l] = ""
+		}
+		var path []string
+		for _, h := range headings[:level+1] {
+			if h != "" {
+				path = append(path, h)
+			}
+		}
+		current = &latexSection{path: strings.Join(path, " > "), level: cmd, startLine: i + 1, lines: []string{lines[i]}}
+	}
+	sections = append(sections, current)
+
+	var atoms []storage.ContentAtom
+	seqIdx := 0
+	for _, sec := range sections {
+		text := latexToText(strings.Join(sec.lines, "\n"))
+		if text == "" {
+			continue
+		}
+		lineStart, lineEnd := sec.startLine, sec.startLine+len(sec.lines)-1
+		anchor := storage.EvidenceAnchor{AssetID: asset.ID, LineStart: &lineStart, LineEnd: &lineEnd}
+		if sec.path != "" {
+			anchor.Chapter = &sec.path
+		}
+		atom := storage.NewContentAtom(
+			ComputeAtomID(asset.ID, storage.AtomText, seqIdx),
+			asset.ID, storage.AtomText, seqIdx, anchor.ToJSON(),
+		)
+		atom.PayloadText = &text
+		setAtomMetadata(&atom, "encoding", enc)
+		if sec.level != "" {
+			setAtomMetadata(&atom, "section_level", sec.level)
+		}
+		atoms = append(atoms, atom)
+		seqIdx++
+	}
+
+	if len(meta) > 0 {
+		atoms = append(atoms, metadataAtom(asset.ID, meta, seqIdx))
+	}
+	return atoms, nil
+}
+
+// latexMetadata reads \title, \author and \date.
+func latexMetadata(src string) map[string]string {
+	meta := make(map[string]string)
+	for cmd, key := range map[string]string{"title": "title", "author": "author", "date": "created"} {
+		i := strings.Index(src, `\`+cmd+`{`)
+		if i < 0 {
+			continue
+		}
+		arg, _, ok := readLaTeXArg(src, i+len(cmd)+1)
+		if !ok {
+			continue
+		}
+		if v := strings.Join(strings.Fields(latexToText(arg)), " "); v != "" {
+			meta[key] = strings.ReplaceAll(v, " ,", ",")
+		}
+	}
+	return meta
+}
+
+// stripLaTeXComment removes an unescaped % and the rest of the line.
+func stripLaTeXComment(line string) string {
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++ // skip the escaped character, including \%
+		case '%':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// latexToText converts LaTeX source to plain text, leaving math segments
+// as written.
+func latexToText(src string) string {
+	var b strings.Builder
+	for _, seg := range splitLaTeXMath(src) {
+		if seg.math {
+			b.WriteString(seg.text)
+			continue
+		}
+		text := latexSpaceRE.ReplaceAllString(stripLaTeXCommands(seg.text), " ")
+		b.WriteString(strings.ReplaceAll(strings.ReplaceAll(text, "\n ", "\n"), " \n", "\n"))
+	}
+	return strings.TrimSpace(latexBlankRE.ReplaceAllString(b.String(), "\n\n"))
+}
+
+type latexSegment struct {
+	text string
+	math bool
+}
+
+// splitLaTeXMath separates inline and display math ($…$, $$…$$, \(…\),
+// \[…\] and math environments) from surrounding text.
+func splitLaTeXMath(s string) []latexSegment {
+	var segs []latexSegment
+	textStart := 0
+	emit := func(start, end int) {
+		if start > textStart {
+			segs = append(segs, latexSegment{text: s[textStart:start]})
+		}
+		segs = append(segs, latexSegment{text: s[start:end], math: true})
+		textStart = end
+	}
+	// closing finds the end of a math segment opened at i, or -1.
+	closing := func(from int, delim string) int {
+		if j := strings.Index(s[from:], delim); j >= 0 {
+			return from + j + len(delim)
+		}
+		return -1
+	}
+
+	for i := 0; i < len(s); i++ {
+		end := -1
+		switch {
+		case strings.HasPrefix(s[i:], `\begin{`):
+			name, argEnd, ok := readLaTeXArg(s, i+len(`\begin`))
+			if ok && latexMathEnvs[strings.TrimSuffix(name, "*")] {
+				end = closing(argEnd, `\end{`+name+`}`)
+			}
+		case strings.HasPrefix(s[i:], `\[`):
+			end = closing(i+2, `\]`)
+		case strings.HasPrefix(s[i:], `\(`):
+			end = closing(i+2, `\)`)
+		case s[i] == '\\':
+			i++ // escaped character such as \$
+			continue
+		case strings.HasPrefix(s[i:], "$$"):
+			end = closing(i+2, "$$")
+		case s[i] == '$':
+			for j := i + 1; j < len(s); j++ {
+				if s[j] == '\\' {
+					j++
+				} else if s[j] == '$' {
+					end = j + 1
+					break
+				}
+			}
+		}
+		if end > 0 {
+			emit(i, end)
+			i = end - 1
+		}
+	}
+	if textStart < len(s) {
+		segs = append(segs, latexSegment{text: s[textStart:]})
+	}
+	return segs
+}
+
+// stripLaTeXCommands removes command names, optional arguments and braces
+// from text, applying latexCommands where a command has special handling.
+func stripLaTeXCommands(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && isASCIILetter(s[i+1]):
+			j := i + 1
+			for j < len(s) && isASCIILetter(s[j]) {
+				j++
+			}
+			name := s[i+1 : j]
+			if j < len(s) && s[j] == '*' {
+				j++
+			}
+			if j < len(s) && s[j] == '[' {
+				if k := strings.IndexByte(s[j:], ']'); k >= 0 {
+					j += k + 1
+				}
+			}
+			i = j
+			cmd, ok := latexCommands[name]
+			if !ok {
+				continue // arguments stay as text; their braces are dropped below
+			}
+			args := make([]string, 0, cmd.args)
+			for n := 0; n < cmd.args; n++ {
+				arg, end, ok := readLaTeXArg(s, i)
+				if !ok {
+					break
+				}
+				args = append(args, arg)
+				i = end
+			}
+			if cmd.render != nil && len(args) == cmd.args {
+				b.WriteString(cmd.render(args))
+			}
+		case c == '\\' && i+1 < len(s):
+			switch next := s[i+1]; {
+			case next == '\\':
+				b.WriteByte('\n')
+			case strings.IndexByte("%&$#_{}", next) >= 0:
+				b.WriteByte(next)
+			default:
+				b.WriteByte(' ') // spacing commands such as \, and \;
+			}
+			i += 2
+		case c == '{' || c == '}':
+			i++
+		case c == '~':
+			b.WriteByte(' ')
+			i++
+		case strings.HasPrefix(s[i:], "``") || strings.HasPrefix(s[i:], "''"):
+			b.WriteByte('"')
+			i += 2
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String()
+}
+
+// readLaTeXArg reads a brace-delimited argument starting at or after i
+// (skipping whitespace), returning its contents and the index after the
+// closing brace.
+func readLaTeXArg(s string, i int) (string, int, bool) {
+	for i < len(s) && (s[i] == ' ' || s[i] == '\t' || s[i] == '\n') {
+		i++
+	}
+	if i >= len(s) || s[i] != '{' {
+		return "", i, false
+	}
+	depth := 0
+	for j := i; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			j++
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return s[i+1 : j], j + 1, true
+			}
+		}
+	}
+	return "", i, false
+}
+
+func isASCIILetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
@@ -0,0 +1,74 @@
+package extractors
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/oho/knowledge-refinery-daemon/internal/storage"
+)
+
+func TestLaTeXExtractor(t *testing.T) {
+	src := `\documentclass{article}
+\title{On \emph{Refinement}}
+\author{Ada Lovelace \and Charles Babbage}
+\begin{document}
+\maketitle
+We study refinement. % a comment
+\section{Introduction}\label{sec:intro}
+Prior work~\cite{knuth84} is \textbf{important}; see Section~\ref{sec:method}.
+Costs are 5\% lower.
+\subsection[Short]{Energy}
+The energy is $E = mc^2$, and
+\begin{equation}
+  \int_0^1 f(x)\,dx = 1
+\end{equation}
+\section*{Method}
+\begin{itemize}
+  \item First\footnote{See \url{https://example.org}.}
+\end{itemize}
+\end{document}
+`
+	path := filepath.Join(t.TempDir(), "paper.tex")
+	os.WriteFile(path, []byte(src), 0644)
+
+	atoms, err := (&LaTeXExtractor{}).Extract(storage.NewFileAsset("tex", path, "paper.tex"))
+	if err != nil {
+		t.Fatalf("Extract: %v", err)
+	}
+	if len(atoms) != 5 {
+		t.Fatalf("expected 4 section atoms and metadata, got %d", len(atoms))
+	}
+
+	want := []struct {
+		chapter            string
+		lineStart, lineEnd int
+		text               string
+	}{
+		{"", 5, 6, "We study refinement."},
+		{"Introduction", 7, 9, "Introduction\nPrior work [knuth84] is important; see Section sec:method.\nCosts are 5% lower."},
+		{"Introduction > Energy", 10, 14, "Energy\nThe energy is $E = mc^2$, and\n\\begin{equation}\n  \\int_0^1 f(x)\\,dx = 1\n\\end{equation}"},
+		{"Method", 15, 18, "Method\n\n- First (See https://example.org.)"},
+	}
+	for i, w := range want {
+		anchor, _ := storage.ParseEvidenceAnchor(atoms[i].EvidenceAnchor)
+		chapter := ""
+		if anchor.Chapter != nil {
+			chapter = *anchor.Chapter
+		}
+		if chapter != w.chapter || *anchor.LineStart != w.lineStart || *anchor.LineEnd != w.lineEnd {
+			t.Errorf("atom %d anchor = %q lines %d-%d, want %q lines %d-%d",
+				i, chapter, *anchor.LineStart, *anchor.LineEnd, w.chapter, w.lineStart, w.lineEnd)
+		}
+		if got := *atoms[i].PayloadText; got != w.text {
+			t.Errorf("atom %d text = %q, want %q", i, got, w.text)
+		}
+	}
+
+	var meta map[string]string
+	json.Unmarshal([]byte(*atoms[4].MetadataJSON), &meta)
+	if meta["title"] != "On Refinement" || meta["author"] != "Ada Lovelace, Charles Babbage" {
+		t.Errorf("unexpected metadata: %v", meta)
+	}
+}
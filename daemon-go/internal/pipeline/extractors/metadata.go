@@ -0,0 +1,375 @@
+package extractors
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/oho/knowledge-refinery-daemon/internal/storage"
+)
+
+// maxMetadataScanBytes bounds how much of a file is read when looking for
+// EXIF/XMP/info dictionaries. Metadata lives near the start (images) or the
+// end (PDF trailers) of a file, so the head and tail are scanned.
+const maxMetadataScanBytes = 4 * 1024 * 1024
+
+var officeExtensions = map[string]bool{
+	".docx": true, ".xlsx": true, ".pptx": true,
+	".odt": true, ".ods": true, ".odp": true,
+}
+
+// ExtractFileMetadata reads embedded metadata (EXIF, XMP, PDF info
+// dictionaries, office document properties) into normalised keys such as
+// "title", "author", "created", "captured_at" and "gps_latitude".
+func ExtractFileMetadata(asset storage.FileAsset) map[string]string {
+	ext := strings.ToLower(filepath.Ext(asset.Filename))
+	meta := make(map[string]string)
+
+	switch {
+	case ext == ".pdf":
+		merge(meta, pdfInfoMetadata(asset.Path))
+	case officeExtensions[ext]:
+		merge(meta, officeMetadata(asset.Path))
+		return meta // zipped XML, no raw EXIF/XMP to scan
+	case ext == ".epub":
+		return meta // EPUB metadata lives in the OPF, handled by the EPUB extractor
+	case mobiExtensions[ext]:
+		return meta // EXTH records, handled by the MOBI extractor
+	}
+
+	data, err := readHeadAndTail(asset.Path, maxMetadataScanBytes)
+	if err != nil {
+		return meta
+	}
+	if imageExtensions[ext] {
+		if block := findEXIFBlock(data); block != nil {
+			merge(meta, parseEXIF(block))
+		}
+	}
+	if ext == ".pdf" && meta["title"] == "" {
+		merge(meta, pdfInfoDictionary(data))
+	}
+	if packet := findXMPPacket(data); packet != nil {
+		merge(meta, parseXMP(packet))
+	}
+	return meta
+}
+
+// metadataAtom wraps normalised metadata in an AtomMetadata content atom.
+func metadataAtom(assetID string, meta map[string]string, seqIdx int) storage.ContentAtom {
+	metaJSON, _ := json.Marshal(meta)
+	metaStr := string(metaJSON)
+	anchor := storage.EvidenceAnchor{AssetID: assetID}
+	atom := storage.NewContentAtom(
+		ComputeAtomID(assetID, storage.AtomMetadata, seqIdx),
+		assetID, storage.AtomMetadata, seqIdx, anchor.ToJSON(),
+	)
+	atom.MetadataJSON = &metaStr
+	return atom
+}
+
+// merge copies keys from src that dst does not already have, so the first
+// (most authoritative) source wins.
+func merge(dst, src map[string]string) {
+	for k, v := range src {
+		if _, ok := dst[k]; !ok && v != "" {
+			dst[k] = v
+		}
+	}
+}
+
+func readHeadAndTail(path string, n int64) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() <= 2*n {
+		return io.ReadAll(f)
+	}
+	buf := make([]byte, 2*n)
+	if _, err := io.ReadFull(f, buf[:n]); err != nil {
+		return nil, err
+	}
+	if _, err := f.ReadAt(buf[n:], info.Size()-n); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// -- PDF --
+
+var pdfinfoKeys = map[string]string{
+	"Title":        "title",
+	"Author":       "author",
+	"Subject":      "subject",
+	"Keywords":     "keywords",
+	"Creator":      "creator_tool",
+	"Producer":     "producer",
+	"CreationDate": "created",
+	"ModDate":      "modified",
+	"Pages":        "page_count",
+}
+
+// pdfInfoMetadata uses poppler's pdfinfo, which also handles info
+// dictionaries inside compressed object streams.
+func pdfInfoMetadata(path string) map[string]string {
+	meta := make(map[string]string)
+	out, err := exec.Command("pdfinfo", "-isodates", path).Output()
+	if err != nil {
+		return meta
+	}
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		k, v, ok := strings.Cut(sc.Text(), ":")
+		if !ok {
+			continue
+		}
+		if key, ok := pdfinfoKeys[strings.TrimSpace(k)]; ok {
+			if v = strings.TrimSpace(v); v != "" {
+				meta[key] = v
+			}
+		}
+	}
+	return meta
+}
+
+var pdfInfoEntryRE = regexp.MustCompile(`/(Title|Author|Subject|Keywords|Creator|Producer|CreationDate|ModDate)\s*(\((?:\\.|[^\\)])*\)|<[0-9A-Fa-f\s]*>)`)
+
+// pdfInfoDictionary scans raw PDF bytes for uncompressed info dictionary
+// entries. Used when pdfinfo is not installed.
+func pdfInfoDictionary(data []byte) map[string]string {
+	meta := make(map[string]string)
+	for _, m := range pdfInfoEntryRE.FindAllSubmatch(data, -1) {
+		key := pdfinfoKeys[string(m[1])]
+		if _, ok := meta[key]; ok {
+			continue
+		}
+		v := strings.TrimSpace(decodePDFString(m[2]))
+		if key == "created" || key == "modified" {
+			v = normalizePDFDate(v)
+		}
+		if v != "" {
+			meta[key] = v
+		}
+	}
+	return meta
+}
+
+// decodePDFString decodes a literal "(...)" or hex "<...>" PDF string,
+// including UTF-16BE strings marked with a byte order mark.
+func decodePDFString(raw []byte) string {
+	var b []byte
+	if raw[0] == '<' {
+		hex := bytes.Map(func(r rune) rune {
+			if r == ' ' || r == '\n' || r == '\r' || r == '\t' {
+				return -1
+			}
+			return r
+		}, raw[1:len(raw)-1])
+		if len(hex)%2 == 1 {
+			hex = append(hex, '0')
+		}
+		b = make([]byte, len(hex)/2)
+		for i := range b {
+			b[i] = unhex(hex[2*i])<<4 | unhex(hex[2*i+1])
+		}
+	} else {
+		inner := raw[1 : len(raw)-1]
+		for i := 0; i < len(inner); i++ {
+			c := inner[i]
+			if c != '\\' || i+1 >= len(inner) {
+				b = append(b, c)
+				continue
+			}
+			i++
+			switch e := inner[i]; e {
+			case 'n':
+				b = append(b, '\n')
+			case 'r':
+				b = append(b, '\r')
+			case 't':
+				b = append(b, '\t')
+			case '0', '1', '2', '3', '4', '5', '6', '7':
+				v := 0
+				j := 0
+				for ; j < 3 && i+j < len(inner) && inner[i+j] >= '0' && inner[i+j] <= '7'; j++ {
+					v = v*8 + int(inner[i+j]-'0')
+				}
+				b = append(b, byte(v))
+				i += j - 1
+			default:
+				b = append(b, e)
+			}
+		}
+	}
+
+	if len(b) >= 2 && b[0] == 0xFE && b[1] == 0xFF {
+		u := make([]uint16, 0, (len(b)-2)/2)
+		for i := 2; i+1 < len(b); i += 2 {
+			u = append(u, uint16(b[i])<<8|uint16(b[i+1]))
+		}
+		return string(utf16.Decode(u))
+	}
+	return string(b)
+}
+
+func unhex(c byte) byte {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0'
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10
+	}
+	return 0
+}
+
+var pdfDateRE = regexp.MustCompile(`^D?:?(\d{4})(\d{2})?(\d{2})?(\d{2})?(\d{2})?(\d{2})?([Z+\-])?(\d{2})?'?(\d{2})?`)
+
+// normalizePDFDate converts "D:20230501123456+02'00'" into ISO 8601.
+func normalizePDFDate(s string) string {
+	m := pdfDateRE.FindStringSubmatch(s)
+	if m == nil {
+		return s
+	}
+	part := func(i int, def string) string {
+		if m[i] == "" {
+			return def
+		}
+		return m[i]
+	}
+	out := m[1] + "-" + part(2, "01") + "-" + part(3, "01") + "T" +
+		part(4, "00") + ":" + part(5, "00") + ":" + part(6, "00")
+	switch m[7] {
+	case "Z":
+		out += "Z"
+	case "+", "-":
+		out += m[7] + part(8, "00") + ":" + part(9, "00")
+	}
+	return out
+}
+
+// -- Office documents --
+
+// officeMetadata reads OOXML docProps/core.xml or ODF meta.xml.
+func officeMetadata(path string) map[string]string {
+	meta := make(map[string]string)
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return meta
+	}
+	defer r.Close()
+
+	for _, name := range []string{"docProps/core.xml", "meta.xml"} {
+		f := findZipFile(r, name)
+		if f == nil {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			continue
+		}
+		merge(meta, parsePropertiesXML(io.LimitReader(rc, maxMetadataScanBytes)))
+		rc.Close()
+	}
+	if f := findZipFile(r, "docProps/app.xml"); f != nil {
+		if rc, err := f.Open(); err == nil {
+			merge(meta, parsePropertiesXML(io.LimitReader(rc, maxMetadataScanBytes)))
+			rc.Close()
+		}
+	}
+	return meta
+}
+
+// officePropertyKeys maps element local names from OOXML core/app
+// properties and ODF meta.xml to normalised keys.
+var officePropertyKeys = map[string]string{
+	"title":           "title",
+	"creator":         "author",
+	"initial-creator": "author",
+	"subject":         "subject",
+	"description":     "description",
+	"keywords":        "keywords",
+	"keyword":         "keywords",
+	"lastModifiedBy":  "last_modified_by",
+	"created":         "created",
+	"creation-date":   "created",
+	"modified":        "modified",
+	"date":            "modified",
+	"language":        "language",
+	"Application":     "creator_tool",
+	"generator":       "creator_tool",
+	"Pages":           "page_count",
+	"page-count":      "page_count",
+}
+
+func parsePropertiesXML(r io.Reader) map[string]string {
+	meta := make(map[string]string)
+	dec := xml.NewDecoder(r)
+	var current string
+	var text strings.Builder
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if key, ok := officePropertyKeys[t.Name.Local]; ok {
+				current = key
+				text.Reset()
+			}
+			// ODF stores page count as an attribute of meta:document-statistic.
+			for _, attr := range t.Attr {
+				if attr.Name.Local == "page-count" {
+					meta["page_count"] = attr.Value
+				}
+			}
+		case xml.CharData:
+			if current != "" {
+				text.Write(t)
+			}
+		case xml.EndElement:
+			if current != "" {
+				v := strings.TrimSpace(text.String())
+				if current == "created" || current == "modified" {
+					v = normalizeISODate(v)
+				}
+				if _, exists := meta[current]; !exists && v != "" {
+					meta[current] = v
+				}
+				current = ""
+			}
+		}
+	}
+	return meta
+}
+
+// normalizeISODate trims sub-second precision from RFC 3339 timestamps.
+func normalizeISODate(s string) string {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999", "2006-01-02T15:04:05"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			if strings.HasSuffix(s, "Z") || strings.ContainsAny(s[10:], "+-") {
+				return t.Format(time.RFC3339)
+			}
+			return t.Format("2006-01-02T15:04:05")
+		}
+	}
+	return s
+}
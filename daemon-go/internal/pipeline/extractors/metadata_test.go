@@ -0,0 +1,189 @@
+package extractors
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/oho/knowledge-refinery-daemon/internal/storage"
+)
+
+// buildTIFF assembles a little-endian TIFF block with an IFD0 (Make, Model),
+// an Exif sub-IFD (DateTimeOriginal) and a GPS sub-IFD.
+func buildTIFF() []byte {
+	type entry struct {
+		tag, typ uint16
+		count    uint32
+		data     []byte
+	}
+	le := binary.LittleEndian
+	rational := func(vals ...uint32) []byte {
+		b := make([]byte, 0, len(vals)*4)
+		for _, v := range vals {
+			b = le.AppendUint32(b, v)
+		}
+		return b
+	}
+	ascii := func(s string) []byte { return append([]byte(s), 0) }
+
+	var buf bytes.Buffer
+	buf.WriteString("II")
+	binary.Write(&buf, le, uint16(42))
+	binary.Write(&buf, le, uint32(8))
+
+	// Lay out IFDs sequentially; values larger than 4 bytes go after each IFD.
+	writeIFD := func(start int, entries []entry) []byte {
+		out := make([]byte, 0)
+		out = le.AppendUint16(out, uint16(len(entries)))
+		dataOff := start + 2 + len(entries)*12 + 4
+		var extra []byte
+		for _, e := range entries {
+			out = le.AppendUint16(out, e.tag)
+			out = le.AppendUint16(out, e.typ)
+			out = le.AppendUint32(out, e.count)
+			if len(e.data) <= 4 {
+				v := make([]byte, 4)
+				copy(v, e.data)
+				out = append(out, v...)
+			} else {
+				out = le.AppendUint32(out, uint32(dataOff+len(extra)))
+				extra = append(extra, e.data...)
+			}
+		}
+		out = le.AppendUint32(out, 0)
+		return append(out, extra...)
+	}
+
+	ifd0Start := 8
+	ifd0Entries := []entry{
+		{tagMake, 2, 6, ascii("Canon")},
+		{tagModel, 2, 9, ascii("EOS R5 X")},
+		{tagExifIFD, 4, 1, nil},
+		{tagGPSIFD, 4, 1, nil},
+	}
+	// Two passes: first to learn the IFD0 size, then with real pointers.
+	size0 := len(writeIFD(ifd0Start, ifd0Entries))
+	exifStart := ifd0Start + size0
+	exifEntries := []entry{{tagDateTimeOriginal, 2, 20, ascii("2023:05:01 12:34:56")}}
+	sizeExif := len(writeIFD(exifStart, exifEntries))
+	gpsStart := exifStart + sizeExif
+	gpsEntries := []entry{
+		{gpsLatitudeRef, 2, 2, ascii("N")},
+		{gpsLatitude, 5, 3, rational(52, 1, 30, 1, 0, 1)},
+		{gpsLongitudeRef, 2, 2, ascii("W")},
+		{gpsLongitude, 5, 3, rational(13, 1, 15, 1, 0, 1)},
+	}
+	ifd0Entries[2].data = le.AppendUint32(nil, uint32(exifStart))
+	ifd0Entries[3].data = le.AppendUint32(nil, uint32(gpsStart))
+
+	buf.Write(writeIFD(ifd0Start, ifd0Entries))
+	buf.Write(writeIFD(exifStart, exifEntries))
+	buf.Write(writeIFD(gpsStart, gpsEntries))
+	return buf.Bytes()
+}
+
+func buildJPEGWithEXIF() []byte {
+	payload := append([]byte("Exif\x00\x00"), buildTIFF()...)
+	var buf bytes.Buffer
+	buf.Write([]byte{0xFF, 0xD8, 0xFF, 0xE1})
+	binary.Write(&buf, binary.BigEndian, uint16(len(payload)+2))
+	buf.Write(payload)
+	buf.Write([]byte{0xFF, 0xD9})
+	return buf.Bytes()
+}
+
+func TestParseEXIFFromJPEG(t *testing.T) {
+	block := findEXIFBlock(buildJPEGWithEXIF())
+	if block == nil {
+		t.Fatal("expected EXIF block in JPEG")
+	}
+	meta := parseEXIF(block)
+	expected := map[string]string{
+		"camera_make":   "Canon",
+		"camera_model":  "EOS R5 X",
+		"captured_at":   "2023-05-01T12:34:56",
+		"gps_latitude":  "52.500000",
+		"gps_longitude": "-13.250000",
+	}
+	for k, v := range expected {
+		if meta[k] != v {
+			t.Errorf("%s: expected %q, got %q", k, v, meta[k])
+		}
+	}
+}
+
+func TestParseXMP(t *testing.T) {
+	packet := []byte(`<x:xmpmeta xmlns:x="adobe:ns:meta/">
+<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+<rdf:Description xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:xmp="http://ns.adobe.com/xap/1.0/"
+  xmp:CreateDate="2021-03-04T10:00:00Z">
+  <dc:title><rdf:Alt><rdf:li xml:lang="x-default">Quarterly Report</rdf:li></rdf:Alt></dc:title>
+  <dc:creator><rdf:Seq><rdf:li>Ada Lovelace</rdf:li><rdf:li>Charles Babbage</rdf:li></rdf:Seq></dc:creator>
+</rdf:Description>
+</rdf:RDF>
+</x:xmpmeta>`)
+	meta := parseXMP(findXMPPacket(append([]byte("junk"), packet...)))
+	if meta["title"] != "Quarterly Report" {
+		t.Errorf("unexpected title: %q", meta["title"])
+	}
+	if meta["author"] != "Ada Lovelace, Charles Babbage" {
+		t.Errorf("unexpected author: %q", meta["author"])
+	}
+	if meta["created"] != "2021-03-04T10:00:00Z" {
+		t.Errorf("unexpected created: %q", meta["created"])
+	}
+}
+
+func TestPDFInfoDictionary(t *testing.T) {
+	raw := []byte("%PDF-1.4\n1 0 obj\n<< /Title (Annual \\(Draft\\) Plan) /Author <FEFF004A006F> /CreationDate (D:20230102030405+01'00') >>\nendobj\n")
+	meta := pdfInfoDictionary(raw)
+	if meta["title"] != "Annual (Draft) Plan" {
+		t.Errorf("unexpected title: %q", meta["title"])
+	}
+	if meta["author"] != "Jo" {
+		t.Errorf("unexpected author: %q", meta["author"])
+	}
+	if meta["created"] != "2023-01-02T03:04:05+01:00" {
+		t.Errorf("unexpected created: %q", meta["created"])
+	}
+}
+
+func TestOfficeMetadata(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.docx")
+	f, _ := os.Create(path)
+	zw := zip.NewWriter(f)
+	w, _ := zw.Create("docProps/core.xml")
+	w.Write([]byte(`<cp:coreProperties xmlns:cp="http://schemas.openxmlformats.org/package/2006/metadata/core-properties"
+ xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:dcterms="http://purl.org/dc/terms/">
+<dc:title>Budget</dc:title><dc:creator>Grace Hopper</dc:creator>
+<dcterms:created>2022-11-05T08:30:00.000Z</dcterms:created></cp:coreProperties>`))
+	zw.Close()
+	f.Close()
+
+	meta := ExtractFileMetadata(storage.NewFileAsset("id", path, "report.docx"))
+	if meta["title"] != "Budget" || meta["author"] != "Grace Hopper" {
+		t.Errorf("unexpected office metadata: %v", meta)
+	}
+	if meta["created"] != "2022-11-05T08:30:00Z" {
+		t.Errorf("unexpected created: %q", meta["created"])
+	}
+}
+
+func TestRegistryAppendsMetadataAtom(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "photo.jpg")
+	os.WriteFile(path, buildJPEGWithEXIF(), 0644)
+
+	atoms := appendMetadataAtom(storage.NewFileAsset("asset1", path, "photo.jpg"), nil)
+	if len(atoms) != 1 || atoms[0].AtomType != storage.AtomMetadata {
+		t.Fatalf("expected one metadata atom, got %d", len(atoms))
+	}
+	var meta map[string]string
+	json.Unmarshal([]byte(*atoms[0].MetadataJSON), &meta)
+	if meta["camera_make"] != "Canon" {
+		t.Errorf("expected camera_make in metadata atom, got %v", meta)
+	}
+}
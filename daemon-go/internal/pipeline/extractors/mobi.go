@@ -0,0 +1,156 @@
+package extractors
+
+import (
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"golang.org/x/text/encoding/charmap"
+
+	"github.com/oho/knowledge-refinery-daemon/internal/storage"
+)
+
+var mobiExtensions = map[string]bool{
+	".mobi": true, ".azw": true, ".azw3": true, ".prc": true,
+}
+
+var (
+	mobiPageBreakRE = regexp.MustCompile(`(?i)<mbp:pagebreak[^>]*>`)
+	mobiFileStartRE = regexp.MustCompile(`(?i)<html[\s>]`)
+	mobiHeadingRE   = regexp.MustCompile(`(?is)<h[1-3][^>]*>(.*?)</h[1-3]>`)
+	mobiHeadRE      = regexp.MustCompile(`(?is)<head[\s>].*?</head>|<style[\s>].*?</style>|<script[\s>].*?</script>`)
+	mobiBlockEndRE  = regexp.MustCompile(`(?i)</(?:p|div|h[1-6]|li|tr|blockquote)>|<br[^>]*>`)
+	mobiSpaceRE     = regexp.MustCompile(`[ \t\r\f\v]+`)
+	mobiBlankRE     = regexp.MustCompile(`\n\s*\n+`)
+)
+
+// mobiMetadataKeys maps EXTH record types to normalised metadata keys.
+var mobiMetadataKeys = map[int]string{
+	exthTitle:       "title",
+	exthAuthor:      "author",
+	exthPublisher:   "publisher",
+	exthDescription: "description",
+	exthISBN:        "isbn",
+	exthSubject:     "keywords",
+	exthPublished:   "created",
+	exthLanguage:    "language",
+}
+
+// MOBIExtractor handles Kindle e-books: PalmDOC, MOBI 6 and KF8 (AZW3).
+// Text is split into chapters at page breaks (MOBI 6) or XHTML file
+// boundaries (KF8), mirroring the chapter atoms of EPUBExtractor.
+type MOBIExtractor struct{}
+
+func (e *MOBIExtractor) Name() string  { return "mobi" }
+func (e *MOBIExtractor) Priority() int { return 18 }
+
+func (e *MOBIExtractor) CanHandle(asset storage.FileAsset) bool {
+	ext := strings.ToLower(filepath.Ext(asset.Filename))
+	return mobiExtensions[ext]
+}
+
+func (e *MOBIExtractor) Extract(asset storage.FileAsset) ([]storage.ContentAtom, error) {
+	data, err := os.ReadFile(asset.Path)
+	if err != nil {
+		return nil, err
+	}
+	book, err := parseMOBI(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", asset.Filename, err)
+	}
+
+	decode := func(b []byte) string {
+		if book.UTF8 {
+			return strings.ToValidUTF8(string(b), "�")
+		}
+		return decodeWith(charmap.Windows1252, b)
+	}
+
+	var atoms []storage.ContentAtom
+	seqIdx := 0
+
+	for i, part := range splitMOBIChapters(decode(book.Text), book.Version >= 8) {
+		text := mobiHTMLToText(part)
+		if text == "" {
+			continue
+		}
+		chapter := fmt.Sprintf("part%d", i+1)
+		if m := mobiHeadingRE.FindStringSubmatch(part); m != nil {
+			if heading := mobiHTMLToText(m[1]); heading != "" {
+				chapter = heading
+			}
+		}
+		anchor := storage.EvidenceAnchor{AssetID: asset.ID, Chapter: &chapter}
+		atom := storage.NewContentAtom(
+			ComputeAtomID(asset.ID, storage.AtomText, seqIdx),
+			asset.ID, storage.AtomText, seqIdx, anchor.ToJSON(),
+		)
+		atom.PayloadText = &text
+		atoms = append(atoms, atom)
+		seqIdx++
+	}
+
+	meta := make(map[string]string)
+	for typ, key := range mobiMetadataKeys {
+		var values []string
+		for _, v := range book.EXTH[typ] {
+			if v = strings.TrimSpace(decode([]byte(v))); v != "" {
+				values = append(values, v)
+			}
+		}
+		if len(values) > 0 {
+			meta[key] = strings.Join(values, "; ")
+		}
+	}
+	if meta["title"] == "" && book.Title != "" {
+		meta["title"] = decode([]byte(book.Title))
+	}
+	switch {
+	case book.Version >= 8:
+		meta["format"] = "KF8"
+	case book.Version > 0:
+		meta["format"] = fmt.Sprintf("MOBI %d", book.Version)
+	default:
+		meta["format"] = "PalmDOC"
+	}
+	atoms = append(atoms, metadataAtom(asset.ID, meta, seqIdx))
+
+	return atoms, nil
+}
+
+// splitMOBIChapters cuts book markup into chapters. KF8 text is a sequence
+// of complete XHTML files; MOBI 6 text is one document with page breaks.
+func splitMOBIChapters(markup string, kf8 bool) []string {
+	if !kf8 {
+		return mobiPageBreakRE.Split(markup, -1)
+	}
+	starts := mobiFileStartRE.FindAllStringIndex(markup, -1)
+	if len(starts) == 0 {
+		return []string{markup}
+	}
+	parts := make([]string, 0, len(starts))
+	for i, s := range starts {
+		end := len(markup)
+		if i+1 < len(starts) {
+			end = starts[i+1][0]
+		}
+		parts = append(parts, markup[s[0]:end])
+	}
+	return parts
+}
+
+// mobiHTMLToText strips markup, keeping paragraph breaks so sentence
+// splitting has whitespace to work with.
+func mobiHTMLToText(markup string) string {
+	text := mobiHeadRE.ReplaceAllString(markup, "")
+	text = mobiBlockEndRE.ReplaceAllString(text, "\n")
+	text = htmlTagRE.ReplaceAllString(text, " ")
+	text = html.UnescapeString(text)
+	text = mobiSpaceRE.ReplaceAllString(text, " ")
+	text = strings.ReplaceAll(strings.ReplaceAll(text, "\n ", "\n"), " \n", "\n")
+	text = mobiBlankRE.ReplaceAllString(text, "\n\n")
+	return strings.TrimSpace(text)
+}
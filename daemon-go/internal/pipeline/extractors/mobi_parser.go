@@ -0,0 +1,422 @@
+package extractors
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Compression schemes in the PalmDOC header.
+const (
+	mobiNoCompression = 1
+	mobiPalmDOC       = 2
+	mobiHuffCDIC      = 17480
+)
+
+// EXTH record types read into metadata.
+const (
+	exthAuthor      = 100
+	exthPublisher   = 101
+	exthDescription = 103
+	exthISBN        = 104
+	exthSubject     = 105
+	exthPublished   = 106
+	exthKF8Boundary = 121
+	exthTitle       = 503
+	exthLanguage    = 524
+)
+
+// mobiBook is the decoded text and header fields of a MOBI, AZW or AZW3
+// (KF8) file.
+type mobiBook struct {
+	Title   string
+	Version int              // MOBI file version; 8 means KF8
+	EXTH    map[int][]string // EXTH records by type, in file order
+	Text    []byte           // decompressed markup, still in the book's encoding
+	UTF8    bool             // text encoding is UTF-8 rather than CP1252
+}
+
+// mobiHeader holds the fields of record 0 needed to decode the text.
+type mobiHeader struct {
+	compression int
+	textLength  int
+	textRecords int
+	encrypted   bool
+	encoding    int
+	version     int
+	title       string
+	huffRecord  int
+	huffCount   int
+	extraFlags  uint16
+	exth        map[int][]string
+}
+
+// parseMOBI reads a Palm database container holding a MOBI book. For
+// combination files carrying both a MOBI 6 and a KF8 section, the KF8
+// section is preferred because it carries the newer markup.
+func parseMOBI(data []byte) (*mobiBook, error) {
+	records, err := pdbRecords(data)
+	if err != nil {
+		return nil, err
+	}
+	hdr, err := parseMOBIHeader(records[0])
+	if err != nil {
+		return nil, err
+	}
+
+	base := 0
+	if b, ok := hdr.exthInt(exthKF8Boundary); ok && hdr.version < 8 && b > 0 && b < len(records) {
+		if kf8, err := parseMOBIHeader(records[b]); err == nil && kf8.version >= 8 {
+			base, hdr = b, kf8
+		}
+	}
+	if hdr.encrypted {
+		return nil, errors.New("mobi: book is DRM-protected")
+	}
+	if base+hdr.textRecords >= len(records) {
+		return nil, fmt.Errorf("mobi: %d text records but only %d records", hdr.textRecords, len(records)-base-1)
+	}
+
+	var decode func([]byte) ([]byte, error)
+	switch hdr.compression {
+	case mobiNoCompression:
+		decode = func(b []byte) ([]byte, error) { return b, nil }
+	case mobiPalmDOC:
+		decode = func(b []byte) ([]byte, error) { return palmDOCDecompress(b), nil }
+	case mobiHuffCDIC:
+		start := base + hdr.huffRecord
+		if hdr.huffCount < 2 || start+hdr.huffCount > len(records) {
+			return nil, errors.New("mobi: HUFF/CDIC records out of range")
+		}
+		huff, err := newHuffCDIC(records[start], records[start+1:start+hdr.huffCount])
+		if err != nil {
+			return nil, err
+		}
+		decode = huff.decompress
+	default:
+		return nil, fmt.Errorf("mobi: unsupported compression %d", hdr.compression)
+	}
+
+	var text bytes.Buffer
+	for i := 1; i <= hdr.textRecords; i++ {
+		rec := records[base+i]
+		rec = rec[:len(rec)-trailingEntriesSize(rec, hdr.extraFlags)]
+		out, err := decode(rec)
+		if err != nil {
+			return nil, fmt.Errorf("mobi: text record %d: %w", i, err)
+		}
+		text.Write(out)
+	}
+	body := text.Bytes()
+	if hdr.textLength > 0 && hdr.textLength < len(body) {
+		body = body[:hdr.textLength]
+	}
+
+	return &mobiBook{
+		Title:   hdr.title,
+		Version: hdr.version,
+		EXTH:    hdr.exth,
+		Text:    body,
+		UTF8:    hdr.encoding == 65001,
+	}, nil
+}
+
+// pdbRecords splits a Palm database into its records.
+func pdbRecords(data []byte) ([][]byte, error) {
+	if len(data) < 78 {
+		return nil, errors.New("mobi: file too short")
+	}
+	if kind := string(data[60:68]); kind != "BOOKMOBI" && kind != "TEXtREAd" {
+		return nil, fmt.Errorf("mobi: unsupported database type %q", kind)
+	}
+	n := int(binary.BigEndian.Uint16(data[76:78]))
+	if n == 0 || 78+8*n > len(data) {
+		return nil, errors.New("mobi: bad record list")
+	}
+	offsets := make([]int, n+1)
+	for i := 0; i < n; i++ {
+		offsets[i] = int(binary.BigEndian.Uint32(data[78+8*i:]))
+	}
+	offsets[n] = len(data)
+
+	records := make([][]byte, n)
+	for i := 0; i < n; i++ {
+		start, end := offsets[i], offsets[i+1]
+		if start > end || end > len(data) {
+			return nil, fmt.Errorf("mobi: record %d out of range", i)
+		}
+		records[i] = data[start:end]
+	}
+	return records, nil
+}
+
+// parseMOBIHeader reads the PalmDOC header and, if present, the MOBI and
+// EXTH headers from a section's first record. Plain PalmDOC files have only
+// the 16-byte PalmDOC header.
+func parseMOBIHeader(rec []byte) (*mobiHeader, error) {
+	if len(rec) < 16 {
+		return nil, errors.New("mobi: record 0 too short")
+	}
+	be := binary.BigEndian
+	h := &mobiHeader{
+		compression: int(be.Uint16(rec[0:])),
+		textLength:  int(be.Uint32(rec[4:])),
+		textRecords: int(be.Uint16(rec[8:])),
+		encrypted:   be.Uint16(rec[12:]) != 0,
+		encoding:    1252,
+		exth:        make(map[int][]string),
+	}
+	if len(rec) < 24 || string(rec[16:20]) != "MOBI" {
+		return h, nil
+	}
+
+	headerLen := int(be.Uint32(rec[20:]))
+	field := func(off int) uint32 {
+		if off+4 > 16+headerLen || off+4 > len(rec) {
+			return 0
+		}
+		return be.Uint32(rec[off:])
+	}
+	h.encoding = int(field(28))
+	h.version = int(field(36))
+	if off, n := int(field(84)), int(field(88)); off > 0 && off+n <= len(rec) {
+		h.title = string(rec[off : off+n])
+	}
+	h.huffRecord = int(field(112))
+	h.huffCount = int(field(116))
+	if headerLen >= 0xE4 && 0xF4 <= len(rec) {
+		h.extraFlags = be.Uint16(rec[0xF2:])
+	}
+	if field(128)&0x40 != 0 && 16+headerLen < len(rec) {
+		h.exth = parseEXTH(rec[16+headerLen:])
+	}
+	return h, nil
+}
+
+func (h *mobiHeader) exthInt(typ int) (int, bool) {
+	v := h.exth[typ]
+	if len(v) == 0 || len(v[0]) != 4 {
+		return 0, false
+	}
+	return int(binary.BigEndian.Uint32([]byte(v[0]))), true
+}
+
+// parseEXTH decodes the extended header's typed records. Values are kept
+// as raw strings; numeric records are four big-endian bytes.
+func parseEXTH(b []byte) map[int][]string {
+	out := make(map[int][]string)
+	if len(b) < 12 || string(b[:4]) != "EXTH" {
+		return out
+	}
+	count := int(binary.BigEndian.Uint32(b[8:]))
+	pos := 12
+	for i := 0; i < count && pos+8 <= len(b); i++ {
+		typ := int(binary.BigEndian.Uint32(b[pos:]))
+		size := int(binary.BigEndian.Uint32(b[pos+4:]))
+		if size < 8 || pos+size > len(b) {
+			break
+		}
+		out[typ] = append(out[typ], string(b[pos+8:pos+size]))
+		pos += size
+	}
+	return out
+}
+
+// trailingEntriesSize returns the number of bytes at the end of a text
+// record that hold trailing entries rather than compressed text. Each set
+// bit above bit 0 in flags adds one entry whose size is stored as a
+// backward-encoded variable-width integer; bit 0 marks multibyte overlap.
+func trailingEntriesSize(rec []byte, flags uint16) int {
+	size := 0
+	for f := flags >> 1; f != 0; f >>= 1 {
+		if f&1 == 0 {
+			continue
+		}
+		end := len(rec) - size
+		n, shift := 0, 0
+		for end > 0 {
+			end--
+			b := rec[end]
+			n |= int(b&0x7F) << shift
+			shift += 7
+			if b&0x80 != 0 || shift >= 28 {
+				break
+			}
+		}
+		size += n
+	}
+	if flags&1 != 0 && size < len(rec) {
+		size += int(rec[len(rec)-size-1]&3) + 1
+	}
+	if size > len(rec) {
+		return len(rec)
+	}
+	return size
+}
+
+// palmDOCDecompress expands PalmDOC's LZ77 variant.
+func palmDOCDecompress(in []byte) []byte {
+	out := make([]byte, 0, 4096)
+	for i := 0; i < len(in); i++ {
+		c := in[i]
+		switch {
+		case c == 0 || (c >= 0x09 && c <= 0x7F):
+			out = append(out, c)
+		case c <= 0x08: // literal run
+			end := i + 1 + int(c)
+			if end > len(in) {
+				end = len(in)
+			}
+			out = append(out, in[i+1:end]...)
+			i = end - 1
+		case c >= 0xC0: // space plus character
+			out = append(out, ' ', c^0x80)
+		default: // back reference: 11-bit distance, 3-bit length
+			if i+1 >= len(in) {
+				return out
+			}
+			i++
+			pair := int(c)<<8 | int(in[i])
+			dist := (pair >> 3) & 0x7FF
+			n := pair&7 + 3
+			if dist == 0 || dist > len(out) {
+				continue
+			}
+			for j := 0; j < n; j++ { // may overlap its own output
+				out = append(out, out[len(out)-dist])
+			}
+		}
+	}
+	return out
+}
+
+// huffCDIC decodes HUFF/CDIC compressed text: a canonical Huffman code
+// over a dictionary of phrases, where phrases may themselves be compressed.
+type huffCDIC struct {
+	dict1   [256]huffCode
+	mincode [33]uint64
+	maxcode [33]uint64
+	phrases []huffPhrase
+	depth   int
+}
+
+type huffCode struct {
+	length  int
+	term    bool
+	maxcode uint64
+}
+
+type huffPhrase struct {
+	data     []byte
+	expanded bool
+}
+
+func newHuffCDIC(huff []byte, cdics [][]byte) (*huffCDIC, error) {
+	be := binary.BigEndian
+	if len(huff) < 16 || string(huff[:4]) != "HUFF" {
+		return nil, errors.New("mobi: bad HUFF record")
+	}
+	off1, off2 := int(be.Uint32(huff[8:])), int(be.Uint32(huff[12:]))
+	if off1+256*4 > len(huff) || off2+64*4 > len(huff) {
+		return nil, errors.New("mobi: truncated HUFF record")
+	}
+
+	h := &huffCDIC{}
+	for i := 0; i < 256; i++ {
+		v := be.Uint32(huff[off1+4*i:])
+		length := int(v & 0x1F)
+		if length == 0 {
+			return nil, errors.New("mobi: zero-length Huffman code")
+		}
+		h.dict1[i] = huffCode{
+			length:  length,
+			term:    v&0x80 != 0,
+			maxcode: ((uint64(v>>8) + 1) << (32 - length)) - 1,
+		}
+	}
+	for length := 1; length <= 32; length++ {
+		lo := uint64(be.Uint32(huff[off2+8*(length-1):]))
+		hi := uint64(be.Uint32(huff[off2+8*(length-1)+4:]))
+		h.mincode[length] = lo << (32 - length)
+		h.maxcode[length] = ((hi + 1) << (32 - length)) - 1
+	}
+
+	for _, cdic := range cdics {
+		if len(cdic) < 16 || string(cdic[:4]) != "CDIC" {
+			return nil, errors.New("mobi: bad CDIC record")
+		}
+		total, bits := int(be.Uint32(cdic[8:])), be.Uint32(cdic[12:])
+		n := total - len(h.phrases)
+		if bits < 32 && n > 1<<bits {
+			n = 1 << bits
+		}
+		for i := 0; i < n && 16+2*i+2 <= len(cdic); i++ {
+			off := 16 + int(be.Uint16(cdic[16+2*i:]))
+			if off+2 > len(cdic) {
+				return nil, errors.New("mobi: CDIC phrase out of range")
+			}
+			blen := int(be.Uint16(cdic[off:]))
+			end := off + 2 + blen&0x7FFF
+			if end > len(cdic) {
+				return nil, errors.New("mobi: CDIC phrase out of range")
+			}
+			h.phrases = append(h.phrases, huffPhrase{data: cdic[off+2 : end], expanded: blen&0x8000 != 0})
+		}
+	}
+	return h, nil
+}
+
+func (h *huffCDIC) decompress(data []byte) ([]byte, error) {
+	h.depth++
+	defer func() { h.depth-- }()
+	if h.depth > 32 {
+		return nil, errors.New("mobi: HUFF/CDIC phrases nested too deeply")
+	}
+
+	padded := make([]byte, len(data)+16)
+	copy(padded, data)
+	bitsLeft := len(data) * 8
+	pos, n := 0, 32
+	x := binary.BigEndian.Uint64(padded)
+
+	var out []byte
+	for {
+		if n <= 0 {
+			pos += 4
+			x = binary.BigEndian.Uint64(padded[pos:])
+			n += 32
+		}
+		code := (x >> uint(n)) & 0xFFFFFFFF
+
+		c := h.dict1[code>>24]
+		length, maxcode := c.length, c.maxcode
+		if !c.term {
+			for length < 32 && code < h.mincode[length] {
+				length++
+			}
+			maxcode = h.maxcode[length]
+		}
+		n -= length
+		bitsLeft -= length
+		if bitsLeft < 0 {
+			break
+		}
+
+		idx := int((maxcode - code) >> (32 - length))
+		if idx >= len(h.phrases) {
+			return nil, fmt.Errorf("mobi: phrase %d out of range", idx)
+		}
+		p := h.phrases[idx]
+		if !p.expanded {
+			expanded, err := h.decompress(p.data)
+			if err != nil {
+				return nil, err
+			}
+			p = huffPhrase{data: expanded, expanded: true}
+			h.phrases[idx] = p
+		}
+		out = append(out, p.data...)
+	}
+	return out, nil
+}
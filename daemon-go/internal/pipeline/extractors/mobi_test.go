@@ -0,0 +1,245 @@
+package extractors
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/oho/knowledge-refinery-daemon/internal/storage"
+)
+
+// mobiSpec describes a test book for buildMOBI.
+type mobiSpec struct {
+	compression int
+	version     int
+	encoding    int
+	title       string
+	exth        map[int]string
+	text        [][]byte // text records, already compressed
+	textLength  int
+	extraFlags  uint16
+	extra       [][]byte // records after the text (e.g. HUFF/CDIC)
+	huffRecord  int
+}
+
+// buildMOBI assembles a BOOKMOBI Palm database.
+func buildMOBI(spec mobiSpec) []byte {
+	be := binary.BigEndian
+
+	var rec0 bytes.Buffer
+	palm := make([]byte, 16)
+	be.PutUint16(palm[0:], uint16(spec.compression))
+	be.PutUint32(palm[4:], uint32(spec.textLength))
+	be.PutUint16(palm[8:], uint16(len(spec.text)))
+	be.PutUint16(palm[10:], 4096)
+	rec0.Write(palm)
+
+	const headerLen = 0xE8
+	mobi := make([]byte, headerLen)
+	copy(mobi, "MOBI")
+	be.PutUint32(mobi[4:], headerLen)
+	be.PutUint32(mobi[12:], uint32(spec.encoding))
+	be.PutUint32(mobi[20:], uint32(spec.version))
+	be.PutUint32(mobi[96:], uint32(spec.huffRecord))
+	be.PutUint32(mobi[100:], uint32(len(spec.extra)))
+	be.PutUint32(mobi[112:], 0x40)
+	be.PutUint16(mobi[0xF2-16:], spec.extraFlags)
+
+	var exth bytes.Buffer
+	for typ, v := range spec.exth {
+		binary.Write(&exth, be, uint32(typ))
+		binary.Write(&exth, be, uint32(8+len(v)))
+		exth.WriteString(v)
+	}
+	exthRec := append([]byte("EXTH"), make([]byte, 8)...)
+	be.PutUint32(exthRec[4:], uint32(12+exth.Len()))
+	be.PutUint32(exthRec[8:], uint32(len(spec.exth)))
+	exthRec = append(exthRec, exth.Bytes()...)
+
+	titleOff := 16 + headerLen + len(exthRec)
+	be.PutUint32(mobi[84-16:], uint32(titleOff))
+	be.PutUint32(mobi[88-16:], uint32(len(spec.title)))
+	rec0.Write(mobi)
+	rec0.Write(exthRec)
+	rec0.WriteString(spec.title)
+
+	records := append([][]byte{rec0.Bytes()}, spec.text...)
+	records = append(records, spec.extra...)
+
+	hdr := make([]byte, 78+8*len(records)+2)
+	copy(hdr, "test-book")
+	copy(hdr[60:], "BOOKMOBI")
+	be.PutUint16(hdr[76:], uint16(len(records)))
+	off := len(hdr)
+	for i, r := range records {
+		be.PutUint32(hdr[78+8*i:], uint32(off))
+		off += len(r)
+	}
+	out := hdr
+	for _, r := range records {
+		out = append(out, r...)
+	}
+	return out
+}
+
+func extractMOBI(t *testing.T, data []byte, name string) []storage.ContentAtom {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	os.WriteFile(path, data, 0644)
+	atoms, err := (&MOBIExtractor{}).Extract(storage.NewFileAsset("mobi-id", path, name))
+	if err != nil {
+		t.Fatalf("Extract: %v", err)
+	}
+	return atoms
+}
+
+func TestPalmDOCDecompress(t *testing.T) {
+	// "abcabcabc x": literals, a back reference (distance 3, length 6),
+	// a space+char byte, and a literal run.
+	in := []byte{'a', 'b', 'c', 0x80, 0x1B, 'x' | 0x80, 0x02, 0xC3, 0xA9}
+	got := palmDOCDecompress(in)
+	if want := "abcabcabc x\xc3\xa9"; string(got) != want {
+		t.Errorf("palmDOCDecompress = %q, want %q", got, want)
+	}
+}
+
+func TestTrailingEntriesSize(t *testing.T) {
+	// "hello", a two-byte multibyte overlap ("X", 0x01), and a three-byte
+	// trailing entry whose size byte comes last.
+	rec := []byte("helloX\x01ZZ\x83")
+	n := trailingEntriesSize(rec, 0x3)
+	if got := string(rec[:len(rec)-n]); got != "hello" {
+		t.Errorf("text after stripping = %q, want hello", got)
+	}
+}
+
+func TestMOBIExtractorChapters(t *testing.T) {
+	markup := `<html><head><guide></guide></head><body>` +
+		`<h1>Chapter One</h1><p>It was a bright cold day in April.</p>` +
+		`<mbp:pagebreak/><h2>Chapter Two</h2><p>Caf&eacute; &amp; cr&egrave;me.</p>` +
+		`</body></html>`
+	data := buildMOBI(mobiSpec{
+		compression: mobiNoCompression,
+		version:     6,
+		encoding:    65001,
+		title:       "Header Title",
+		exth: map[int]string{
+			exthTitle:     "A Test Book",
+			exthAuthor:    "Jane Author",
+			exthLanguage:  "en",
+			exthPublisher: "Example Press",
+		},
+		// Split the text across two records, the second with a
+		// trailing entry that must be stripped.
+		text:       [][]byte{[]byte(markup[:60] + "\x81"), []byte(markup[60:] + "\x81")},
+		textLength: len(markup),
+		extraFlags: 0x2,
+	})
+
+	atoms := extractMOBI(t, data, "book.mobi")
+	if len(atoms) != 3 {
+		t.Fatalf("expected 2 chapters and a metadata atom, got %d atoms", len(atoms))
+	}
+
+	wantChapters := []struct{ chapter, text string }{
+		{"Chapter One", "Chapter One\nIt was a bright cold day in April."},
+		{"Chapter Two", "Chapter Two\nCafé & crème."},
+	}
+	for i, want := range wantChapters {
+		var anchor storage.EvidenceAnchor
+		json.Unmarshal([]byte(atoms[i].EvidenceAnchor), &anchor)
+		if anchor.Chapter == nil || *anchor.Chapter != want.chapter {
+			t.Errorf("atom %d chapter = %v, want %q", i, anchor.Chapter, want.chapter)
+		}
+		if got := *atoms[i].PayloadText; got != want.text {
+			t.Errorf("atom %d text = %q, want %q", i, got, want.text)
+		}
+	}
+
+	var meta map[string]string
+	json.Unmarshal([]byte(*atoms[2].MetadataJSON), &meta)
+	if meta["title"] != "A Test Book" || meta["author"] != "Jane Author" ||
+		meta["publisher"] != "Example Press" || meta["language"] != "en" || meta["format"] != "MOBI 6" {
+		t.Errorf("unexpected metadata: %v", meta)
+	}
+}
+
+func TestMOBIExtractorKF8HuffCDIC(t *testing.T) {
+	// A HUFF table where every 8-bit code is terminal and code byte b selects
+	// phrase 255-b, and a CDIC whose last phrase is itself compressed.
+	be := binary.BigEndian
+	huff := make([]byte, 24+256*4+64*4)
+	copy(huff, "HUFF")
+	be.PutUint32(huff[8:], 24)
+	be.PutUint32(huff[12:], 24+256*4)
+	for i := 0; i < 256; i++ {
+		be.PutUint32(huff[24+4*i:], 255<<8|0x80|8)
+	}
+
+	phrases := [][]byte{
+		[]byte("<html><body><h1>Intro</h1><p>Hello"),
+		[]byte(" world.</p></body></html>"),
+		[]byte("<html><body><p>Second file.</p></body></html>"),
+		{255 - 0, 255 - 1}, // compressed: expands to phrases 0 and 1
+	}
+	var table, bodies bytes.Buffer
+	for i, p := range phrases {
+		binary.Write(&table, be, uint16(2*len(phrases)+bodies.Len()))
+		flag := uint16(0x8000)
+		if i == 3 {
+			flag = 0
+		}
+		binary.Write(&bodies, be, uint16(len(p))|flag)
+		bodies.Write(p)
+	}
+	cdic := make([]byte, 16)
+	copy(cdic, "CDIC")
+	be.PutUint32(cdic[4:], 16)
+	be.PutUint32(cdic[8:], uint32(len(phrases)))
+	be.PutUint32(cdic[12:], 8)
+	cdic = append(append(cdic, table.Bytes()...), bodies.Bytes()...)
+
+	data := buildMOBI(mobiSpec{
+		compression: mobiHuffCDIC,
+		version:     8,
+		encoding:    65001,
+		title:       "KF8 Book",
+		text:        [][]byte{{255 - 3}, {255 - 2}},
+		huffRecord:  3,
+		extra:       [][]byte{huff, cdic},
+	})
+
+	atoms := extractMOBI(t, data, "book.azw3")
+	if len(atoms) != 3 {
+		t.Fatalf("expected 2 chapters and a metadata atom, got %d atoms", len(atoms))
+	}
+	if got := *atoms[0].PayloadText; got != "Intro\nHello world." {
+		t.Errorf("chapter 1 = %q", got)
+	}
+	if got := *atoms[1].PayloadText; got != "Second file." {
+		t.Errorf("chapter 2 = %q", got)
+	}
+	var anchor storage.EvidenceAnchor
+	json.Unmarshal([]byte(atoms[1].EvidenceAnchor), &anchor)
+	if anchor.Chapter == nil || *anchor.Chapter != "part2" {
+		t.Errorf("chapter 2 anchor = %v, want part2", anchor.Chapter)
+	}
+	if !strings.Contains(*atoms[2].MetadataJSON, `"title":"KF8 Book"`) || !strings.Contains(*atoms[2].MetadataJSON, `"format":"KF8"`) {
+		t.Errorf("unexpected metadata: %s", *atoms[2].MetadataJSON)
+	}
+}
+
+func TestMOBIExtractorRejectsDRM(t *testing.T) {
+	data := buildMOBI(mobiSpec{compression: mobiNoCompression, version: 6, text: [][]byte{[]byte("x")}})
+	rec0 := binary.BigEndian.Uint32(data[78:])
+	binary.BigEndian.PutUint16(data[rec0+12:], 2) // encryption type
+	path := filepath.Join(t.TempDir(), "drm.azw")
+	os.WriteFile(path, data, 0644)
+	if _, err := (&MOBIExtractor{}).Extract(storage.NewFileAsset("drm", path, "drm.azw")); err == nil || !strings.Contains(err.Error(), "DRM") {
+		t.Errorf("expected DRM error, got %v", err)
+	}
+}
@@ -0,0 +1,201 @@
+package extractors
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/oho/knowledge-refinery-daemon/internal/storage"
+)
+
+// maxNotebookOutputChars bounds how much of each cell output is kept, so
+// large printed dataframes or logs do not drown the cell's source.
+const maxNotebookOutputChars = 4000
+
+var ansiEscapeRE = regexp.MustCompile(`\x1b\[[0-9;]*[A-Za-z]`)
+
+// notebookText is a notebook string field, stored either as one string or
+// as a list of lines.
+type notebookText string
+
+func (t *notebookText) UnmarshalJSON(b []byte) error {
+	var lines []string
+	if err := json.Unmarshal(b, &lines); err == nil {
+		*t = notebookText(strings.Join(lines, ""))
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	*t = notebookText(s)
+	return nil
+}
+
+type notebookCell struct {
+	CellType string           `json:"cell_type"`
+	Source   notebookText     `json:"source"`
+	Input    notebookText     `json:"input"` // nbformat 3 code cells
+	Outputs  []notebookOutput `json:"outputs"`
+}
+
+type notebookOutput struct {
+	OutputType string                     `json:"output_type"`
+	Text       notebookText               `json:"text"`
+	Data       map[string]json.RawMessage `json:"data"` // MIME bundle; values may be objects
+	EName      string                     `json:"ename"`
+	EValue     string                     `json:"evalue"`
+}
+
+type notebookFile struct {
+	NBFormat   int            `json:"nbformat"`
+	Cells      []notebookCell `json:"cells"`
+	Worksheets []struct {
+		Cells []notebookCell `json:"cells"`
+	} `json:"worksheets"` // nbformat 3
+	Metadata struct {
+		KernelSpec struct {
+			Name        string `json:"name"`
+			DisplayName string `json:"display_name"`
+			Language    string `json:"language"`
+		} `json:"kernelspec"`
+		LanguageInfo struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		} `json:"language_info"`
+	} `json:"metadata"`
+}
+
+// NotebookExtractor handles Jupyter notebooks, emitting one atom per cell
+// with markdown, code and text outputs, anchored by cell index.
+type NotebookExtractor struct{}
+
+func (e *NotebookExtractor) Name() string  { return "notebook" }
+func (e *NotebookExtractor) Priority() int { return 12 }
+
+func (e *NotebookExtractor) CanHandle(asset storage.FileAsset) bool {
+	return strings.ToLower(filepath.Ext(asset.Filename)) == ".ipynb"
+}
+
+func (e *NotebookExtractor) Extract(asset storage.FileAsset) ([]storage.ContentAtom, error) {
+	data, err := os.ReadFile(asset.Path)
+	if err != nil {
+		return nil, err
+	}
+	var nb notebookFile
+	if err := json.Unmarshal(data, &nb); err != nil {
+		return nil, fmt.Errorf("parse notebook: %w", err)
+	}
+	cells := nb.Cells
+	for _, ws := range nb.Worksheets {
+		cells = append(cells, ws.Cells...)
+	}
+
+	lang := nb.Metadata.LanguageInfo.Name
+	if lang == "" {
+		lang = nb.Metadata.KernelSpec.Language
+	}
+
+	var atoms []storage.ContentAtom
+	seqIdx := 0
+	for i, cell := range cells {
+		text := renderNotebookCell(cell, lang)
+		if text == "" {
+			continue
+		}
+		cellIndex := i
+		anchor := storage.EvidenceAnchor{AssetID: asset.ID, CellIndex: &cellIndex}
+		atom := storage.NewContentAtom(
+			ComputeAtomID(asset.ID, storage.AtomText, seqIdx),
+			asset.ID, storage.AtomText, seqIdx, anchor.ToJSON(),
+		)
+		atom.PayloadText = &text
+		setAtomMetadata(&atom, "cell_type", cell.CellType)
+		atoms = append(atoms, atom)
+		seqIdx++
+	}
+
+	meta := map[string]string{"cell_count": fmt.Sprint(len(cells))}
+	if nb.NBFormat > 0 {
+		meta["nbformat"] = fmt.Sprint(nb.NBFormat)
+	}
+	if lang != "" {
+		meta["programming_language"] = lang
+	}
+	if v := nb.Metadata.LanguageInfo.Version; v != "" {
+		meta["programming_language_version"] = v
+	}
+	if k := nb.Metadata.KernelSpec.DisplayName; k != "" {
+		meta["kernel"] = k
+	}
+	atoms = append(atoms, metadataAtom(asset.ID, meta, seqIdx))
+	return atoms, nil
+}
+
+// renderNotebookCell turns a cell into text: markdown as written, code in a
+// fenced block followed by its text outputs.
+func renderNotebookCell(cell notebookCell, lang string) string {
+	source := strings.TrimSpace(string(cell.Source))
+	if source == "" {
+		source = strings.TrimSpace(string(cell.Input))
+	}
+	if cell.CellType != "code" {
+		return source
+	}
+
+	var b strings.Builder
+	if source != "" {
+		fmt.Fprintf(&b, "```%s\n%s\n```", lang, source)
+	}
+	for _, out := range cell.Outputs {
+		text := notebookOutputText(out)
+		if text == "" {
+			continue
+		}
+		if len(text) > maxNotebookOutputChars {
+			text = strings.ToValidUTF8(text[:maxNotebookOutputChars], "") + "\n[output truncated]"
+		}
+		if b.Len() > 0 {
+			b.WriteString("\n\n")
+		}
+		b.WriteString("Output:\n")
+		b.WriteString(text)
+	}
+	return b.String()
+}
+
+// data returns a textual MIME bundle entry, or "" if absent or not text.
+func (o notebookOutput) data(mime string) string {
+	var t notebookText
+	if raw, ok := o.Data[mime]; !ok || json.Unmarshal(raw, &t) != nil {
+		return ""
+	}
+	return string(t)
+}
+
+// notebookOutputText returns the textual part of an output; images and
+// other binary MIME bundles are skipped.
+func notebookOutputText(out notebookOutput) string {
+	var text string
+	switch out.OutputType {
+	case "stream":
+		text = string(out.Text)
+	case "error", "pyerr":
+		text = out.EName + ": " + out.EValue
+	default: // execute_result, display_data, pyout
+		switch {
+		case out.data("text/markdown") != "":
+			text = out.data("text/markdown")
+		case out.data("text/plain") != "":
+			text = out.data("text/plain")
+		case out.data("text/html") != "":
+			text = stripHTML(out.data("text/html"))
+		default:
+			text = string(out.Text) // nbformat 3 pyout
+		}
+	}
+	return strings.TrimSpace(ansiEscapeRE.ReplaceAllString(text, ""))
+}
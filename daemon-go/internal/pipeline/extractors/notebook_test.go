@@ -0,0 +1,69 @@
+package extractors
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/oho/knowledge-refinery-daemon/internal/storage"
+)
+
+func TestNotebookExtractor(t *testing.T) {
+	nb := `{
+  "nbformat": 4,
+  "metadata": {"kernelspec": {"display_name": "Python 3", "language": "python"},
+               "language_info": {"name": "python", "version": "3.12.1"}},
+  "cells": [
+    {"cell_type": "markdown", "source": ["# Results\n", "Fitting the model."]},
+    {"cell_type": "code", "source": "print('hi')\n1 + 1", "outputs": [
+      {"output_type": "stream", "name": "stdout", "text": ["hi\n"]},
+      {"output_type": "execute_result", "data": {"text/plain": ["2"], "application/json": {"v": 2}}},
+      {"output_type": "display_data", "data": {"image/png": "iVBORw0KGgo="}}
+    ]},
+    {"cell_type": "code", "source": [], "outputs": []},
+    {"cell_type": "code", "source": "1/0", "outputs": [
+      {"output_type": "error", "ename": "ZeroDivisionError", "evalue": "division by zero",
+       "traceback": ["\u001b[0;31mZeroDivisionError\u001b[0m"]}
+    ]}
+  ]
+}`
+	path := filepath.Join(t.TempDir(), "analysis.ipynb")
+	os.WriteFile(path, []byte(nb), 0644)
+
+	atoms, err := (&NotebookExtractor{}).Extract(storage.NewFileAsset("nb", path, "analysis.ipynb"))
+	if err != nil {
+		t.Fatalf("Extract: %v", err)
+	}
+	if len(atoms) != 4 {
+		t.Fatalf("expected 3 cell atoms (empty cell skipped) and metadata, got %d", len(atoms))
+	}
+
+	want := []struct {
+		cell int
+		text string
+	}{
+		{0, "# Results\nFitting the model."},
+		{1, "```python\nprint('hi')\n1 + 1\n```\n\nOutput:\nhi\n\nOutput:\n2"},
+		{3, "```python\n1/0\n```\n\nOutput:\nZeroDivisionError: division by zero"},
+	}
+	for i, w := range want {
+		anchor, _ := storage.ParseEvidenceAnchor(atoms[i].EvidenceAnchor)
+		if anchor.CellIndex == nil || *anchor.CellIndex != w.cell {
+			t.Errorf("atom %d cell_index = %v, want %d", i, anchor.CellIndex, w.cell)
+		}
+		if got := *atoms[i].PayloadText; got != w.text {
+			t.Errorf("atom %d text = %q, want %q", i, got, w.text)
+		}
+	}
+	if !strings.Contains(*atoms[1].MetadataJSON, `"cell_type":"code"`) {
+		t.Errorf("cell metadata = %s", *atoms[1].MetadataJSON)
+	}
+
+	var meta map[string]string
+	json.Unmarshal([]byte(*atoms[3].MetadataJSON), &meta)
+	if meta["kernel"] != "Python 3" || meta["programming_language"] != "python" || meta["cell_count"] != "4" {
+		t.Errorf("unexpected metadata: %v", meta)
+	}
+}
@@ -0,0 +1,256 @@
+package extractors
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/oho/knowledge-refinery-daemon/internal/config"
+	"github.com/oho/knowledge-refinery-daemon/internal/storage"
+)
+
+// defaultPluginPriority places plugins ahead of every built-in extractor
+// unless the config says otherwise.
+const defaultPluginPriority = 50
+
+const maxPluginStderrBytes = 4096
+
+var errPluginOutputLimit = errors.New("plugin output limit exceeded")
+
+var validAtomTypes = map[storage.AtomType]bool{
+	storage.AtomText: true, storage.AtomImage: true, storage.AtomTable: true,
+	storage.AtomMetadata: true, storage.AtomBinary: true,
+}
+
+// pluginRecord is one JSON value in a plugin's output stream. It mirrors
+// ContentAtom, but IDs and the asset ID are assigned by the daemon and
+// metadata and anchors are plain objects.
+type pluginRecord struct {
+	AtomType       storage.AtomType        `json:"atom_type"`
+	SequenceIndex  *int                    `json:"sequence_index,omitempty"`
+	PayloadText    *string                 `json:"payload_text,omitempty"`
+	PayloadRef     *string                 `json:"payload_ref,omitempty"`
+	Metadata       json.RawMessage         `json:"metadata,omitempty"`
+	EvidenceAnchor *storage.EvidenceAnchor `json:"evidence_anchor,omitempty"`
+}
+
+// PluginExtractor runs an external executable declared in the config.
+//
+// The executable receives the asset path as its final argument, and
+// KR_ASSET_ID, KR_ASSET_PATH and KR_MIME_TYPE in its environment. It runs
+// in a scratch working directory with stdin closed, and must write a stream
+// of JSON atom records to stdout and exit 0. Wall time, output size and the
+// number of atoms are bounded by the sandbox limits.
+type PluginExtractor struct {
+	plugin  config.PluginConfig
+	sandbox config.SandboxConfig
+	tempDir string
+}
+
+func NewPluginExtractor(plugin config.PluginConfig, sandbox config.SandboxConfig, tempDir string) *PluginExtractor {
+	if plugin.Priority == 0 {
+		plugin.Priority = defaultPluginPriority
+	}
+	return &PluginExtractor{plugin: plugin, sandbox: sandbox, tempDir: tempDir}
+}
+
+func (e *PluginExtractor) Name() string  { return "plugin:" + e.plugin.Name }
+func (e *PluginExtractor) Priority() int { return e.plugin.Priority }
+
+// Version combines the declared plugin version with its command line, so
+// pointing the plugin at another executable invalidates cached results.
+func (e *PluginExtractor) Version() string {
+	v := e.plugin.Version
+	if v == "" {
+		v = "1"
+	}
+	return v + "+" + strings.Join(append([]string{e.plugin.Command}, e.plugin.Args...), " ")
+}
+
+func (e *PluginExtractor) CanHandle(asset storage.FileAsset) bool {
+	name := strings.ToLower(asset.Filename)
+	for _, glob := range e.plugin.Globs {
+		if ok, _ := filepath.Match(strings.ToLower(glob), name); ok {
+			return true
+		}
+	}
+	if asset.MimeType != nil {
+		mime, _, _ := strings.Cut(*asset.MimeType, ";")
+		mime = strings.TrimSpace(strings.ToLower(mime))
+		for _, want := range e.plugin.MimeTypes {
+			want = strings.ToLower(want)
+			if want == mime || (strings.HasSuffix(want, "/*") && strings.HasPrefix(mime, strings.TrimSuffix(want, "*"))) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (e *PluginExtractor) Extract(asset storage.FileAsset) ([]storage.ContentAtom, error) {
+	timeout := time.Duration(e.sandbox.MaxCPUSeconds) * time.Second
+	if e.plugin.TimeoutSeconds > 0 {
+		timeout = time.Duration(e.plugin.TimeoutSeconds) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	workDir, err := os.MkdirTemp(e.tempDir, "plugin-")
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s: %w", e.plugin.Name, err)
+	}
+	defer os.RemoveAll(workDir)
+
+	args := append(append([]string{}, e.plugin.Args...), asset.Path)
+	cmd := exec.CommandContext(ctx, e.plugin.Command, args...)
+	cmd.Dir = workDir
+	cmd.Env = e.environ(asset, workDir)
+	cmd.WaitDelay = 2 * time.Second
+
+	stdout := &cappedBuffer{limit: e.sandbox.MaxOutputBytes, onLimit: cancel}
+	stderr := &cappedBuffer{limit: maxPluginStderrBytes, truncate: true}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	if err := cmd.Run(); err != nil {
+		switch {
+		case stdout.exceeded:
+			return nil, fmt.Errorf("plugin %s: output exceeded %d bytes", e.plugin.Name, e.sandbox.MaxOutputBytes)
+		case ctx.Err() == context.DeadlineExceeded:
+			return nil, fmt.Errorf("plugin %s: timed out after %s", e.plugin.Name, timeout)
+		}
+		return nil, fmt.Errorf("plugin %s: %w: %s", e.plugin.Name, err, strings.TrimSpace(stderr.buf.String()))
+	}
+	return e.parseOutput(asset, stdout.buf.Bytes())
+}
+
+// environ passes a minimal environment so plugins do not inherit daemon
+// configuration or credentials.
+func (e *PluginExtractor) environ(asset storage.FileAsset, workDir string) []string {
+	env := []string{
+		"PATH=" + os.Getenv("PATH"),
+		"HOME=" + workDir,
+		"TMPDIR=" + workDir,
+		"KR_ASSET_ID=" + asset.ID,
+		"KR_ASSET_PATH=" + asset.Path,
+	}
+	if asset.MimeType != nil {
+		env = append(env, "KR_MIME_TYPE="+*asset.MimeType)
+	}
+	return env
+}
+
+// parseOutput decodes the record stream (newline-delimited or concatenated
+// JSON) into content atoms.
+func (e *PluginExtractor) parseOutput(asset storage.FileAsset, out []byte) ([]storage.ContentAtom, error) {
+	var atoms []storage.ContentAtom
+	used := make(map[int]bool)
+	nextSeq := 0
+
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for {
+		var rec pluginRecord
+		err := dec.Decode(&rec)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("plugin %s: invalid record %d: %w", e.plugin.Name, len(atoms)+1, err)
+		}
+		if len(atoms) >= e.sandbox.MaxFiles {
+			return nil, fmt.Errorf("plugin %s: more than %d atoms", e.plugin.Name, e.sandbox.MaxFiles)
+		}
+		if !validAtomTypes[rec.AtomType] {
+			return nil, fmt.Errorf("plugin %s: record %d has unknown atom_type %q", e.plugin.Name, len(atoms)+1, rec.AtomType)
+		}
+
+		seqIdx := nextSeq
+		if rec.SequenceIndex != nil {
+			seqIdx = *rec.SequenceIndex
+		}
+		if used[seqIdx] {
+			return nil, fmt.Errorf("plugin %s: duplicate sequence_index %d", e.plugin.Name, seqIdx)
+		}
+		used[seqIdx] = true
+		if seqIdx >= nextSeq {
+			nextSeq = seqIdx + 1
+		}
+
+		anchor := storage.EvidenceAnchor{}
+		if rec.EvidenceAnchor != nil {
+			anchor = *rec.EvidenceAnchor
+		}
+		anchor.AssetID = asset.ID
+
+		atom := storage.NewContentAtom(
+			ComputeAtomID(asset.ID, rec.AtomType, seqIdx),
+			asset.ID, rec.AtomType, seqIdx, anchor.ToJSON(),
+		)
+		atom.PayloadText = rec.PayloadText
+		if rec.PayloadRef != nil {
+			ref, err := e.resolvePayloadRef(asset, *rec.PayloadRef)
+			if err != nil {
+				return nil, err
+			}
+			atom.PayloadRef = &ref
+		}
+		if len(rec.Metadata) > 0 && string(rec.Metadata) != "null" {
+			meta := string(rec.Metadata)
+			atom.MetadataJSON = &meta
+		}
+		atoms = append(atoms, atom)
+	}
+	return atoms, nil
+}
+
+// resolvePayloadRef only lets a plugin reference the asset itself or a file
+// next to it; files written to the scratch directory do not outlive the run.
+func (e *PluginExtractor) resolvePayloadRef(asset storage.FileAsset, ref string) (string, error) {
+	if !filepath.IsAbs(ref) {
+		ref = filepath.Join(filepath.Dir(asset.Path), ref)
+	}
+	ref = filepath.Clean(ref)
+	if filepath.Dir(ref) != filepath.Dir(filepath.Clean(asset.Path)) {
+		return "", fmt.Errorf("plugin %s: payload_ref %q is outside the asset directory", e.plugin.Name, ref)
+	}
+	return ref, nil
+}
+
+// cappedBuffer collects process output up to limit bytes. Past the limit it
+// either silently drops the rest (truncate) or fails the write and calls
+// onLimit so the caller can kill the process.
+// It deliberately does not embed bytes.Buffer: io.Copy would use the
+// embedded ReadFrom and bypass the limit.
+type cappedBuffer struct {
+	buf      bytes.Buffer
+	limit    int64
+	truncate bool
+	onLimit  func()
+	exceeded bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	remaining := b.limit - int64(b.buf.Len())
+	if int64(len(p)) <= remaining {
+		return b.buf.Write(p)
+	}
+	if remaining > 0 {
+		b.buf.Write(p[:remaining])
+	}
+	if b.truncate {
+		return len(p), nil
+	}
+	if !b.exceeded && b.onLimit != nil {
+		b.onLimit()
+	}
+	b.exceeded = true
+	return 0, errPluginOutputLimit
+}
@@ -0,0 +1,112 @@
+package extractors
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/oho/knowledge-refinery-daemon/internal/config"
+	"github.com/oho/knowledge-refinery-daemon/internal/storage"
+)
+
+func writePlugin(t *testing.T, script string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "plugin.sh")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func testSandbox() config.SandboxConfig {
+	return config.SandboxConfig{MaxOutputBytes: 1 << 20, MaxFiles: 100, MaxCPUSeconds: 10}
+}
+
+func TestPluginExtractorReadsAtomStream(t *testing.T) {
+	cmd := writePlugin(t, `
+echo '{"atom_type":"text","payload_text":"run '"$(basename "$1")"'","evidence_anchor":{"line_start":3,"line_end":4}}'
+echo '{"atom_type":"metadata","metadata":{"instrument":"LC-MS","asset":"'"$KR_ASSET_ID"'"}}'
+`)
+	ext := NewPluginExtractor(config.PluginConfig{Name: "lab", Command: cmd, Globs: []string{"*.LAB"}}, testSandbox(), t.TempDir())
+
+	asset := storage.NewFileAsset("asset1", "/data/run42.lab", "run42.lab")
+	if !ext.CanHandle(asset) {
+		t.Fatal("expected plugin to handle glob match")
+	}
+	atoms, err := ext.Extract(asset)
+	if err != nil {
+		t.Fatalf("Extract: %v", err)
+	}
+	if len(atoms) != 2 {
+		t.Fatalf("expected 2 atoms, got %d", len(atoms))
+	}
+	if *atoms[0].PayloadText != "run run42.lab" || atoms[0].SequenceIndex != 0 {
+		t.Errorf("unexpected text atom: %+v", atoms[0])
+	}
+	anchor, _ := storage.ParseEvidenceAnchor(atoms[0].EvidenceAnchor)
+	if anchor.AssetID != "asset1" || anchor.LineStart == nil || *anchor.LineStart != 3 {
+		t.Errorf("expected anchor with asset ID and line, got %s", atoms[0].EvidenceAnchor)
+	}
+	if atoms[1].AtomType != storage.AtomMetadata || !strings.Contains(*atoms[1].MetadataJSON, `"asset":"asset1"`) {
+		t.Errorf("unexpected metadata atom: %+v", atoms[1])
+	}
+	if ext.Priority() != defaultPluginPriority {
+		t.Errorf("expected default priority %d, got %d", defaultPluginPriority, ext.Priority())
+	}
+}
+
+func TestPluginExtractorMimeMatch(t *testing.T) {
+	ext := NewPluginExtractor(config.PluginConfig{Name: "x", Command: "true", MimeTypes: []string{"application/x-lab*", "text/*"}}, testSandbox(), "")
+	asset := storage.NewFileAsset("id", "/data/a.bin", "a.bin")
+	if ext.CanHandle(asset) {
+		t.Error("should not handle asset without matching glob or MIME type")
+	}
+	mime := "text/csv; charset=utf-8"
+	asset.MimeType = &mime
+	if !ext.CanHandle(asset) {
+		t.Error("should handle wildcard MIME match")
+	}
+}
+
+func TestPluginExtractorLimits(t *testing.T) {
+	asset := storage.NewFileAsset("asset1", "/data/a.lab", "a.lab")
+
+	slow := NewPluginExtractor(config.PluginConfig{Name: "slow", Command: writePlugin(t, "sleep 5"), TimeoutSeconds: 1}, testSandbox(), "")
+	if _, err := slow.Extract(asset); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("expected timeout error, got %v", err)
+	}
+
+	sandbox := testSandbox()
+	sandbox.MaxOutputBytes = 64
+	noisy := NewPluginExtractor(config.PluginConfig{Name: "noisy", Command: writePlugin(t, `while true; do echo '{"atom_type":"text","payload_text":"xxxxxxxx"}'; done`)}, sandbox, "")
+	if _, err := noisy.Extract(asset); err == nil || !strings.Contains(err.Error(), "output exceeded") {
+		t.Errorf("expected output limit error, got %v", err)
+	}
+
+	failing := NewPluginExtractor(config.PluginConfig{Name: "bad", Command: writePlugin(t, "echo boom >&2; exit 3")}, testSandbox(), "")
+	if _, err := failing.Extract(asset); err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("expected exit error with stderr, got %v", err)
+	}
+
+	escaping := NewPluginExtractor(config.PluginConfig{Name: "ref", Command: writePlugin(t, `echo '{"atom_type":"image","payload_ref":"/etc/passwd"}'`)}, testSandbox(), "")
+	if _, err := escaping.Extract(asset); err == nil {
+		t.Error("expected payload_ref outside the asset directory to be rejected")
+	}
+}
+
+func TestCreateRegistryRegistersPlugins(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Plugins = []config.PluginConfig{
+		{Name: "lab", Command: writePlugin(t, "true"), Globs: []string{"*.lab"}},
+		{Name: "missing", Command: "/nonexistent/plugin"},
+	}
+	reg := CreateRegistry(cfg)
+	builtins := len(CreateDefaultRegistry().extractors)
+	if len(reg.extractors) != builtins+1 {
+		t.Fatalf("expected %d built-ins plus 1 plugin, got %d", builtins, len(reg.extractors))
+	}
+	if reg.extractors[0].Name() != "plugin:lab" {
+		t.Errorf("expected plugin first by priority, got %s", reg.extractors[0].Name())
+	}
+}
@@ -0,0 +1,172 @@
+package extractors
+
+import (
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/oho/knowledge-refinery-daemon/internal/storage"
+)
+
+// Cues are grouped into atoms of at most subtitleGroupSeconds, and a pause
+// longer than subtitleGapSeconds always starts a new group.
+const (
+	subtitleGroupSeconds = 60.0
+	subtitleGapSeconds   = 10.0
+)
+
+var (
+	subtitleTimingRE = regexp.MustCompile(`((?:\d+:)?\d{1,2}:\d{2}[,.]\d{1,3})\s*-->\s*((?:\d+:)?\d{1,2}:\d{2}[,.]\d{1,3})`)
+	vttVoiceRE       = regexp.MustCompile(`<v(?:\.[\w.-]+)?\s+([^>]+)>`)
+	subtitleTagRE    = regexp.MustCompile(`<[^>]*>|\{\\[^}]*\}`)
+	subtitleBlockRE  = regexp.MustCompile(`\n[ \t]*\n`)
+)
+
+type subtitleCue struct {
+	start, end float64
+	text       string
+}
+
+// SubtitleExtractor handles SubRip (.srt) and WebVTT (.vtt) subtitles,
+// grouping consecutive cues into atoms anchored by their time range.
+type SubtitleExtractor struct{}
+
+func (e *SubtitleExtractor) Name() string  { return "subtitle" }
+func (e *SubtitleExtractor) Priority() int { return 12 }
+
+func (e *SubtitleExtractor) CanHandle(asset storage.FileAsset) bool {
+	ext := strings.ToLower(filepath.Ext(asset.Filename))
+	return ext == ".srt" || ext == ".vtt"
+}
+
+func (e *SubtitleExtractor) Extract(asset storage.FileAsset) ([]storage.ContentAtom, error) {
+	data, err := os.ReadFile(asset.Path)
+	if err != nil {
+		return nil, err
+	}
+	src, enc := decodeText(data)
+	cues := parseSubtitles(src)
+
+	var atoms []storage.ContentAtom
+	seqIdx := 0
+	for _, group := range groupSubtitleCues(cues) {
+		lines := make([]string, len(group))
+		for i, c := range group {
+			lines[i] = c.text
+		}
+		text := strings.Join(lines, "\n")
+		start, end := group[0].start, group[len(group)-1].end
+		anchor := storage.EvidenceAnchor{AssetID: asset.ID, TimeStart: &start, TimeEnd: &end}
+		atom := storage.NewContentAtom(
+			ComputeAtomID(asset.ID, storage.AtomText, seqIdx),
+			asset.ID, storage.AtomText, seqIdx, anchor.ToJSON(),
+		)
+		atom.PayloadText = &text
+		setAtomMetadata(&atom, "encoding", enc)
+		atoms = append(atoms, atom)
+		seqIdx++
+	}
+
+	if len(cues) > 0 {
+		format := "SubRip"
+		if strings.EqualFold(filepath.Ext(asset.Filename), ".vtt") {
+			format = "WebVTT"
+		}
+		atoms = append(atoms, metadataAtom(asset.ID, map[string]string{
+			"format":    format,
+			"cue_count": strconv.Itoa(len(cues)),
+			"duration":  storage.FormatTimestamp(cues[len(cues)-1].end),
+		}, seqIdx))
+	}
+	return atoms, nil
+}
+
+// parseSubtitles reads SRT or WebVTT cues. Blocks without a timing line
+// (the WEBVTT header, NOTE, STYLE and REGION blocks) are skipped, markup is
+// stripped, WebVTT voice spans become "Speaker: " prefixes, and lines
+// repeated from the previous cue (rolling captions) are dropped.
+func parseSubtitles(src string) []subtitleCue {
+	src = strings.ReplaceAll(strings.ReplaceAll(src, "\r\n", "\n"), "\r", "\n")
+
+	var cues []subtitleCue
+	var prevLines map[string]bool
+	for _, block := range subtitleBlockRE.Split(src, -1) {
+		lines := strings.Split(strings.TrimSpace(block), "\n")
+		timing := -1
+		for i, line := range lines {
+			if subtitleTimingRE.MatchString(line) {
+				timing = i
+				break
+			}
+		}
+		if timing < 0 {
+			continue
+		}
+		m := subtitleTimingRE.FindStringSubmatch(lines[timing])
+		start, err1 := parseSubtitleTime(m[1])
+		end, err2 := parseSubtitleTime(m[2])
+		if err1 != nil || err2 != nil {
+			continue
+		}
+
+		var text []string
+		seen := make(map[string]bool)
+		for _, line := range lines[timing+1:] {
+			line = vttVoiceRE.ReplaceAllString(line, "$1: ")
+			line = html.UnescapeString(subtitleTagRE.ReplaceAllString(line, ""))
+			line = strings.Join(strings.Fields(line), " ")
+			if line == "" {
+				continue
+			}
+			seen[line] = true
+			if !prevLines[line] {
+				text = append(text, line)
+			}
+		}
+		prevLines = seen
+		if len(text) == 0 {
+			continue
+		}
+		cues = append(cues, subtitleCue{start: start, end: end, text: strings.Join(text, " ")})
+	}
+	return cues
+}
+
+// parseSubtitleTime parses HH:MM:SS,mmm (SRT) or [HH:]MM:SS.mmm (WebVTT)
+// into seconds.
+func parseSubtitleTime(s string) (float64, error) {
+	s = strings.Replace(s, ",", ".", 1)
+	parts := strings.Split(s, ":")
+	var total float64
+	for _, p := range parts {
+		v, err := strconv.ParseFloat(p, 64)
+		if err != nil {
+			return 0, fmt.Errorf("bad timestamp %q: %w", s, err)
+		}
+		total = total*60 + v
+	}
+	return total, nil
+}
+
+func groupSubtitleCues(cues []subtitleCue) [][]subtitleCue {
+	var groups [][]subtitleCue
+	var current []subtitleCue
+	for _, c := range cues {
+		if len(current) > 0 {
+			last := current[len(current)-1]
+			if c.start-last.end > subtitleGapSeconds || c.end-current[0].start > subtitleGroupSeconds {
+				groups = append(groups, current)
+				current = nil
+			}
+		}
+		current = append(current, c)
+	}
+	if len(current) > 0 {
+		groups = append(groups, current)
+	}
+	return groups
+}
@@ -0,0 +1,78 @@
+package extractors
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/oho/knowledge-refinery-daemon/internal/storage"
+)
+
+func TestParseSubtitlesSRT(t *testing.T) {
+	srt := "1\r\n00:00:01,000 --> 00:00:03,500\r\n{\\an8}<i>Hello</i> there.\r\n\r\n" +
+		"2\r\n01:02:03,250 --> 01:02:05,000\r\nSecond &amp; last.\r\n"
+	cues := parseSubtitles(srt)
+	if len(cues) != 2 {
+		t.Fatalf("expected 2 cues, got %d", len(cues))
+	}
+	if cues[0].start != 1 || cues[0].end != 3.5 || cues[0].text != "Hello there." {
+		t.Errorf("cue 0 = %+v", cues[0])
+	}
+	if cues[1].start != 3723.25 || cues[1].text != "Second & last." {
+		t.Errorf("cue 1 = %+v", cues[1])
+	}
+}
+
+func TestSubtitleExtractorVTT(t *testing.T) {
+	vtt := `WEBVTT
+Kind: captions
+
+NOTE This is a comment
+
+intro
+00:00.000 --> 00:04.000 align:start
+<v Alice>Welcome to the show.
+
+00:04.000 --> 00:08.000
+<v Alice>Welcome to the show.
+Today we talk about <c.yellow>rivers</c>.
+
+00:50.000 --> 01:05.000
+Rivers are long.
+
+01:30.000 --> 01:32.000
+After the break.
+`
+	path := filepath.Join(t.TempDir(), "talk.vtt")
+	os.WriteFile(path, []byte(vtt), 0644)
+
+	atoms, err := (&SubtitleExtractor{}).Extract(storage.NewFileAsset("vtt", path, "talk.vtt"))
+	if err != nil {
+		t.Fatalf("Extract: %v", err)
+	}
+	// The 42s pause starts a new group, the 65s span another, and the
+	// 25s pause a third.
+	want := []struct {
+		start, end float64
+		text       string
+	}{
+		{0, 8, "Alice: Welcome to the show.\nToday we talk about rivers."},
+		{50, 65, "Rivers are long."},
+		{90, 92, "After the break."},
+	}
+	if len(atoms) != len(want)+1 {
+		t.Fatalf("expected %d groups and metadata, got %d atoms", len(want), len(atoms))
+	}
+	for i, w := range want {
+		anchor, _ := storage.ParseEvidenceAnchor(atoms[i].EvidenceAnchor)
+		if *anchor.TimeStart != w.start || *anchor.TimeEnd != w.end {
+			t.Errorf("group %d = %v-%v, want %v-%v", i, *anchor.TimeStart, *anchor.TimeEnd, w.start, w.end)
+		}
+		if got := *atoms[i].PayloadText; got != w.text {
+			t.Errorf("group %d text = %q, want %q", i, got, w.text)
+		}
+	}
+	if atoms[3].AtomType != storage.AtomMetadata {
+		t.Errorf("expected trailing metadata atom")
+	}
+}
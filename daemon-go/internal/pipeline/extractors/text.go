@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"unicode"
 
 	"github.com/oho/knowledge-refinery-daemon/internal/storage"
 )
@@ -22,6 +23,9 @@ type TextExtractor struct{}
 func (e *TextExtractor) Name() string     { return "text" }
 func (e *TextExtractor) Priority() int    { return 10 }
 
+// Version 2 anchors plain text and markdown by line range.
+func (e *TextExtractor) Version() string { return "2" }
+
 func (e *TextExtractor) CanHandle(asset storage.FileAsset) bool {
 	ext := strings.ToLower(filepath.Ext(asset.Filename))
 	return textExtensions[ext]
@@ -32,7 +36,7 @@ func (e *TextExtractor) Extract(asset storage.FileAsset) ([]storage.ContentAtom,
 	if err != nil {
 		return nil, err
 	}
-	text := string(data)
+	text, enc := decodeText(data)
 	ext := strings.ToLower(filepath.Ext(asset.Filename))
 
 	switch ext {
@@ -42,17 +46,26 @@ func (e *TextExtractor) Extract(asset storage.FileAsset) ([]storage.ContentAtom,
 		text = stripRTF(text)
 	}
 
-	text = strings.TrimSpace(text)
-	if text == "" {
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
 		return nil, nil
 	}
 
 	anchor := storage.EvidenceAnchor{AssetID: asset.ID}
+	if ext != ".html" && ext != ".htm" && ext != ".rtf" {
+		// Plain text keeps its lines, so chunks can be located by line.
+		leading := len(text) - len(strings.TrimLeftFunc(text, unicode.IsSpace))
+		lineStart := 1 + strings.Count(text[:leading], "\n")
+		lineEnd := lineStart + strings.Count(trimmed, "\n")
+		anchor.LineStart, anchor.LineEnd = &lineStart, &lineEnd
+	}
+	text = trimmed
 	atom := storage.NewContentAtom(
 		ComputeAtomID(asset.ID, storage.AtomText, 0),
 		asset.ID, storage.AtomText, 0, anchor.ToJSON(),
 	)
 	atom.PayloadText = &text
+	setAtomMetadata(&atom, "encoding", enc)
 	return []storage.ContentAtom{atom}, nil
 }
 
@@ -14,6 +14,9 @@ type TikaFallbackExtractor struct{}
 func (e *TikaFallbackExtractor) Name() string     { return "tika_fallback" }
 func (e *TikaFallbackExtractor) Priority() int    { return 1 }
 
+// Version 2 rejects binary data before decoding it as text.
+func (e *TikaFallbackExtractor) Version() string { return "2" }
+
 func (e *TikaFallbackExtractor) CanHandle(asset storage.FileAsset) bool {
 	return true // fallback handles everything
 }
@@ -21,6 +24,7 @@ func (e *TikaFallbackExtractor) CanHandle(asset storage.FileAsset) bool {
 func (e *TikaFallbackExtractor) Extract(asset storage.FileAsset) ([]storage.ContentAtom, error) {
 	// Try textutil first (macOS built-in)
 	text, err := extractWithTextutil(asset.Path)
+	enc := ""
 	if err != nil || strings.TrimSpace(text) == "" {
 		slog.Debug("textutil failed, trying raw read", "file", asset.Filename)
 		// Try raw text read
@@ -28,8 +32,13 @@ func (e *TikaFallbackExtractor) Extract(asset storage.FileAsset) ([]storage.Cont
 		if err != nil {
 			return nil, err
 		}
-		text = string(data)
-		// Check if it looks like text (not binary)
+		// Check if it looks like text (not binary) before decoding, since
+		// the Windows-1252 fallback turns any bytes into text. UTF-16 is
+		// full of NUL bytes, so it is checked once decoded.
+		if !isUTF16(data) && !isLikelyText(string(data)) {
+			return nil, nil
+		}
+		text, enc = decodeText(data)
 		if !isLikelyText(text) {
 			return nil, nil
 		}
@@ -46,6 +55,9 @@ func (e *TikaFallbackExtractor) Extract(asset storage.FileAsset) ([]storage.Cont
 		asset.ID, storage.AtomText, 0, anchor.ToJSON(),
 	)
 	atom.PayloadText = &text
+	if enc != "" {
+		setAtomMetadata(&atom, "encoding", enc)
+	}
 	return []storage.ContentAtom{atom}, nil
 }
 
@@ -0,0 +1,166 @@
+package extractors
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// XMP namespace URIs for the properties we normalise.
+const (
+	nsDC        = "http://purl.org/dc/elements/1.1/"
+	nsXMP       = "http://ns.adobe.com/xap/1.0/"
+	nsPhotoshop = "http://ns.adobe.com/photoshop/1.0/"
+	nsEXIF      = "http://ns.adobe.com/exif/1.0/"
+	nsTIFF      = "http://ns.adobe.com/tiff/1.0/"
+	nsPDF       = "http://ns.adobe.com/pdf/1.3/"
+	nsRDF       = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+)
+
+type xmpProperty struct {
+	space string
+	local string
+}
+
+var xmpKeys = map[xmpProperty]string{
+	{nsDC, "title"}:              "title",
+	{nsDC, "creator"}:            "author",
+	{nsDC, "description"}:        "description",
+	{nsDC, "subject"}:            "keywords",
+	{nsDC, "rights"}:             "copyright",
+	{nsDC, "language"}:           "language",
+	{nsXMP, "CreateDate"}:        "created",
+	{nsXMP, "ModifyDate"}:        "modified",
+	{nsXMP, "CreatorTool"}:       "creator_tool",
+	{nsPhotoshop, "DateCreated"}: "captured_at",
+	{nsEXIF, "DateTimeOriginal"}: "captured_at",
+	{nsEXIF, "GPSLatitude"}:      "gps_latitude",
+	{nsEXIF, "GPSLongitude"}:     "gps_longitude",
+	{nsTIFF, "Make"}:             "camera_make",
+	{nsTIFF, "Model"}:            "camera_model",
+	{nsPDF, "Producer"}:          "producer",
+	{nsPDF, "Keywords"}:          "keywords",
+}
+
+var (
+	xmpStart = []byte("<x:xmpmeta")
+	xmpEnd   = []byte("</x:xmpmeta>")
+)
+
+// findXMPPacket returns the first embedded XMP packet in a file's bytes.
+// XMP is stored uncompressed by design, so a byte scan works for any container.
+func findXMPPacket(data []byte) []byte {
+	start := bytes.Index(data, xmpStart)
+	if start < 0 {
+		return nil
+	}
+	end := bytes.Index(data[start:], xmpEnd)
+	if end < 0 {
+		return nil
+	}
+	return data[start : start+end+len(xmpEnd)]
+}
+
+// parseXMP reads well-known Dublin Core, XMP, EXIF and PDF properties from an
+// XMP packet. Properties may appear as rdf:Description attributes or as child
+// elements holding plain text or rdf:Alt/Seq/Bag lists.
+func parseXMP(packet []byte) map[string]string {
+	meta := make(map[string]string)
+	dec := xml.NewDecoder(bytes.NewReader(packet))
+	dec.Strict = false
+
+	var current string // normalised key of the property element being read
+	var depth int      // nesting depth inside that property element
+	var values []string
+	var text strings.Builder
+
+	set := func(key, value string) {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			return
+		}
+		if _, exists := meta[key]; !exists {
+			meta[key] = normalizeXMPValue(key, value)
+		}
+	}
+
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if current != "" {
+				depth++
+				if t.Name.Space == nsRDF && t.Name.Local == "li" {
+					text.Reset()
+				}
+				continue
+			}
+			if t.Name.Space == nsRDF && t.Name.Local == "Description" {
+				for _, attr := range t.Attr {
+					if key, ok := xmpKeys[xmpProperty{attr.Name.Space, attr.Name.Local}]; ok {
+						set(key, attr.Value)
+					}
+				}
+				continue
+			}
+			if key, ok := xmpKeys[xmpProperty{t.Name.Space, t.Name.Local}]; ok {
+				current, depth, values = key, 0, nil
+				text.Reset()
+			}
+		case xml.CharData:
+			if current != "" {
+				text.Write(t)
+			}
+		case xml.EndElement:
+			if current == "" {
+				continue
+			}
+			if depth > 0 {
+				if t.Name.Space == nsRDF && t.Name.Local == "li" {
+					if v := strings.TrimSpace(text.String()); v != "" {
+						values = append(values, v)
+					}
+					text.Reset()
+				}
+				depth--
+				continue
+			}
+			if len(values) > 0 {
+				set(current, strings.Join(values, ", "))
+			} else {
+				set(current, text.String())
+			}
+			current = ""
+		}
+	}
+	return meta
+}
+
+// normalizeXMPValue converts XMP GPS coordinates ("51,30.5N") to decimal
+// degrees; other values are returned unchanged.
+func normalizeXMPValue(key, value string) string {
+	if key != "gps_latitude" && key != "gps_longitude" {
+		return value
+	}
+	if len(value) < 2 {
+		return value
+	}
+	ref := value[len(value)-1]
+	var v, scale float64 = 0, 1
+	for _, part := range strings.Split(value[:len(value)-1], ",") {
+		var f float64
+		if _, err := fmt.Sscan(part, &f); err != nil {
+			return value
+		}
+		v += f / scale
+		scale *= 60
+	}
+	if ref == 'S' || ref == 'W' {
+		v = -v
+	}
+	return fmt.Sprintf("%.6f", v)
+}
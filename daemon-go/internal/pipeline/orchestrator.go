@@ -4,6 +4,7 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"path/filepath"
@@ -14,6 +15,7 @@ import (
 	"github.com/oho/knowledge-refinery-daemon/internal/lmstudio"
 	"github.com/oho/knowledge-refinery-daemon/internal/pipeline/extractors"
 	"github.com/oho/knowledge-refinery-daemon/internal/storage"
+	"github.com/oho/knowledge-refinery-daemon/internal/tokenizer"
 )
 
 // Orchestrator coordinates the full ingestion pipeline.
@@ -25,10 +27,14 @@ type Orchestrator struct {
 	scanner         *Scanner
 	registry        *extractors.Registry
 	chunker         *Chunker
+	boilerplate     *Boilerplate
 	embedder        *Embedder
 	annotator       *Annotator
 	conceptualizer  *Conceptualizer
+	vision          *VisionEnricher // nil unless vision captions are enabled
+	sentenceModel   *string         // embedding model for semantic chunking, resolved lazily
 	running         bool
+	reembedding     bool
 	currentJobID    *string
 	mu              sync.Mutex
 	liveProgress    map[string]any
@@ -37,19 +43,62 @@ type Orchestrator struct {
 }
 
 func NewOrchestrator(db *storage.Database, vs *storage.VectorStore, lm *lmstudio.Client, cfg config.Config) *Orchestrator {
-	return &Orchestrator{
+	o := &Orchestrator{
 		db:             db,
 		vs:             vs,
 		lm:             lm,
 		cfg:            cfg,
 		scanner:        NewScanner(db, cfg),
-		registry:       extractors.CreateDefaultRegistry(),
+		registry:       extractors.CreateRegistry(cfg),
 		chunker:        NewChunker(cfg.Pipeline),
+		boilerplate:    NewBoilerplate(cfg.Pipeline.BoilerplateMinAtoms, cfg.Pipeline.BoilerplateVolumeAssets),
 		embedder:       NewEmbedder(lm, vs, db, cfg.LMStudio.EmbeddingBatchSize),
 		annotator:      NewAnnotator(lm, db, cfg.Pipeline.Version),
 		conceptualizer: NewConceptualizer(db, vs, lm, cfg.Pipeline.Version),
 		liveProgress:   make(map[string]any),
 	}
+	if cfg.Pipeline.VisionCaptions {
+		o.vision = NewVisionEnricher(lm, cfg.LMStudio.VisionModel)
+	}
+	if cfg.Pipeline.AudioTranscription {
+		o.registry.Register(extractors.NewAudioExtractor(lm, cfg.LMStudio.TranscriptionModel))
+	}
+	o.chunker.SetSentenceEmbedder(o.embedSentences)
+	o.chunker.SetTokenizers(
+		loadTokenizer(cfg.LMStudio.EmbeddingTokenizer, "embedding"),
+		loadTokenizer(cfg.LMStudio.ChatTokenizer, "chat"),
+		cfg.LMStudio.EmbeddingMaxTokens,
+	)
+	o.embedder.tokens = o.chunker.EmbeddingTokens
+	o.annotator.truncated = o.chunker.TruncatedForEmbedding
+	if cfg.Pipeline.ExtractCacheMaxBytes > 0 {
+		o.registry.SetCache(extractors.NewExtractCache(cfg.CacheDir, cfg.Pipeline.ExtractCacheMaxBytes))
+	}
+	return o
+}
+
+// loadTokenizer loads the tokenizer configured for a model role, or
+// returns nil so token counts fall back to cl100k_base.
+func loadTokenizer(path, role string) *tokenizer.Tokenizer {
+	if path == "" {
+		return nil
+	}
+	t, err := tokenizer.Load(path)
+	if err != nil {
+		slog.Warn("Failed to load tokenizer, using cl100k_base estimates", "model", role, "error", err)
+		return nil
+	}
+	slog.Info("Loaded tokenizer", "model", role, "type", t.Kind(), "path", t.Path(), "max_tokens", t.MaxTokens())
+	return t
+}
+
+// embedSentences embeds sentence windows for semantic chunking with the
+// same model used for chunk embeddings.
+func (o *Orchestrator) embedSentences(texts []string) ([][]float64, error) {
+	if o.sentenceModel == nil {
+		o.sentenceModel = o.lm.GetEmbeddingModel()
+	}
+	return o.lm.Embed(texts, o.sentenceModel)
 }
 
 func (o *Orchestrator) IsRunning() bool {
@@ -58,6 +107,11 @@ func (o *Orchestrator) IsRunning() bool {
 	return o.running
 }
 
+// Namespaces lists the stored embedding namespaces.
+func (o *Orchestrator) Namespaces() ([]storage.Namespace, error) {
+	return o.vs.Namespaces()
+}
+
 func (o *Orchestrator) Conceptualizer() *Conceptualizer {
 	return o.conceptualizer
 }
@@ -168,6 +222,14 @@ func (o *Orchestrator) runPipelineWorker(jobID string, volumePaths []string) {
 	progress["stage"] = "extracting"
 	o.updateProgress(jobID, progress)
 
+	if o.vision != nil && o.vision.BeginRun() {
+		if n, err := o.db.RequeueVisionPending(); err != nil {
+			slog.Warn("Failed to requeue assets awaiting vision captions", "error", err)
+		} else if n > 0 {
+			slog.Info("Requeued assets awaiting vision captions", "count", n)
+		}
+	}
+
 	pending, _ := o.db.GetAssetsByStatus(storage.StatusPending, 10000)
 	extractCount := 0
 	extractErrors := 0
@@ -189,9 +251,15 @@ func (o *Orchestrator) runPipelineWorker(jobID string, volumePaths []string) {
 			extractErrors++
 			continue
 		}
+		if o.vision != nil {
+			derived, deferred := o.vision.Enrich(asset, atoms)
+			atoms = append(atoms, derived...)
+			o.db.SetVisionPending(asset.ID, deferred)
+		}
 		if len(atoms) > 0 {
 			o.db.InsertContentAtoms(atoms)
 		}
+		o.db.SetAssetMetadata(asset.ID, collectMetadata(atoms))
 		o.db.UpdateAssetStatus(asset.ID, storage.StatusExtracted, nil)
 		extractCount++
 		o.emit("extracting", "extracted", asset.Filename, map[string]int{"done": i + 1, "total": len(pending)})
@@ -208,6 +276,20 @@ func (o *Orchestrator) runPipelineWorker(jobID string, volumePaths []string) {
 
 	extracted, _ := o.db.GetAssetsByStatus(storage.StatusExtracted, 10000)
 	chunkCount := 0
+	suppressedCount := 0
+	volumes, _ := o.db.GetWatchedVolumes()
+
+	// Record every asset's lines before chunking any, so lines repeated
+	// across a volume are recognised in the first assets of a run too.
+	if o.boilerplate.VolumeAssets() > 0 {
+		for _, asset := range extracted {
+			if volume := volumeFor(asset, volumes); volume != "" {
+				atoms, _ := o.db.GetAtomsForAsset(asset.ID)
+				o.db.RecordBoilerplateLines(volume, asset.ID, o.boilerplate.VolumeLines(atoms))
+			}
+		}
+	}
+	volumeRepeats := make(map[string]map[string]int)
 
 	for i, asset := range extracted {
 		o.liveProgress = map[string]any{"chunk": map[string]any{
@@ -215,7 +297,21 @@ func (o *Orchestrator) runPipelineWorker(jobID string, volumePaths []string) {
 		}}
 
 		atoms, _ := o.db.GetAtomsForAsset(asset.ID)
-		chunks := o.chunker.ChunkAtoms(atoms, asset.ID)
+		volume := volumeFor(asset, volumes)
+		if _, ok := volumeRepeats[volume]; !ok && volume != "" && o.boilerplate.VolumeAssets() > 0 {
+			volumeRepeats[volume], _ = o.db.RepeatedBoilerplateLines(volume, o.boilerplate.VolumeAssets())
+		}
+		excluded, suppressed := o.boilerplate.Find(atoms, volumeRepeats[volume])
+
+		o.db.DeleteChunksForAsset(asset.ID)
+		parents, chunks := o.chunker.ChunkAtomsExcluding(atoms, asset.ID, o.chunker.StrategyFor(asset, volumes), excluded)
+		if len(suppressed) > 0 {
+			o.db.InsertSuppressedText(suppressed)
+			suppressedCount += len(suppressed)
+		}
+		if len(parents) > 0 {
+			o.db.InsertParentChunks(parents)
+		}
 		if len(chunks) > 0 {
 			o.db.InsertChunks(chunks)
 			chunkCount += len(chunks)
@@ -225,8 +321,10 @@ func (o *Orchestrator) runPipelineWorker(jobID string, volumePaths []string) {
 			"done": i + 1, "total": len(extracted), "chunks_created": chunkCount,
 		})
 	}
-	progress["stages"].(map[string]any)["chunk"] = map[string]any{"chunks_created": chunkCount}
-	slog.Info("Chunk complete", "chunks", chunkCount)
+	progress["stages"].(map[string]any)["chunk"] = map[string]any{
+		"chunks_created": chunkCount, "lines_suppressed": suppressedCount,
+	}
+	slog.Info("Chunk complete", "chunks", chunkCount, "suppressed_lines", suppressedCount)
 
 	// Stage 4: Embed
 	slog.Info("=== Stage 4: Embedding ===")
@@ -247,6 +345,9 @@ func (o *Orchestrator) runPipelineWorker(jobID string, volumePaths []string) {
 			map[string]int{"embedded": embeddedCount, "total": len(unembedded)})
 		progress["stages"].(map[string]any)["embed"] = map[string]any{"embedded": embeddedCount}
 		slog.Info("Embed complete", "count", embeddedCount)
+		if err := o.vs.SaveIndex(); err != nil {
+			slog.Warn("Failed to save vector index", "error", err)
+		}
 
 		// Mark assets as embedded
 		chunked, _ := o.db.GetAssetsByStatus(storage.StatusChunked, 10000)
@@ -268,6 +369,13 @@ func (o *Orchestrator) runPipelineWorker(jobID string, volumePaths []string) {
 			"embedded": 0, "note": "all chunks already embedded",
 		}
 	}
+	if ns, model := o.embedder.Namespace(), o.embedder.Model(); ns != "" && ns != o.vs.Model() && o.vs.Count() > 0 {
+		if _, err := o.Reembed(model); err != nil {
+			slog.Warn("Failed to start re-embed", "model", model, "error", err)
+		} else {
+			o.emit("embedding", "reembed_started", model, nil)
+		}
+	}
 
 	// Stage 5: Annotate
 	slog.Info("=== Stage 5: Annotating ===")
@@ -324,6 +432,154 @@ func (o *Orchestrator) runPipelineWorker(jobID string, volumePaths []string) {
 	slog.Info("=== Pipeline completed ===")
 }
 
+// Reembed re-embeds the searched chunks with model, or the current
+// embedding model when empty, and its document template in a background
+// job. Searches keep using the active namespace until every chunk has a
+// vector in the new one, then switch over. Returns job ID.
+func (o *Orchestrator) Reembed(model string) (string, error) {
+	if model == "" {
+		m := o.lm.GetEmbeddingModel()
+		if m == nil {
+			return "", fmt.Errorf("no embedding model available")
+		}
+		model = *m
+	}
+	ns := o.lm.EmbeddingNamespace(model)
+	if ns == o.vs.Model() {
+		return "", fmt.Errorf("vectors are already embedded with %s", model)
+	}
+
+	o.mu.Lock()
+	if o.reembedding {
+		o.mu.Unlock()
+		return "", fmt.Errorf("re-embed already running")
+	}
+	o.reembedding = true
+	o.mu.Unlock()
+
+	jobID := generateJobID()
+	now := storage.NowISO()
+	progress := map[string]any{"model": model, "namespace": ns, "from_model": o.vs.Model(), "embedded": 0,
+		"total": o.vs.Count(), "started_at": now}
+	progressJSON, _ := json.Marshal(progress)
+	progressStr := string(progressJSON)
+	o.db.UpsertPipelineJob(storage.PipelineJob{
+		ID:           jobID,
+		JobType:      "reembed",
+		Status:       storage.JobRunning,
+		ProgressJSON: &progressStr,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	})
+
+	go o.runReembedWorker(jobID, model, ns, progress)
+	return jobID, nil
+}
+
+func (o *Orchestrator) runReembedWorker(jobID, model, ns string, progress map[string]any) {
+	defer func() {
+		o.mu.Lock()
+		o.reembedding = false
+		o.mu.Unlock()
+	}()
+	finish := func(status storage.JobStatus, err error) {
+		if err != nil {
+			slog.Error("Re-embed failed", "model", model, "error", err)
+			progress["error"] = err.Error()
+		}
+		progress["completed_at"] = storage.NowISO()
+		data, _ := json.Marshal(progress)
+		s := string(data)
+		o.db.UpdateJobStatus(jobID, status, &s)
+	}
+
+	probe, err := o.lm.EmbedSingle("hello world", &model)
+	if err != nil {
+		finish(storage.JobFailed, err)
+		return
+	}
+	dim := len(probe)
+	if err := o.vs.BeginNamespace(ns, dim); err != nil {
+		finish(storage.JobFailed, err)
+		return
+	}
+	slog.Info("Re-embedding vectors", "namespace", ns, "dim", dim, "from_model", progress["from_model"])
+
+	batchSize := max(o.cfg.LMStudio.EmbeddingBatchSize, 1)
+	embedded := 0
+	for {
+		batch, err := o.vs.MissingVectors(ns, batchSize)
+		if err != nil {
+			finish(storage.JobFailed, err)
+			return
+		}
+		if len(batch) == 0 {
+			// Chunks the pipeline embedded into the active namespace
+			// since the last batch are caught up before switching.
+			err := o.vs.Activate(ns)
+			if errors.Is(err, storage.ErrVectorsMissing) {
+				continue
+			}
+			if err != nil {
+				finish(storage.JobFailed, err)
+				return
+			}
+			break
+		}
+		texts := make([]string, len(batch))
+		for i, rec := range batch {
+			texts[i] = rec.Text
+		}
+		rawVecs, err := o.lm.EmbedDocuments(texts, model)
+		if err != nil {
+			finish(storage.JobFailed, err)
+			return
+		}
+		for i := range batch {
+			if len(rawVecs[i]) != dim {
+				finish(storage.JobFailed, fmt.Errorf("model returned %d dimensions, expected %d", len(rawVecs[i]), dim))
+				return
+			}
+			vec := make([]float32, dim)
+			for k, v := range rawVecs[i] {
+				vec[k] = float32(v)
+			}
+			batch[i].Vector, batch[i].Model = vec, ns
+		}
+		if err := o.vs.AddVectors(batch); err != nil {
+			finish(storage.JobFailed, err)
+			return
+		}
+		embedded += len(batch)
+		progress["embedded"] = embedded
+		o.updateProgress(jobID, progress)
+	}
+	finish(storage.JobCompleted, nil)
+	o.emit("embedding", "reembed_completed", model, map[string]int{"embedded": embedded})
+	slog.Info("Re-embed complete", "model", model, "embedded", embedded)
+}
+
+// collectMetadata flattens all metadata atoms of an asset into one map for
+// the searchable asset_metadata index.
+func collectMetadata(atoms []storage.ContentAtom) map[string]string {
+	meta := make(map[string]string)
+	for _, a := range atoms {
+		if a.AtomType != storage.AtomMetadata || a.MetadataJSON == nil {
+			continue
+		}
+		var fields map[string]any
+		if err := json.Unmarshal([]byte(*a.MetadataJSON), &fields); err != nil {
+			continue
+		}
+		for k, v := range fields {
+			if _, exists := meta[k]; !exists {
+				meta[k] = fmt.Sprint(v)
+			}
+		}
+	}
+	return meta
+}
+
 func (o *Orchestrator) updateProgress(jobID string, progress map[string]any) {
 	data, _ := json.Marshal(progress)
 	s := string(data)
@@ -369,6 +625,20 @@ func (o *Orchestrator) GetStatus() map[string]any {
 	conceptCount, _ := o.db.CountConcepts()
 	edgeCount, _ := o.db.CountEdges()
 
+	reembedType := "reembed"
+	reembedInfo := map[string]any{}
+	if job, _ := o.db.GetLatestJob(&reembedType); job != nil {
+		var prog any
+		if job.ProgressJSON != nil {
+			json.Unmarshal([]byte(*job.ProgressJSON), &prog)
+		}
+		reembedInfo = map[string]any{
+			"job_id":   job.ID,
+			"status":   string(job.Status),
+			"progress": prog,
+		}
+	}
+
 	o.mu.Lock()
 	running := o.running
 	var currentJobID *string
@@ -392,6 +662,8 @@ func (o *Orchestrator) GetStatus() map[string]any {
 		"status_counts":    counts,
 		"latest_job":       jobInfo,
 		"vector_count":     o.vs.Count(),
+		"embedding_model":  o.vs.Model(),
+		"reembed_job":      reembedInfo,
 		"chunk_count":      chunkCount,
 		"annotation_count": annotationCount,
 		"concept_count":    conceptCount,
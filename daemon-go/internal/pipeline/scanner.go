@@ -11,18 +11,21 @@ import (
 	"strings"
 
 	"github.com/oho/knowledge-refinery-daemon/internal/config"
+	"github.com/oho/knowledge-refinery-daemon/internal/pipeline/extractors"
 	"github.com/oho/knowledge-refinery-daemon/internal/storage"
 )
 
-// SupportedExtensions lists file types the pipeline can process.
+// SupportedExtensions lists file types the pipeline can process. Recordings
+// (.wav, .mp3, .m4a) are only processed with audio transcription enabled.
 var SupportedExtensions = map[string]bool{
 	".txt": true, ".md": true, ".markdown": true, ".html": true, ".htm": true, ".rtf": true,
-	".pdf":  true,
-	".jpg":  true, ".jpeg": true, ".png": true, ".webp": true,
+	".ipynb": true, ".tex": true, ".ltx": true, ".srt": true, ".vtt": true,
+	".pdf": true,
+	".jpg": true, ".jpeg": true, ".png": true, ".webp": true,
 	".heic": true, ".heif": true, ".tiff": true, ".tif": true,
-	".epub": true, ".mobi": true,
-	".zip":  true, ".tar": true, ".gz": true, ".xz": true, ".7z": true, ".rar": true, ".iso": true,
-	".dcm":  true, ".dicom": true,
+	".epub": true, ".mobi": true, ".azw": true, ".azw3": true, ".prc": true,
+	".zip": true, ".tar": true, ".gz": true, ".xz": true, ".7z": true, ".rar": true, ".iso": true,
+	".dcm": true, ".dicom": true,
 }
 
 // ScanStats holds results from a directory scan.
@@ -87,14 +90,32 @@ func GuessMimeType(path string) *string {
 			mimeType = "text/markdown"
 		case ".epub":
 			mimeType = "application/epub+zip"
+		case ".mobi", ".prc":
+			mimeType = "application/x-mobipocket-ebook"
+		case ".azw", ".azw3":
+			mimeType = "application/vnd.amazon.ebook"
 		case ".rtf":
 			mimeType = "application/rtf"
+		case ".ipynb":
+			mimeType = "application/x-ipynb+json"
+		case ".tex", ".ltx":
+			mimeType = "application/x-tex"
+		case ".srt":
+			mimeType = "application/x-subrip"
+		case ".vtt":
+			mimeType = "text/vtt"
 		case ".heic", ".heif":
 			mimeType = "image/heic"
 		case ".webp":
 			mimeType = "image/webp"
 		case ".dcm", ".dicom":
 			mimeType = "application/dicom"
+		case ".wav":
+			mimeType = "audio/wav"
+		case ".mp3":
+			mimeType = "audio/mpeg"
+		case ".m4a":
+			mimeType = "audio/mp4"
 		default:
 			return nil
 		}
@@ -106,12 +127,14 @@ func GuessMimeType(path string) *string {
 type Scanner struct {
 	db          *storage.Database
 	maxFileSize int64
+	audio       bool // recordings are skipped unless they can be transcribed
 }
 
 func NewScanner(db *storage.Database, cfg config.Config) *Scanner {
 	return &Scanner{
 		db:          db,
 		maxFileSize: cfg.Pipeline.MaxFileSizeBytes,
+		audio:       cfg.Pipeline.AudioTranscription,
 	}
 }
 
@@ -162,6 +185,12 @@ func (s *Scanner) processFile(path string, stats *ScanStats) error {
 		stats.Skipped++
 		return nil
 	}
+	// Left for a scan with transcription enabled, rather than extracted
+	// by the fallback into nothing.
+	if !s.audio && extractors.IsAudio(path) {
+		stats.Skipped++
+		return nil
+	}
 
 	absPath, _ := filepath.Abs(path)
 	mtimeNs := info.ModTime().UnixNano()
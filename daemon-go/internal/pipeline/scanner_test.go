@@ -170,3 +170,22 @@ func TestScanStatsAdd(t *testing.T) {
 		t.Errorf("unexpected stats after Add: %+v", a)
 	}
 }
+
+func TestScanDirectorySkipsAudioWithoutTranscription(t *testing.T) {
+	scanner, _, dir := setupScannerTest(t)
+
+	os.WriteFile(filepath.Join(dir, "meeting.m4a"), []byte("fake-audio"), 0644)
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("hello"), 0644)
+
+	stats, _ := scanner.ScanDirectory(dir)
+	if stats.New != 1 || stats.Skipped != 1 {
+		t.Errorf("expected the recording skipped, got %+v", stats)
+	}
+
+	// Enabling transcription picks it up on the next scan
+	scanner.audio = true
+	stats, _ = scanner.ScanDirectory(dir)
+	if stats.New != 1 || stats.Unchanged != 1 {
+		t.Errorf("expected the recording added, got %+v", stats)
+	}
+}
@@ -0,0 +1,185 @@
+package pipeline
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/oho/knowledge-refinery-daemon/internal/mathutil"
+	"github.com/oho/knowledge-refinery-daemon/internal/storage"
+)
+
+// Chunking strategies. The non-default strategy is appended to the chunk's
+// pipeline version ("v1.0+semantic") so chunks record how they were cut.
+const (
+	ChunkFixed    = "fixed"
+	ChunkSemantic = "semantic"
+)
+
+// semanticEmbedBatch bounds how many sentence windows go to the embedding
+// endpoint per request.
+const semanticEmbedBatch = 64
+
+// SentenceEmbedder embeds a batch of texts, returning one vector per text.
+type SentenceEmbedder func(texts []string) ([][]float64, error)
+
+// ValidChunkStrategy reports whether s names a chunking strategy.
+func ValidChunkStrategy(s string) bool {
+	return s == ChunkFixed || s == ChunkSemantic
+}
+
+// SetSentenceEmbedder sets the embedding function used by the semantic
+// strategy. Without one, semantic chunking falls back to fixed.
+func (c *Chunker) SetSentenceEmbedder(fn SentenceEmbedder) {
+	c.embed = fn
+}
+
+// StrategyFor picks the chunking strategy for an asset: the strategy of the
+// innermost watched volume containing it, else the one configured for its
+// file extension, else the default.
+func (c *Chunker) StrategyFor(asset storage.FileAsset, volumes []storage.WatchedVolume) string {
+	best := -1
+	strategy := ""
+	for _, v := range volumes {
+		if v.ChunkStrategy == nil || !ValidChunkStrategy(*v.ChunkStrategy) {
+			continue
+		}
+		if n := volumeDepth(asset, v); n > best {
+			best = n
+			strategy = *v.ChunkStrategy
+		}
+	}
+	if strategy != "" {
+		return strategy
+	}
+	if s, ok := c.strategyByType[strings.ToLower(filepath.Ext(asset.Filename))]; ok {
+		return s
+	}
+	return c.strategy
+}
+
+// volumeDepth returns the length of v's path if it contains asset, else -1,
+// so the innermost of nested volumes is the one with the largest depth.
+func volumeDepth(asset storage.FileAsset, v storage.WatchedVolume) int {
+	root := strings.TrimRight(v.Path, string(filepath.Separator)) + string(filepath.Separator)
+	if strings.HasPrefix(asset.Path, root) {
+		return len(root)
+	}
+	return -1
+}
+
+// volumeFor returns the path of the innermost watched volume containing
+// asset, or "" if none does.
+func volumeFor(asset storage.FileAsset, volumes []storage.WatchedVolume) string {
+	best, path := -1, ""
+	for _, v := range volumes {
+		if n := volumeDepth(asset, v); n > best {
+			best, path = n, v.Path
+		}
+	}
+	return path
+}
+
+// splitSemantic embeds a window of sentences around each sentence and cuts
+// where the cosine distance between neighbouring windows is above the
+// configured percentile, once the current chunk has reached the minimum
+// size. Chunks never exceed the maximum size, and a short final chunk is
+// merged into its predecessor when it fits.
+func (c *Chunker) splitSemantic(text, lang string) ([]string, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, nil
+	}
+	if c.countTokens(text) <= c.max {
+		return []string{text}, nil
+	}
+	if c.embed == nil {
+		return nil, fmt.Errorf("no sentence embedder configured")
+	}
+
+	sentences := c.splitSentences(text, lang)
+	sep := " "
+	if usesFullWidthStops(lang) {
+		sep = ""
+	}
+	if len(sentences) < 3 {
+		return c.splitText(text, lang), nil
+	}
+
+	windows := make([]string, len(sentences))
+	for i := range sentences {
+		lo, hi := max(0, i-c.window), min(len(sentences), i+c.window+1)
+		windows[i] = strings.Join(sentences[lo:hi], sep)
+	}
+	vectors := make([][]float32, 0, len(windows))
+	for i := 0; i < len(windows); i += semanticEmbedBatch {
+		batch := windows[i:min(len(windows), i+semanticEmbedBatch)]
+		raw, err := c.embed(batch)
+		if err != nil {
+			return nil, err
+		}
+		if len(raw) != len(batch) {
+			return nil, fmt.Errorf("embedder returned %d vectors for %d texts", len(raw), len(batch))
+		}
+		for _, v := range raw {
+			vec := make([]float32, len(v))
+			for k, x := range v {
+				vec[k] = float32(x)
+			}
+			vectors = append(vectors, vec)
+		}
+	}
+
+	// distances[i] is the topic shift between sentence i and i+1.
+	distances := make([]float64, len(sentences)-1)
+	for i := range distances {
+		distances[i] = 1 - mathutil.CosineSimilarity(vectors[i], vectors[i+1])
+	}
+	threshold := percentile(distances, c.percentile)
+
+	var chunks, current []string
+	currentTokens := 0
+	emit := func() {
+		if len(current) > 0 {
+			chunks = append(chunks, strings.TrimSpace(strings.Join(current, sep)))
+		}
+		current, currentTokens = nil, 0
+	}
+	for i, sentence := range sentences {
+		sentTokens := c.countTokens(sentence)
+		if currentTokens+sentTokens > c.max {
+			emit()
+		}
+		current = append(current, sentence)
+		currentTokens += sentTokens
+		if i < len(distances) && distances[i] > threshold && currentTokens >= c.min {
+			emit()
+		}
+	}
+	if len(current) > 0 && currentTokens < c.min && len(chunks) > 0 {
+		last := chunks[len(chunks)-1]
+		merged := strings.TrimSpace(last + sep + strings.Join(current, sep))
+		if c.countTokens(merged) <= c.max {
+			chunks[len(chunks)-1] = merged
+			current = nil
+		}
+	}
+	emit()
+	return chunks, nil
+}
+
+// percentile returns the p-th percentile (0-100) of values by linear
+// interpolation between the closest ranks.
+func percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return math.Inf(1)
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	rank := p / 100 * float64(len(sorted)-1)
+	lo := int(math.Floor(rank))
+	hi := int(math.Ceil(rank))
+	return sorted[lo] + (sorted[hi]-sorted[lo])*(rank-float64(lo))
+}
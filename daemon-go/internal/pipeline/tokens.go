@@ -0,0 +1,62 @@
+package pipeline
+
+import (
+	"log/slog"
+
+	"github.com/oho/knowledge-refinery-daemon/internal/tokenizer"
+)
+
+// QualityEmbeddingTruncated flags chunks longer than the embedding model's
+// max sequence length: the model silently ignored their tail.
+const QualityEmbeddingTruncated = "embedding_truncated"
+
+// SetTokenizers makes the chunker count tokens the way the embedding and
+// chat models do; either may be nil. A chunk must fit both, so counts are
+// the larger of the two, with cl100k_base standing in for a missing one.
+// embedMax is the number of tokens the embedding model accepts, or 0 to
+// take it from the embedding tokenizer; chunk sizes are lowered to fit it.
+func (c *Chunker) SetTokenizers(embed, chat *tokenizer.Tokenizer, embedMax int) {
+	c.embedTokenizer, c.chatTokenizer = embed, chat
+	if embedMax <= 0 && embed != nil {
+		embedMax = embed.MaxTokens()
+	}
+	c.embedMax = embedMax
+	if embedMax <= 0 || c.max <= embedMax {
+		return
+	}
+	c.max = embedMax
+	c.target = min(c.target, embedMax*3/4)
+	c.min = min(c.min, c.target*2/3)
+	slog.Info("Limited chunk sizes to embedding model",
+		"max_tokens", embedMax, "target", c.target, "min", c.min, "max", c.max)
+}
+
+func (c *Chunker) countTokens(text string) int {
+	if c.embedTokenizer == nil && c.chatTokenizer == nil {
+		return CountTokens(text)
+	}
+	n := 0
+	for _, t := range []*tokenizer.Tokenizer{c.embedTokenizer, c.chatTokenizer} {
+		if t != nil {
+			n = max(n, t.Count(text))
+		} else {
+			n = max(n, CountTokens(text))
+		}
+	}
+	return n
+}
+
+// EmbeddingTokens returns how many tokens text is for the embedding model
+// and how many the model accepts (0 if unknown).
+func (c *Chunker) EmbeddingTokens(text string) (tokens, limit int) {
+	if c.embedTokenizer != nil {
+		return c.embedTokenizer.Count(text), c.embedMax
+	}
+	return CountTokens(text), c.embedMax
+}
+
+// TruncatedForEmbedding reports whether the embedding model cuts text off.
+func (c *Chunker) TruncatedForEmbedding(text string) bool {
+	tokens, limit := c.EmbeddingTokens(text)
+	return limit > 0 && tokens > limit
+}
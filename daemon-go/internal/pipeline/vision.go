@@ -0,0 +1,154 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/oho/knowledge-refinery-daemon/internal/lmstudio"
+	"github.com/oho/knowledge-refinery-daemon/internal/pipeline/extractors"
+	"github.com/oho/knowledge-refinery-daemon/internal/storage"
+)
+
+const maxVisionImageBytes = 20 * 1024 * 1024
+
+// Formats vision models reliably accept as data URLs. DICOM and HEIC image
+// atoms are skipped on purpose.
+var visionImageExtensions = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".webp": true, ".gif": true,
+}
+
+var visionPrompt = `Describe this image for a search index. Produce a JSON object with these fields:
+- "caption": 1-3 sentences describing what the image shows, including any diagram structure or chart meaning
+- "objects": array of short labels for the distinct objects, people, or elements visible (up to 15)
+
+Respond with ONLY the JSON object, no other text.`
+
+type visionJSON struct {
+	Caption string   `json:"caption"`
+	Objects []string `json:"objects"`
+}
+
+// VisionEnricher captions image atoms with a vision-capable chat model and
+// emits the results as text atoms linked to the source image atom.
+type VisionEnricher struct {
+	lm     *lmstudio.Client
+	prompt string
+
+	mu         sync.Mutex // guards model and missing, used by concurrent workers
+	configured bool
+	model      *string
+	missing    bool // no vision model was loaded when last looked up this run
+}
+
+func NewVisionEnricher(lm *lmstudio.Client, model string) *VisionEnricher {
+	v := &VisionEnricher{lm: lm, prompt: visionPrompt}
+	if model != "" {
+		v.configured = true
+		v.model = &model
+	}
+	return v
+}
+
+// BeginRun forgets the model looked up by the previous run, unless one is
+// configured, and reports whether a vision model is available now.
+func (v *VisionEnricher) BeginRun() bool {
+	v.mu.Lock()
+	if !v.configured {
+		v.model = nil
+	}
+	v.missing = false
+	v.mu.Unlock()
+	return v.visionModel() != nil
+}
+
+// Enrich returns caption and object atoms for every image atom in atoms.
+// Failures are logged and skipped so enrichment never fails an extraction.
+// deferred reports images left uncaptioned because no vision model is
+// loaded, so the asset can be enriched again once one is.
+func (v *VisionEnricher) Enrich(asset storage.FileAsset, atoms []storage.ContentAtom) (derived []storage.ContentAtom, deferred bool) {
+	seqIdx := 0
+	for _, a := range atoms {
+		if a.SequenceIndex >= seqIdx {
+			seqIdx = a.SequenceIndex + 1
+		}
+	}
+
+	for _, img := range atoms {
+		if img.AtomType != storage.AtomImage || img.PayloadRef == nil {
+			continue
+		}
+		path := *img.PayloadRef
+		if !visionImageExtensions[strings.ToLower(filepath.Ext(path))] {
+			continue
+		}
+		if info, err := os.Stat(path); err != nil || info.Size() > maxVisionImageBytes {
+			continue
+		}
+
+		model := v.visionModel()
+		if model == nil {
+			return nil, true
+		}
+
+		raw, err := v.lm.DescribeImage(path, v.prompt, model)
+		if err != nil {
+			slog.Warn("Vision caption failed", "file", asset.Filename, "error", err)
+			continue
+		}
+		var parsed visionJSON
+		if err := json.Unmarshal([]byte(raw), &parsed); err != nil {
+			slog.Warn("Failed to parse vision caption JSON", "file", asset.Filename, "error", err)
+			continue
+		}
+
+		if caption := strings.TrimSpace(parsed.Caption); caption != "" {
+			text := "Image description: " + caption
+			derived = append(derived, linkedAtom(img, *model, "caption", text, seqIdx))
+			seqIdx++
+		}
+		if len(parsed.Objects) > 0 {
+			text := "Objects in image: " + strings.Join(parsed.Objects, ", ")
+			derived = append(derived, linkedAtom(img, *model, "objects", text, seqIdx))
+			seqIdx++
+		}
+	}
+	return derived, false
+}
+
+// visionModel returns the configured model, or else the first vision model
+// LM Studio offers. A failed lookup is remembered until the next run.
+func (v *VisionEnricher) visionModel() *string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.model == nil && !v.missing {
+		v.model = v.lm.GetVisionModel()
+		if v.model == nil {
+			v.missing = true
+			slog.Warn("Vision captions enabled but no vision model is loaded")
+		}
+	}
+	return v.model
+}
+
+// linkedAtom builds a text atom that shares the image atom's anchor and
+// records the image atom ID and captioning model in its metadata.
+func linkedAtom(img storage.ContentAtom, model, kind, text string, seqIdx int) storage.ContentAtom {
+	atom := storage.NewContentAtom(
+		extractors.ComputeAtomID(img.AssetID, storage.AtomText, seqIdx),
+		img.AssetID, storage.AtomText, seqIdx, img.EvidenceAnchor,
+	)
+	atom.PayloadText = &text
+	meta, _ := json.Marshal(map[string]string{
+		"source_atom_id": img.ID,
+		"derived":        fmt.Sprintf("vision_%s", kind),
+		"model":          model,
+	})
+	metaStr := string(meta)
+	atom.MetadataJSON = &metaStr
+	return atom
+}
@@ -0,0 +1,155 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/oho/knowledge-refinery-daemon/internal/lmstudio"
+	"github.com/oho/knowledge-refinery-daemon/internal/storage"
+)
+
+func TestVisionEnricherCreatesLinkedAtoms(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"choices": []map[string]any{{
+				"message": map[string]string{
+					"role":    "assistant",
+					"content": `{"caption": "A whiteboard diagram of a data pipeline.", "objects": ["whiteboard", "arrows"]}`,
+				},
+			}},
+		})
+	}))
+	defer srv.Close()
+
+	imgPath := filepath.Join(t.TempDir(), "diagram.jpg")
+	os.WriteFile(imgPath, []byte("fake-jpeg"), 0644)
+
+	asset := storage.NewFileAsset("asset1", imgPath, "diagram.jpg")
+	img := storage.NewContentAtom("img1", "asset1", storage.AtomImage, 0, `{"asset_id":"asset1"}`)
+	img.PayloadRef = &imgPath
+
+	v := NewVisionEnricher(lmstudio.NewClient(srv.URL+"/v1", 10), "test-vl")
+	derived, _ := v.Enrich(asset, []storage.ContentAtom{img})
+	if len(derived) != 2 {
+		t.Fatalf("expected caption and objects atoms, got %d", len(derived))
+	}
+	for i, a := range derived {
+		if a.AtomType != storage.AtomText || a.PayloadText == nil {
+			t.Errorf("atom %d should be a text atom", i)
+		}
+		if a.SequenceIndex != i+1 {
+			t.Errorf("atom %d: expected sequence index %d, got %d", i, i+1, a.SequenceIndex)
+		}
+		if a.MetadataJSON == nil || !strings.Contains(*a.MetadataJSON, `"source_atom_id":"img1"`) {
+			t.Errorf("atom %d should link to the image atom", i)
+		}
+	}
+	if !strings.Contains(*derived[1].PayloadText, "whiteboard, arrows") {
+		t.Errorf("unexpected objects text: %q", *derived[1].PayloadText)
+	}
+}
+
+func TestVisionEnricherSkipsUnsupportedImages(t *testing.T) {
+	v := NewVisionEnricher(lmstudio.NewClient("http://127.0.0.1:1/v1", 1), "test-vl")
+
+	ref := "/path/scan.dcm"
+	img := storage.NewContentAtom("img1", "asset1", storage.AtomImage, 0, `{"asset_id":"asset1"}`)
+	img.PayloadRef = &ref
+
+	asset := storage.NewFileAsset("asset1", ref, "scan.dcm")
+	if derived, deferred := v.Enrich(asset, []storage.ContentAtom{img}); len(derived) != 0 || deferred {
+		t.Errorf("expected no atoms for DICOM image, got %d (deferred %v)", len(derived), deferred)
+	}
+}
+
+func TestVisionEnricherLooksUpModelConcurrently(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/models" {
+			json.NewEncoder(w).Encode(map[string]any{"data": []map[string]string{{"id": "qwen2.5-vl-7b-instruct"}}})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"choices": []map[string]any{{
+				"message": map[string]string{"role": "assistant", "content": `{"caption": "A cat."}`},
+			}},
+		})
+	}))
+	defer srv.Close()
+
+	imgPath := filepath.Join(t.TempDir(), "cat.png")
+	os.WriteFile(imgPath, []byte("fake-png"), 0644)
+	img := storage.NewContentAtom("img1", "asset1", storage.AtomImage, 0, `{"asset_id":"asset1"}`)
+	img.PayloadRef = &imgPath
+	asset := storage.NewFileAsset("asset1", imgPath, "cat.png")
+
+	// Pipeline workers share one enricher; run with -race
+	v := NewVisionEnricher(lmstudio.NewClient(srv.URL+"/v1", 10), "")
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			derived, _ := v.Enrich(asset, []storage.ContentAtom{img})
+			if len(derived) != 1 || !strings.Contains(*derived[0].MetadataJSON, `"model":"qwen2.5-vl-7b-instruct"`) {
+				t.Errorf("expected a caption from the discovered vision model, got %+v", derived)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestVisionEnricherRemembersMissingModelForRun(t *testing.T) {
+	var lookups atomic.Int32
+	var loaded atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/models" {
+			lookups.Add(1)
+			models := []map[string]string{{"id": "text-embedding-nomic"}}
+			if loaded.Load() {
+				models = append(models, map[string]string{"id": "llava-1.6"})
+			}
+			json.NewEncoder(w).Encode(map[string]any{"data": models})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"choices": []map[string]any{{
+				"message": map[string]string{"role": "assistant", "content": `{"caption": "A cat."}`},
+			}},
+		})
+	}))
+	defer srv.Close()
+
+	imgPath := filepath.Join(t.TempDir(), "cat.png")
+	os.WriteFile(imgPath, []byte("fake-png"), 0644)
+	img := storage.NewContentAtom("img1", "asset1", storage.AtomImage, 0, `{"asset_id":"asset1"}`)
+	img.PayloadRef = &imgPath
+	asset := storage.NewFileAsset("asset1", imgPath, "cat.png")
+
+	v := NewVisionEnricher(lmstudio.NewClient(srv.URL+"/v1", 10), "")
+	if v.BeginRun() {
+		t.Fatal("expected no vision model before one is loaded")
+	}
+	for range 3 {
+		if derived, deferred := v.Enrich(asset, []storage.ContentAtom{img}); len(derived) != 0 || !deferred {
+			t.Fatalf("expected the image to be deferred, got %d atoms (deferred %v)", len(derived), deferred)
+		}
+	}
+	if n := lookups.Load(); n != 1 {
+		t.Errorf("expected one model lookup for the run, got %d", n)
+	}
+
+	loaded.Store(true)
+	if !v.BeginRun() {
+		t.Fatal("expected the next run to find the loaded vision model")
+	}
+	if derived, deferred := v.Enrich(asset, []storage.ContentAtom{img}); len(derived) != 1 || deferred {
+		t.Errorf("expected a caption once a vision model is loaded, got %d atoms (deferred %v)", len(derived), deferred)
+	}
+}
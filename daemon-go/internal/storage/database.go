@@ -3,6 +3,7 @@ package storage
 import (
 	"database/sql"
 	"fmt"
+	"strings"
 	"time"
 
 	_ "modernc.org/sqlite"
@@ -41,6 +42,14 @@ CREATE TABLE IF NOT EXISTS content_atoms (
 );
 CREATE INDEX IF NOT EXISTS idx_content_atoms_asset ON content_atoms(asset_id);
 
+CREATE TABLE IF NOT EXISTS asset_metadata (
+    asset_id TEXT NOT NULL REFERENCES file_assets(id),
+    key TEXT NOT NULL,
+    value TEXT NOT NULL,
+    PRIMARY KEY (asset_id, key)
+);
+CREATE INDEX IF NOT EXISTS idx_asset_metadata_key ON asset_metadata(key, value);
+
 CREATE TABLE IF NOT EXISTS chunks (
     id TEXT PRIMARY KEY,
     atom_id TEXT REFERENCES content_atoms(id),
@@ -56,6 +65,40 @@ CREATE TABLE IF NOT EXISTS chunks (
 CREATE INDEX IF NOT EXISTS idx_chunks_asset ON chunks(asset_id);
 CREATE INDEX IF NOT EXISTS idx_chunks_atom ON chunks(atom_id);
 
+CREATE TABLE IF NOT EXISTS parent_chunks (
+    id TEXT PRIMARY KEY,
+    atom_id TEXT REFERENCES content_atoms(id),
+    asset_id TEXT REFERENCES file_assets(id),
+    chunk_text TEXT NOT NULL,
+    token_count INTEGER,
+    chunk_index INTEGER,
+    evidence_anchor TEXT NOT NULL,
+    pipeline_version TEXT,
+    created_at TEXT
+);
+CREATE INDEX IF NOT EXISTS idx_parent_chunks_asset ON parent_chunks(asset_id);
+
+CREATE TABLE IF NOT EXISTS boilerplate_lines (
+    volume TEXT NOT NULL,
+    line_hash TEXT NOT NULL,
+    asset_id TEXT NOT NULL,
+    PRIMARY KEY (volume, line_hash, asset_id)
+);
+CREATE INDEX IF NOT EXISTS idx_boilerplate_lines_asset ON boilerplate_lines(asset_id);
+
+CREATE TABLE IF NOT EXISTS suppressed_text (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    atom_id TEXT NOT NULL,
+    asset_id TEXT NOT NULL,
+    start_offset INTEGER NOT NULL,
+    end_offset INTEGER NOT NULL,
+    text TEXT NOT NULL,
+    reason TEXT NOT NULL,
+    occurrences INTEGER,
+    created_at TEXT
+);
+CREATE INDEX IF NOT EXISTS idx_suppressed_text_asset ON suppressed_text(asset_id);
+
 CREATE TABLE IF NOT EXISTS annotations (
     id TEXT PRIMARY KEY,
     chunk_id TEXT REFERENCES chunks(id),
@@ -118,8 +161,32 @@ CREATE TABLE IF NOT EXISTS watched_volumes (
     added_at TEXT,
     last_scan_at TEXT
 );
+
+CREATE TABLE IF NOT EXISTS vision_pending (
+    asset_id TEXT PRIMARY KEY,
+    created_at TEXT
+);
 `
 
+// schemaMigrations evolve tables created by earlier versions. They run in
+// order on every start; a "duplicate column name" error means the step was
+// already applied.
+var schemaMigrations = []string{
+	"ALTER TABLE chunks ADD COLUMN language TEXT",
+	"CREATE INDEX IF NOT EXISTS idx_chunks_language ON chunks(language)",
+	"ALTER TABLE watched_volumes ADD COLUMN chunk_strategy TEXT",
+	"ALTER TABLE chunks ADD COLUMN parent_id TEXT",
+	"ALTER TABLE chunks ADD COLUMN parent_start INTEGER",
+	"ALTER TABLE chunks ADD COLUMN parent_end INTEGER",
+	"CREATE INDEX IF NOT EXISTS idx_chunks_parent ON chunks(parent_id)",
+}
+
+// chunkColumns lists chunk columns explicitly so scans do not depend on the
+// physical column order left behind by migrations.
+const chunkColumns = `id, atom_id, asset_id, chunk_text, token_count, chunk_index,
+	evidence_anchor, embedding_id, pipeline_version, created_at, language,
+	parent_id, parent_start, parent_end`
+
 // Database provides thread-safe SQLite operations.
 type Database struct {
 	db *sql.DB
@@ -145,8 +212,24 @@ func NewDatabase(dbPath string) (*Database, error) {
 }
 
 func (d *Database) Initialize() error {
-	_, err := d.db.Exec(schemaDDL)
-	return err
+	if _, err := d.db.Exec(schemaDDL); err != nil {
+		return err
+	}
+	if err := migrate(d.db, schemaMigrations); err != nil {
+		return err
+	}
+	return ensureChunkFTS(d.db)
+}
+
+// migrate applies schema migration statements, skipping columns that
+// already exist.
+func migrate(db *sql.DB, statements []string) error {
+	for _, stmt := range statements {
+		if _, err := db.Exec(stmt); err != nil && !strings.Contains(err.Error(), "duplicate column name") {
+			return fmt.Errorf("migrate %q: %w", stmt, err)
+		}
+	}
+	return nil
 }
 
 func (d *Database) Close() error {
@@ -343,30 +426,139 @@ func (d *Database) DeleteAtomsForAsset(assetID string) error {
 	return err
 }
 
+// SetVisionPending records whether an asset has images that went uncaptioned
+// because no vision model was loaded when it was extracted.
+func (d *Database) SetVisionPending(assetID string, pending bool) error {
+	if !pending {
+		_, err := d.db.Exec("DELETE FROM vision_pending WHERE asset_id=?", assetID)
+		return err
+	}
+	_, err := d.db.Exec(
+		"INSERT OR IGNORE INTO vision_pending (asset_id, created_at) VALUES (?, ?)",
+		assetID, nowISO(),
+	)
+	return err
+}
+
+// RequeueVisionPending sets every asset awaiting captions back to pending so
+// the next extraction captions it, and returns how many were requeued.
+func (d *Database) RequeueVisionPending() (int, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	res, err := tx.Exec(
+		"UPDATE file_assets SET status=?, error_message=NULL, updated_at=? WHERE id IN (SELECT asset_id FROM vision_pending)",
+		string(StatusPending), nowISO(),
+	)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	if _, err := tx.Exec("DELETE FROM vision_pending"); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	n, _ := res.RowsAffected()
+	return int(n), tx.Commit()
+}
+
+// -- Asset metadata operations --
+
+// SetAssetMetadata replaces the normalised metadata fields for an asset.
+func (d *Database) SetAssetMetadata(assetID string, meta map[string]string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM asset_metadata WHERE asset_id=?", assetID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	for k, v := range meta {
+		if _, err := tx.Exec(
+			"INSERT INTO asset_metadata (asset_id, key, value) VALUES (?, ?, ?)",
+			assetID, k, v,
+		); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetAssetMetadata returns all metadata fields for an asset.
+func (d *Database) GetAssetMetadata(assetID string) (map[string]string, error) {
+	rows, err := d.db.Query("SELECT key, value FROM asset_metadata WHERE asset_id=?", assetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	meta := make(map[string]string)
+	for rows.Next() {
+		var k, v string
+		if err := rows.Scan(&k, &v); err != nil {
+			return nil, err
+		}
+		meta[k] = v
+	}
+	return meta, rows.Err()
+}
+
+// FindAssetsByMetadata returns IDs of assets matching every filter. Values
+// match case-insensitively as substrings, so "2023" matches any 2023 date.
+func (d *Database) FindAssetsByMetadata(filters map[string]string) ([]string, error) {
+	if len(filters) == 0 {
+		return nil, nil
+	}
+	var where []string
+	var args []any
+	for k, v := range filters {
+		where = append(where, "(key=? AND value LIKE ? ESCAPE '\\')")
+		args = append(args, k, "%"+escapeLike(v)+"%")
+	}
+	args = append(args, len(filters))
+	rows, err := d.db.Query(
+		"SELECT asset_id FROM asset_metadata WHERE "+strings.Join(where, " OR ")+
+			" GROUP BY asset_id HAVING COUNT(DISTINCT key)=?",
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func escapeLike(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+	return r.Replace(s)
+}
+
 // -- Chunk operations --
 
 func (d *Database) InsertChunk(c Chunk) error {
-	_, err := d.db.Exec(`
-		INSERT OR REPLACE INTO chunks
-		(id, atom_id, asset_id, chunk_text, token_count, chunk_index,
-		 evidence_anchor, embedding_id, pipeline_version, created_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		c.ID, c.AtomID, c.AssetID, c.ChunkText, c.TokenCount, c.ChunkIndex,
-		c.EvidenceAnchor, c.EmbeddingID, c.PipelineVersion, c.CreatedAt,
-	)
-	return err
+	return d.InsertChunks([]Chunk{c})
 }
 
+// InsertChunks stores chunks, replacing those with the same ID, and
+// indexes their text for keyword search.
 func (d *Database) InsertChunks(chunks []Chunk) error {
 	tx, err := d.db.Begin()
 	if err != nil {
 		return err
 	}
 	stmt, err := tx.Prepare(`
-		INSERT OR REPLACE INTO chunks
-		(id, atom_id, asset_id, chunk_text, token_count, chunk_index,
-		 evidence_anchor, embedding_id, pipeline_version, created_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+		INSERT OR REPLACE INTO chunks (` + chunkColumns + `)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
 	if err != nil {
 		tx.Rollback()
 		return err
@@ -374,20 +566,29 @@ func (d *Database) InsertChunks(chunks []Chunk) error {
 	defer stmt.Close()
 
 	for _, c := range chunks {
+		if _, err := tx.Exec(unindexChunkSQL, c.ID); err != nil {
+			tx.Rollback()
+			return err
+		}
 		_, err := stmt.Exec(
 			c.ID, c.AtomID, c.AssetID, c.ChunkText, c.TokenCount, c.ChunkIndex,
-			c.EvidenceAnchor, c.EmbeddingID, c.PipelineVersion, c.CreatedAt,
+			c.EvidenceAnchor, c.EmbeddingID, c.PipelineVersion, c.CreatedAt, c.Language,
+			c.ParentID, c.ParentStart, c.ParentEnd,
 		)
 		if err != nil {
 			tx.Rollback()
 			return err
 		}
+		if _, err := tx.Exec(indexChunkSQL, c.ID); err != nil {
+			tx.Rollback()
+			return err
+		}
 	}
 	return tx.Commit()
 }
 
 func (d *Database) GetChunksForAsset(assetID string) ([]Chunk, error) {
-	rows, err := d.db.Query("SELECT * FROM chunks WHERE asset_id=? ORDER BY chunk_index", assetID)
+	rows, err := d.db.Query("SELECT "+chunkColumns+" FROM chunks WHERE asset_id=? ORDER BY chunk_index", assetID)
 	if err != nil {
 		return nil, err
 	}
@@ -396,7 +597,7 @@ func (d *Database) GetChunksForAsset(assetID string) ([]Chunk, error) {
 }
 
 func (d *Database) GetChunksWithoutEmbeddings(limit int) ([]Chunk, error) {
-	rows, err := d.db.Query("SELECT * FROM chunks WHERE embedding_id IS NULL LIMIT ?", limit)
+	rows, err := d.db.Query("SELECT "+chunkColumns+" FROM chunks WHERE embedding_id IS NULL LIMIT ?", limit)
 	if err != nil {
 		return nil, err
 	}
@@ -405,11 +606,12 @@ func (d *Database) GetChunksWithoutEmbeddings(limit int) ([]Chunk, error) {
 }
 
 func (d *Database) GetChunk(chunkID string) (*Chunk, error) {
-	row := d.db.QueryRow("SELECT * FROM chunks WHERE id=?", chunkID)
+	row := d.db.QueryRow("SELECT "+chunkColumns+" FROM chunks WHERE id=?", chunkID)
 	var c Chunk
 	err := row.Scan(
 		&c.ID, &c.AtomID, &c.AssetID, &c.ChunkText, &c.TokenCount, &c.ChunkIndex,
-		&c.EvidenceAnchor, &c.EmbeddingID, &c.PipelineVersion, &c.CreatedAt,
+		&c.EvidenceAnchor, &c.EmbeddingID, &c.PipelineVersion, &c.CreatedAt, &c.Language,
+		&c.ParentID, &c.ParentStart, &c.ParentEnd,
 	)
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -425,9 +627,170 @@ func (d *Database) UpdateChunkEmbedding(chunkID, embeddingID string) error {
 	return err
 }
 
+// DeleteChunksForAsset removes an asset's chunks, their keyword index
+// entries, parent sections and suppressed text.
 func (d *Database) DeleteChunksForAsset(assetID string) error {
-	_, err := d.db.Exec("DELETE FROM chunks WHERE asset_id=?", assetID)
-	return err
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, stmt := range []string{
+		unindexAssetChunksSQL,
+		"DELETE FROM chunks WHERE asset_id=?",
+		"DELETE FROM parent_chunks WHERE asset_id=?",
+		"DELETE FROM suppressed_text WHERE asset_id=?",
+	} {
+		if _, err := tx.Exec(stmt, assetID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// InsertParentChunks stores the parent sections that child chunks link to.
+func (d *Database) InsertParentChunks(parents []ParentChunk) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(`
+		INSERT OR REPLACE INTO parent_chunks
+		(id, atom_id, asset_id, chunk_text, token_count, chunk_index,
+		 evidence_anchor, pipeline_version, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	for _, p := range parents {
+		_, err := stmt.Exec(
+			p.ID, p.AtomID, p.AssetID, p.ChunkText, p.TokenCount, p.ChunkIndex,
+			p.EvidenceAnchor, p.PipelineVersion, p.CreatedAt,
+		)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (d *Database) GetParentChunk(parentID string) (*ParentChunk, error) {
+	row := d.db.QueryRow(`SELECT id, atom_id, asset_id, chunk_text, token_count, chunk_index,
+		evidence_anchor, pipeline_version, created_at FROM parent_chunks WHERE id=?`, parentID)
+	var p ParentChunk
+	err := row.Scan(
+		&p.ID, &p.AtomID, &p.AssetID, &p.ChunkText, &p.TokenCount, &p.ChunkIndex,
+		&p.EvidenceAnchor, &p.PipelineVersion, &p.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// -- Boilerplate operations --
+
+// RecordBoilerplateLines replaces the line hashes recorded for an asset in
+// a volume, from which lines repeated across the volume are counted.
+func (d *Database) RecordBoilerplateLines(volume, assetID string, hashes []string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM boilerplate_lines WHERE asset_id=?", assetID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	stmt, err := tx.Prepare("INSERT OR IGNORE INTO boilerplate_lines (volume, line_hash, asset_id) VALUES (?, ?, ?)")
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+	for _, h := range hashes {
+		if _, err := stmt.Exec(volume, h, assetID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// RepeatedBoilerplateLines returns the line hashes recorded for at least
+// minAssets assets of a volume, with their asset counts.
+func (d *Database) RepeatedBoilerplateLines(volume string, minAssets int) (map[string]int, error) {
+	rows, err := d.db.Query(`SELECT line_hash, COUNT(*) FROM boilerplate_lines
+		WHERE volume=? GROUP BY line_hash HAVING COUNT(*) >= ?`, volume, minAssets)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	counts := make(map[string]int)
+	for rows.Next() {
+		var hash string
+		var n int
+		if err := rows.Scan(&hash, &n); err != nil {
+			return nil, err
+		}
+		counts[hash] = n
+	}
+	return counts, rows.Err()
+}
+
+// InsertSuppressedText records text left out of chunking.
+func (d *Database) InsertSuppressedText(spans []SuppressedText) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(`
+		INSERT INTO suppressed_text
+		(atom_id, asset_id, start_offset, end_offset, text, reason, occurrences, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	for _, s := range spans {
+		_, err := stmt.Exec(s.AtomID, s.AssetID, s.Start, s.End, s.Text, s.Reason, s.Occurrences, s.CreatedAt)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetSuppressedText returns the text left out of an asset's chunks, in
+// document order.
+func (d *Database) GetSuppressedText(assetID string) ([]SuppressedText, error) {
+	rows, err := d.db.Query(`SELECT s.atom_id, s.asset_id, s.start_offset, s.end_offset, s.text,
+		s.reason, s.occurrences, s.created_at
+		FROM suppressed_text s LEFT JOIN content_atoms a ON a.id = s.atom_id
+		WHERE s.asset_id=? ORDER BY a.sequence_index, s.start_offset`, assetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var spans []SuppressedText
+	for rows.Next() {
+		var s SuppressedText
+		if err := rows.Scan(&s.AtomID, &s.AssetID, &s.Start, &s.End, &s.Text,
+			&s.Reason, &s.Occurrences, &s.CreatedAt); err != nil {
+			return nil, err
+		}
+		spans = append(spans, s)
+	}
+	return spans, rows.Err()
 }
 
 func (d *Database) CountChunks() (int, error) {
@@ -442,7 +805,8 @@ func (d *Database) scanChunks(rows *sql.Rows) ([]Chunk, error) {
 		var c Chunk
 		err := rows.Scan(
 			&c.ID, &c.AtomID, &c.AssetID, &c.ChunkText, &c.TokenCount, &c.ChunkIndex,
-			&c.EvidenceAnchor, &c.EmbeddingID, &c.PipelineVersion, &c.CreatedAt,
+			&c.EvidenceAnchor, &c.EmbeddingID, &c.PipelineVersion, &c.CreatedAt, &c.Language,
+			&c.ParentID, &c.ParentStart, &c.ParentEnd,
 		)
 		if err != nil {
 			return nil, err
@@ -695,16 +1059,16 @@ func (d *Database) UpdateJobStatus(jobID string, status JobStatus, progress *str
 
 func (d *Database) AddWatchedVolume(vol WatchedVolume) error {
 	_, err := d.db.Exec(`
-		INSERT INTO watched_volumes (id, path, label, added_at, last_scan_at)
-		VALUES (?, ?, ?, ?, ?)
-		ON CONFLICT(path) DO UPDATE SET label=excluded.label`,
-		vol.ID, vol.Path, vol.Label, vol.AddedAt, vol.LastScanAt,
+		INSERT INTO watched_volumes (id, path, label, added_at, last_scan_at, chunk_strategy)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(path) DO UPDATE SET label=excluded.label, chunk_strategy=excluded.chunk_strategy`,
+		vol.ID, vol.Path, vol.Label, vol.AddedAt, vol.LastScanAt, vol.ChunkStrategy,
 	)
 	return err
 }
 
 func (d *Database) GetWatchedVolumes() ([]WatchedVolume, error) {
-	rows, err := d.db.Query("SELECT * FROM watched_volumes")
+	rows, err := d.db.Query("SELECT id, path, label, added_at, last_scan_at, chunk_strategy FROM watched_volumes")
 	if err != nil {
 		return nil, err
 	}
@@ -713,7 +1077,7 @@ func (d *Database) GetWatchedVolumes() ([]WatchedVolume, error) {
 	var vols []WatchedVolume
 	for rows.Next() {
 		var v WatchedVolume
-		if err := rows.Scan(&v.ID, &v.Path, &v.Label, &v.AddedAt, &v.LastScanAt); err != nil {
+		if err := rows.Scan(&v.ID, &v.Path, &v.Label, &v.AddedAt, &v.LastScanAt, &v.ChunkStrategy); err != nil {
 			return nil, err
 		}
 		vols = append(vols, v)
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"database/sql"
 	"path/filepath"
 	"testing"
 )
@@ -206,6 +207,61 @@ func TestChunkCRUD(t *testing.T) {
 	}
 }
 
+func TestChunkLanguageMigration(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "old.db")
+
+	// A database created before chunks had a language column.
+	old, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if _, err := old.Exec(`CREATE TABLE chunks (
+		id TEXT PRIMARY KEY, atom_id TEXT, asset_id TEXT, chunk_text TEXT NOT NULL,
+		token_count INTEGER, chunk_index INTEGER, evidence_anchor TEXT NOT NULL,
+		embedding_id TEXT, pipeline_version TEXT, created_at TEXT)`); err != nil {
+		t.Fatalf("create old table: %v", err)
+	}
+	if _, err := old.Exec(`INSERT INTO chunks (id, atom_id, asset_id, chunk_text, token_count, chunk_index, evidence_anchor, pipeline_version, created_at)
+		VALUES ('old1', 'atom0', 'asset0', 'legacy', 1, 0, '{}', 'v1.0', '')`); err != nil {
+		t.Fatalf("insert old row: %v", err)
+	}
+	old.Close()
+
+	db, err := NewDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	defer db.Close()
+	for i := 0; i < 2; i++ { // migrations must be idempotent
+		if err := db.Initialize(); err != nil {
+			t.Fatalf("Initialize #%d: %v", i+1, err)
+		}
+	}
+
+	legacy, err := db.GetChunk("old1")
+	if err != nil || legacy == nil {
+		t.Fatalf("GetChunk(old1): %v", err)
+	}
+	if legacy.Language != nil {
+		t.Errorf("legacy chunk language = %q, want nil", *legacy.Language)
+	}
+
+	a := NewFileAsset("asset1", "/tmp/de.txt", "de.txt")
+	db.UpsertFileAsset(a)
+	atom := NewContentAtom("atom1", "asset1", AtomText, 0, `{}`)
+	db.InsertContentAtom(atom)
+	c := NewChunk("chunk1", "atom1", "asset1", "Guten Tag", 3, 0, `{}`, "v1.0")
+	lang := "de"
+	c.Language = &lang
+	if err := db.InsertChunk(c); err != nil {
+		t.Fatalf("InsertChunk: %v", err)
+	}
+	got, _ := db.GetChunk("chunk1")
+	if got == nil || got.Language == nil || *got.Language != "de" {
+		t.Errorf("expected language de, got %+v", got)
+	}
+}
+
 func TestAnnotationCRUD(t *testing.T) {
 	db := newTestDB(t)
 
@@ -371,6 +427,20 @@ func TestWatchedVolumeCRUD(t *testing.T) {
 	if vols[0].Path != "/tmp/docs" {
 		t.Errorf("expected /tmp/docs, got %s", vols[0].Path)
 	}
+	if vols[0].ChunkStrategy != nil {
+		t.Errorf("expected no chunk strategy, got %q", *vols[0].ChunkStrategy)
+	}
+
+	// Re-adding the path updates its chunk strategy
+	strategy := "semantic"
+	vol.ChunkStrategy = &strategy
+	if err := db.AddWatchedVolume(vol); err != nil {
+		t.Fatalf("AddWatchedVolume: %v", err)
+	}
+	vols, _ = db.GetWatchedVolumes()
+	if len(vols) != 1 || vols[0].ChunkStrategy == nil || *vols[0].ChunkStrategy != "semantic" {
+		t.Errorf("expected chunk strategy semantic, got %+v", vols)
+	}
 
 	// Update scan time
 	if err := db.UpdateVolumeScanTime("vol1"); err != nil {
@@ -386,3 +456,105 @@ func TestWatchedVolumeCRUD(t *testing.T) {
 		t.Errorf("expected 0 volumes after remove, got %d", len(vols2))
 	}
 }
+
+func TestBoilerplateLines(t *testing.T) {
+	db := newTestDB(t)
+
+	for _, id := range []string{"a1", "a2", "a3"} {
+		if err := db.RecordBoilerplateLines("vol1", id, []string{"footer", id}); err != nil {
+			t.Fatalf("RecordBoilerplateLines: %v", err)
+		}
+	}
+	db.RecordBoilerplateLines("vol2", "b1", []string{"footer"})
+
+	repeats, err := db.RepeatedBoilerplateLines("vol1", 3)
+	if err != nil {
+		t.Fatalf("RepeatedBoilerplateLines: %v", err)
+	}
+	if len(repeats) != 1 || repeats["footer"] != 3 {
+		t.Errorf("expected footer in 3 assets, got %v", repeats)
+	}
+
+	// Re-recording an asset replaces its lines
+	db.RecordBoilerplateLines("vol1", "a3", []string{"a3"})
+	if repeats, _ := db.RepeatedBoilerplateLines("vol1", 3); len(repeats) != 0 {
+		t.Errorf("expected no repeats after re-record, got %v", repeats)
+	}
+
+	atom := NewContentAtom("atom1", "a1", AtomText, 0, `{"asset_id":"a1"}`)
+	db.InsertContentAtom(atom)
+	spans := []SuppressedText{
+		{AtomID: "atom1", AssetID: "a1", Start: 40, End: 52, Text: "Page 1 of 4", Reason: "repeated_in_asset", Occurrences: 4},
+		{AtomID: "atom1", AssetID: "a1", Start: 0, End: 12, Text: "ACME Corp", Reason: "repeated_in_asset", Occurrences: 4},
+	}
+	if err := db.InsertSuppressedText(spans); err != nil {
+		t.Fatalf("InsertSuppressedText: %v", err)
+	}
+	got, err := db.GetSuppressedText("a1")
+	if err != nil {
+		t.Fatalf("GetSuppressedText: %v", err)
+	}
+	if len(got) != 2 || got[0].Text != "ACME Corp" || got[1].Start != 40 {
+		t.Errorf("expected spans in document order, got %+v", got)
+	}
+
+	db.DeleteChunksForAsset("a1")
+	if got, _ := db.GetSuppressedText("a1"); len(got) != 0 {
+		t.Errorf("expected suppressed text deleted with chunks, got %d", len(got))
+	}
+}
+
+func TestAssetMetadataFilter(t *testing.T) {
+	db := newTestDB(t)
+
+	for _, id := range []string{"a1", "a2"} {
+		db.UpsertFileAsset(NewFileAsset(id, "/tmp/"+id+".jpg", id+".jpg"))
+	}
+	db.SetAssetMetadata("a1", map[string]string{"captured_at": "2023-05-01T12:00:00", "author": "Ada Lovelace"})
+	db.SetAssetMetadata("a2", map[string]string{"captured_at": "2021-01-01T00:00:00", "author": "Ada Lovelace"})
+
+	ids, err := db.FindAssetsByMetadata(map[string]string{"captured_at": "2023", "author": "lovelace"})
+	if err != nil {
+		t.Fatalf("FindAssetsByMetadata: %v", err)
+	}
+	if len(ids) != 1 || ids[0] != "a1" {
+		t.Errorf("expected [a1], got %v", ids)
+	}
+
+	// Replacing metadata drops old keys
+	db.SetAssetMetadata("a1", map[string]string{"title": "Holiday"})
+	meta, _ := db.GetAssetMetadata("a1")
+	if len(meta) != 1 || meta["title"] != "Holiday" {
+		t.Errorf("expected replaced metadata, got %v", meta)
+	}
+}
+
+func TestVisionPendingRequeue(t *testing.T) {
+	db := newTestDB(t)
+
+	for _, id := range []string{"a1", "a2", "a3"} {
+		db.UpsertFileAsset(NewFileAsset(id, "/tmp/"+id+".png", id+".png"))
+		db.UpdateAssetStatus(id, StatusExtracted, nil)
+	}
+	db.SetVisionPending("a1", true)
+	db.SetVisionPending("a2", true)
+	db.SetVisionPending("a2", false) // captioned on a later extraction
+
+	n, err := db.RequeueVisionPending()
+	if err != nil {
+		t.Fatalf("RequeueVisionPending: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("expected 1 requeued asset, got %d", n)
+	}
+	for id, want := range map[string]AssetStatus{"a1": StatusPending, "a2": StatusExtracted, "a3": StatusExtracted} {
+		if a, _ := db.GetFileAsset(id); a.Status != want {
+			t.Errorf("%s: expected status %s, got %s", id, want, a.Status)
+		}
+	}
+
+	// Requeued assets are not requeued again
+	if n, _ := db.RequeueVisionPending(); n != 0 {
+		t.Errorf("expected nothing left to requeue, got %d", n)
+	}
+}
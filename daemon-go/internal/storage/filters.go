@@ -0,0 +1,206 @@
+package storage
+
+import (
+	"strings"
+	"time"
+)
+
+// SearchFilter scopes a search by the source file, the chunk's annotation
+// and its concepts. Empty fields do not restrict; set fields must all hold.
+type SearchFilter struct {
+	MIMETypes      []string          // any of; "image" matches every image/* type
+	Extensions     []string          // any of, with or without the dot
+	Volumes        []string          // any of, by watched volume ID or path
+	PathPrefix     string            // e.g. "/Users/me/Documents/2023/"
+	PathGlob       string            // SQLite GLOB over the full path; * also matches /
+	ModifiedAfter  *time.Time        // file mtime, inclusive
+	ModifiedBefore *time.Time        // file mtime, inclusive
+	Metadata       map[string]string // see FindAssetsByMetadata
+	Topics         []string          // all of, as case-insensitive substrings of an annotated topic
+	Entities       []string          // all of, as case-insensitive substrings of an entity name
+	Sentiment      string            // annotated sentiment label
+	Concepts       []string          // member of any of these concept IDs
+	Language       string            // ISO 639-1 code of the chunk
+}
+
+// RecordFilter is a SearchFilter resolved to the assets and chunks it
+// admits, for use while search candidates are selected.
+type RecordFilter struct {
+	assets   map[string]bool // nil when assets are not restricted
+	chunks   map[string]bool // nil when chunks are not restricted
+	language string
+}
+
+// Accept reports whether a record passes the filter.
+func (f *RecordFilter) Accept(rec *VectorRecord) bool {
+	return (f.assets == nil || f.assets[rec.AssetID]) &&
+		(f.chunks == nil || f.chunks[rec.ID]) &&
+		(f.language == "" || rec.Language == f.language)
+}
+
+// MatchesNone reports whether no record can pass, so searching is moot.
+func (f *RecordFilter) MatchesNone() bool {
+	return (f.assets != nil && len(f.assets) == 0) || (f.chunks != nil && len(f.chunks) == 0)
+}
+
+// ResolveFilter looks up the assets and chunks a filter admits. It returns
+// nil when the filter does not restrict anything.
+func (d *Database) ResolveFilter(f SearchFilter) (*RecordFilter, error) {
+	rf := &RecordFilter{language: strings.ToLower(f.Language)}
+
+	var where []string
+	var args []any
+	anyOf := func(conds []string) string { return "(" + strings.Join(conds, " OR ") + ")" }
+	if len(f.MIMETypes) > 0 {
+		var conds []string
+		for _, m := range f.MIMETypes {
+			m = strings.ToLower(strings.TrimSuffix(m, "/"))
+			conds = append(conds, `(lower(mime_type)=? OR lower(mime_type) LIKE ? ESCAPE '\' OR lower(mime_type) LIKE ? ESCAPE '\')`)
+			args = append(args, m, escapeLike(m)+"/%", escapeLike(m)+";%")
+		}
+		where = append(where, anyOf(conds))
+	}
+	if len(f.Extensions) > 0 {
+		var conds []string
+		for _, ext := range f.Extensions {
+			conds = append(conds, `lower(filename) LIKE ? ESCAPE '\'`)
+			args = append(args, "%."+escapeLike(strings.ToLower(strings.TrimPrefix(ext, "."))))
+		}
+		where = append(where, anyOf(conds))
+	}
+	if len(f.Volumes) > 0 {
+		roots, err := d.volumeRoots(f.Volumes)
+		if err != nil {
+			return nil, err
+		}
+		conds := []string{"0"}
+		for _, root := range roots {
+			conds = append(conds, `(path=? OR path LIKE ? ESCAPE '\')`)
+			args = append(args, root, escapeLike(root)+"/%")
+		}
+		where = append(where, anyOf(conds))
+	}
+	if f.PathPrefix != "" {
+		where = append(where, `path LIKE ? ESCAPE '\'`)
+		args = append(args, escapeLike(f.PathPrefix)+"%")
+	}
+	if f.PathGlob != "" {
+		where = append(where, "path GLOB ?")
+		args = append(args, f.PathGlob)
+	}
+	if f.ModifiedAfter != nil {
+		where = append(where, "mtime_ns >= ?")
+		args = append(args, f.ModifiedAfter.UnixNano())
+	}
+	if f.ModifiedBefore != nil {
+		where = append(where, "mtime_ns <= ?")
+		args = append(args, f.ModifiedBefore.UnixNano())
+	}
+	if len(where) > 0 {
+		assets, err := d.idSet("SELECT id FROM file_assets WHERE "+strings.Join(where, " AND "), args...)
+		if err != nil {
+			return nil, err
+		}
+		rf.assets = assets
+	}
+	if len(f.Metadata) > 0 {
+		ids, err := d.FindAssetsByMetadata(f.Metadata)
+		if err != nil {
+			return nil, err
+		}
+		matched := make(map[string]bool, len(ids))
+		for _, id := range ids {
+			if rf.assets == nil || rf.assets[id] {
+				matched[id] = true
+			}
+		}
+		rf.assets = matched
+	}
+
+	// Chunk conditions, intersected
+	var queries []string
+	args = nil
+	var annotation []string
+	for _, topic := range f.Topics {
+		annotation = append(annotation, `EXISTS (SELECT 1 FROM json_each(CASE WHEN json_valid(topics_json) THEN topics_json END)
+			WHERE value LIKE ? ESCAPE '\')`)
+		args = append(args, "%"+escapeLike(topic)+"%")
+	}
+	for _, entity := range f.Entities {
+		annotation = append(annotation, `EXISTS (SELECT 1 FROM json_each(CASE WHEN json_valid(entities_json) THEN entities_json END)
+			WHERE (CASE WHEN type='object' THEN json_extract(value, '$.name') ELSE value END) LIKE ? ESCAPE '\')`)
+		args = append(args, "%"+escapeLike(entity)+"%")
+	}
+	if f.Sentiment != "" {
+		annotation = append(annotation, "lower(sentiment_label)=?")
+		args = append(args, strings.ToLower(f.Sentiment))
+	}
+	if len(annotation) > 0 {
+		queries = append(queries, "SELECT chunk_id FROM annotations WHERE is_current=1 AND "+strings.Join(annotation, " AND "))
+	}
+	if len(f.Concepts) > 0 {
+		queries = append(queries, "SELECT target_id FROM graph_edges WHERE edge_type='concept_member' AND source_id IN (?"+
+			strings.Repeat(",?", len(f.Concepts)-1)+")")
+		for _, id := range f.Concepts {
+			args = append(args, id)
+		}
+	}
+	if len(queries) > 0 {
+		chunks, err := d.idSet(strings.Join(queries, " INTERSECT "), args...)
+		if err != nil {
+			return nil, err
+		}
+		rf.chunks = chunks
+	}
+
+	if rf.assets == nil && rf.chunks == nil && rf.language == "" {
+		return nil, nil
+	}
+	return rf, nil
+}
+
+// volumeRoots returns the paths of the watched volumes given by ID or path,
+// without trailing slashes.
+func (d *Database) volumeRoots(volumes []string) ([]string, error) {
+	placeholders := "?" + strings.Repeat(",?", len(volumes)-1)
+	args := make([]any, 0, 2*len(volumes))
+	for _, v := range volumes {
+		args = append(args, v)
+	}
+	for _, v := range volumes {
+		args = append(args, strings.TrimSuffix(v, "/"))
+	}
+	rows, err := d.db.Query("SELECT path FROM watched_volumes WHERE id IN ("+placeholders+") OR rtrim(path, '/') IN ("+
+		placeholders+")", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var roots []string
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return nil, err
+		}
+		roots = append(roots, strings.TrimSuffix(path, "/"))
+	}
+	return roots, rows.Err()
+}
+
+// idSet runs a query selecting one ID column and returns the IDs as a set.
+func (d *Database) idSet(query string, args ...any) (map[string]bool, error) {
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids[id] = true
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"path/filepath"
+	"slices"
+	"sort"
+	"testing"
+	"time"
+)
+
+func seedFilterCorpus(t *testing.T, db *Database) {
+	t.Helper()
+	files := []struct {
+		id, path, mime string
+		mtime          time.Time
+	}{
+		{"report", "/vol/work/2023/report.pdf", "application/pdf", time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"photo", "/vol/work/photos/IMG_1.JPG", "image/jpeg", time.Date(2023, 7, 1, 0, 0, 0, 0, time.UTC)},
+		{"notes", "/home/me/notes.md", "text/markdown; charset=utf-8", time.Date(2024, 1, 5, 12, 0, 0, 0, time.UTC)},
+	}
+	for _, f := range files {
+		a := NewFileAsset(f.id, f.path, filepath.Base(f.path))
+		mime := f.mime
+		a.MimeType = &mime
+		a.MtimeNs = f.mtime.UnixNano()
+		db.UpsertFileAsset(a)
+		db.InsertContentAtom(NewContentAtom(f.id+"-atom", f.id, AtomText, 0, `{}`))
+		db.InsertChunk(NewChunk(f.id+"-1", f.id+"-atom", f.id, "text of "+f.id, 3, 0, `{}`, "v1"))
+	}
+	db.AddWatchedVolume(NewWatchedVolume("vol-work", "/vol/work/", nil))
+
+	annotate := func(chunkID, topics, entities, sentiment string) {
+		err := db.InsertAnnotation(Annotation{
+			ID: "ann-" + chunkID, ChunkID: chunkID, ModelID: "m", PromptID: "p", PromptVersion: "1",
+			PipelineVersion: "v1", TopicsJSON: &topics, EntitiesJSON: &entities, SentimentLabel: &sentiment,
+			IsCurrent: 1, CreatedAt: nowISO(),
+		})
+		if err != nil {
+			t.Fatalf("InsertAnnotation: %v", err)
+		}
+	}
+	annotate("report-1", `["Quarterly Budget", "Hiring"]`, `[{"name": "ACME Corp", "type": "org"}]`, "negative")
+	annotate("photo-1", `["Office party"]`, `["Jane Doe"]`, "Positive")
+	annotate("notes-1", `not json`, `[]`, "neutral")
+
+	db.InsertGraphEdge(GraphEdge{ID: "e1", SourceID: "concept-a", TargetID: "report-1", EdgeType: "concept_member", Weight: 1})
+	db.InsertGraphEdge(GraphEdge{ID: "e2", SourceID: "concept-b", TargetID: "notes-1", EdgeType: "concept_member", Weight: 1})
+	db.InsertGraphEdge(GraphEdge{ID: "e3", SourceID: "concept-a", TargetID: "photo-1", EdgeType: "similarity", Weight: 1})
+}
+
+func acceptedChunks(t *testing.T, db *Database, f SearchFilter) []string {
+	t.Helper()
+	rf, err := db.ResolveFilter(f)
+	if err != nil {
+		t.Fatalf("ResolveFilter(%+v): %v", f, err)
+	}
+	var ids []string
+	for _, rec := range []VectorRecord{
+		{ID: "report-1", AssetID: "report"}, {ID: "photo-1", AssetID: "photo"}, {ID: "notes-1", AssetID: "notes"},
+	} {
+		if rf == nil || rf.Accept(&rec) {
+			ids = append(ids, rec.ID)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestResolveFilter(t *testing.T) {
+	db := newTestDB(t)
+	seedFilterCorpus(t, db)
+	day := func(y int, m time.Month, d int) *time.Time {
+		t := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+		return &t
+	}
+
+	tests := []struct {
+		name   string
+		filter SearchFilter
+		want   []string
+	}{
+		{"none", SearchFilter{}, []string{"notes-1", "photo-1", "report-1"}},
+		{"mime exact", SearchFilter{MIMETypes: []string{"application/pdf"}}, []string{"report-1"}},
+		{"mime family", SearchFilter{MIMETypes: []string{"image"}}, []string{"photo-1"}},
+		{"mime with parameters", SearchFilter{MIMETypes: []string{"text/markdown", "image/png"}}, []string{"notes-1"}},
+		{"extension", SearchFilter{Extensions: []string{"jpg", ".md"}}, []string{"notes-1", "photo-1"}},
+		{"volume by id", SearchFilter{Volumes: []string{"vol-work"}}, []string{"photo-1", "report-1"}},
+		{"volume by path", SearchFilter{Volumes: []string{"/vol/work"}}, []string{"photo-1", "report-1"}},
+		{"unknown volume", SearchFilter{Volumes: []string{"/nowhere"}}, nil},
+		{"path prefix", SearchFilter{PathPrefix: "/vol/work/2023/"}, []string{"report-1"}},
+		{"path glob", SearchFilter{PathGlob: "/vol/*.JPG"}, []string{"photo-1"}},
+		{"modified range", SearchFilter{ModifiedAfter: day(2023, 6, 1), ModifiedBefore: day(2023, 12, 31)}, []string{"photo-1"}},
+		{"topic substring", SearchFilter{Topics: []string{"budget"}}, []string{"report-1"}},
+		{"all topics", SearchFilter{Topics: []string{"budget", "party"}}, nil},
+		{"entity object", SearchFilter{Entities: []string{"acme"}}, []string{"report-1"}},
+		{"entity string", SearchFilter{Entities: []string{"Jane"}}, []string{"photo-1"}},
+		{"sentiment", SearchFilter{Sentiment: "positive"}, []string{"photo-1"}},
+		{"concepts", SearchFilter{Concepts: []string{"concept-a", "concept-b"}}, []string{"notes-1", "report-1"}},
+		{"asset and chunk", SearchFilter{Volumes: []string{"vol-work"}, Concepts: []string{"concept-a"}, Sentiment: "negative"}, []string{"report-1"}},
+		{"metadata and path", SearchFilter{PathPrefix: "/home/", Metadata: map[string]string{"author": "x"}}, nil},
+	}
+	for _, tt := range tests {
+		got := acceptedChunks(t, db, tt.filter)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: accepted %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if rf, _ := db.ResolveFilter(SearchFilter{}); rf != nil {
+		t.Error("an empty filter should resolve to nil")
+	}
+	if rf, _ := db.ResolveFilter(SearchFilter{Topics: []string{"nothing like it"}}); rf == nil || !rf.MatchesNone() {
+		t.Error("a filter matching no chunk should report MatchesNone")
+	}
+}
+
+func TestFilteredSearchKeepsLimit(t *testing.T) {
+	db := newTestDB(t)
+	seedFilterCorpus(t, db)
+	vs, err := NewVectorStore(db.DB(), 2)
+	if err != nil {
+		t.Fatalf("NewVectorStore: %v", err)
+	}
+	// The filtered-in vector is the furthest from the query
+	vs.AddVectors([]VectorRecord{
+		{ID: "report-1", Vector: []float32{0, 1}, Text: "r", AssetID: "report", AtomType: "text"},
+		{ID: "photo-1", Vector: []float32{1, 0}, Text: "p", AssetID: "photo", AtomType: "text"},
+		{ID: "notes-1", Vector: []float32{0.9, 0.1}, Text: "n", AssetID: "notes", AtomType: "text"},
+	})
+	rf, err := db.ResolveFilter(SearchFilter{Extensions: []string{"pdf"}})
+	if err != nil {
+		t.Fatalf("ResolveFilter: %v", err)
+	}
+	if results := vs.SearchFiltered([]float32{1, 0}, 1, rf.Accept); len(results) != 1 || results[0].ID != "report-1" {
+		t.Errorf("expected report-1 despite being furthest, got %+v", results)
+	}
+}
@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"database/sql"
+	"strings"
+	"unicode"
+)
+
+// chunkFTSDDL indexes chunk text for keyword search. The index reads its
+// text from chunks and shares their rowids; InsertChunk(s) and
+// DeleteChunksForAsset keep it in step.
+const chunkFTSDDL = `
+CREATE VIRTUAL TABLE chunks_fts USING fts5(
+    chunk_text,
+    content='chunks',
+    tokenize='unicode61 remove_diacritics 2'
+)`
+
+// TextMatch is a chunk matching a keyword query, with its BM25 score
+// (higher is better).
+type TextMatch struct {
+	VectorRecord
+	Score float64 `json:"score"`
+}
+
+// ensureChunkFTS creates the keyword index, indexing the chunks of
+// databases created before it existed.
+func ensureChunkFTS(db *sql.DB) error {
+	var n int
+	err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name='chunks_fts'").Scan(&n)
+	if err != nil || n > 0 {
+		return err
+	}
+	if _, err := db.Exec(chunkFTSDDL); err != nil {
+		return err
+	}
+	_, err = db.Exec("INSERT INTO chunks_fts(chunks_fts) VALUES('rebuild')")
+	return err
+}
+
+// Statements keeping chunks_fts in step with a chunk row. The delete
+// must run while the row still holds the text that was indexed.
+const (
+	unindexChunkSQL = `INSERT INTO chunks_fts(chunks_fts, rowid, chunk_text)
+		SELECT 'delete', rowid, chunk_text FROM chunks WHERE id=?`
+	indexChunkSQL = `INSERT INTO chunks_fts(rowid, chunk_text)
+		SELECT rowid, chunk_text FROM chunks WHERE id=?`
+	unindexAssetChunksSQL = `INSERT INTO chunks_fts(chunks_fts, rowid, chunk_text)
+		SELECT 'delete', rowid, chunk_text FROM chunks WHERE asset_id=?`
+)
+
+// ftsQuery turns free text into an FTS5 query matching any of its words.
+// Each word is quoted, so punctuation and FTS5 operators in the input are
+// taken literally: "E-1234" matches the phrase "e 1234".
+func ftsQuery(text string) string {
+	var terms []string
+	for _, word := range strings.Fields(text) {
+		if strings.IndexFunc(word, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }) < 0 {
+			continue
+		}
+		terms = append(terms, `"`+strings.ReplaceAll(word, `"`, `""`)+`"`)
+	}
+	return strings.Join(terms, " OR ")
+}
+
+// SearchChunkText returns up to limit chunks matching any word of query,
+// best BM25 score first. filter, if set, must accept a match.
+func (d *Database) SearchChunkText(query string, limit int, filter func(*VectorRecord) bool) ([]TextMatch, error) {
+	match := ftsQuery(query)
+	if match == "" || limit <= 0 {
+		return nil, nil
+	}
+	rows, err := d.db.Query(`
+		SELECT c.id, c.chunk_text, c.asset_id, COALESCE(a.path, ''), c.evidence_anchor,
+			COALESCE(c.pipeline_version, ''), COALESCE(c.language, ''), -bm25(chunks_fts)
+		FROM chunks_fts
+		JOIN chunks c ON c.rowid = chunks_fts.rowid
+		LEFT JOIN file_assets a ON a.id = c.asset_id
+		WHERE chunks_fts MATCH ?
+		ORDER BY bm25(chunks_fts)`, match)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var matches []TextMatch
+	for rows.Next() && len(matches) < limit {
+		m := TextMatch{VectorRecord: VectorRecord{AtomType: "text"}}
+		err := rows.Scan(&m.ID, &m.Text, &m.AssetID, &m.AssetPath, &m.EvidenceAnchor,
+			&m.PipelineVersion, &m.Language, &m.Score)
+		if err != nil {
+			return nil, err
+		}
+		if filter == nil || filter(&m.VectorRecord) {
+			matches = append(matches, m)
+		}
+	}
+	return matches, rows.Err()
+}
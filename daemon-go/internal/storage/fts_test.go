@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func insertTextChunks(t *testing.T, db *Database, assetID string, texts ...string) {
+	t.Helper()
+	db.UpsertFileAsset(NewFileAsset(assetID, "/docs/"+assetID+".txt", assetID+".txt"))
+	db.InsertContentAtom(NewContentAtom(assetID+"-atom", assetID, AtomText, 0, `{}`))
+	chunks := make([]Chunk, len(texts))
+	for i, text := range texts {
+		chunks[i] = NewChunk(assetID+"-"+string(rune('a'+i)), assetID+"-atom", assetID, text, 5, i, `{}`, "v1")
+	}
+	if err := db.InsertChunks(chunks); err != nil {
+		t.Fatalf("InsertChunks: %v", err)
+	}
+}
+
+func matchIDs(matches []TextMatch) []string {
+	ids := make([]string, len(matches))
+	for i, m := range matches {
+		ids[i] = m.ID
+	}
+	return ids
+}
+
+func TestSearchChunkText(t *testing.T) {
+	db := newTestDB(t)
+	insertTextChunks(t, db, "manual",
+		"The pump reports error E-4012 when the valve sticks.",
+		"Replace part number XK-77 every spring.",
+		"General maintenance notes about the pump and the valve.")
+	insertTextChunks(t, db, "memo", "Café budget meeting moved to Thursday.")
+
+	matches, err := db.SearchChunkText("E-4012", 10, nil)
+	if err != nil {
+		t.Fatalf("SearchChunkText: %v", err)
+	}
+	if len(matches) != 1 || matches[0].ID != "manual-a" || matches[0].AssetPath != "/docs/manual.txt" || matches[0].Score <= 0 {
+		t.Fatalf("expected manual-a for the error code, got %+v", matches)
+	}
+
+	// Any word matches; chunks with more of the rarer words rank first
+	matches, _ = db.SearchChunkText("valve sticks", 10, nil)
+	if ids := matchIDs(matches); len(ids) != 2 || ids[0] != "manual-a" {
+		t.Errorf("expected manual-a then manual-c, got %v", ids)
+	}
+
+	// Diacritics and FTS5 syntax in the query are harmless
+	if matches, _ := db.SearchChunkText("cafe", 10, nil); len(matches) != 1 || matches[0].ID != "memo-a" {
+		t.Errorf("expected memo-a for cafe, got %v", matchIDs(matches))
+	}
+	if _, err := db.SearchChunkText(`pump" OR NEAR(* -`, 10, nil); err != nil {
+		t.Errorf("query with FTS5 syntax: %v", err)
+	}
+
+	matches, _ = db.SearchChunkText("pump", 10, func(rec *VectorRecord) bool { return rec.ID != "manual-a" })
+	if ids := matchIDs(matches); len(ids) != 1 || ids[0] != "manual-c" {
+		t.Errorf("expected the filter to leave manual-c, got %v", ids)
+	}
+
+	// Replaced and deleted chunks leave the index
+	insertTextChunks(t, db, "manual", "The pump was replaced.")
+	if matches, _ := db.SearchChunkText("E-4012", 10, nil); len(matches) != 0 {
+		t.Errorf("expected the replaced text unindexed, got %v", matchIDs(matches))
+	}
+	if err := db.DeleteChunksForAsset("manual"); err != nil {
+		t.Fatalf("DeleteChunksForAsset: %v", err)
+	}
+	if matches, _ := db.SearchChunkText("pump XK-77", 10, nil); len(matches) != 0 {
+		t.Errorf("expected no matches after delete, got %v", matchIDs(matches))
+	}
+}
+
+func TestChunkFTSBackfill(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := NewDatabase(path)
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	if err := db.Initialize(); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	insertTextChunks(t, db, "notes", "Quarterly figures for the Oslo office.")
+
+	// A database from before the keyword index
+	if _, err := db.DB().Exec("DROP TABLE chunks_fts"); err != nil {
+		t.Fatalf("drop index: %v", err)
+	}
+	if err := db.Initialize(); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	defer db.Close()
+	if matches, _ := db.SearchChunkText("oslo", 10, nil); len(matches) != 1 {
+		t.Errorf("expected existing chunks indexed, got %v", matchIDs(matches))
+	}
+}
@@ -0,0 +1,528 @@
+package storage
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/rand"
+	"slices"
+	"sync"
+)
+
+// IndexParams tunes the approximate nearest-neighbour index.
+type IndexParams struct {
+	// M is the number of links per node on the upper layers (2*M on the
+	// bottom layer). Higher values raise recall and memory use. 0 disables
+	// the index.
+	M int `json:"m"`
+	// EfConstruction is the candidate list size while inserting.
+	EfConstruction int `json:"ef_construction"`
+	// EfSearch is the candidate list size while searching; raising it
+	// trades speed for recall. It is at least the requested limit.
+	EfSearch int `json:"ef_search"`
+	// ExactBelow is the collection size under which every vector is
+	// scored instead, which is both exact and fast enough.
+	ExactBelow int `json:"exact_below"`
+	// Quantization is QuantizeNone or QuantizeInt8, which stores a
+	// quarter of the bytes per vector at some cost in ranking accuracy.
+	Quantization string `json:"quantization"`
+	// Rescore is how many candidates per requested result a quantized
+	// search re-scores with the raw float32 vectors.
+	Rescore int `json:"rescore"`
+}
+
+func DefaultIndexParams() IndexParams {
+	return IndexParams{M: 16, EfConstruction: 200, EfSearch: 64, ExactBelow: 20000, Quantization: QuantizeNone, Rescore: 4}
+}
+
+// hnsw is a Hierarchical Navigable Small World graph (Malkov & Yashunin,
+// 2016) over the VectorStore's cache slots. Nodes are linked to their
+// nearest neighbours on a random number of layers; a search descends
+// greedily from the sparse top layer and explores the bottom layer with a
+// candidate list of ef nodes. Distances are 1 - cosine similarity on the
+// cache's normalized, possibly quantized, vectors.
+type hnsw struct {
+	m, efConstruction int
+	levelMult         float64
+	rng               *rand.Rand
+
+	nodes    []hnswNode // by cache slot
+	entry    int32      // -1 when empty
+	maxLevel int
+	count    int
+}
+
+// hnswNode holds a node's links per layer; nil when the slot is not in
+// the graph.
+type hnswNode struct {
+	links [][]int32
+}
+
+type candidate struct {
+	id   int32
+	dist float32
+}
+
+// nearestFirst and furthestFirst are candidate heaps.
+type nearestFirst []candidate
+
+func (h nearestFirst) Len() int           { return len(h) }
+func (h nearestFirst) Less(i, j int) bool { return h[i].dist < h[j].dist }
+func (h nearestFirst) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *nearestFirst) Push(x any)        { *h = append(*h, x.(candidate)) }
+func (h *nearestFirst) Pop() any {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
+
+type furthestFirst []candidate
+
+func (h furthestFirst) Len() int           { return len(h) }
+func (h furthestFirst) Less(i, j int) bool { return h[i].dist > h[j].dist }
+func (h furthestFirst) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *furthestFirst) Push(x any)        { *h = append(*h, x.(candidate)) }
+func (h *furthestFirst) Pop() any {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
+
+// sorted returns the heap's candidates nearest first.
+func (h furthestFirst) sorted() []candidate {
+	out := slices.Clone([]candidate(h))
+	slices.SortFunc(out, byDist)
+	return out
+}
+
+func newHNSW(m, efConstruction int) *hnsw {
+	return &hnsw{
+		m:              m,
+		efConstruction: efConstruction,
+		levelMult:      1 / math.Log(float64(max(m, 2))),
+		rng:            rand.New(rand.NewSource(1)),
+		entry:          -1,
+	}
+}
+
+func (h *hnsw) maxLinks(level int) int {
+	if level == 0 {
+		return 2 * h.m
+	}
+	return h.m
+}
+
+func (h *hnsw) contains(id int32) bool {
+	return int(id) < len(h.nodes) && h.nodes[id].links != nil
+}
+
+// onLevel reports whether id is in the graph down from level.
+func (h *hnsw) onLevel(id int32, level int) bool {
+	return int(id) < len(h.nodes) && len(h.nodes[id].links) > level
+}
+
+func vecDistance(a, b []float32) float32 {
+	return 1 - dotProduct(a, b)
+}
+
+// visitedSet marks nodes seen during one search. Sets are pooled and
+// cleared by bumping a generation counter.
+type visitedSet struct {
+	marks []uint32
+	gen   uint32
+}
+
+var visitedPool = sync.Pool{New: func() any { return &visitedSet{} }}
+
+func getVisited(n int) *visitedSet {
+	v := visitedPool.Get().(*visitedSet)
+	if len(v.marks) < n {
+		v.marks = make([]uint32, n+n/4)
+		v.gen = 0
+	}
+	v.gen++
+	if v.gen == 0 {
+		clear(v.marks)
+		v.gen = 1
+	}
+	return v
+}
+
+// visit marks id and reports whether it was already marked.
+func (v *visitedSet) visit(id int32) bool {
+	if v.marks[id] == v.gen {
+		return true
+	}
+	v.marks[id] = v.gen
+	return false
+}
+
+// descend walks greedily towards q from ep on the layers above level.
+func (h *hnsw) descend(vecs []cachedVec, q []float32, ep candidate, level int) candidate {
+	for l := h.maxLevel; l > level; l-- {
+		for changed := true; changed; {
+			changed = false
+			for _, n := range h.nodes[ep.id].links[l] {
+				if !h.onLevel(n, l) {
+					continue
+				}
+				if d := vecs[n].distance(q); d < ep.dist {
+					ep, changed = candidate{n, d}, true
+				}
+			}
+		}
+	}
+	return ep
+}
+
+// searchLayer returns up to ef nodes of one layer nearest to q, nearest
+// first, starting from entries. Nodes rejected by accept are traversed but
+// not returned.
+func (h *hnsw) searchLayer(vecs []cachedVec, q []float32, entries []candidate, ef, level int, accept func(int32) bool) []candidate {
+	visited := getVisited(len(h.nodes))
+	defer visitedPool.Put(visited)
+
+	cands := make(nearestFirst, 0, ef)
+	results := make(furthestFirst, 0, ef+1)
+	for _, e := range entries {
+		if visited.visit(e.id) {
+			continue
+		}
+		heap.Push(&cands, e)
+		if accept == nil || accept(e.id) {
+			heap.Push(&results, e)
+		}
+	}
+	for len(cands) > 0 {
+		c := heap.Pop(&cands).(candidate)
+		if len(results) >= ef && c.dist > results[0].dist {
+			break
+		}
+		for _, n := range h.nodes[c.id].links[level] {
+			if visited.visit(n) || !h.onLevel(n, level) {
+				continue
+			}
+			d := vecs[n].distance(q)
+			if len(results) >= ef && d >= results[0].dist {
+				continue
+			}
+			heap.Push(&cands, candidate{n, d})
+			if accept == nil || accept(n) {
+				heap.Push(&results, candidate{n, d})
+				if len(results) > ef {
+					heap.Pop(&results)
+				}
+			}
+		}
+	}
+	return results.sorted()
+}
+
+// selectNeighbors picks up to m of cands (nearest first) with the
+// heuristic of the paper: a candidate is skipped when it is closer to an
+// already selected neighbour than to the base node, which keeps links
+// spread in different directions.
+func (h *hnsw) selectNeighbors(vecs []cachedVec, cands []candidate, m int) []int32 {
+	out := make([]int32, 0, m)
+	for _, c := range cands {
+		keep := true
+		for _, s := range out {
+			if vecs[c.id].distanceTo(&vecs[s]) < c.dist {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			out = append(out, c.id)
+			if len(out) == m {
+				break
+			}
+		}
+	}
+	return out
+}
+
+func (h *hnsw) randomLevel() int {
+	return int(-math.Log(1-h.rng.Float64()) * h.levelMult)
+}
+
+// insert adds cache slot id to the graph.
+func (h *hnsw) insert(vecs []cachedVec, id int32) {
+	if h.contains(id) {
+		return
+	}
+	if int(id) >= len(h.nodes) {
+		h.nodes = append(h.nodes, make([]hnswNode, int(id)+1-len(h.nodes))...)
+	}
+	q := vecs[id].floats()
+	level := h.randomLevel()
+	h.nodes[id].links = make([][]int32, level+1)
+	h.count++
+	if h.entry < 0 {
+		h.entry, h.maxLevel = id, level
+		return
+	}
+
+	ep := h.descend(vecs, q, candidate{h.entry, vecs[h.entry].distance(q)}, level)
+	entries := []candidate{ep}
+	for l := min(level, h.maxLevel); l >= 0; l-- {
+		cands := h.searchLayer(vecs, q, entries, h.efConstruction, l, nil)
+		cands = slices.DeleteFunc(cands, func(c candidate) bool { return c.id == id })
+		neighbors := h.selectNeighbors(vecs, cands, h.m)
+		h.nodes[id].links[l] = neighbors
+		for _, n := range neighbors {
+			h.link(vecs, n, id, l)
+		}
+		if len(cands) > 0 {
+			entries = cands
+		}
+	}
+	if level > h.maxLevel {
+		h.entry, h.maxLevel = id, level
+	}
+}
+
+// link adds an edge from n to id on level, pruning n's links when full.
+func (h *hnsw) link(vecs []cachedVec, n, id int32, level int) {
+	links := append(h.nodes[n].links[level], id)
+	if len(links) > h.maxLinks(level) {
+		cands := make([]candidate, 0, len(links))
+		for _, l := range links {
+			if h.onLevel(l, level) { // drop stale links to removed nodes
+				cands = append(cands, candidate{l, vecs[n].distanceTo(&vecs[l])})
+			}
+		}
+		slices.SortFunc(cands, byDist)
+		links = h.selectNeighbors(vecs, cands, h.maxLinks(level))
+	}
+	h.nodes[n].links[level] = links
+}
+
+func byDist(a, b candidate) int {
+	switch {
+	case a.dist < b.dist:
+		return -1
+	case a.dist > b.dist:
+		return 1
+	}
+	return 0
+}
+
+// remove takes cache slot id out of the graph. Its neighbours drop their
+// links to it and are reconnected to its other neighbours. Nodes that
+// linked to it one-way keep a stale link, which searches skip.
+func (h *hnsw) remove(vecs []cachedVec, id int32) {
+	if !h.contains(id) {
+		return
+	}
+	old := h.nodes[id].links
+	h.nodes[id].links = nil
+	h.count--
+
+	for l, neighbors := range old {
+		for _, n := range neighbors {
+			if !h.onLevel(n, l) {
+				continue
+			}
+			seen := map[int32]bool{n: true, id: true}
+			var cands []candidate
+			for _, c := range append(slices.Clone(h.nodes[n].links[l]), neighbors...) {
+				if !seen[c] && h.onLevel(c, l) {
+					seen[c] = true
+					cands = append(cands, candidate{c, vecs[n].distanceTo(&vecs[c])})
+				}
+			}
+			slices.SortFunc(cands, byDist)
+			links := make([]int32, 0, min(len(cands), h.maxLinks(l)))
+			for _, c := range cands[:min(len(cands), h.maxLinks(l))] {
+				links = append(links, c.id)
+			}
+			h.nodes[n].links[l] = links
+		}
+	}
+
+	if h.entry == id {
+		h.resetEntry()
+	}
+}
+
+// resetEntry makes a node on the highest layer the entry point.
+func (h *hnsw) resetEntry() {
+	h.entry, h.maxLevel = -1, 0
+	for i, n := range h.nodes {
+		if n.links != nil && (h.entry < 0 || len(n.links)-1 > h.maxLevel) {
+			h.entry, h.maxLevel = int32(i), len(n.links)-1
+		}
+	}
+}
+
+// bytes estimates the memory held by the links.
+func (h *hnsw) bytes() int64 {
+	var n int64
+	for _, node := range h.nodes {
+		for _, level := range node.links {
+			n += int64(cap(level)) * 4
+		}
+	}
+	return n
+}
+
+// search returns the k nodes nearest to q accepted by accept.
+func (h *hnsw) search(vecs []cachedVec, q []float32, k, ef int, accept func(int32) bool) []candidate {
+	if h.entry < 0 || k <= 0 {
+		return nil
+	}
+	ep := h.descend(vecs, q, candidate{h.entry, vecs[h.entry].distance(q)}, 0)
+	results := h.searchLayer(vecs, q, []candidate{ep}, max(ef, k), 0, accept)
+	if len(results) > k {
+		results = results[:k]
+	}
+	return results
+}
+
+// -- Persistence --
+
+const hnswMagic = "KRHNSW01"
+
+// encode serializes the graph with nodes identified by chunk ID, so it can
+// be restored onto a cache loaded in a different order.
+func (h *hnsw) encode(vecs []cachedVec) []byte {
+	pos := make(map[int32]uint32, h.count)
+	var order []int32
+	for i, n := range h.nodes {
+		if n.links != nil {
+			pos[int32(i)] = uint32(len(order))
+			order = append(order, int32(i))
+		}
+	}
+	buf := []byte(hnswMagic)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(h.m))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(order)))
+	entry := uint32(math.MaxUint32)
+	if h.entry >= 0 {
+		entry = pos[h.entry]
+	}
+	buf = binary.LittleEndian.AppendUint32(buf, entry)
+	for _, id := range order {
+		buf = binary.LittleEndian.AppendUint16(buf, uint16(len(vecs[id].id)))
+		buf = append(buf, vecs[id].id...)
+		links := h.nodes[id].links
+		buf = append(buf, byte(len(links)))
+		for _, level := range links {
+			var kept []uint32
+			for _, n := range level {
+				if p, ok := pos[n]; ok {
+					kept = append(kept, p)
+				}
+			}
+			buf = binary.LittleEndian.AppendUint16(buf, uint16(len(kept)))
+			for _, p := range kept {
+				buf = binary.LittleEndian.AppendUint32(buf, p)
+			}
+		}
+	}
+	return buf
+}
+
+var errBadIndex = errors.New("invalid vector index snapshot")
+
+// decodeHNSW restores a graph onto the cache slots given by slotOf. Nodes
+// whose chunk is gone are dropped with their links. It fails when the
+// snapshot was built with a different M.
+func decodeHNSW(data []byte, m, efConstruction int, slotOf map[string]int32, slots int) (*hnsw, error) {
+	r := snapshotReader{data: data}
+	if string(r.bytes(len(hnswMagic))) != hnswMagic {
+		return nil, errBadIndex
+	}
+	if int(r.uint32()) != m {
+		return nil, errors.New("vector index built with different M")
+	}
+	n := int(r.uint32())
+	entry := r.uint32()
+
+	h := newHNSW(m, efConstruction)
+	h.nodes = make([]hnswNode, slots)
+	slotAt := make([]int32, n)
+	levels := make([][][]uint32, n)
+	for i := 0; i < n && r.err == nil; i++ {
+		id := string(r.bytes(int(r.uint16())))
+		links := make([][]uint32, r.byte())
+		for l := range links {
+			links[l] = make([]uint32, r.uint16())
+			for j := range links[l] {
+				links[l][j] = r.uint32()
+			}
+		}
+		slot, ok := slotOf[id]
+		if !ok {
+			slot = -1
+		}
+		slotAt[i], levels[i] = slot, links
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	for i, links := range levels {
+		slot := slotAt[i]
+		if slot < 0 || len(links) == 0 {
+			continue
+		}
+		node := make([][]int32, len(links))
+		for l, level := range links {
+			node[l] = make([]int32, 0, len(level))
+			for _, p := range level {
+				if int(p) < n && slotAt[p] >= 0 {
+					node[l] = append(node[l], slotAt[p])
+				}
+			}
+		}
+		h.nodes[slot].links = node
+		h.count++
+	}
+	if entry < uint32(n) && slotAt[entry] >= 0 {
+		h.entry, h.maxLevel = slotAt[entry], len(h.nodes[slotAt[entry]].links)-1
+	} else {
+		h.resetEntry()
+	}
+	return h, nil
+}
+
+type snapshotReader struct {
+	data []byte
+	err  error
+}
+
+func (r *snapshotReader) bytes(n int) []byte {
+	if r.err != nil || n > len(r.data) {
+		r.err = errBadIndex
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *snapshotReader) byte() byte {
+	if b := r.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *snapshotReader) uint16() uint16 {
+	if b := r.bytes(2); b != nil {
+		return binary.LittleEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *snapshotReader) uint32() uint32 {
+	if b := r.bytes(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
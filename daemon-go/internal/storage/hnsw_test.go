@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"testing"
+)
+
+func randomRecords(n, dim int, seed int64) []VectorRecord {
+	rng := rand.New(rand.NewSource(seed))
+	records := make([]VectorRecord, n)
+	for i := range records {
+		vec := make([]float32, dim)
+		for j := range vec {
+			vec[j] = float32(rng.NormFloat64())
+		}
+		records[i] = VectorRecord{
+			ID: fmt.Sprintf("v%d", i), Vector: vec, Text: "t",
+			AssetID: fmt.Sprintf("a%d", i%10), AssetPath: "/a", AtomType: "text",
+		}
+	}
+	return records
+}
+
+func newIndexedStore(t *testing.T, path string) *VectorStore {
+	t.Helper()
+	db, err := NewDatabase(path)
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	vs, err := NewVectorStore(db.DB(), 16)
+	if err != nil {
+		t.Fatalf("NewVectorStore: %v", err)
+	}
+	vs.SetIndexParams(IndexParams{M: 8, EfConstruction: 64, EfSearch: 32, ExactBelow: 0})
+	if err := vs.LoadAll(); err != nil {
+		t.Fatalf("LoadAll: %v", err)
+	}
+	return vs
+}
+
+func TestHNSWRecall(t *testing.T) {
+	vs := newIndexedStore(t, filepath.Join(t.TempDir(), "test.db"))
+	if err := vs.AddVectors(randomRecords(1500, 16, 1)); err != nil {
+		t.Fatalf("AddVectors: %v", err)
+	}
+
+	report := vs.MeasureRecall(100, 10, 0)
+	if !report.UsingIndex || report.Indexed != 1500 || report.Samples != 100 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if report.Recall < 0.9 {
+		t.Errorf("recall@10 = %.3f, want >= 0.9", report.Recall)
+	}
+
+	// Deleted vectors leave the graph and the rest stay reachable
+	if err := vs.DeleteByAsset("a3"); err != nil {
+		t.Fatalf("DeleteByAsset: %v", err)
+	}
+	if vs.Count() != 1350 || vs.index.count != 1350 {
+		t.Fatalf("expected 1350 vectors and nodes, got %d and %d", vs.Count(), vs.index.count)
+	}
+	for _, rec := range randomRecords(20, 16, 2) {
+		for _, res := range vs.Search(rec.Vector, 10) {
+			if res.AssetID == "a3" {
+				t.Fatalf("deleted vector %s returned", res.ID)
+			}
+		}
+	}
+	if report := vs.MeasureRecall(100, 10, 0); report.Recall < 0.9 {
+		t.Errorf("recall@10 after delete = %.3f", report.Recall)
+	}
+
+	// Freed slots are reused by new vectors
+	vs.AddVectors(randomRecords(1600, 16, 3)[1500:])
+	if len(vs.cache) != 1500 || vs.Count() != 1450 {
+		t.Errorf("expected reused slots, cache %d count %d", len(vs.cache), vs.Count())
+	}
+}
+
+func TestHNSWFilteredSearch(t *testing.T) {
+	vs := newIndexedStore(t, filepath.Join(t.TempDir(), "test.db"))
+	records := randomRecords(600, 16, 4)
+	vs.AddVectors(records)
+
+	// Only 6 of 600 vectors match: the graph search falls short and the
+	// exact search returns all of them.
+	filter := func(rec *VectorRecord) bool { return rec.ID[len(rec.ID)-2:] == "00" || rec.ID == "v0" }
+	res := vs.SearchFiltered(records[0].Vector, 10, filter)
+	if len(res) != 6 || res[0].ID != "v0" {
+		t.Errorf("expected the 6 matching vectors with v0 first, got %d", len(res))
+	}
+}
+
+func TestHNSWPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	vs1 := newIndexedStore(t, path)
+	records := randomRecords(400, 16, 5)
+	vs1.AddVectors(records)
+	if err := vs1.SaveIndex(); err != nil {
+		t.Fatalf("SaveIndex: %v", err)
+	}
+	if vs1.indexDirty {
+		t.Error("expected index saved")
+	}
+	// Changes after the snapshot are caught up on load
+	vs1.DeleteByAsset("a1")
+	vs1.AddVectors(randomRecords(410, 16, 6)[400:])
+
+	vs2 := newIndexedStore(t, path)
+	vs2.indexing.Wait()
+	if vs2.Count() != 370 || vs2.index.count != 370 {
+		t.Fatalf("expected 370 vectors and nodes, got %d and %d", vs2.Count(), vs2.index.count)
+	}
+	restored := 0
+	for _, rec := range records[:50] {
+		if slot, ok := vs2.byID[rec.ID]; ok && len(vs2.index.nodes[slot].links[0]) > 0 {
+			restored++
+		}
+	}
+	if restored != 45 {
+		t.Errorf("expected 45 restored nodes with links, got %d", restored)
+	}
+	if report := vs2.MeasureRecall(50, 10, 0); report.Recall < 0.9 {
+		t.Errorf("recall@10 after reload = %.3f", report.Recall)
+	}
+}
@@ -2,6 +2,9 @@ package storage
 
 import (
 	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
 	"time"
 )
 
@@ -53,10 +56,14 @@ type EvidenceAnchor struct {
 	Page         *int      `json:"page,omitempty"`
 	Bbox         []float64 `json:"bbox,omitempty"`
 	Chapter      *string   `json:"chapter,omitempty"`
-	Offset       *int      `json:"offset,omitempty"`
+	Offset       *int      `json:"offset,omitempty"` // chunk start within the atom's text, in characters
+	Length       *int      `json:"length,omitempty"` // chunk length in characters
 	ArchiveChain *string   `json:"archive_chain,omitempty"`
 	LineStart    *int      `json:"line_start,omitempty"`
 	LineEnd      *int      `json:"line_end,omitempty"`
+	CellIndex    *int      `json:"cell_index,omitempty"` // notebook cell, 0-based
+	TimeStart    *float64  `json:"time_start,omitempty"` // seconds from the start of the media
+	TimeEnd      *float64  `json:"time_end,omitempty"`
 }
 
 func (ea EvidenceAnchor) ToJSON() string {
@@ -64,6 +71,72 @@ func (ea EvidenceAnchor) ToJSON() string {
 	return string(b)
 }
 
+// Describe renders the anchor's location for display, e.g.
+// "page 5, lines 42-58" or "00:01:05.000-00:01:40.500".
+func (ea EvidenceAnchor) Describe() string {
+	var parts []string
+	if ea.ArchiveChain != nil {
+		parts = append(parts, *ea.ArchiveChain)
+	}
+	if ea.Chapter != nil {
+		parts = append(parts, *ea.Chapter)
+	}
+	if ea.Page != nil {
+		parts = append(parts, fmt.Sprintf("page %d", *ea.Page))
+	}
+	if ea.CellIndex != nil {
+		parts = append(parts, fmt.Sprintf("cell %d", *ea.CellIndex+1))
+	}
+	switch {
+	case ea.LineStart != nil && ea.LineEnd != nil && *ea.LineEnd != *ea.LineStart:
+		parts = append(parts, fmt.Sprintf("lines %d-%d", *ea.LineStart, *ea.LineEnd))
+	case ea.LineStart != nil:
+		parts = append(parts, fmt.Sprintf("line %d", *ea.LineStart))
+	}
+	if ea.TimeStart != nil {
+		t := FormatTimestamp(*ea.TimeStart)
+		if ea.TimeEnd != nil {
+			t += "-" + FormatTimestamp(*ea.TimeEnd)
+		}
+		parts = append(parts, t)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Union returns the anchor covering both ea and o, two spans of the same
+// atom: the character, line and time ranges widened to include both.
+func (ea EvidenceAnchor) Union(o EvidenceAnchor) EvidenceAnchor {
+	u := ea
+	if ea.Offset != nil && ea.Length != nil && o.Offset != nil && o.Length != nil {
+		start := min(*ea.Offset, *o.Offset)
+		length := max(*ea.Offset+*ea.Length, *o.Offset+*o.Length) - start
+		u.Offset, u.Length = &start, &length
+	}
+	if u.LineStart != nil && o.LineStart != nil {
+		v := min(*u.LineStart, *o.LineStart)
+		u.LineStart = &v
+	}
+	if u.LineEnd != nil && o.LineEnd != nil {
+		v := max(*u.LineEnd, *o.LineEnd)
+		u.LineEnd = &v
+	}
+	if u.TimeStart != nil && o.TimeStart != nil {
+		v := min(*u.TimeStart, *o.TimeStart)
+		u.TimeStart = &v
+	}
+	if u.TimeEnd != nil && o.TimeEnd != nil {
+		v := max(*u.TimeEnd, *o.TimeEnd)
+		u.TimeEnd = &v
+	}
+	return u
+}
+
+// FormatTimestamp formats seconds as HH:MM:SS.mmm.
+func FormatTimestamp(seconds float64) string {
+	ms := int64(math.Round(seconds * 1000))
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
 func ParseEvidenceAnchor(s string) (EvidenceAnchor, error) {
 	var ea EvidenceAnchor
 	err := json.Unmarshal([]byte(s), &ea)
@@ -136,6 +209,13 @@ type Chunk struct {
 	EmbeddingID     *string `json:"embedding_id,omitempty"`
 	PipelineVersion string  `json:"pipeline_version"`
 	CreatedAt       string  `json:"created_at"`
+	Language        *string `json:"language,omitempty"` // ISO 639-1 code of the source atom
+	// ParentID links a child chunk to the larger section it was cut from.
+	// ParentStart/ParentEnd locate the child in the parent's text, in
+	// characters (Unicode code points).
+	ParentID    *string `json:"parent_id,omitempty"`
+	ParentStart *int    `json:"parent_start,omitempty"`
+	ParentEnd   *int    `json:"parent_end,omitempty"`
 }
 
 func NewChunk(id, atomID, assetID, text string, tokenCount, chunkIndex int, anchor, pipelineVersion string) Chunk {
@@ -152,6 +232,34 @@ func NewChunk(id, atomID, assetID, text string, tokenCount, chunkIndex int, anch
 	}
 }
 
+// ParentChunk is a section of an atom, larger than the chunks embedded for
+// search, returned as display and answer context for its child chunks.
+type ParentChunk struct {
+	ID              string `json:"id"`
+	AtomID          string `json:"atom_id"`
+	AssetID         string `json:"asset_id"`
+	ChunkText       string `json:"chunk_text"`
+	TokenCount      int    `json:"token_count"`
+	ChunkIndex      int    `json:"chunk_index"`
+	EvidenceAnchor  string `json:"evidence_anchor"`
+	PipelineVersion string `json:"pipeline_version"`
+	CreatedAt       string `json:"created_at"`
+}
+
+// SuppressedText is a line of an atom left out of chunking as boilerplate.
+// Start and End are character offsets within the atom's text, which keeps
+// the line for evidence display.
+type SuppressedText struct {
+	AtomID      string `json:"atom_id"`
+	AssetID     string `json:"asset_id"`
+	Start       int    `json:"start"`
+	End         int    `json:"end"`
+	Text        string `json:"text"`
+	Reason      string `json:"reason"`      // "repeated_in_asset" or "repeated_in_volume"
+	Occurrences int    `json:"occurrences"` // atoms or assets the line appears in
+	CreatedAt   string `json:"created_at"`
+}
+
 // Annotation represents an LLM-generated analysis of a chunk.
 type Annotation struct {
 	ID                  string   `json:"id"`
@@ -213,6 +321,9 @@ type WatchedVolume struct {
 	Label      *string `json:"label,omitempty"`
 	AddedAt    string  `json:"added_at"`
 	LastScanAt *string `json:"last_scan_at,omitempty"`
+	// ChunkStrategy overrides the configured chunking strategy for files
+	// under this volume; nil means use the configuration.
+	ChunkStrategy *string `json:"chunk_strategy,omitempty"`
 }
 
 func NewWatchedVolume(id, path string, label *string) WatchedVolume {
@@ -0,0 +1,350 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+)
+
+// Namespace statuses. One namespace is active and searched; another may be
+// building while the corpus is re-embedded with a new model.
+const (
+	NamespaceActive   = "active"
+	NamespaceBuilding = "building"
+)
+
+// ErrVectorsMissing is returned by Activate while records of the active
+// namespace have no vector in the namespace being activated yet.
+var ErrVectorsMissing = errors.New("vectors missing from the namespace being activated")
+
+// Namespace describes the vectors stored for one embedding model.
+type Namespace struct {
+	Model       string  `json:"model"`
+	Dimension   int     `json:"dimension"`
+	Status      string  `json:"status"`
+	Vectors     int     `json:"vectors"`
+	CreatedAt   string  `json:"created_at"`
+	ActivatedAt *string `json:"activated_at"`
+}
+
+// migrateVectorNamespaces keys chunk_vectors by (id, model) in databases
+// created before vectors recorded their model, and registers the existing
+// vectors as the active, unnamed namespace.
+func migrateVectorNamespaces(db *sql.DB) error {
+	hasModel := false
+	rows, err := db.Query("SELECT name FROM pragma_table_info('chunk_vectors')")
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		hasModel = hasModel || name == "model"
+	}
+	rows.Close()
+
+	if !hasModel {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		for _, stmt := range []string{
+			"ALTER TABLE chunk_vectors RENAME TO chunk_vectors_legacy",
+			"DROP INDEX IF EXISTS idx_chunk_vectors_asset",
+			vectorTableDDL,
+			`INSERT INTO chunk_vectors (id, model, dimension, vector, text, asset_id, asset_path,
+				evidence_anchor, topics, atom_type, pipeline_version, language)
+			SELECT id, '', length(vector)/4, vector, text, asset_id, asset_path,
+				evidence_anchor, topics, atom_type, pipeline_version, language FROM chunk_vectors_legacy`,
+			"DROP TABLE chunk_vectors_legacy",
+		} {
+			if _, err := tx.Exec(stmt); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		slog.Info("Migrated chunk_vectors to per-model namespaces")
+	}
+	if _, err := db.Exec("CREATE INDEX IF NOT EXISTS idx_chunk_vectors_model ON chunk_vectors(model)"); err != nil {
+		return err
+	}
+
+	var active int
+	if err := db.QueryRow("SELECT COUNT(*) FROM vector_namespaces WHERE status=?", NamespaceActive).Scan(&active); err != nil {
+		return err
+	}
+	if active > 0 {
+		return nil
+	}
+	now := nowISO()
+	_, err = db.Exec(`INSERT OR REPLACE INTO vector_namespaces (model, dimension, status, created_at, activated_at)
+		SELECT '', COALESCE(MAX(dimension), 0), ?, ?, ? FROM chunk_vectors WHERE model=''`,
+		NamespaceActive, now, now)
+	return err
+}
+
+// activeNamespace returns the model whose vectors are searched.
+func activeNamespace(db *sql.DB) (string, error) {
+	var model string
+	err := db.QueryRow("SELECT model FROM vector_namespaces WHERE status=? ORDER BY activated_at DESC LIMIT 1",
+		NamespaceActive).Scan(&model)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return model, err
+}
+
+// namespaceStats returns the number and dimension of a model's vectors.
+func (vs *VectorStore) namespaceStats(model string) (count, dim int, err error) {
+	err = vs.db.QueryRow("SELECT COUNT(*), COALESCE(MAX(dimension), 0) FROM chunk_vectors WHERE model=?",
+		model).Scan(&count, &dim)
+	return count, dim, err
+}
+
+// Model returns the active namespace's embedding model; "" for vectors
+// stored before models were recorded.
+func (vs *VectorStore) Model() string {
+	vs.mu.RLock()
+	defer vs.mu.RUnlock()
+	return vs.model
+}
+
+// Adopt makes model the active namespace when that needs no re-embedding:
+// the active namespace is empty, or it is the unnamed legacy namespace
+// with vectors of the same dimension, which are then assumed to come from
+// model and tagged with it. It reports whether model is active.
+func (vs *VectorStore) Adopt(model string, dim int) (bool, error) {
+	active := vs.Model()
+	if model == active {
+		return true, nil
+	}
+	count, activeDim, err := vs.namespaceStats(active)
+	if err != nil {
+		return false, err
+	}
+	if count == 0 {
+		vs.SetDimension(dim)
+		return true, vs.Activate(model)
+	}
+	if active != "" || activeDim != dim {
+		return false, nil
+	}
+	if n, _, err := vs.namespaceStats(model); err != nil || n > 0 {
+		return false, err // partly re-embedded already; let the re-embed finish
+	}
+
+	tx, err := vs.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	now := nowISO()
+	for _, q := range []struct {
+		stmt string
+		args []any
+	}{
+		{"UPDATE chunk_vectors SET model=? WHERE model=?", []any{model, active}},
+		{"DELETE FROM vector_namespaces WHERE model=?", []any{active}},
+		{`INSERT OR REPLACE INTO vector_namespaces (model, dimension, status, created_at, activated_at)
+			VALUES (?, ?, ?, ?, ?)`, []any{model, dim, NamespaceActive, now, now}},
+		{"DELETE FROM vector_index WHERE name=?", []any{indexName(model)}},
+		{"UPDATE vector_index SET name=? WHERE name=?", []any{indexName(model), indexName(active)}},
+	} {
+		if _, err := tx.Exec(q.stmt, q.args...); err != nil {
+			tx.Rollback()
+			return false, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+
+	vs.mu.Lock()
+	vs.model = model
+	for i := range vs.cache {
+		if vs.cache[i].id != "" {
+			vs.cache[i].rec.Model = model
+		}
+	}
+	vs.mu.Unlock()
+	slog.Info("Tagged existing vectors with embedding model", "model", model, "count", count)
+	return true, nil
+}
+
+// BeginNamespace registers model as a namespace being built, so vectors can
+// be added to it while the active namespace keeps serving searches.
+func (vs *VectorStore) BeginNamespace(model string, dim int) error {
+	_, err := vs.db.Exec(`INSERT INTO vector_namespaces (model, dimension, status, created_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(model) DO UPDATE SET dimension=excluded.dimension`,
+		model, dim, NamespaceBuilding, nowISO())
+	return err
+}
+
+// MissingVectors returns up to limit records of the active namespace that
+// have no vector for model yet, without their vectors.
+func (vs *VectorStore) MissingVectors(model string, limit int) ([]VectorRecord, error) {
+	rows, err := vs.db.Query(`SELECT a.id, a.text, a.asset_id, a.asset_path, a.evidence_anchor, a.topics,
+			a.atom_type, a.pipeline_version, COALESCE(a.language, '')
+		FROM chunk_vectors a
+		WHERE a.model=? AND NOT EXISTS (SELECT 1 FROM chunk_vectors b WHERE b.id=a.id AND b.model=?)
+		LIMIT ?`, vs.Model(), model, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []VectorRecord
+	for rows.Next() {
+		var rec VectorRecord
+		err := rows.Scan(&rec.ID, &rec.Text, &rec.AssetID, &rec.AssetPath, &rec.EvidenceAnchor,
+			&rec.Topics, &rec.AtomType, &rec.PipelineVersion, &rec.Language)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, rec)
+	}
+	return records, rows.Err()
+}
+
+// countMissing returns how many records of namespace from have no vector
+// for model.
+func (vs *VectorStore) countMissing(from, model string) (int, error) {
+	var n int
+	err := vs.db.QueryRow(`SELECT COUNT(*) FROM chunk_vectors a
+		WHERE a.model=? AND NOT EXISTS (SELECT 1 FROM chunk_vectors b WHERE b.id=a.id AND b.model=?)`,
+		from, model).Scan(&n)
+	return n, err
+}
+
+// Activate switches searches to model's namespace. Its vectors are loaded
+// and indexed while the current namespace keeps serving; afterwards the
+// previous namespace's vectors and index are deleted, and vectors can no
+// longer be added to it. If vectors were added to the current namespace
+// that model has none for, nothing is switched and ErrVectorsMissing is
+// returned, so they can be re-embedded first.
+func (vs *VectorStore) Activate(model string) error {
+	vs.mu.Lock()
+	if model == vs.model {
+		vs.mu.Unlock()
+		return nil
+	}
+	if vs.activating != nil {
+		other := *vs.activating
+		vs.mu.Unlock()
+		return fmt.Errorf("namespace %q is already being activated", other)
+	}
+	vs.activating = &model
+	vs.activatingAdds, vs.activatingDeletes = nil, nil
+	params := vs.params
+	vs.mu.Unlock()
+
+	cache, byID, dim, err := vs.readNamespace(model, params.Quantization)
+	if err != nil {
+		vs.mu.Lock()
+		vs.activating = nil
+		vs.mu.Unlock()
+		return err
+	}
+	var index *hnsw
+	if params.M > 0 {
+		index = vs.readIndex(model, params, byID, len(cache))
+		for _, slot := range byID {
+			if !index.contains(slot) {
+				index.insert(cache, slot)
+			}
+		}
+	}
+
+	vs.mu.Lock()
+	previous := vs.model
+	// Adds take the lock, so none can slip in between this check and the
+	// switch.
+	missing, err := vs.countMissing(previous, model)
+	if err == nil && missing > 0 {
+		err = fmt.Errorf("%w: %d records", ErrVectorsMissing, missing)
+	}
+	if err != nil {
+		vs.activating, vs.activatingAdds, vs.activatingDeletes = nil, nil, nil
+		vs.mu.Unlock()
+		return err
+	}
+	if vs.retired == nil {
+		vs.retired = make(map[string]bool)
+	}
+	vs.retired[previous] = true
+	delete(vs.retired, model)
+	vs.model = model
+	vs.cache, vs.byID, vs.free = cache, byID, nil
+	vs.index, vs.indexDirty = index, index != nil
+	if dim > 0 {
+		vs.dimension = dim
+	}
+	for _, rec := range vs.activatingAdds {
+		vs.put(rec)
+	}
+	for _, assetID := range vs.activatingDeletes {
+		vs.removeAsset(assetID)
+	}
+	vs.activating, vs.activatingAdds, vs.activatingDeletes = nil, nil, nil
+	dim = vs.dimension
+	count := len(vs.byID)
+	vs.mu.Unlock()
+
+	tx, err := vs.db.Begin()
+	if err != nil {
+		return err
+	}
+	now := nowISO()
+	for _, q := range []struct {
+		stmt string
+		args []any
+	}{
+		{"DELETE FROM chunk_vectors WHERE model=?", []any{previous}},
+		{"DELETE FROM vector_index WHERE name=?", []any{indexName(previous)}},
+		{"DELETE FROM vector_namespaces WHERE model=?", []any{previous}},
+		{`INSERT INTO vector_namespaces (model, dimension, status, created_at, activated_at)
+			VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT(model) DO UPDATE SET dimension=excluded.dimension, status=excluded.status,
+				activated_at=excluded.activated_at`, []any{model, dim, NamespaceActive, now, now}},
+	} {
+		if _, err := tx.Exec(q.stmt, q.args...); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	slog.Info("Activated embedding namespace", "model", model, "previous", previous, "vectors", count, "dim", dim)
+	return vs.SaveIndex()
+}
+
+// Namespaces lists the stored namespaces with their vector counts.
+func (vs *VectorStore) Namespaces() ([]Namespace, error) {
+	rows, err := vs.db.Query(`SELECT n.model, n.dimension, n.status, n.created_at, n.activated_at,
+			(SELECT COUNT(*) FROM chunk_vectors c WHERE c.model=n.model)
+		FROM vector_namespaces n ORDER BY n.status, n.model`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Namespace
+	for rows.Next() {
+		var ns Namespace
+		var created sql.NullString
+		if err := rows.Scan(&ns.Model, &ns.Dimension, &ns.Status, &created, &ns.ActivatedAt, &ns.Vectors); err != nil {
+			return nil, err
+		}
+		ns.CreatedAt = created.String
+		out = append(out, ns)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestLegacyVectorsAdopted(t *testing.T) {
+	db, err := NewDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	defer db.Close()
+
+	// chunk_vectors as created before vectors recorded their model
+	_, err = db.DB().Exec(`
+		CREATE TABLE chunk_vectors (
+			id TEXT PRIMARY KEY, vector BLOB NOT NULL, text TEXT NOT NULL,
+			asset_id TEXT NOT NULL, asset_path TEXT NOT NULL, evidence_anchor TEXT,
+			topics TEXT, atom_type TEXT, pipeline_version TEXT
+		);
+		CREATE INDEX idx_chunk_vectors_asset ON chunk_vectors(asset_id);`)
+	if err != nil {
+		t.Fatalf("create legacy table: %v", err)
+	}
+	for _, rec := range randomRecords(3, 16, 1) {
+		_, err := db.DB().Exec(`INSERT INTO chunk_vectors VALUES (?, ?, ?, ?, ?, '', '', 'text', '1')`,
+			rec.ID, float32ToBlob(rec.Vector), rec.Text, rec.AssetID, rec.AssetPath)
+		if err != nil {
+			t.Fatalf("insert legacy row: %v", err)
+		}
+	}
+
+	vs, err := NewVectorStore(db.DB(), 768)
+	if err != nil {
+		t.Fatalf("NewVectorStore: %v", err)
+	}
+	if err := vs.LoadAll(); err != nil {
+		t.Fatalf("LoadAll: %v", err)
+	}
+	if vs.Model() != "" || vs.Count() != 3 || vs.Dimension() != 16 {
+		t.Fatalf("expected 3 legacy vectors of 16 dims, got model %q count %d dim %d", vs.Model(), vs.Count(), vs.Dimension())
+	}
+
+	// Another dimension cannot have produced them
+	if ok, err := vs.Adopt("small-embed", 8); err != nil || ok {
+		t.Fatalf("Adopt with other dimension = %v, %v", ok, err)
+	}
+	if ok, err := vs.Adopt("nomic-embed", 16); err != nil || !ok {
+		t.Fatalf("Adopt = %v, %v", ok, err)
+	}
+	if vs.Model() != "nomic-embed" {
+		t.Errorf("expected nomic-embed active, got %q", vs.Model())
+	}
+	namespaces, err := vs.Namespaces()
+	if err != nil {
+		t.Fatalf("Namespaces: %v", err)
+	}
+	if len(namespaces) != 1 || namespaces[0].Model != "nomic-embed" || namespaces[0].Vectors != 3 ||
+		namespaces[0].Status != NamespaceActive || namespaces[0].Dimension != 16 {
+		t.Errorf("unexpected namespaces %+v", namespaces)
+	}
+	if results := vs.Search(randomRecords(1, 16, 1)[0].Vector, 3); len(results) != 3 {
+		t.Errorf("expected 3 results after adopting, got %d", len(results))
+	}
+}
+
+func TestNamespaceSwitch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	vs := newIndexedStore(t, path)
+	if ok, err := vs.Adopt("model-a", 16); err != nil || !ok {
+		t.Fatalf("Adopt on empty store = %v, %v", ok, err)
+	}
+	old := randomRecords(40, 16, 1)
+	for i := range old {
+		old[i].Model = "model-a"
+	}
+	if err := vs.AddVectors(old); err != nil {
+		t.Fatalf("AddVectors: %v", err)
+	}
+
+	// Vectors of a model being built are stored but not searched
+	if err := vs.BeginNamespace("model-b", 8); err != nil {
+		t.Fatalf("BeginNamespace: %v", err)
+	}
+	next := randomRecords(40, 8, 2)
+	for i := range next {
+		next[i].Model = "model-b"
+	}
+	if err := vs.AddVectors(next[:25]); err != nil {
+		t.Fatalf("AddVectors: %v", err)
+	}
+	if vs.Count() != 40 || vs.Dimension() != 16 {
+		t.Fatalf("expected the active namespace unchanged, count %d dim %d", vs.Count(), vs.Dimension())
+	}
+	if results := vs.Search(old[0].Vector, 1); len(results) != 1 || results[0].ID != old[0].ID {
+		t.Fatalf("expected %s from the active namespace, got %+v", old[0].ID, results)
+	}
+	missing, err := vs.MissingVectors("model-b", 100)
+	if err != nil {
+		t.Fatalf("MissingVectors: %v", err)
+	}
+	if len(missing) != 15 || missing[0].Text != "t" {
+		t.Fatalf("expected 15 missing records with text, got %d", len(missing))
+	}
+
+	// Nothing switches while records lack a vector in the new namespace
+	if err := vs.Activate("model-b"); !errors.Is(err, ErrVectorsMissing) {
+		t.Fatalf("expected ErrVectorsMissing, got %v", err)
+	}
+	if vs.Model() != "model-a" || vs.Count() != 40 {
+		t.Fatalf("expected model-a still active, got %q with %d vectors", vs.Model(), vs.Count())
+	}
+
+	if err := vs.AddVectors(next[25:]); err != nil {
+		t.Fatalf("AddVectors: %v", err)
+	}
+	if err := vs.Activate("model-b"); err != nil {
+		t.Fatalf("Activate: %v", err)
+	}
+	if err := vs.AddVectors(old[:1]); err == nil {
+		t.Error("expected adding to the replaced namespace to fail")
+	}
+	if vs.Model() != "model-b" || vs.Count() != 40 || vs.Dimension() != 8 {
+		t.Fatalf("expected model-b active with 40 vectors of 8 dims, got %q %d %d", vs.Model(), vs.Count(), vs.Dimension())
+	}
+	if results := vs.Search(next[7].Vector, 1); len(results) != 1 || results[0].ID != next[7].ID || results[0].Text != "t" {
+		t.Fatalf("expected %s after cutover, got %+v", next[7].ID, results)
+	}
+	if n, _, _ := vs.namespaceStats("model-a"); n != 0 {
+		t.Errorf("expected model-a vectors deleted, %d left", n)
+	}
+	if _, vectors, _ := vs.GetAllVectors(); len(vectors) != 40 || len(vectors[0]) != 8 {
+		t.Errorf("expected 40 vectors of 8 dims, got %d", len(vectors))
+	}
+
+	// The cutover survives a restart
+	reopened := newIndexedStore(t, path)
+	if reopened.Model() != "model-b" || reopened.Count() != 40 {
+		t.Errorf("expected model-b after reload, got %q with %d vectors", reopened.Model(), reopened.Count())
+	}
+}
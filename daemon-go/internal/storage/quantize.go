@@ -0,0 +1,90 @@
+package storage
+
+import "math"
+
+// Quantization modes for the in-memory vectors.
+const (
+	QuantizeNone = "none" // float32, 4 bytes per dimension
+	QuantizeInt8 = "int8" // scalar quantization, 1 byte per dimension
+)
+
+// cachedVec is the in-memory form of a stored vector: the normalized
+// vector, as float32 or int8 codes, and the record's metadata for filters.
+// The raw vector and the chunk text stay in SQLite.
+type cachedVec struct {
+	id     string
+	vector []float32 // normalized; nil when quantized
+	codes  []int8    // codes[i]*scale approximates the normalized component
+	scale  float32
+	rec    VectorRecord // without Vector and Text
+}
+
+func newCachedVec(rec VectorRecord, quantization string) cachedVec {
+	normalized := normalize(rec.Vector)
+	rec.Vector, rec.Text = nil, ""
+	cv := cachedVec{id: rec.ID, rec: rec}
+	cv.setVector(normalized, quantization)
+	return cv
+}
+
+// setVector stores a normalized vector. int8 codes use a per-vector scale
+// so the largest component maps to ±127.
+func (cv *cachedVec) setVector(v []float32, quantization string) {
+	if quantization != QuantizeInt8 {
+		cv.vector, cv.codes, cv.scale = v, nil, 0
+		return
+	}
+	var peak float32
+	for _, x := range v {
+		peak = max(peak, float32(math.Abs(float64(x))))
+	}
+	codes := make([]int8, len(v))
+	scale := peak / 127
+	if scale > 0 {
+		for i, x := range v {
+			codes[i] = int8(math.Round(float64(x / scale)))
+		}
+	}
+	cv.vector, cv.codes, cv.scale = nil, codes, scale
+}
+
+// floats returns the normalized vector, decoded when quantized.
+func (cv *cachedVec) floats() []float32 {
+	if cv.codes == nil {
+		return cv.vector
+	}
+	out := make([]float32, len(cv.codes))
+	for i, c := range cv.codes {
+		out[i] = float32(c) * cv.scale
+	}
+	return out
+}
+
+// distance returns the cosine distance from the normalized query q.
+func (cv *cachedVec) distance(q []float32) float32 {
+	if cv.codes == nil {
+		return vecDistance(q, cv.vector)
+	}
+	var sum float32
+	for i := range min(len(q), len(cv.codes)) {
+		sum += q[i] * float32(cv.codes[i])
+	}
+	return 1 - sum*cv.scale
+}
+
+// distanceTo returns the cosine distance between two cached vectors.
+func (cv *cachedVec) distanceTo(o *cachedVec) float32 {
+	if cv.codes == nil || o.codes == nil {
+		return o.distance(cv.floats())
+	}
+	var sum int32
+	for i := range min(len(cv.codes), len(o.codes)) {
+		sum += int32(cv.codes[i]) * int32(o.codes[i])
+	}
+	return 1 - float32(sum)*cv.scale*o.scale
+}
+
+// bytes estimates the memory held for the vector.
+func (cv *cachedVec) bytes() int64 {
+	return int64(len(cv.vector)*4 + len(cv.codes))
+}
@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+)
+
+func TestInt8Distance(t *testing.T) {
+	records := randomRecords(50, 64, 7)
+	for i := 1; i < len(records); i++ {
+		a := newCachedVec(records[i-1], QuantizeNone)
+		b := newCachedVec(records[i], QuantizeNone)
+		qa := newCachedVec(records[i-1], QuantizeInt8)
+		qb := newCachedVec(records[i], QuantizeInt8)
+
+		want := a.distanceTo(&b)
+		if got := qa.distanceTo(&qb); math.Abs(float64(got-want)) > 0.02 {
+			t.Errorf("int8 distance %f, float %f", got, want)
+		}
+		if got := qb.distance(a.vector); math.Abs(float64(got-want)) > 0.02 {
+			t.Errorf("int8 query distance %f, float %f", got, want)
+		}
+	}
+}
+
+func TestQuantizedSearchRescores(t *testing.T) {
+	vs := newIndexedStore(t, filepath.Join(t.TempDir(), "test.db"))
+	vs.SetIndexParams(IndexParams{M: 8, EfConstruction: 64, EfSearch: 32, Quantization: QuantizeInt8, Rescore: 4})
+	records := randomRecords(500, 16, 8)
+	for i := range records {
+		records[i].Text = "chunk " + records[i].ID
+	}
+	vs.AddVectors(records)
+
+	for i := range vs.cache {
+		if cv := vs.cache[i]; cv.vector != nil || cv.rec.Vector != nil || cv.rec.Text != "" || len(cv.codes) != 16 {
+			t.Fatalf("expected only int8 codes and metadata cached, got %+v", cv)
+		}
+	}
+
+	exact := newIndexedStore(t, filepath.Join(t.TempDir(), "exact.db"))
+	exact.SetIndexParams(IndexParams{})
+	exact.AddVectors(records)
+
+	for _, q := range randomRecords(20, 16, 9) {
+		got, want := vs.Search(q.Vector, 5), exact.Search(q.Vector, 5)
+		if len(got) != 5 || got[0].ID != want[0].ID {
+			t.Fatalf("expected top result %s, got %+v", want[0].ID, got)
+		}
+		// Distances come from the raw float32 vectors, and text from SQLite
+		if got[0].Distance != want[0].Distance || got[0].Text != "chunk "+got[0].ID {
+			t.Errorf("expected rescored result %+v, got %+v", want[0], got[0])
+		}
+	}
+
+	ids, vectors, texts := vs.GetAllVectors()
+	if len(ids) != 500 || len(vectors[0]) != 16 || texts[0] != "chunk "+ids[0] {
+		t.Errorf("expected raw vectors and texts from the database, got %d", len(ids))
+	}
+}
@@ -1,12 +1,18 @@
 package storage
 
 import (
+	"cmp"
+	"container/heap"
 	"database/sql"
 	"encoding/binary"
 	"fmt"
+	"log/slog"
 	"math"
-	"sort"
+	"math/rand"
+	"slices"
+	"strings"
 	"sync"
+	"time"
 )
 
 // VectorRecord holds a chunk's embedding and metadata.
@@ -20,6 +26,8 @@ type VectorRecord struct {
 	Topics         string    `json:"topics"`
 	AtomType       string    `json:"atom_type"`
 	PipelineVersion string  `json:"pipeline_version"`
+	Language       string    `json:"language,omitempty"`
+	Model          string    `json:"model,omitempty"` // embedding model; "" for vectors stored before models were recorded
 }
 
 // SearchResult is a VectorRecord with a distance score.
@@ -29,23 +37,43 @@ type SearchResult struct {
 }
 
 // VectorStore stores and searches embeddings using SQLite + in-memory index.
+// Large collections are searched through an HNSW graph, persisted in the
+// vector_index table; small ones, and filtered searches the graph cannot
+// satisfy, score every vector. Memory holds only normalized vectors,
+// optionally int8-quantized, and filter metadata; the best candidates are
+// re-scored against the raw vectors in SQLite, which also supplies text.
+//
+// Vectors are stored per embedding model. Only the active model's
+// namespace is loaded and searched; vectors of another model are written
+// to SQLite alone until Activate switches over to it.
 type VectorStore struct {
 	db        *sql.DB
+	model     string // active namespace
 	dimension int
 	mu        sync.RWMutex
-	cache     []cachedVec // in-memory normalized vectors for fast search
+	cache     []cachedVec // by slot; freed slots have no id
+	byID      map[string]int32
+	free      []int32
 	loaded    bool
-}
 
-type cachedVec struct {
-	id     string
-	vector []float32 // pre-normalized
-	rec    VectorRecord
+	params     IndexParams
+	index      *hnsw // nil when disabled
+	indexDirty bool  // changed since the last SaveIndex
+	indexing   sync.WaitGroup
+
+	// While Activate loads a namespace, vectors added to it and assets
+	// deleted are recorded here and applied after the switch.
+	activating        *string
+	activatingAdds    []VectorRecord
+	activatingDeletes []string
+	retired           map[string]bool // namespaces replaced by Activate
 }
 
 const vectorTableDDL = `
 CREATE TABLE IF NOT EXISTS chunk_vectors (
-    id TEXT PRIMARY KEY,
+    id TEXT NOT NULL,
+    model TEXT NOT NULL DEFAULT '',
+    dimension INTEGER NOT NULL DEFAULT 0,
     vector BLOB NOT NULL,
     text TEXT NOT NULL,
     asset_id TEXT NOT NULL,
@@ -53,19 +81,86 @@ CREATE TABLE IF NOT EXISTS chunk_vectors (
     evidence_anchor TEXT,
     topics TEXT,
     atom_type TEXT,
-    pipeline_version TEXT
+    pipeline_version TEXT,
+    language TEXT,
+    PRIMARY KEY (id, model)
 );
 CREATE INDEX IF NOT EXISTS idx_chunk_vectors_asset ON chunk_vectors(asset_id);
+
+CREATE TABLE IF NOT EXISTS vector_namespaces (
+    model TEXT PRIMARY KEY,
+    dimension INTEGER NOT NULL,
+    status TEXT NOT NULL,
+    created_at TEXT,
+    activated_at TEXT
+);
+
+CREATE TABLE IF NOT EXISTS vector_index (
+    name TEXT PRIMARY KEY,
+    data BLOB NOT NULL,
+    node_count INTEGER NOT NULL,
+    updated_at TEXT
+);
 `
 
+// indexName returns the vector_index row holding a namespace's graph.
+func indexName(model string) string {
+	if model == "" {
+		return "chunk_vectors"
+	}
+	return "chunk_vectors:" + model
+}
+
+// Snapshots missing more nodes than this are completed in the background,
+// with exact search until they are.
+const (
+	indexSyncMax    = 1000
+	indexBatchNodes = 256
+)
+
+var vectorMigrations = []string{
+	"ALTER TABLE chunk_vectors ADD COLUMN language TEXT",
+}
+
 func NewVectorStore(db *sql.DB, dimension int) (*VectorStore, error) {
 	if _, err := db.Exec(vectorTableDDL); err != nil {
 		return nil, fmt.Errorf("create vector table: %w", err)
 	}
-	vs := &VectorStore{db: db, dimension: dimension}
+	if err := migrate(db, vectorMigrations); err != nil {
+		return nil, err
+	}
+	if err := migrateVectorNamespaces(db); err != nil {
+		return nil, fmt.Errorf("migrate vector namespaces: %w", err)
+	}
+	vs := &VectorStore{db: db, dimension: dimension, byID: make(map[string]int32)}
+	vs.SetIndexParams(DefaultIndexParams())
 	return vs, nil
 }
 
+// SetIndexParams replaces the index parameters, rebuilding the index over
+// the vectors already cached. Call it before LoadAll.
+func (vs *VectorStore) SetIndexParams(p IndexParams) {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+	if p.Quantization != vs.params.Quantization {
+		for i := range vs.cache {
+			if vs.cache[i].id != "" {
+				vs.cache[i].setVector(vs.cache[i].floats(), p.Quantization)
+			}
+		}
+	}
+	vs.params = p
+	vs.index = nil
+	if p.M <= 0 {
+		return
+	}
+	vs.index = newHNSW(p.M, p.EfConstruction)
+	for _, slot := range vs.byID {
+		vs.index.insert(vs.cache, slot)
+	}
+	vs.indexDirty = len(vs.byID) > 0
+}
+
 func (vs *VectorStore) SetDimension(dim int) {
 	vs.mu.Lock()
 	vs.dimension = dim
@@ -78,40 +173,178 @@ func (vs *VectorStore) Dimension() int {
 	return vs.dimension
 }
 
-// LoadAll loads all vectors from SQLite into memory for fast search.
+// LoadAll loads the active namespace's vectors from SQLite into memory for
+// fast search.
 func (vs *VectorStore) LoadAll() error {
-	rows, err := vs.db.Query("SELECT id, vector, text, asset_id, asset_path, evidence_anchor, topics, atom_type, pipeline_version FROM chunk_vectors")
+	model, err := activeNamespace(vs.db)
+	if err != nil {
+		return err
+	}
+	vs.mu.RLock()
+	quantization := vs.params.Quantization
+	vs.mu.RUnlock()
+
+	cache, byID, dim, err := vs.readNamespace(model, quantization)
 	if err != nil {
 		return err
 	}
+
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+	vs.model = model
+	vs.cache, vs.byID, vs.free = cache, byID, nil
+	vs.loaded = true
+	if dim > 0 {
+		vs.dimension = dim
+	}
+	vs.loadIndex()
+	return nil
+}
+
+// readNamespace reads a model's vectors into cache slots.
+func (vs *VectorStore) readNamespace(model, quantization string) ([]cachedVec, map[string]int32, int, error) {
+	rows, err := vs.db.Query(`SELECT id, vector, asset_id, asset_path, evidence_anchor, topics, atom_type,
+		pipeline_version, COALESCE(language, '') FROM chunk_vectors WHERE model=?`, model)
+	if err != nil {
+		return nil, nil, 0, err
+	}
 	defer rows.Close()
 
 	var cache []cachedVec
+	byID := make(map[string]int32)
+	dim := 0
 	for rows.Next() {
-		var rec VectorRecord
+		rec := VectorRecord{Model: model}
 		var vecBlob []byte
-		err := rows.Scan(&rec.ID, &vecBlob, &rec.Text, &rec.AssetID, &rec.AssetPath,
-			&rec.EvidenceAnchor, &rec.Topics, &rec.AtomType, &rec.PipelineVersion)
+		err := rows.Scan(&rec.ID, &vecBlob, &rec.AssetID, &rec.AssetPath,
+			&rec.EvidenceAnchor, &rec.Topics, &rec.AtomType, &rec.PipelineVersion, &rec.Language)
 		if err != nil {
-			return err
+			return nil, nil, 0, err
 		}
-		vec := blobToFloat32(vecBlob)
-		rec.Vector = vec
-		normalized := normalize(vec)
-		cache = append(cache, cachedVec{id: rec.ID, vector: normalized, rec: rec})
+		rec.Vector = blobToFloat32(vecBlob)
+		dim = len(rec.Vector)
+		byID[rec.ID] = int32(len(cache))
+		cache = append(cache, newCachedVec(rec, quantization))
 	}
+	return cache, byID, dim, rows.Err()
+}
 
+// readIndex restores a namespace's persisted graph onto cache slots, or
+// returns an empty graph when there is none or it does not fit params.
+func (vs *VectorStore) readIndex(model string, params IndexParams, byID map[string]int32, slots int) *hnsw {
+	var data []byte
+	err := vs.db.QueryRow("SELECT data FROM vector_index WHERE name=?", indexName(model)).Scan(&data)
+	if err == nil {
+		index, err := decodeHNSW(data, params.M, params.EfConstruction, byID, slots)
+		if err == nil {
+			return index
+		}
+		slog.Warn("Rebuilding vector index", "model", model, "reason", err)
+	}
+	return newHNSW(params.M, params.EfConstruction)
+}
+
+// loadIndex restores the persisted graph onto the cache and inserts the
+// vectors it lacks. A missing or incompatible snapshot is rebuilt.
+func (vs *VectorStore) loadIndex() {
+	vs.index = nil
+	if vs.params.M <= 0 {
+		return
+	}
+	vs.index = vs.readIndex(vs.model, vs.params, vs.byID, len(vs.cache))
+
+	var pending []string
+	for id, slot := range vs.byID {
+		if !vs.index.contains(slot) {
+			pending = append(pending, id)
+		}
+	}
+	if len(pending) == 0 {
+		return
+	}
+	vs.indexDirty = true
+	if len(pending) <= indexSyncMax {
+		for _, id := range pending {
+			vs.index.insert(vs.cache, vs.byID[id])
+		}
+		return
+	}
+	slog.Info("Indexing vectors in the background", "pending", len(pending), "indexed", vs.index.count)
+	vs.indexing.Add(1)
+	go vs.indexPending(vs.index, pending)
+}
+
+// indexPending inserts vectors into the graph in batches, releasing the
+// lock between them so searches (exact meanwhile) are not held up.
+func (vs *VectorStore) indexPending(index *hnsw, ids []string) {
+	defer vs.indexing.Done()
+	start := time.Now()
+	for i := 0; i < len(ids); i += indexBatchNodes {
+		vs.mu.Lock()
+		if vs.index != index {
+			vs.mu.Unlock()
+			return // reloaded
+		}
+		for _, id := range ids[i:min(i+indexBatchNodes, len(ids))] {
+			if slot, ok := vs.byID[id]; ok {
+				index.insert(vs.cache, slot)
+			}
+		}
+		vs.mu.Unlock()
+	}
+	slog.Info("Vector index complete", "nodes", len(ids), "duration", time.Since(start).Round(time.Second))
+}
+
+// SaveIndex persists the graph if it changed since it was last saved.
+func (vs *VectorStore) SaveIndex() error {
 	vs.mu.Lock()
-	vs.cache = cache
-	vs.loaded = true
-	if len(cache) > 0 {
-		vs.dimension = len(cache[0].vector)
+	if vs.index == nil || !vs.indexDirty {
+		vs.mu.Unlock()
+		return nil
 	}
+	data, count, name := vs.index.encode(vs.cache), vs.index.count, indexName(vs.model)
+	vs.indexDirty = false
 	vs.mu.Unlock()
-	return rows.Err()
+
+	_, err := vs.db.Exec(`INSERT OR REPLACE INTO vector_index (name, data, node_count, updated_at)
+		VALUES (?, ?, ?, ?)`, name, data, count, nowISO())
+	if err != nil {
+		vs.mu.Lock()
+		vs.indexDirty = true
+		vs.mu.Unlock()
+	}
+	return err
+}
+
+// put stores rec in a cache slot, replacing an earlier vector with the
+// same ID, and indexes it. The caller holds the write lock.
+func (vs *VectorStore) put(rec VectorRecord) {
+	slot, ok := vs.byID[rec.ID]
+	if ok {
+		vs.unindex(slot)
+	} else if n := len(vs.free); n > 0 {
+		slot, vs.free = vs.free[n-1], vs.free[:n-1]
+	} else {
+		slot = int32(len(vs.cache))
+		vs.cache = append(vs.cache, cachedVec{})
+	}
+	vs.cache[slot] = newCachedVec(rec, vs.params.Quantization)
+	vs.byID[rec.ID] = slot
+	if vs.index != nil {
+		vs.index.insert(vs.cache, slot)
+		vs.indexDirty = true
+	}
 }
 
-// AddVectors inserts vectors into SQLite and adds them to the in-memory cache.
+func (vs *VectorStore) unindex(slot int32) {
+	if vs.index != nil {
+		vs.index.remove(vs.cache, slot)
+		vs.indexDirty = true
+	}
+}
+
+// AddVectors inserts vectors into SQLite and adds those of the active
+// namespace to the in-memory cache.
 func (vs *VectorStore) AddVectors(records []VectorRecord) error {
 	tx, err := vs.db.Begin()
 	if err != nil {
@@ -119,8 +352,8 @@ func (vs *VectorStore) AddVectors(records []VectorRecord) error {
 	}
 	stmt, err := tx.Prepare(`
 		INSERT OR REPLACE INTO chunk_vectors
-		(id, vector, text, asset_id, asset_path, evidence_anchor, topics, atom_type, pipeline_version)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+		(id, model, dimension, vector, text, asset_id, asset_path, evidence_anchor, topics, atom_type, pipeline_version, language)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
 	if err != nil {
 		tx.Rollback()
 		return err
@@ -131,57 +364,146 @@ func (vs *VectorStore) AddVectors(records []VectorRecord) error {
 	defer vs.mu.Unlock()
 
 	for _, rec := range records {
+		if vs.retired[rec.Model] {
+			tx.Rollback()
+			return fmt.Errorf("namespace %q was replaced by %q", rec.Model, vs.model)
+		}
 		blob := float32ToBlob(rec.Vector)
-		_, err := stmt.Exec(rec.ID, blob, rec.Text, rec.AssetID, rec.AssetPath,
-			rec.EvidenceAnchor, rec.Topics, rec.AtomType, rec.PipelineVersion)
+		_, err := stmt.Exec(rec.ID, rec.Model, len(rec.Vector), blob, rec.Text, rec.AssetID, rec.AssetPath,
+			rec.EvidenceAnchor, rec.Topics, rec.AtomType, rec.PipelineVersion, nullIfEmpty(rec.Language))
 		if err != nil {
 			tx.Rollback()
 			return err
 		}
-		// Add to cache
-		normalized := normalize(rec.Vector)
-		vs.cache = append(vs.cache, cachedVec{id: rec.ID, vector: normalized, rec: rec})
+		switch {
+		case rec.Model == vs.model:
+			vs.put(rec)
+		case vs.activating != nil && rec.Model == *vs.activating:
+			vs.activatingAdds = append(vs.activatingAdds, rec)
+		}
 	}
 	return tx.Commit()
 }
 
 // Search finds the k nearest neighbors using brute-force cosine similarity.
 func (vs *VectorStore) Search(queryVec []float32, limit int) []SearchResult {
+	return vs.SearchFiltered(queryVec, limit, nil)
+}
+
+// SearchFiltered is Search restricted to records accepted by filter. The
+// filter runs during candidate selection, so up to limit matching results
+// are returned. A nil filter accepts everything.
+func (vs *VectorStore) SearchFiltered(queryVec []float32, limit int, filter func(*VectorRecord) bool) []SearchResult {
 	normalized := normalize(queryVec)
 
 	vs.mu.RLock()
-	defer vs.mu.RUnlock()
-
-	type scored struct {
-		idx  int
-		dist float64
+	model := vs.model
+	k := limit
+	if vs.params.Quantization == QuantizeInt8 {
+		k = limit * max(vs.params.Rescore, 1)
+	}
+	var found []candidate
+	if vs.useIndex() {
+		var accept func(int32) bool
+		if filter != nil {
+			accept = func(slot int32) bool { return filter(&vs.cache[slot].rec) }
+		}
+		found = vs.index.search(vs.cache, normalized, k, vs.params.EfSearch, accept)
+		// A selective filter can leave fewer matches reachable in the
+		// graph than exist; score them all instead.
+		if filter != nil && len(found) < k {
+			found = nil
+		}
 	}
-	scores := make([]scored, 0, len(vs.cache))
-	for i, cv := range vs.cache {
-		sim := dotProduct(normalized, cv.vector)
-		// Convert cosine similarity to distance (lower = more similar, matching LanceDB behavior)
-		dist := 1.0 - float64(sim)
-		scores = append(scores, scored{idx: i, dist: dist})
+	if found == nil {
+		found = vs.exactSearch(normalized, k, filter)
 	}
+	results := make([]SearchResult, len(found))
+	for i, c := range found {
+		results[i] = SearchResult{VectorRecord: vs.cache[c.id].rec, Distance: float64(c.dist)}
+	}
+	vs.mu.RUnlock()
 
-	sort.Slice(scores, func(i, j int) bool {
-		return scores[i].dist < scores[j].dist
-	})
+	return vs.rescore(results, model, normalized, limit)
+}
 
-	n := limit
-	if n > len(scores) {
-		n = len(scores)
+// useIndex reports whether searches go through the graph: it is enabled,
+// holds every vector and the collection is large enough to need it.
+func (vs *VectorStore) useIndex() bool {
+	return vs.index != nil && len(vs.byID) >= vs.params.ExactBelow && vs.index.count == len(vs.byID)
+}
+
+// exactSearch scores every vector, keeping the limit nearest.
+func (vs *VectorStore) exactSearch(q []float32, limit int, filter func(*VectorRecord) bool) []candidate {
+	if limit <= 0 {
+		return nil
+	}
+	top := make(furthestFirst, 0, limit+1)
+	for i := range vs.cache {
+		cv := &vs.cache[i]
+		if cv.id == "" || filter != nil && !filter(&cv.rec) {
+			continue
+		}
+		// Cosine distance (lower = more similar, matching LanceDB behavior)
+		dist := cv.distance(q)
+		if len(top) == limit && dist >= top[0].dist {
+			continue
+		}
+		heap.Push(&top, candidate{int32(i), dist})
+		if len(top) > limit {
+			heap.Pop(&top)
+		}
 	}
+	return top.sorted()
+}
 
-	results := make([]SearchResult, n)
-	for i := 0; i < n; i++ {
-		cv := vs.cache[scores[i].idx]
-		results[i] = SearchResult{
-			VectorRecord: cv.rec,
-			Distance:     scores[i].dist,
+// rescore loads the raw vectors and texts of results from SQLite, recomputes
+// their distances to the normalized query q in float32, and returns the
+// limit nearest. Results deleted meanwhile are dropped.
+func (vs *VectorStore) rescore(results []SearchResult, model string, q []float32, limit int) []SearchResult {
+	if len(results) == 0 {
+		return results
+	}
+	byID := make(map[string]*SearchResult, len(results))
+	ids := make([]any, len(results))
+	for i := range results {
+		byID[results[i].ID] = &results[i]
+		ids[i] = results[i].ID
+	}
+	const batchSize = 500
+	loaded := make(map[string]bool, len(results))
+	for start := 0; start < len(ids); start += batchSize {
+		batch := ids[start:min(start+batchSize, len(ids))]
+		rows, err := vs.db.Query("SELECT id, vector, text FROM chunk_vectors WHERE model=? AND id IN (?"+
+			strings.Repeat(",?", len(batch)-1)+")", append([]any{model}, batch...)...)
+		if err != nil {
+			slog.Warn("Failed to load search results", "error", err)
+			break
+		}
+		for rows.Next() {
+			var id string
+			var blob []byte
+			var text string
+			if rows.Scan(&id, &blob, &text) != nil {
+				continue
+			}
+			if res := byID[id]; res != nil {
+				res.Vector, res.Text = blobToFloat32(blob), text
+				res.Distance = float64(vecDistance(q, normalize(res.Vector)))
+				loaded[id] = true
+			}
+		}
+		rows.Close()
+	}
+
+	out := results[:0]
+	for _, res := range results {
+		if loaded[res.ID] {
+			out = append(out, res)
 		}
 	}
-	return results
+	slices.SortStableFunc(out, func(a, b SearchResult) int { return cmp.Compare(a.Distance, b.Distance) })
+	return out[:min(limit, len(out))]
 }
 
 // DeleteByAsset removes all vectors for an asset.
@@ -190,41 +512,237 @@ func (vs *VectorStore) DeleteByAsset(assetID string) error {
 	if err != nil {
 		return err
 	}
-	// Remove from cache
+	// Remove from cache and index
 	vs.mu.Lock()
-	filtered := vs.cache[:0]
-	for _, cv := range vs.cache {
-		if cv.rec.AssetID != assetID {
-			filtered = append(filtered, cv)
-		}
+	if vs.activating != nil {
+		vs.activatingDeletes = append(vs.activatingDeletes, assetID)
 	}
-	vs.cache = filtered
+	vs.removeAsset(assetID)
 	vs.mu.Unlock()
 	return nil
 }
 
+// removeAsset drops an asset's vectors from the cache and index. The
+// caller holds the write lock.
+func (vs *VectorStore) removeAsset(assetID string) {
+	for i := range vs.cache {
+		cv := &vs.cache[i]
+		if cv.id == "" || cv.rec.AssetID != assetID {
+			continue
+		}
+		vs.unindex(int32(i))
+		delete(vs.byID, cv.id)
+		*cv = cachedVec{}
+		vs.free = append(vs.free, int32(i))
+	}
+}
+
 // Count returns the number of vectors.
 func (vs *VectorStore) Count() int {
 	vs.mu.RLock()
 	defer vs.mu.RUnlock()
-	return len(vs.cache)
+	return len(vs.byID)
 }
 
-// GetAllVectors returns all cached vectors (ids, vectors, texts).
-func (vs *VectorStore) GetAllVectors() (ids []string, vectors [][]float32, texts []string) {
+// Vectors returns the normalized in-memory vectors of the given chunks in
+// the active namespace, approximated when quantized, for reading only.
+// Unknown IDs are left out.
+func (vs *VectorStore) Vectors(ids []string) map[string][]float32 {
 	vs.mu.RLock()
 	defer vs.mu.RUnlock()
-	ids = make([]string, len(vs.cache))
-	vectors = make([][]float32, len(vs.cache))
-	texts = make([]string, len(vs.cache))
-	for i, cv := range vs.cache {
-		ids[i] = cv.id
-		vectors[i] = cv.rec.Vector // original (unnormalized)
-		texts[i] = cv.rec.Text
+	out := make(map[string][]float32, len(ids))
+	for _, id := range ids {
+		if slot, ok := vs.byID[id]; ok {
+			out[id] = vs.cache[slot].floats()
+		}
+	}
+	return out
+}
+
+// MeanVector returns the direction of the given chunks' raw vectors in the
+// active namespace, the normalized mean of their normalized vectors, and how
+// many were found. Unknown IDs are left out; the vector is nil if none is
+// found. One chunk's vector is its own direction, several a centroid.
+func (vs *VectorStore) MeanVector(ids []string) ([]float32, int, error) {
+	const batchSize = 500
+	model := vs.Model()
+	var sum []float32
+	n := 0
+	for start := 0; start < len(ids); start += batchSize {
+		batch := ids[start:min(start+batchSize, len(ids))]
+		args := []any{model}
+		for _, id := range batch {
+			args = append(args, id)
+		}
+		rows, err := vs.db.Query("SELECT vector FROM chunk_vectors WHERE model=? AND id IN (?"+
+			strings.Repeat(",?", len(batch)-1)+")", args...)
+		if err != nil {
+			return nil, 0, err
+		}
+		sum, n, err = addVectors(rows, sum, n)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	if n == 0 {
+		return nil, 0, nil
+	}
+	return normalize(sum), n, nil
+}
+
+// AssetVector returns the document vector of an asset, the MeanVector of all
+// its chunks in the active namespace, and how many chunks it averages.
+func (vs *VectorStore) AssetVector(assetID string) ([]float32, int, error) {
+	rows, err := vs.db.Query("SELECT vector FROM chunk_vectors WHERE model=? AND asset_id=?", vs.Model(), assetID)
+	if err != nil {
+		return nil, 0, err
+	}
+	sum, n, err := addVectors(rows, nil, 0)
+	if err != nil || n == 0 {
+		return nil, 0, err
+	}
+	return normalize(sum), n, nil
+}
+
+// addVectors adds the normalized vectors of rows to sum, which n vectors
+// make up so far, skipping any of another dimension, and closes rows.
+func addVectors(rows *sql.Rows, sum []float32, n int) ([]float32, int, error) {
+	defer rows.Close()
+	for rows.Next() {
+		var blob []byte
+		if err := rows.Scan(&blob); err != nil {
+			return nil, 0, err
+		}
+		v := normalize(blobToFloat32(blob))
+		if sum == nil {
+			sum = make([]float32, len(v))
+		}
+		if len(v) != len(sum) {
+			continue
+		}
+		for i, x := range v {
+			sum[i] += x
+		}
+		n++
+	}
+	return sum, n, rows.Err()
+}
+
+// GetAllVectors returns the active namespace's vectors (ids, raw vectors,
+// texts), read from SQLite since the cache holds neither.
+func (vs *VectorStore) GetAllVectors() (ids []string, vectors [][]float32, texts []string) {
+	rows, err := vs.db.Query("SELECT id, vector, text FROM chunk_vectors WHERE model=?", vs.Model())
+	if err != nil {
+		slog.Warn("Failed to read vectors", "error", err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, text string
+		var blob []byte
+		if err := rows.Scan(&id, &blob, &text); err != nil {
+			slog.Warn("Failed to read vector", "error", err)
+			continue
+		}
+		ids = append(ids, id)
+		vectors = append(vectors, blobToFloat32(blob))
+		texts = append(texts, text)
 	}
 	return
 }
 
+// RecallReport compares index searches against exact ones.
+type RecallReport struct {
+	Vectors     int         `json:"vectors"`
+	Indexed     int         `json:"indexed"`
+	Params      IndexParams `json:"params"`
+	UsingIndex  bool        `json:"using_index"` // whether searches currently go through the index
+	Samples     int         `json:"samples"`
+	K           int         `json:"k"`
+	Ef          int         `json:"ef"`
+	CacheBytes  int64       `json:"cache_bytes"` // vectors and graph links held in memory
+	Recall      float64     `json:"recall"`      // share of the exact top k the index also returned
+	ExactMillis float64     `json:"exact_ms"`    // mean per query
+	IndexMillis float64     `json:"index_ms"`    // mean per query
+}
+
+// MeasureRecall searches for samples randomly chosen stored vectors with
+// the index (candidate list ef, or the configured EfSearch when 0) and
+// exactly, and reports how many of the exact k nearest the index found.
+// The read lock is taken per sample, so writers are not held up for the
+// whole measurement; samples deleted meanwhile are skipped.
+func (vs *VectorStore) MeasureRecall(samples, k, ef int) RecallReport {
+	vs.mu.RLock()
+	if ef <= 0 {
+		ef = vs.params.EfSearch
+	}
+	report := RecallReport{Vectors: len(vs.byID), Params: vs.params, UsingIndex: vs.useIndex(), K: k, Ef: ef}
+	for i := range vs.cache {
+		report.CacheBytes += vs.cache[i].bytes()
+	}
+	if vs.index != nil {
+		report.CacheBytes += vs.index.bytes()
+	}
+	if vs.index == nil || vs.index.count == 0 || k <= 0 {
+		vs.mu.RUnlock()
+		return report
+	}
+	report.Indexed = vs.index.count
+
+	ids := make([]string, 0, len(vs.byID))
+	for id := range vs.byID {
+		ids = append(ids, id)
+	}
+	vs.mu.RUnlock()
+	rand.Shuffle(len(ids), func(i, j int) { ids[i], ids[j] = ids[j], ids[i] })
+	ids = ids[:min(samples, len(ids))]
+
+	var hits, total, measured int
+	var exactTime, indexTime time.Duration
+	for _, id := range ids {
+		vs.mu.RLock()
+		slot, ok := vs.byID[id]
+		if !ok || vs.index == nil {
+			vs.mu.RUnlock()
+			continue
+		}
+		q := vs.cache[slot].floats()
+		start := time.Now()
+		exact := vs.exactSearch(q, k, nil)
+		exactTime += time.Since(start)
+		start = time.Now()
+		found := vs.index.search(vs.cache, q, k, ef, nil)
+		indexTime += time.Since(start)
+		vs.mu.RUnlock()
+
+		want := make(map[int32]bool, len(exact))
+		for _, c := range exact {
+			want[c.id] = true
+		}
+		for _, c := range found {
+			if want[c.id] {
+				hits++
+			}
+		}
+		total += len(exact)
+		measured++
+	}
+	report.Samples = measured
+	if total > 0 {
+		report.Recall = float64(hits) / float64(total)
+		report.ExactMillis = float64(exactTime.Microseconds()) / 1000 / float64(measured)
+		report.IndexMillis = float64(indexTime.Microseconds()) / 1000 / float64(measured)
+	}
+	return report
+}
+
+func nullIfEmpty(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
 // -- Vector math helpers --
 
 func float32ToBlob(v []float32) []byte {
@@ -263,7 +781,7 @@ func normalize(v []float32) []float32 {
 
 func dotProduct(a, b []float32) float32 {
 	var sum float32
-	for i := range a {
+	for i := range min(len(a), len(b)) {
 		sum += a[i] * b[i]
 	}
 	return sum
@@ -3,6 +3,7 @@ package storage
 import (
 	"math"
 	"path/filepath"
+	"slices"
 	"testing"
 )
 
@@ -76,7 +77,7 @@ func TestLoadAll(t *testing.T) {
 
 	vs1, _ := NewVectorStore(db.DB(), 3)
 	vs1.AddVectors([]VectorRecord{
-		{ID: "v1", Vector: []float32{1, 0, 0}, Text: "alpha", AssetID: "a1", AssetPath: "/a", AtomType: "text"},
+		{ID: "v1", Vector: []float32{1, 0, 0}, Text: "alpha", AssetID: "a1", AssetPath: "/a", AtomType: "text", Language: "de"},
 	})
 
 	// Create new vector store from same DB and load
@@ -87,6 +88,9 @@ func TestLoadAll(t *testing.T) {
 	if vs2.Count() != 1 {
 		t.Errorf("expected 1 vector after LoadAll, got %d", vs2.Count())
 	}
+	if res := vs2.Search([]float32{1, 0, 0}, 1); len(res) != 1 || res[0].Language != "de" {
+		t.Errorf("expected language to survive LoadAll, got %+v", res)
+	}
 }
 
 func TestGetAllVectors(t *testing.T) {
@@ -110,6 +114,51 @@ func TestGetAllVectors(t *testing.T) {
 	}
 }
 
+func TestVectors(t *testing.T) {
+	vs := newTestVectorStore(t)
+	vs.AddVectors([]VectorRecord{
+		{ID: "v1", Vector: []float32{3, 4, 0}, Text: "alpha", AssetID: "a1", AtomType: "text"},
+	})
+
+	vectors := vs.Vectors([]string{"v1", "missing"})
+	if len(vectors) != 1 {
+		t.Fatalf("expected only the stored vector, got %v", vectors)
+	}
+	if v := vectors["v1"]; math.Abs(float64(v[0])-0.6) > 1e-6 || math.Abs(float64(v[1])-0.8) > 1e-6 {
+		t.Errorf("expected the normalized vector, got %v", v)
+	}
+}
+
+func TestMeanVector(t *testing.T) {
+	vs := newTestVectorStore(t)
+	vs.AddVectors([]VectorRecord{
+		{ID: "v1", Vector: []float32{2, 0, 0}, Text: "alpha", AssetID: "a1", AtomType: "text"},
+		{ID: "v2", Vector: []float32{0, 5, 0}, Text: "beta", AssetID: "a1", AtomType: "text"},
+		{ID: "v3", Vector: []float32{0, 0, 1}, Text: "gamma", AssetID: "a2", AtomType: "text"},
+		{ID: "v1", Vector: []float32{0, 0, 1}, Text: "alpha", AssetID: "a1", AtomType: "text", Model: "other"},
+	})
+
+	// Vectors are normalized before averaging, so lengths do not weigh in
+	mean, n, err := vs.MeanVector([]string{"v1", "v2", "missing"})
+	if err != nil || n != 2 {
+		t.Fatalf("MeanVector: n=%d err=%v", n, err)
+	}
+	if want := float32(1 / math.Sqrt2); math.Abs(float64(mean[0]-want)) > 1e-6 || math.Abs(float64(mean[1]-want)) > 1e-6 || mean[2] != 0 {
+		t.Errorf("expected the normalized mean of v1 and v2, got %v", mean)
+	}
+	if mean, n, _ := vs.MeanVector([]string{"missing"}); mean != nil || n != 0 {
+		t.Errorf("expected no vector for unknown chunks, got %v (%d)", mean, n)
+	}
+
+	asset, n, err := vs.AssetVector("a1")
+	if err != nil || n != 2 || !slices.Equal(asset, mean) {
+		t.Errorf("expected a1's vector to average its two chunks of the active model, got %v (%d, %v)", asset, n, err)
+	}
+	if asset, _, _ := vs.AssetVector("none"); asset != nil {
+		t.Errorf("expected no vector for an unknown asset, got %v", asset)
+	}
+}
+
 func TestNormalize(t *testing.T) {
 	v := []float32{3, 4, 0}
 	n := normalize(v)
@@ -0,0 +1,284 @@
+package tokenizer
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+func parseModel(raw json.RawMessage) (string, model, error) {
+	var head struct {
+		Type   string          `json:"type"`
+		Vocab  json.RawMessage `json:"vocab"`
+		Merges json.RawMessage `json:"merges"`
+	}
+	if err := json.Unmarshal(raw, &head); err != nil {
+		return "", nil, fmt.Errorf("model: %w", err)
+	}
+	kind := head.Type
+	if kind == "" {
+		// Files written by old versions of tokenizers omit the type.
+		switch {
+		case head.Merges != nil:
+			kind = "BPE"
+		case strings.HasPrefix(strings.TrimSpace(string(head.Vocab)), "["):
+			kind = "Unigram"
+		default:
+			kind = "WordPiece"
+		}
+	}
+	var m model
+	var err error
+	switch kind {
+	case "BPE":
+		m, err = parseBPE(raw)
+	case "WordPiece":
+		m, err = parseWordPiece(raw)
+	case "Unigram":
+		m, err = parseUnigram(raw)
+	default:
+		err = fmt.Errorf("unsupported model %q", kind)
+	}
+	return kind, m, err
+}
+
+// wordPiece splits words greedily into the longest vocabulary prefix,
+// continuing with "##"-prefixed pieces. Unsplittable words are one unknown
+// token.
+type wordPiece struct {
+	vocab    map[string]bool
+	prefix   string
+	maxChars int
+}
+
+func parseWordPiece(raw json.RawMessage) (model, error) {
+	var m struct {
+		Vocab                   map[string]int `json:"vocab"`
+		ContinuingSubwordPrefix *string        `json:"continuing_subword_prefix"`
+		MaxInputCharsPerWord    int            `json:"max_input_chars_per_word"`
+	}
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, fmt.Errorf("WordPiece model: %w", err)
+	}
+	wp := &wordPiece{vocab: make(map[string]bool, len(m.Vocab)), prefix: "##", maxChars: m.MaxInputCharsPerWord}
+	for tok := range m.Vocab {
+		wp.vocab[tok] = true
+	}
+	if m.ContinuingSubwordPrefix != nil {
+		wp.prefix = *m.ContinuingSubwordPrefix
+	}
+	if wp.maxChars <= 0 {
+		wp.maxChars = 100
+	}
+	return wp, nil
+}
+
+func (m *wordPiece) count(word string) int {
+	runes := []rune(word)
+	if len(runes) > m.maxChars {
+		return 1
+	}
+	n := 0
+	for start := 0; start < len(runes); {
+		end := len(runes)
+		for ; end > start; end-- {
+			piece := string(runes[start:end])
+			if start > 0 {
+				piece = m.prefix + piece
+			}
+			if m.vocab[piece] {
+				break
+			}
+		}
+		if end == start {
+			return 1
+		}
+		n++
+		start = end
+	}
+	return n
+}
+
+// bpe applies merges by rank to a word's characters. Symbols missing from
+// the vocabulary become byte tokens with byte fallback, otherwise an
+// unknown token.
+type bpe struct {
+	vocab        map[string]bool
+	ranks        map[[2]string]int
+	suffix       string
+	byteFallback bool
+	fuseUnk      bool
+	ignoreMerges bool // words found whole in the vocabulary are one token
+}
+
+func parseBPE(raw json.RawMessage) (model, error) {
+	var m struct {
+		Vocab           map[string]int    `json:"vocab"`
+		Merges          []json.RawMessage `json:"merges"`
+		EndOfWordSuffix *string           `json:"end_of_word_suffix"`
+		ByteFallback    bool              `json:"byte_fallback"`
+		FuseUnk         bool              `json:"fuse_unk"`
+		IgnoreMerges    bool              `json:"ignore_merges"`
+	}
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, fmt.Errorf("BPE model: %w", err)
+	}
+	b := &bpe{
+		vocab:        make(map[string]bool, len(m.Vocab)),
+		ranks:        make(map[[2]string]int, len(m.Merges)),
+		byteFallback: m.ByteFallback,
+		fuseUnk:      m.FuseUnk,
+		ignoreMerges: m.IgnoreMerges,
+	}
+	for tok := range m.Vocab {
+		b.vocab[tok] = true
+	}
+	if m.EndOfWordSuffix != nil {
+		b.suffix = *m.EndOfWordSuffix
+	}
+	for rank, raw := range m.Merges {
+		// Merges are "a b" strings, or ["a", "b"] pairs in newer files.
+		var pair []string
+		var s string
+		if json.Unmarshal(raw, &s) == nil {
+			pair = strings.SplitN(s, " ", 2)
+		} else if err := json.Unmarshal(raw, &pair); err != nil {
+			return nil, fmt.Errorf("BPE merge %d: %w", rank, err)
+		}
+		if len(pair) != 2 {
+			return nil, fmt.Errorf("BPE merge %d is not a pair", rank)
+		}
+		b.ranks[[2]string{pair[0], pair[1]}] = rank
+	}
+	return b, nil
+}
+
+func (m *bpe) count(word string) int {
+	if m.ignoreMerges && m.vocab[word+m.suffix] {
+		return 1
+	}
+	var symbols []string
+	for _, r := range word {
+		symbols = append(symbols, string(r))
+	}
+	if len(symbols) == 0 {
+		return 0
+	}
+	symbols[len(symbols)-1] += m.suffix
+
+	for len(symbols) > 1 {
+		best, bestRank := -1, math.MaxInt
+		for i := 0; i+1 < len(symbols); i++ {
+			if r, ok := m.ranks[[2]string{symbols[i], symbols[i+1]}]; ok && r < bestRank {
+				best, bestRank = i, r
+			}
+		}
+		if best < 0 {
+			break
+		}
+		pair := [2]string{symbols[best], symbols[best+1]}
+		merged := symbols[:0:0]
+		for i := 0; i < len(symbols); i++ {
+			if i+1 < len(symbols) && symbols[i] == pair[0] && symbols[i+1] == pair[1] {
+				merged = append(merged, pair[0]+pair[1])
+				i++
+			} else {
+				merged = append(merged, symbols[i])
+			}
+		}
+		symbols = merged
+	}
+
+	n := 0
+	prevUnk := false
+	for _, s := range symbols {
+		switch {
+		case m.vocab[s]:
+			n++
+			prevUnk = false
+		case m.byteFallback:
+			n += len(s)
+		case m.fuseUnk && prevUnk:
+		default:
+			n++
+			prevUnk = true
+		}
+	}
+	return n
+}
+
+// unigram segments a word into the most probable sequence of vocabulary
+// pieces, as SentencePiece does.
+type unigram struct {
+	scores       map[string]float64
+	maxPiece     int // longest piece in runes
+	unkScore     float64
+	byteFallback bool
+}
+
+func parseUnigram(raw json.RawMessage) (model, error) {
+	var m struct {
+		Vocab        [][2]json.RawMessage `json:"vocab"`
+		ByteFallback bool                 `json:"byte_fallback"`
+	}
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, fmt.Errorf("Unigram model: %w", err)
+	}
+	u := &unigram{scores: make(map[string]float64, len(m.Vocab)), byteFallback: m.ByteFallback}
+	minScore := 0.0
+	for i, entry := range m.Vocab {
+		var piece string
+		var score float64
+		if json.Unmarshal(entry[0], &piece) != nil || json.Unmarshal(entry[1], &score) != nil {
+			return nil, fmt.Errorf("Unigram vocab entry %d is not [piece, score]", i)
+		}
+		u.scores[piece] = score
+		u.maxPiece = max(u.maxPiece, utf8.RuneCountInString(piece))
+		minScore = min(minScore, score)
+	}
+	// SentencePiece scores unknown characters well below any real piece.
+	u.unkScore = minScore - 10
+	return u, nil
+}
+
+func (m *unigram) count(word string) int {
+	runes := []rune(word)
+	if len(runes) == 0 {
+		return 0
+	}
+	type node struct {
+		score  float64
+		tokens int
+		unk    bool // best path ends in an unknown character
+	}
+	best := make([]node, len(runes)+1)
+	for i := 1; i <= len(runes); i++ {
+		best[i] = node{score: math.Inf(-1)}
+	}
+	for start := 0; start < len(runes); start++ {
+		if math.IsInf(best[start].score, -1) {
+			continue
+		}
+		for end := start + 1; end <= len(runes) && end-start <= m.maxPiece; end++ {
+			if s, ok := m.scores[string(runes[start:end])]; ok {
+				if cand := best[start].score + s; cand > best[end].score {
+					best[end] = node{score: cand, tokens: best[start].tokens + 1}
+				}
+			}
+		}
+		// Any single character can be consumed as an unknown piece.
+		end := start + 1
+		if cand := best[start].score + m.unkScore; cand > best[end].score {
+			tokens := best[start].tokens + 1
+			if m.byteFallback {
+				tokens = best[start].tokens + utf8.RuneLen(runes[start])
+			} else if best[start].unk {
+				tokens = best[start].tokens // consecutive unknowns fuse
+			}
+			best[end] = node{score: cand, tokens: tokens, unk: true}
+		}
+	}
+	return best[len(runes)].tokens
+}
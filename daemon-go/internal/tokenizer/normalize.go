@@ -0,0 +1,448 @@
+package tokenizer
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/dlclark/regexp2"
+	"golang.org/x/text/unicode/norm"
+)
+
+// normalizer rewrites text before it is split into words.
+type normalizer func(string) string
+
+// preTokenizer splits normalized text into the words the model sees.
+type preTokenizer func(string) []string
+
+// gpt2Pattern is the word pattern of byte-level BPE tokenizers.
+const gpt2Pattern = `'s|'t|'re|'ve|'m|'ll|'d| ?\p{L}+| ?\p{N}+| ?[^\s\p{L}\p{N}]+|\s+(?!\S)|\s+`
+
+// metaspace is SentencePiece's word-boundary marker.
+const metaspace = "▁"
+
+type component struct {
+	Type string `json:"type"`
+
+	// Normalizers.
+	Lowercase          *bool             `json:"lowercase"`
+	StripAccents       *bool             `json:"strip_accents"`
+	CleanText          *bool             `json:"clean_text"`
+	HandleChineseChars *bool             `json:"handle_chinese_chars"`
+	StripLeft          bool              `json:"left"`
+	StripRight         bool              `json:"right"`
+	Prepend            string            `json:"prepend"`
+	Content            string            `json:"content"`
+	Normalizers        []json.RawMessage `json:"normalizers"`
+
+	// Pre-tokenizers.
+	AddPrefixSpace   *bool             `json:"add_prefix_space"`
+	UseRegex         *bool             `json:"use_regex"`
+	Replacement      string            `json:"replacement"`
+	PrependScheme    string            `json:"prepend_scheme"`
+	Split            *bool             `json:"split"`
+	IndividualDigits bool              `json:"individual_digits"`
+	Behavior         string            `json:"behavior"`
+	Invert           bool              `json:"invert"`
+	Pretokenizers    []json.RawMessage `json:"pretokenizers"`
+
+	Pattern *struct {
+		String *string `json:"String"`
+		Regex  *string `json:"Regex"`
+	} `json:"pattern"`
+}
+
+func (c component) flag(v *bool, def bool) bool {
+	if v == nil {
+		return def
+	}
+	return *v
+}
+
+func (c component) regex() (*regexp2.Regexp, error) {
+	switch {
+	case c.Pattern == nil:
+		return nil, fmt.Errorf("%s without pattern", c.Type)
+	case c.Pattern.String != nil:
+		return regexp2.Compile(regexp2.Escape(*c.Pattern.String), regexp2.None)
+	case c.Pattern.Regex != nil:
+		return regexp2.Compile(*c.Pattern.Regex, regexp2.None)
+	}
+	return nil, fmt.Errorf("%s pattern is empty", c.Type)
+}
+
+func parseNormalizer(raw json.RawMessage) (normalizer, error) {
+	var c component
+	if len(raw) == 0 || string(raw) == "null" {
+		return func(s string) string { return s }, nil
+	}
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return nil, err
+	}
+	switch c.Type {
+	case "BertNormalizer":
+		lower := c.flag(c.Lowercase, true)
+		strip := c.flag(c.StripAccents, lower)
+		clean := c.flag(c.CleanText, true)
+		chinese := c.flag(c.HandleChineseChars, true)
+		return func(s string) string {
+			if clean {
+				s = cleanText(s)
+			}
+			if chinese {
+				s = padChineseChars(s)
+			}
+			if strip {
+				s = stripAccents(s)
+			}
+			if lower {
+				s = strings.ToLower(s)
+			}
+			return s
+		}, nil
+	case "Lowercase":
+		return strings.ToLower, nil
+	case "StripAccents":
+		return stripAccents, nil
+	case "NFC":
+		return norm.NFC.String, nil
+	case "NFD":
+		return norm.NFD.String, nil
+	case "NFKC", "Precompiled":
+		return norm.NFKC.String, nil
+	case "NFKD":
+		return norm.NFKD.String, nil
+	case "Strip":
+		return func(s string) string {
+			if c.StripLeft {
+				s = strings.TrimLeftFunc(s, unicode.IsSpace)
+			}
+			if c.StripRight {
+				s = strings.TrimRightFunc(s, unicode.IsSpace)
+			}
+			return s
+		}, nil
+	case "Prepend":
+		return func(s string) string { return c.Prepend + s }, nil
+	case "Replace":
+		re, err := c.regex()
+		if err != nil {
+			return nil, err
+		}
+		content := strings.ReplaceAll(c.Content, "$", "$$")
+		return func(s string) string {
+			out, err := re.Replace(s, content, -1, -1)
+			if err != nil {
+				return s
+			}
+			return out
+		}, nil
+	case "Sequence":
+		var steps []normalizer
+		for _, sub := range c.Normalizers {
+			n, err := parseNormalizer(sub)
+			if err != nil {
+				return nil, err
+			}
+			steps = append(steps, n)
+		}
+		return func(s string) string {
+			for _, n := range steps {
+				s = n(s)
+			}
+			return s
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported normalizer %q", c.Type)
+}
+
+func parsePreTokenizer(raw json.RawMessage) (preTokenizer, error) {
+	var c component
+	if len(raw) == 0 || string(raw) == "null" {
+		// SentencePiece models often skip pre-tokenization and mark words
+		// with "▁" in the normalizer. Splitting at the markers keeps BPE
+		// merges per word; pieces rarely span a word boundary.
+		return func(s string) []string { return splitBefore(s, metaspace) }, nil
+	}
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return nil, err
+	}
+	switch c.Type {
+	case "BertPreTokenizer":
+		return func(s string) []string { return isolatePunctuation(strings.Fields(s)) }, nil
+	case "Whitespace":
+		re := regexp2.MustCompile(`\w+|[^\w\s]+`, regexp2.None)
+		return func(s string) []string { return matches(re, s) }, nil
+	case "WhitespaceSplit":
+		return strings.Fields, nil
+	case "Punctuation":
+		return func(s string) []string { return isolatePunctuation([]string{s}) }, nil
+	case "Digits":
+		return func(s string) []string { return splitDigits(s, c.IndividualDigits) }, nil
+	case "ByteLevel":
+		prefix := c.flag(c.AddPrefixSpace, true)
+		var re *regexp2.Regexp
+		if c.flag(c.UseRegex, true) {
+			re = regexp2.MustCompile(gpt2Pattern, regexp2.None)
+		}
+		return func(s string) []string {
+			if prefix && s != "" && !strings.HasPrefix(s, " ") {
+				s = " " + s
+			}
+			words := []string{s}
+			if re != nil {
+				words = splitRegex(re, s, "Isolated", false)
+			}
+			for i, w := range words {
+				words[i] = byteLevel(w)
+			}
+			return words
+		}, nil
+	case "Metaspace":
+		repl := c.Replacement
+		if repl == "" {
+			repl = metaspace
+		}
+		scheme := c.PrependScheme
+		if scheme == "" {
+			scheme = "never"
+			if c.flag(c.AddPrefixSpace, true) {
+				scheme = "always"
+			}
+		}
+		split := c.flag(c.Split, true)
+		return func(s string) []string {
+			s = strings.ReplaceAll(s, " ", repl)
+			if scheme != "never" && s != "" && !strings.HasPrefix(s, repl) {
+				s = repl + s
+			}
+			if !split {
+				return []string{s}
+			}
+			return splitBefore(s, repl)
+		}, nil
+	case "Split":
+		re, err := c.regex()
+		if err != nil {
+			return nil, err
+		}
+		return func(s string) []string { return splitRegex(re, s, c.Behavior, c.Invert) }, nil
+	case "Sequence":
+		var steps []preTokenizer
+		for _, sub := range c.Pretokenizers {
+			p, err := parsePreTokenizer(sub)
+			if err != nil {
+				return nil, err
+			}
+			steps = append(steps, p)
+		}
+		return func(s string) []string {
+			words := []string{s}
+			for _, p := range steps {
+				var next []string
+				for _, w := range words {
+					next = append(next, p(w)...)
+				}
+				words = next
+			}
+			return words
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported pre-tokenizer %q", c.Type)
+}
+
+// cleanText drops control characters and turns all whitespace into
+// spaces, as BERT's normalizer does.
+func cleanText(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '\t' || r == '\n' || r == '\r' || unicode.IsSpace(r):
+			return ' '
+		case r == 0 || r == unicode.ReplacementChar || unicode.IsControl(r) || unicode.Is(unicode.Cf, r):
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// padChineseChars surrounds each CJK ideograph with spaces so it becomes
+// a word of its own.
+func padChineseChars(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if unicode.Is(unicode.Han, r) {
+			b.WriteByte(' ')
+			b.WriteRune(r)
+			b.WriteByte(' ')
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func stripAccents(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.Is(unicode.Mn, r) {
+			return -1
+		}
+		return r
+	}, norm.NFD.String(s))
+}
+
+// isPunct matches BERT's notion of punctuation: all non-alphanumeric ASCII
+// plus the Unicode punctuation categories.
+func isPunct(r rune) bool {
+	if r < 128 {
+		return r > ' ' && r != 127 && !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}
+	return unicode.IsPunct(r)
+}
+
+func isolatePunctuation(words []string) []string {
+	var out []string
+	for _, w := range words {
+		start := 0
+		for i, r := range w {
+			if isPunct(r) {
+				if i > start {
+					out = append(out, w[start:i])
+				}
+				out = append(out, string(r))
+				start = i + len(string(r))
+			}
+		}
+		if start < len(w) {
+			out = append(out, w[start:])
+		}
+	}
+	return out
+}
+
+func splitDigits(s string, individual bool) []string {
+	var out []string
+	start := 0
+	prevDigit := false
+	for i, r := range s {
+		digit := unicode.IsDigit(r)
+		if i > start && (digit != prevDigit || (digit && individual)) {
+			out = append(out, s[start:i])
+			start = i
+		}
+		prevDigit = digit
+	}
+	if start < len(s) {
+		out = append(out, s[start:])
+	}
+	return out
+}
+
+// splitBefore cuts s before each run of sep, so every word but possibly
+// the first starts with it.
+func splitBefore(s, sep string) []string {
+	var out []string
+	start := 0
+	for i := 0; i < len(s); {
+		if strings.HasPrefix(s[i:], sep) {
+			if i > start && !strings.HasSuffix(s[:i], sep) {
+				out = append(out, s[start:i])
+				start = i
+			}
+			i += len(sep)
+			continue
+		}
+		i++
+	}
+	if start < len(s) {
+		out = append(out, s[start:])
+	}
+	return out
+}
+
+func matches(re *regexp2.Regexp, s string) []string {
+	var out []string
+	m, _ := re.FindStringMatch(s)
+	for m != nil {
+		out = append(out, m.String())
+		m, _ = re.FindNextMatch(m)
+	}
+	return out
+}
+
+// splitRegex splits s around matches of re with the given Hugging Face
+// split behavior. With invert, the text between matches is the delimiter.
+func splitRegex(re *regexp2.Regexp, s, behavior string, invert bool) []string {
+	runes := []rune(s)
+	type span struct {
+		start, end int
+		delim      bool
+	}
+	var spans []span
+	pos := 0
+	m, _ := re.FindRunesMatch(runes)
+	for m != nil {
+		if m.Length == 0 {
+			m, _ = re.FindNextMatch(m)
+			continue
+		}
+		if m.Index > pos {
+			spans = append(spans, span{pos, m.Index, invert})
+		}
+		spans = append(spans, span{m.Index, m.Index + m.Length, !invert})
+		pos = m.Index + m.Length
+		m, _ = re.FindNextMatch(m)
+	}
+	if pos < len(runes) {
+		spans = append(spans, span{pos, len(runes), invert})
+	}
+
+	var out []string
+	pending := -1 // start of a delimiter waiting to merge with the next span
+	for i, sp := range spans {
+		start := sp.start
+		if pending >= 0 {
+			start, pending = pending, -1
+		}
+		switch {
+		case !sp.delim || behavior == "Isolated" || behavior == "Contiguous" || behavior == "":
+			out = append(out, string(runes[start:sp.end]))
+		case behavior == "Removed":
+		case behavior == "MergedWithPrevious":
+			if len(out) > 0 && i > 0 && !spans[i-1].delim {
+				out[len(out)-1] += string(runes[start:sp.end])
+			} else {
+				out = append(out, string(runes[start:sp.end]))
+			}
+		case behavior == "MergedWithNext":
+			pending = start
+		}
+	}
+	if pending >= 0 {
+		out = append(out, string(runes[pending:]))
+	}
+	return out
+}
+
+// byteToRune is GPT-2's reversible mapping of bytes to printable runes.
+var byteToRune = func() [256]rune {
+	var table [256]rune
+	n := 0
+	for b := 0; b < 256; b++ {
+		if (b >= '!' && b <= '~') || (b >= 0xA1 && b <= 0xAC) || (b >= 0xAE && b <= 0xFF) {
+			table[b] = rune(b)
+		} else {
+			table[b] = rune(256 + n)
+			n++
+		}
+	}
+	return table
+}()
+
+func byteLevel(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		b.WriteRune(byteToRune[s[i]])
+	}
+	return b.String()
+}
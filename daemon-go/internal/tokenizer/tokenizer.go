@@ -0,0 +1,183 @@
+// Package tokenizer counts tokens the way a specific model does, by loading
+// the model's Hugging Face tokenizer.json.
+//
+// Only counting is supported: text runs through the file's normalizer and
+// pre-tokenizer, and each word is split by the model (BPE, WordPiece or
+// Unigram, the SentencePiece algorithm). Ids are never produced, so added
+// tokens are not matched in the input and the "Precompiled" SentencePiece
+// normalizer is approximated by NFKC.
+package tokenizer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// maxCachedWords bounds the per-tokenizer word count cache; it is cleared
+// when full.
+const maxCachedWords = 1 << 16
+
+// Tokenizer counts tokens for one model.
+type Tokenizer struct {
+	path      string
+	kind      string
+	normalize normalizer
+	split     preTokenizer
+	model     model
+	special   int // tokens the post-processor adds around a single sequence
+	maxLength int // model's max sequence length including special tokens; 0 if unknown
+
+	mu    sync.Mutex
+	cache map[string]int
+}
+
+// model counts the tokens of one pre-tokenized word.
+type model interface {
+	count(word string) int
+}
+
+type tokenizerFile struct {
+	Truncation *struct {
+		MaxLength int `json:"max_length"`
+	} `json:"truncation"`
+	Normalizer    json.RawMessage `json:"normalizer"`
+	PreTokenizer  json.RawMessage `json:"pre_tokenizer"`
+	PostProcessor json.RawMessage `json:"post_processor"`
+	Model         json.RawMessage `json:"model"`
+}
+
+// Load reads a tokenizer.json, or the tokenizer.json inside path when path
+// is a directory. The max sequence length comes from the file's truncation
+// settings, else from model_max_length in a tokenizer_config.json beside it.
+func Load(path string) (*Tokenizer, error) {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		path = filepath.Join(path, "tokenizer.json")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f tokenizerFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	t := &Tokenizer{path: path, cache: make(map[string]int)}
+	if t.kind, t.model, err = parseModel(f.Model); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if t.normalize, err = parseNormalizer(f.Normalizer); err != nil {
+		return nil, fmt.Errorf("%s: normalizer: %w", path, err)
+	}
+	if t.split, err = parsePreTokenizer(f.PreTokenizer); err != nil {
+		return nil, fmt.Errorf("%s: pre_tokenizer: %w", path, err)
+	}
+	t.special = specialTokenCount(f.PostProcessor)
+
+	if f.Truncation != nil && f.Truncation.MaxLength > 0 {
+		t.maxLength = f.Truncation.MaxLength
+	} else {
+		t.maxLength = configMaxLength(filepath.Join(filepath.Dir(path), "tokenizer_config.json"))
+	}
+	return t, nil
+}
+
+// configMaxLength reads model_max_length from a tokenizer_config.json.
+// Transformers writes a huge sentinel when the model sets no limit, so
+// implausible values count as unknown.
+func configMaxLength(path string) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	var cfg struct {
+		ModelMaxLength float64 `json:"model_max_length"`
+	}
+	if json.Unmarshal(data, &cfg) != nil || cfg.ModelMaxLength <= 0 || cfg.ModelMaxLength > 1<<20 {
+		return 0
+	}
+	return int(cfg.ModelMaxLength)
+}
+
+// Kind returns the tokenization model: "BPE", "WordPiece" or "Unigram".
+func (t *Tokenizer) Kind() string { return t.kind }
+
+// Path returns the tokenizer.json the tokenizer was loaded from.
+func (t *Tokenizer) Path() string { return t.path }
+
+// MaxTokens returns how many tokens of text the model accepts once its
+// special tokens are added, or 0 when the file does not say.
+func (t *Tokenizer) MaxTokens() int {
+	if t.maxLength == 0 {
+		return 0
+	}
+	return max(1, t.maxLength-t.special)
+}
+
+// Count returns the number of tokens text encodes to, excluding the
+// special tokens added around it.
+func (t *Tokenizer) Count(text string) int {
+	if text == "" {
+		return 0
+	}
+	n := 0
+	for _, word := range t.split(t.normalize(text)) {
+		n += t.countWord(word)
+	}
+	return n
+}
+
+func (t *Tokenizer) countWord(word string) int {
+	t.mu.Lock()
+	n, ok := t.cache[word]
+	t.mu.Unlock()
+	if ok {
+		return n
+	}
+	n = t.model.count(word)
+	t.mu.Lock()
+	if len(t.cache) >= maxCachedWords {
+		clear(t.cache)
+	}
+	t.cache[word] = n
+	t.mu.Unlock()
+	return n
+}
+
+// specialTokenCount returns how many special tokens a post-processor adds
+// to a single sequence.
+func specialTokenCount(raw json.RawMessage) int {
+	var p struct {
+		Type       string            `json:"type"`
+		Single     []json.RawMessage `json:"single"`
+		Processors []json.RawMessage `json:"processors"`
+	}
+	if len(raw) == 0 || json.Unmarshal(raw, &p) != nil {
+		return 0
+	}
+	switch p.Type {
+	case "BertProcessing", "RobertaProcessing":
+		return 2
+	case "TemplateProcessing":
+		n := 0
+		for _, piece := range p.Single {
+			var v struct {
+				SpecialToken json.RawMessage `json:"SpecialToken"`
+			}
+			if json.Unmarshal(piece, &v) == nil && v.SpecialToken != nil {
+				n++
+			}
+		}
+		return n
+	case "Sequence":
+		n := 0
+		for _, sub := range p.Processors {
+			n += specialTokenCount(sub)
+		}
+		return n
+	}
+	return 0
+}
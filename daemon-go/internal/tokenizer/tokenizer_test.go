@@ -0,0 +1,116 @@
+package tokenizer
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/dlclark/regexp2"
+)
+
+func writeTokenizer(t *testing.T, body string) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "tokenizer.json"), []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestWordPiece(t *testing.T) {
+	dir := writeTokenizer(t, `{
+		"truncation": {"max_length": 8},
+		"normalizer": {"type": "BertNormalizer", "lowercase": true},
+		"pre_tokenizer": {"type": "BertPreTokenizer"},
+		"post_processor": {"type": "TemplateProcessing", "single": [
+			{"SpecialToken": {"id": "[CLS]", "type_id": 0}},
+			{"Sequence": {"id": "A", "type_id": 0}},
+			{"SpecialToken": {"id": "[SEP]", "type_id": 0}}
+		]},
+		"model": {"type": "WordPiece", "unk_token": "[UNK]", "continuing_subword_prefix": "##",
+			"vocab": {"[UNK]": 0, "[CLS]": 1, "[SEP]": 2, "un": 3, "##aff": 4, "##able": 5, "hello": 6, "!": 7, "world": 8}}
+	}`)
+	tok, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if tok.Kind() != "WordPiece" {
+		t.Errorf("Kind = %q", tok.Kind())
+	}
+	// un ##aff ##able | hello | , (unknown) | world | !
+	if n := tok.Count("Unaffable hello, WORLD!"); n != 7 {
+		t.Errorf("Count = %d, want 7", n)
+	}
+	if n := tok.MaxTokens(); n != 6 {
+		t.Errorf("MaxTokens = %d, want 6 (8 minus [CLS] and [SEP])", n)
+	}
+}
+
+func TestByteLevelBPE(t *testing.T) {
+	dir := writeTokenizer(t, `{
+		"pre_tokenizer": {"type": "ByteLevel", "add_prefix_space": false, "use_regex": true},
+		"post_processor": {"type": "ByteLevel"},
+		"model": {"type": "BPE",
+			"vocab": {"Ġ": 0, "l": 1, "o": 2, "w": 3, "e": 4, "r": 5, "lo": 6, "low": 7, "er": 8},
+			"merges": ["l o", ["lo", "w"], "e r"]}
+	}`)
+	os.WriteFile(filepath.Join(dir, "tokenizer_config.json"), []byte(`{"model_max_length": 512}`), 0o644)
+	tok, err := Load(filepath.Join(dir, "tokenizer.json"))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	// "lower" -> low er; " lower" -> Ġ low er
+	if n := tok.Count("lower lower"); n != 5 {
+		t.Errorf("Count = %d, want 5", n)
+	}
+	if n := tok.MaxTokens(); n != 512 {
+		t.Errorf("MaxTokens = %d, want 512 from tokenizer_config.json", n)
+	}
+}
+
+func TestUnigramMetaspace(t *testing.T) {
+	dir := writeTokenizer(t, `{
+		"normalizer": {"type": "Precompiled", "precompiled_charsmap": null},
+		"pre_tokenizer": {"type": "Metaspace", "replacement": "▁", "prepend_scheme": "always"},
+		"model": {"type": "Unigram", "unk_id": 0, "vocab": [
+			["<unk>", 0], ["▁hello", -1], ["▁he", -2], ["llo", -2], ["▁", -3],
+			["w", -4], ["o", -4], ["▁world", -1.5]]}
+	}`)
+	tok, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if n := tok.Count("hello world"); n != 2 {
+		t.Errorf("Count = %d, want 2", n)
+	}
+	// ▁hello | ▁ w xyz, where the unknown x, y and z fuse into one token
+	if n := tok.Count("hello wxyz"); n != 4 {
+		t.Errorf("Count = %d, want 4", n)
+	}
+	if tok.MaxTokens() != 0 {
+		t.Errorf("MaxTokens = %d, want 0 when unknown", tok.MaxTokens())
+	}
+}
+
+func TestLoadRejectsUnknownModel(t *testing.T) {
+	dir := writeTokenizer(t, `{"model": {"type": "WordLevel", "vocab": {}}}`)
+	if _, err := Load(dir); err == nil {
+		t.Error("expected an error for an unsupported model")
+	}
+}
+
+func TestSplitRegexBehaviors(t *testing.T) {
+	re := regexp2.MustCompile(`-`, regexp2.None)
+	cases := map[string][]string{
+		"Isolated":           {"a", "-", "b", "-", "c"},
+		"Removed":            {"a", "b", "c"},
+		"MergedWithPrevious": {"a-", "b-", "c"},
+		"MergedWithNext":     {"a", "-b", "-c"},
+	}
+	for behavior, want := range cases {
+		if got := splitRegex(re, "a-b-c", behavior, false); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %q, want %q", behavior, got, want)
+		}
+	}
+}
@@ -51,6 +51,14 @@ func main() {
 		slog.Error("Failed to initialize vector store", "error", err)
 		os.Exit(1)
 	}
+	vs.SetIndexParams(storage.IndexParams{
+		M:              cfg.VectorIndex.M,
+		EfConstruction: cfg.VectorIndex.EfConstruction,
+		EfSearch:       cfg.VectorIndex.EfSearch,
+		ExactBelow:     cfg.VectorIndex.ExactBelow,
+		Quantization:   cfg.VectorIndex.Quantization,
+		Rescore:        cfg.VectorIndex.Rescore,
+	})
 	if err := vs.LoadAll(); err != nil {
 		slog.Error("Failed to load vectors", "error", err)
 		os.Exit(1)
@@ -59,6 +67,16 @@ func main() {
 
 	// Initialize LM Studio client
 	lm := lmstudio.NewClient(cfg.LMStudio.BaseURL, cfg.LMStudio.Timeout)
+	lm.SetTranscriptionURL(cfg.LMStudio.TranscriptionURL)
+	lm.SetRerankEndpoint(cfg.LMStudio.RerankURL, cfg.LMStudio.RerankModel)
+	lm.SetQueryCacheSize(cfg.LMStudio.QueryCacheSize)
+	if len(cfg.LMStudio.EmbeddingTemplates) > 0 {
+		templates := make(map[string]lmstudio.EmbeddingTemplate, len(cfg.LMStudio.EmbeddingTemplates))
+		for match, t := range cfg.LMStudio.EmbeddingTemplates {
+			templates[match] = lmstudio.EmbeddingTemplate{Document: t.Document, Query: t.Query}
+		}
+		lm.SetEmbeddingTemplates(templates)
+	}
 	if lm.HealthCheck() {
 		models := lm.ListModels()
 		var ids []string
@@ -125,6 +143,9 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	srv.Shutdown(ctx)
+	if err := vs.SaveIndex(); err != nil {
+		slog.Warn("Failed to save vector index", "error", err)
+	}
 
 	slog.Info("Daemon stopped")
 }